@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"comicsd/internal/archive"
+	"comicsd/internal/downloader"
+)
+
+// The simulated site of BenchmarkDownloadPipeline, e.g.
+// go test ./cmd/comicsd -bench Pipeline -args -bench.page-latency 20ms
+var (
+	benchChapters     = flag.Int("bench.chapters", 4, "chapters per simulated download")
+	benchPages        = flag.Int("bench.pages", 25, "pages per simulated chapter")
+	benchPageSize     = flag.Int("bench.page-size", 256<<10, "bytes per simulated page")
+	benchPageLatency  = flag.Duration("bench.page-latency", 2*time.Millisecond, "simulated latency of a page download")
+	benchEnumLatency  = flag.Duration("bench.enum-latency", 10*time.Millisecond, "simulated latency of enumerating a chapter")
+	benchWorkerCounts = []int{1, 2, 4, 8}
+)
+
+// benchChapter is a chapter of the simulated site, serving pages of a fixed
+// size after a delay
+type benchChapter struct {
+	pages []string
+	data  []byte
+}
+
+func (c *benchChapter) PageIDs() []string { return c.pages }
+
+func (c *benchChapter) DownloadPageTo(page string, w io.Writer) error {
+	time.Sleep(*benchPageLatency)
+	_, err := w.Write(c.data)
+	return err
+}
+
+func (c *benchChapter) Close() {}
+
+// benchOpener enumerates the chapters like downloader.OpenChapters: up to
+// workers chapters ahead of the one being downloaded, each taking the
+// enumeration latency
+func benchOpener(chapters, workers int, data []byte) downloader.ChapterOpener {
+	pages := make([]string, *benchPages)
+	for i := range pages {
+		pages[i] = fmt.Sprint(i + 1)
+	}
+	ready := make([]chan struct{}, chapters)
+	for i := range ready {
+		ready[i] = make(chan struct{})
+	}
+	sem := make(chan struct{}, workers)
+	go func() {
+		for i := range ready {
+			sem <- struct{}{}
+			go func(i int) {
+				time.Sleep(*benchEnumLatency)
+				close(ready[i])
+			}(i)
+		}
+	}()
+	return func(i int) (downloader.PageSource, error) {
+		<-ready[i]
+		<-sem
+		return &benchChapter{pages: pages, data: data}, nil
+	}
+}
+
+// peakHeap samples the heap in use until stop is called, which returns the
+// highest sample
+func peakHeap() (stop func() uint64) {
+	var peak atomic.Uint64
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(time.Millisecond)
+		defer ticker.Stop()
+		var m runtime.MemStats
+		for {
+			runtime.ReadMemStats(&m)
+			if m.HeapInuse > peak.Load() {
+				peak.Store(m.HeapInuse)
+			}
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return func() uint64 {
+		close(done)
+		<-finished
+		return peak.Load()
+	}
+}
+
+// BenchmarkDownloadPipeline measures the page throughput and peak heap of
+// the download pipeline against a simulated site, without a browser
+func BenchmarkDownloadPipeline(b *testing.B) {
+	data := make([]byte, *benchPageSize)
+	chapterIDs := make([]string, *benchChapters)
+	for i := range chapterIDs {
+		chapterIDs[i] = fmt.Sprint(i + 1)
+	}
+
+	for _, format := range []string{"cbz", "epub"} {
+		for _, workers := range benchWorkerCounts {
+			b.Run(fmt.Sprintf("%s/workers=%d", format, workers), func(b *testing.B) {
+				orig := openChapters
+				defer func() { openChapters = orig }()
+				openChapters = func(ctx context.Context, comicID string, ids []string, n int) (downloader.ChapterOpener, error) {
+					return benchOpener(len(ids), n, data), nil
+				}
+				job := downloadJob{comicID: "1", title: "bench", chapterIDs: chapterIDs, format: format, workers: workers}
+
+				b.SetBytes(int64(*benchChapters * *benchPages * *benchPageSize))
+				runtime.GC()
+				stop := peakHeap()
+				pages := 0
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					w, err := archive.NewWriter(format, io.Discard, job.title)
+					if err != nil {
+						b.Fatal(err)
+					}
+					n, err := addPages(context.Background(), job, w)
+					if err == nil {
+						err = w.Close()
+					}
+					if err != nil {
+						b.Fatal(err)
+					}
+					pages += n
+				}
+				b.StopTimer()
+				peak := stop()
+
+				b.ReportMetric(float64(pages)/b.Elapsed().Seconds(), "pages/s")
+				b.ReportMetric(float64(peak)/(1<<20), "peak-MiB")
+			})
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestChecksumSidecar(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "東大特訓班.cbz")
+	if err := os.WriteFile(path, []byte("abc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sum, err := fileChecksum(path)
+	if err != nil {
+		t.Fatalf("fileChecksum failed: %v", err)
+	}
+	const abc = "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+	if sum != abc {
+		t.Fatalf("unexpected checksum %s", sum)
+	}
+
+	if err := writeChecksumFile(path, sum); err != nil {
+		t.Fatalf("writeChecksumFile failed: %v", err)
+	}
+	data, err := os.ReadFile(path + ".sha256")
+	if err != nil {
+		t.Fatalf("sidecar not written: %v", err)
+	}
+	if string(data) != abc+"  東大特訓班.cbz\n" {
+		t.Errorf("unexpected sidecar: %q", data)
+	}
+}
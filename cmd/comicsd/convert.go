@@ -0,0 +1,204 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"comicsd/internal/archive"
+	"comicsd/internal/downloader"
+	"comicsd/internal/epub"
+	"comicsd/internal/info"
+	"comicsd/internal/naming"
+	"comicsd/internal/site"
+)
+
+// book is the content of an archive read back by convert
+type book struct {
+	// title is the archive's title, its file name when it has no metadata
+	title string
+	// info is the comic of the archive's metadata, nil without metadata
+	info  *info.ComicInfo
+	cover []byte
+	pages []bookPage
+}
+
+// bookPage is a page image and its file extension
+type bookPage struct {
+	ext  string
+	data []byte
+}
+
+// readBook reads the pages in reading order, the cover and the metadata of
+// a CBZ, CBT or EPUB written by comicsd: ComicInfo.xml for the first two and
+// the package document for EPUB
+func readBook(format, file string) (*book, error) {
+	b := &book{title: strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))}
+	// EPUB images, cover included, are in OEBPS/images; the others are at
+	// the top of the archive
+	imageDir, metadataName := "", "ComicInfo.xml"
+	if format == "epub" {
+		imageDir, metadataName = "OEBPS/images/", "OEBPS/content.opf"
+	}
+	pages := make(map[int]bookPage)
+	var metadata []byte
+	err := walkArchive(format, file, func(name string, r io.Reader) error {
+		rel, ok := strings.CutPrefix(name, imageDir)
+		if name != metadataName && (!ok || strings.Contains(rel, "/")) {
+			return nil
+		}
+		ext := path.Ext(rel)
+		stem := strings.TrimSuffix(rel, ext)
+		index, err := strconv.Atoi(stem)
+		// Archives written before the cover was renamed call it cover too
+		isCover := stem == "cover" || stem == naming.CoverName
+		if name != metadataName && !isCover && (err != nil || index < 0) {
+			// Not an image, such as pages.json
+			return nil
+		}
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return fmt.Errorf("read %s: %w", name, err)
+		}
+		switch {
+		case name == metadataName:
+			metadata = data
+		case isCover:
+			b.cover = data
+		default:
+			pages[index] = bookPage{ext: ext, data: data}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	indexes := make([]int, 0, len(pages))
+	for index := range pages {
+		indexes = append(indexes, index)
+	}
+	slices.Sort(indexes)
+	for _, index := range indexes {
+		b.pages = append(b.pages, pages[index])
+	}
+	if metadata == nil {
+		return b, nil
+	}
+	if format == "epub" {
+		title, m, err := epub.ParsePackage(metadata)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", metadataName, err)
+		}
+		b.title, b.info = title, epubInfo(title, m)
+		return b, nil
+	}
+	ci, title, err := info.ParseComicRackXML(metadata)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", metadataName, err)
+	}
+	b.info = ci
+	if title != "" {
+		b.title = title
+	}
+	return b, nil
+}
+
+// epubInfo returns the comic described by the metadata of an EPUB titled
+// title, the counterpart of ParseComicRackXML
+func epubInfo(title string, m epub.Metadata) *info.ComicInfo {
+	ci := &info.ComicInfo{
+		ID:          site.Default.ComicID(m.Source),
+		Title:       title,
+		Author:      m.Creator,
+		Description: m.Description,
+		Year:        m.Year,
+	}
+	for _, source := range m.ChapterSources {
+		if comicID, chapterID, err := site.Default.ParseChapterURL(source); err == nil {
+			ci.ID = comicID
+			ci.Chapters = append(ci.Chapters, info.Chapter{ID: chapterID, URL: source})
+		}
+	}
+	return ci
+}
+
+// runConvert rewrites the archive at input in format, carrying over its
+// pages, cover and metadata, and reports the result to w. An empty format
+// converts EPUBs to the default format and the others to EPUB; an empty
+// output is the input's name with the format's extension.
+func runConvert(w io.Writer, input, output, format string, overwrite bool) (err error) {
+	from, ok := dedupeFormats[strings.ToLower(filepath.Ext(input))]
+	if !ok {
+		return fmt.Errorf("cannot convert %s: use a .cbz, .cbt or .epub file", input)
+	}
+	if format == "" {
+		format = "epub"
+		if from == "epub" {
+			format = archive.Default
+		}
+	}
+	if format != "cbz" && format != "cbt" && format != "epub" {
+		return fmt.Errorf("convert writes cbz, cbt or epub, not %s", format)
+	}
+	if output == "" {
+		output = strings.TrimSuffix(input, filepath.Ext(input)) + "." + archive.Extension(format)
+	}
+	if filepath.Clean(output) == filepath.Clean(input) {
+		return fmt.Errorf("cannot convert %s to itself", input)
+	}
+
+	b, err := readBook(from, input)
+	if err != nil {
+		return fmt.Errorf("cannot read %s: %w", input, err)
+	}
+	if len(b.pages) == 0 {
+		return fmt.Errorf("%s has no pages", input)
+	}
+
+	file, err := downloader.CreateOutput(output, overwrite)
+	if errors.Is(err, downloader.ErrOutputExists) {
+		return fmt.Errorf("%w (use -overwrite)", err)
+	}
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// Leave no half-written archive behind
+		if err != nil {
+			os.Remove(output)
+		}
+	}()
+	defer file.Close()
+
+	job := downloadJob{format: format, title: b.title, metadata: b.info != nil, info: b.info}
+	if b.info != nil {
+		for _, chapter := range b.info.Chapters {
+			job.chapterIDs = append(job.chapterIDs, chapter.ID)
+		}
+	}
+	writer, err := newJobWriter(job, b.cover, file)
+	if err != nil {
+		return err
+	}
+	for i, p := range b.pages {
+		if err := writer.AddPage(naming.PageEntryName(i, 0, p.ext), p.data); err != nil {
+			writer.Close()
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Converted %d pages of %s to %s\n", len(b.pages), input, output)
+	return nil
+}
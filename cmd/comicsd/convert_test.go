@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"comicsd/internal/downloader"
+)
+
+func TestRunConvertRoundTrip(t *testing.T) {
+	stubChapters(t, map[string][]string{"566271": {"1", "2"}, "566272": {"1"}})
+	job := testJob("cbz")
+	job.chapterIDs = []string{"566271", "566272"}
+	job.outputDir = t.TempDir()
+	job.info.Description = "受験"
+	job.info.Year = 2003
+	if err := runDownload(context.Background(), job); err != nil {
+		t.Fatalf("runDownload failed: %v", err)
+	}
+	cbz := filepath.Join(job.outputDir, job.fileName())
+
+	var out strings.Builder
+	if err := runConvert(&out, cbz, "", "", false); err != nil {
+		t.Fatalf("convert to EPUB failed: %v", err)
+	}
+	epubPath := strings.TrimSuffix(cbz, ".cbz") + ".epub"
+	if !strings.Contains(out.String(), "Converted 3 pages") {
+		t.Errorf("unexpected output: %s", out.String())
+	}
+	_, contents := readZip(t, epubPath)
+	opf := contents["OEBPS/content.opf"]
+	for _, want := range []string{
+		"<dc:title>東大特訓班</dc:title>",
+		"<dc:creator>三田紀房</dc:creator>",
+		"<dc:date>2003</dc:date>",
+		"<dc:source>https://tw.manhuagui.com/comic/1128/566272.html</dc:source>",
+	} {
+		if !strings.Contains(opf, want) {
+			t.Errorf("content.opf missing %s:\n%s", want, opf)
+		}
+	}
+
+	back := filepath.Join(t.TempDir(), "back.cbz")
+	if err := runConvert(&out, epubPath, back, "", false); err != nil {
+		t.Fatalf("convert back to CBZ failed: %v", err)
+	}
+	names, contents := readZip(t, back)
+	if got := strings.Join(names, ","); got != "0000.jpg,0001.jpg,0002.jpg,ComicInfo.xml" {
+		t.Fatalf("unexpected entries: %s", got)
+	}
+	for name, want := range map[string]string{"0000.jpg": "566271/1", "0001.jpg": "566271/2", "0002.jpg": "566272/1"} {
+		if contents[name] != want {
+			t.Errorf("%s = %q, want %q", name, contents[name], want)
+		}
+	}
+	for _, want := range []string{"<Series>東大特訓班</Series>", "<Writer>三田紀房</Writer>", "<Summary>受験</Summary>", "566271.html"} {
+		if !strings.Contains(contents["ComicInfo.xml"], want) {
+			t.Errorf("ComicInfo.xml missing %s:\n%s", want, contents["ComicInfo.xml"])
+		}
+	}
+}
+
+func TestRunConvertKeepsExistingOutput(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "in.cbz")
+	writeTestZip(t, input, [][2]string{{"0.jpg", "page"}})
+	writeTestZip(t, filepath.Join(dir, "in.epub"), nil)
+
+	err := runConvert(&strings.Builder{}, input, "", "", false)
+	if !errors.Is(err, downloader.ErrOutputExists) {
+		t.Errorf("err = %v, want ErrOutputExists", err)
+	}
+	if err := runConvert(&strings.Builder{}, input, "", "", true); err != nil {
+		t.Errorf("convert with overwrite failed: %v", err)
+	}
+	if err := runConvert(&strings.Builder{}, input, "", "zip", true); err == nil {
+		t.Error("expected an error for an unsupported format")
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"comicsd/internal/downloader"
+	"comicsd/internal/epub"
+	"comicsd/internal/info"
+	"comicsd/internal/naming"
+)
+
+// downloadCover fetches a cover image. Defined as a variable for tests.
+var downloadCover = downloader.DownloadCover
+
+// coverOptions select where the cover command writes the image
+type coverOptions struct {
+	// output is the file to write, "-" for stdout, or empty to name it after
+	// the comic title
+	output    string
+	overwrite bool
+}
+
+// runCover fetches the comic's cover and writes it to stdout or a file,
+// reporting the written file on w
+func runCover(ctx context.Context, w, stdout io.Writer, fetcher info.Fetcher, comicID string, opts coverOptions) error {
+	ci, err := fetcher.GetComicInfo(comicID)
+	if err != nil {
+		return err
+	}
+	if ci.CoverURL == "" {
+		return fmt.Errorf("comic %s has no cover", comicID)
+	}
+	data, err := downloadCover(ctx, ci.CoverURL)
+	if err != nil {
+		return err
+	}
+	if opts.output == "-" {
+		_, err := stdout.Write(data)
+		return err
+	}
+
+	path := opts.output
+	if path == "" {
+		path = coverFileName(ci, data)
+	}
+	file, err := downloader.CreateOutput(path, opts.overwrite)
+	if errors.Is(err, downloader.ErrOutputExists) {
+		return fmt.Errorf("%w (use -overwrite to replace it)", err)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(path)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Saved cover of %s to %s\n", ci.Title, path)
+	return nil
+}
+
+// coverFileName names the cover after the comic title, falling back to the
+// comic ID, with the extension of its image format
+func coverFileName(ci *info.ComicInfo, data []byte) string {
+	name := naming.Sanitize(ci.Title)
+	if name == "" {
+		name = ci.ID
+	}
+	return name + imageExt(data)
+}
+
+// imageExt returns the file extension of the detected image format, ".jpg"
+// when the data is not a known image
+func imageExt(data []byte) string {
+	switch strings.TrimPrefix(http.DetectContentType(data), "image/") {
+	case "png":
+		return ".png"
+	case "webp":
+		return ".webp"
+	case "gif":
+		return ".gif"
+	}
+	return ".jpg"
+}
+
+// coverWriter is implemented by archive writers that can take a cover after
+// their first pages
+type coverWriter interface {
+	SetCover(name string, data []byte) error
+}
+
+// coverAspectWidth and coverAspectHeight are the 2:3 portrait ratio of
+// covers cropped from a page
+const (
+	coverAspectWidth  = 2
+	coverAspectHeight = 3
+)
+
+// setPageCover makes page the cover of w, cropped to a portrait when crop is
+// set. A page that cannot be cropped is used as it is.
+func setPageCover(w coverWriter, page []byte, crop bool) error {
+	if crop {
+		cropped, err := epub.CropImage(page, coverAspectWidth, coverAspectHeight)
+		if err != nil {
+			log.Printf("not cropping cover: %v", err)
+		} else {
+			page = cropped
+		}
+	}
+	return w.SetCover("cover"+imageExt(page), page)
+}
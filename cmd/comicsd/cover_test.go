@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"comicsd/internal/downloader"
+	"comicsd/internal/info"
+	"comicsd/internal/info/infotest"
+)
+
+var pngHeader = []byte("\x89PNG\r\n\x1a\n")
+
+func coverFetcher() *infotest.Fetcher {
+	return &infotest.Fetcher{Comics: map[string]*info.ComicInfo{
+		"1128": {ID: "1128", Title: "東大特訓班", CoverURL: "//cf.hamreus.com/cpic/b/1128.jpg"},
+		"2250": {ID: "2250", Title: "No Cover"},
+	}}
+}
+
+func stubCover(t *testing.T, data []byte) *[]string {
+	t.Helper()
+	orig := downloadCover
+	t.Cleanup(func() { downloadCover = orig })
+	var urls []string
+	downloadCover = func(ctx context.Context, coverURL string) ([]byte, error) {
+		urls = append(urls, coverURL)
+		return data, nil
+	}
+	return &urls
+}
+
+func TestRunCoverWritesFile(t *testing.T) {
+	urls := stubCover(t, pngHeader)
+	path := filepath.Join(t.TempDir(), "cover.png")
+
+	var out bytes.Buffer
+	if err := runCover(context.Background(), &out, nil, coverFetcher(), "1128", coverOptions{output: path}); err != nil {
+		t.Fatalf("runCover failed: %v", err)
+	}
+	if data, err := os.ReadFile(path); err != nil || !bytes.Equal(data, pngHeader) {
+		t.Errorf("unexpected cover file: %q, %v", data, err)
+	}
+	if len(*urls) != 1 || (*urls)[0] != "//cf.hamreus.com/cpic/b/1128.jpg" {
+		t.Errorf("unexpected cover URLs: %v", *urls)
+	}
+	if !strings.Contains(out.String(), path) {
+		t.Errorf("expected the path reported, got %q", out.String())
+	}
+
+	err := runCover(context.Background(), &out, nil, coverFetcher(), "1128", coverOptions{output: path})
+	if !errors.Is(err, downloader.ErrOutputExists) {
+		t.Errorf("expected ErrOutputExists, got %v", err)
+	}
+}
+
+func TestRunCoverToStdout(t *testing.T) {
+	stubCover(t, []byte("jpeg"))
+
+	var out, stdout bytes.Buffer
+	if err := runCover(context.Background(), &out, &stdout, coverFetcher(), "1128", coverOptions{output: "-"}); err != nil {
+		t.Fatalf("runCover failed: %v", err)
+	}
+	if stdout.String() != "jpeg" || out.Len() != 0 {
+		t.Errorf("unexpected output: stdout %q, messages %q", stdout.String(), out.String())
+	}
+}
+
+func TestRunCoverWithoutCover(t *testing.T) {
+	urls := stubCover(t, nil)
+	err := runCover(context.Background(), nil, nil, coverFetcher(), "2250", coverOptions{output: "-"})
+	if err == nil || !strings.Contains(err.Error(), "has no cover") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if len(*urls) != 0 {
+		t.Errorf("expected no download, got %v", *urls)
+	}
+}
+
+func TestCoverFileName(t *testing.T) {
+	tests := []struct {
+		ci   info.ComicInfo
+		data []byte
+		want string
+	}{
+		{info.ComicInfo{ID: "1128", Title: "東大特訓班"}, []byte("\xff\xd8\xff\xe0"), "東大特訓班.jpg"},
+		{info.ComicInfo{ID: "1128", Title: "A/B"}, pngHeader, "A_B.png"},
+		{info.ComicInfo{ID: "1128"}, []byte("RIFF\x00\x00\x00\x00WEBPVP8 "), "1128.webp"},
+	}
+	for _, tt := range tests {
+		if got := coverFileName(&tt.ci, tt.data); got != tt.want {
+			t.Errorf("coverFileName(%q) = %q, want %q", tt.ci.Title, got, tt.want)
+		}
+	}
+}
+
+func TestWriteArchiveUsesFirstPageAsMissingCover(t *testing.T) {
+	stubChapters(t, map[string][]string{"a": {"1", "2"}, "b": {"1"}})
+	path := filepath.Join(t.TempDir(), "out.cbz")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := testJob("cbz")
+	job.cover = true
+	job.pageCover = true
+	job.titlePages = true
+
+	_, err = writeArchive(context.Background(), job, file)
+	file.Close()
+	if err != nil {
+		t.Fatalf("writeArchive failed: %v", err)
+	}
+
+	names, contents := readZip(t, path)
+	expected := "0000.jpg,0001.jpg,!cover.jpg,0002.jpg,0003.jpg,0004.jpg,ComicInfo.xml"
+	if strings.Join(names, ",") != expected {
+		t.Fatalf("unexpected entries: %v", names)
+	}
+	if contents["!cover.jpg"] != "a/1" {
+		t.Errorf("expected the first page as the cover, not the title page, got %q", contents["!cover.jpg"])
+	}
+	if !strings.Contains(contents["ComicInfo.xml"], "<PageCount>6</PageCount>") {
+		t.Errorf("ComicInfo.xml should count the cover: %s", contents["ComicInfo.xml"])
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// dedupeFormats maps the file extensions dedupe-dir scans to their formats
+var dedupeFormats = map[string]string{
+	".cbz":  "cbz",
+	".cbt":  "cbt",
+	".epub": "epub",
+}
+
+// findDuplicates groups the archives in dir holding the same pages. Each group
+// is sorted by file name and the groups by their first file.
+func findDuplicates(dir string) ([][]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	byHash := make(map[string][]string)
+	for _, entry := range entries {
+		format, ok := dedupeFormats[strings.ToLower(filepath.Ext(entry.Name()))]
+		if !ok || !entry.Type().IsRegular() {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		sum, err := archiveContentHash(format, path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+		byHash[sum] = append(byHash[sum], path)
+	}
+
+	var groups [][]string
+	for _, paths := range byHash {
+		if len(paths) > 1 {
+			slices.Sort(paths)
+			groups = append(groups, paths)
+		}
+	}
+	slices.SortFunc(groups, func(a, b []string) int {
+		return strings.Compare(a[0], b[0])
+	})
+	return groups, nil
+}
+
+// archiveContentHash returns the hex encoded SHA-256 of the archive's page
+// images in reading order. Metadata such as the EPUB's modification date is
+// left out, so downloads of the same chapters on different days match. An
+// archive without pages is hashed whole.
+func archiveContentHash(format, path string) (string, error) {
+	h := sha256.New()
+	pages := 0
+	if format == "epub" {
+		zr, err := zip.OpenReader(path)
+		if err != nil {
+			return "", err
+		}
+		defer zr.Close()
+		for _, f := range zr.File {
+			if !strings.HasPrefix(f.Name, "OEBPS/images/") || !epubPagePattern.MatchString(f.Name) {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return "", fmt.Errorf("open %s: %w", f.Name, err)
+			}
+			data, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				return "", fmt.Errorf("read %s: %w", f.Name, err)
+			}
+			hashPage(h, data)
+			pages++
+		}
+	} else {
+		byIndex, err := readArchivePages(format, path)
+		if err != nil {
+			return "", err
+		}
+		indexes := make([]int, 0, len(byIndex))
+		for index := range byIndex {
+			indexes = append(indexes, index)
+		}
+		slices.Sort(indexes)
+		for _, index := range indexes {
+			hashPage(h, byIndex[index])
+		}
+		pages = len(indexes)
+	}
+	if pages == 0 {
+		return fileChecksum(path)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashPage adds a page to h, prefixed with its length so that pages split
+// differently never hash alike
+func hashPage(h hash.Hash, data []byte) {
+	binary.Write(h, binary.BigEndian, uint64(len(data)))
+	h.Write(data)
+}
+
+// runDedupeDir reports the duplicate archives in dir to w. With remove it
+// deletes every file of a group but the first, after confirmation read from r
+// unless yes is set.
+func runDedupeDir(r io.Reader, w io.Writer, dir string, remove, yes bool) error {
+	groups, err := findDuplicates(dir)
+	if err != nil {
+		return err
+	}
+	if len(groups) == 0 {
+		fmt.Fprintf(w, "No duplicates found in %s\n", dir)
+		return nil
+	}
+
+	var duplicates []string
+	for _, group := range groups {
+		fmt.Fprintf(w, "%s\n", filepath.Base(group[0]))
+		for _, path := range group[1:] {
+			fmt.Fprintf(w, "  duplicate %s\n", filepath.Base(path))
+		}
+		duplicates = append(duplicates, group[1:]...)
+	}
+	fmt.Fprintf(w, "%d duplicate files of %d archives\n", len(duplicates), len(groups))
+	if !remove {
+		return nil
+	}
+
+	if !yes {
+		fmt.Fprintf(w, "Remove %d duplicate files? [y/N] ", len(duplicates))
+		in := bufio.NewScanner(r)
+		answer := ""
+		if in.Scan() {
+			answer = strings.ToLower(strings.TrimSpace(in.Text()))
+		}
+		if answer != "y" && answer != "yes" {
+			fmt.Fprintln(w, "Nothing removed")
+			return nil
+		}
+	}
+	for _, path := range duplicates {
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(w, "Removed %d files\n", len(duplicates))
+	return nil
+}
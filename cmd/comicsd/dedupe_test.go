@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFindDuplicates(t *testing.T) {
+	dir := t.TempDir()
+	pages := [][2]string{{"0.jpg", "page 1"}, {"1.jpg", "page 2"}}
+	writeTestZip(t, filepath.Join(dir, "a.cbz"), pages)
+	// Same pages with different metadata
+	writeTestZip(t, filepath.Join(dir, "b.cbz"), append(pages, [2]string{"ComicInfo.xml", "<ComicInfo/>"}))
+	writeTestZip(t, filepath.Join(dir, "c.cbz"), [][2]string{{"0.jpg", "page 1"}})
+	writeTestZip(t, filepath.Join(dir, "d.epub"), [][2]string{
+		{"OEBPS/images/0.jpg", "page 1"},
+		{"OEBPS/images/1.jpg", "page 2"},
+		{"OEBPS/content.opf", "modified today"},
+	})
+	writeTestZip(t, filepath.Join(dir, "e.epub"), [][2]string{
+		{"OEBPS/images/0.jpg", "page 1"},
+		{"OEBPS/images/1.jpg", "page 2"},
+		{"OEBPS/content.opf", "modified yesterday"},
+	})
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("page 1"), 0644)
+
+	groups, err := findDuplicates(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got [][]string
+	for _, group := range groups {
+		var names []string
+		for _, path := range group {
+			names = append(names, filepath.Base(path))
+		}
+		got = append(got, names)
+	}
+	want := [][]string{{"a.cbz", "b.cbz", "d.epub", "e.epub"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("groups = %v, want %v", got, want)
+	}
+}
+
+func TestRunDedupeDirRemove(t *testing.T) {
+	dir := t.TempDir()
+	pages := [][2]string{{"0.jpg", "page 1"}}
+	writeTestZip(t, filepath.Join(dir, "a.cbz"), pages)
+	writeTestZip(t, filepath.Join(dir, "b.cbz"), pages)
+
+	var out strings.Builder
+	if err := runDedupeDir(strings.NewReader("n\n"), &out, dir, true, false); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "  duplicate b.cbz\n") || !strings.Contains(out.String(), "Nothing removed") {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "b.cbz")); err != nil {
+		t.Fatalf("declined removal deleted the duplicate: %v", err)
+	}
+
+	out.Reset()
+	if err := runDedupeDir(strings.NewReader("y\n"), &out, dir, true, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "b.cbz")); !os.IsNotExist(err) {
+		t.Errorf("duplicate not removed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a.cbz")); err != nil {
+		t.Errorf("first file removed: %v", err)
+	}
+	if !strings.Contains(out.String(), "Removed 1 files") {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+}
@@ -0,0 +1,1155 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"comicsd/internal/archive"
+	"comicsd/internal/cbt"
+	"comicsd/internal/config"
+	"comicsd/internal/downloader"
+	"comicsd/internal/epub"
+	"comicsd/internal/info"
+	"comicsd/internal/naming"
+	"comicsd/internal/ocr"
+)
+
+// downloadJob describes one archive to download
+type downloadJob struct {
+	comicID     string
+	title       string
+	chapterIDs  []string
+	format      string
+	outputDir   string
+	workers     int
+	cover       bool
+	imageFormat epub.ImageFormat
+	// imageQuality is the quality of lossy transcoding, zero for the default
+	imageQuality int
+	// transform makes pages gray or narrower for the reader's screen
+	transform epub.Transform
+	// overwrite allows replacing an existing output file
+	overwrite bool
+	// metadata embeds the comic info in the archive
+	metadata bool
+	// manifest adds pages.json describing every CBZ or CBT page
+	manifest bool
+	// opf writes a Calibre OPF sidecar and the cover next to the archive
+	opf bool
+	// checksum prints the SHA-256 of the archive; checksumFile also writes it
+	// to a .sha256 file next to the archive
+	checksum     bool
+	checksumFile bool
+	// flattenTitles makes the file name ASCII-only
+	flattenTitles bool
+	// pageCSS replaces the default EPUB page style when set
+	pageCSS string
+	// ocr embeds the text of EPUB pages recognized in ocrLang
+	ocr     bool
+	ocrLang string
+	// imageOnly puts EPUB images in the spine without an XHTML page each
+	imageOnly bool
+	// frontMatter adds EPUB title and colophon pages
+	frontMatter epub.FrontMatter
+	// epubVersion is the EPUB version to write, zero to pick it from the
+	// images; fixedLayout writes a fixed-layout EPUB 3
+	epubVersion int
+	fixedLayout bool
+	// rightToLeft turns EPUB pages from right to left
+	rightToLeft bool
+	// output is the file to write instead of the named file in outputDir,
+	// "-" for stdout
+	output string
+	// pageRanges, when set, limits the pages of the chapter at the same index
+	pageRanges []pageRange
+	// retryFailed rewrites an existing CBZ or CBT, downloading only the pages
+	// missing from it. existing holds the pages it already has by index.
+	retryFailed bool
+	existing    map[int][]byte
+	// resume keeps the pages of an EPUB in parts as they are written, so
+	// that an interrupted download is picked up where it stopped
+	resume bool
+	parts  *pageParts
+	// titlePages inserts a page naming the chapter before each chapter
+	titlePages bool
+	// pageCover makes the first page the cover when the comic has none;
+	// cropCover crops it to a portrait cover
+	pageCover bool
+	cropCover bool
+	// maxInflight bounds the pages downloaded but not yet written, zero for
+	// a multiple of workers
+	maxInflight int
+	// chapterWorkers is the number of chapters downloaded at once, each in a
+	// tab of its own
+	chapterWorkers int
+	// continueOnError skips the chapters that fail instead of stopping
+	continueOnError bool
+	// quiet logs every page instead of drawing a progress bar
+	quiet bool
+	// progress follows the written pages, nil to ignore them
+	progress progress
+	// info is the already fetched comic info, if any
+	info *info.ComicInfo
+}
+
+// chapterPages returns the pages of the i-th chapter selected by its page range
+func (job downloadJob) chapterPages(i int, cc downloader.PageSource) ([]string, error) {
+	if job.pageRanges == nil {
+		return cc.PageIDs(), nil
+	}
+	pages, err := job.pageRanges[i].apply(cc.PageIDs())
+	if err != nil {
+		return nil, downloader.ChapterError(job.comicID, job.chapterIDs[i], err)
+	}
+	return pages, nil
+}
+
+// chapterURLs returns the readers of the job's chapters
+func (job downloadJob) chapterURLs() []string {
+	urls := make([]string, len(job.chapterIDs))
+	for i, id := range job.chapterIDs {
+		urls[i] = job.info.ChapterURL(id)
+	}
+	return urls
+}
+
+// knownPageCount returns the number of pages of the job's chapters from the
+// page counts in its info, title pages included, or 0 when a count is not
+// known. Page ranges are ignored, so it is an upper bound.
+func (job downloadJob) knownPageCount() int {
+	if job.info == nil {
+		return 0
+	}
+	counts := make(map[string]int, len(job.info.Chapters))
+	for _, chapter := range job.info.Chapters {
+		counts[chapter.ID] = chapter.PageCount
+	}
+	total := 0
+	for _, id := range job.chapterIDs {
+		if counts[id] <= 0 {
+			return 0
+		}
+		total += counts[id]
+		if job.titlePages {
+			total++
+		}
+	}
+	return total
+}
+
+// dedupeChapters drops repeated chapter IDs, and their page ranges, so a
+// chapter passed twice is downloaded once
+func (job *downloadJob) dedupeChapters() {
+	unique, duplicates := downloader.DedupeIDs(job.chapterIDs)
+	if len(duplicates) == 0 {
+		return
+	}
+	log.Printf("Skipping duplicate chapters: %s", strings.Join(duplicates, ", "))
+	if job.pageRanges != nil {
+		seen := make(map[string]bool, len(unique))
+		ranges := make([]pageRange, 0, len(unique))
+		for i, id := range job.chapterIDs {
+			if !seen[id] {
+				seen[id] = true
+				ranges = append(ranges, job.pageRanges[i])
+			}
+		}
+		job.pageRanges = ranges
+	}
+	job.chapterIDs = unique
+}
+
+// reporter returns the job's progress, ignoring it when unset
+func (job downloadJob) reporter() progress {
+	if job.progress == nil {
+		return noProgress{}
+	}
+	return job.progress
+}
+
+// fileName returns the name of the job's output file. The title is only
+// flattened here; the archive metadata keeps the original.
+func (job downloadJob) fileName() string {
+	name := job.title
+	if job.flattenTitles {
+		name = naming.Flatten(job.title, job.comicID)
+	}
+	return naming.OutputFilename(name, archive.Extension(job.format), "")
+}
+
+// outputPath returns the file the job writes, unless it writes to stdout
+func (job downloadJob) outputPath() string {
+	if job.output != "" {
+		return job.output
+	}
+	return filepath.Join(job.outputDir, job.fileName())
+}
+
+// messages returns where the job reports its progress: stderr when the
+// archive goes to stdout, so it can be piped
+func (job downloadJob) messages() io.Writer {
+	if job.output == "-" {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// downloadFlags are the flags shared by the download commands
+type downloadFlags struct {
+	format        *string
+	outputDir     *string
+	output        *string
+	workers       *int
+	cover         *bool
+	pageCover     *bool
+	cropCover     *bool
+	imageFormat   *string
+	imageQuality  *int
+	overwrite     *bool
+	metadata      *bool
+	manifest      *bool
+	opf           *bool
+	checksum      *bool
+	checksumFile  *bool
+	flattenTitles *bool
+	pageCSS       *string
+	ocr           *bool
+	ocrLang       *string
+	imageOnly     *bool
+	quiet         *bool
+	retryFailed   *bool
+	resume        *bool
+	titlePages    *bool
+	settings      *settingsFlags
+	// chapterWorkers is apart from workers, which only prepare chapters
+	chapterWorkers  *int
+	continueOnError *bool
+	// frontMatter lists the EPUB's opening pages, frontMatterFirst places
+	// them before the cover
+	frontMatter      *string
+	frontMatterFirst *bool
+	// The page transform and EPUB layout suited to a reader
+	grayscale   *bool
+	maxWidth    *int
+	direction   *string
+	epubVersion *int
+	fixedLayout *bool
+	// reader is a preset of the flags above
+	reader *string
+}
+
+func addDownloadFlags(fs *flag.FlagSet) *downloadFlags {
+	return &downloadFlags{
+		format:        fs.String("format", "cbz", "output format (cbz, cbt, epub, cbz-series or auto, default from config)"),
+		outputDir:     fs.String("output-dir", "", "directory to write the file to (default from config, else current directory)"),
+		output:        fs.String("o", "", "file to write, - for stdout (default <title>.<ext> in the output directory)"),
+		workers:       fs.Int("workers", config.DefaultWorkers, "number of concurrent browser tabs (default from config)"),
+		cover:         fs.Bool("cover", true, "embed the comic cover image"),
+		pageCover:     fs.Bool("page-cover", true, "use the first page as the cover when the comic has none"),
+		cropCover:     fs.Bool("crop-cover", false, "crop a cover made from the first page to a 2:3 portrait"),
+		imageFormat:   fs.String("image-format", "", "transcode page images to jpeg, png or webp (default keeps the original)"),
+		imageQuality:  fs.Int("image-quality", 0, "quality (1-100) of jpeg and webp transcoding (default 90 for jpeg, 80 for webp)"),
+		overwrite:     fs.Bool("overwrite", false, "replace the output file if it already exists"),
+		metadata:      fs.Bool("metadata", true, "embed the comic's metadata (ComicInfo.xml in CBZ and CBT, author and description in EPUB)"),
+		manifest:      fs.Bool("manifest", false, "add a pages.json listing the chapter, page, format and size of every CBZ or CBT page"),
+		opf:           fs.Bool("opf", false, "write a Calibre OPF metadata file and the cover next to the written file"),
+		checksum:      fs.Bool("checksum", false, "print the SHA-256 of the written file"),
+		checksumFile:  fs.Bool("checksum-file", false, "also write the SHA-256 to a .sha256 file next to the written file"),
+		flattenTitles: fs.Bool("flatten-titles", false, "use an ASCII-only file name, keeping the original title in the metadata"),
+		pageCSS:       fs.String("page-css", "", "file with CSS replacing the default style of EPUB pages"),
+		ocr:           fs.Bool("ocr", false, "embed the text of EPUB pages recognized by tesseract, making the book searchable"),
+		ocrLang:       fs.String("ocr-lang", "", "tesseract language of -ocr (default from config, else chi_tra)"),
+		imageOnly:     fs.Bool("no-xhtml-wrapper", false, "reference EPUB images directly instead of wrapping each in a page; smaller, but only some readers open it"),
+		quiet:         fs.Bool("quiet", false, "log every page instead of drawing a progress bar in a terminal"),
+		retryFailed:   fs.Bool("retry-failed", false, "complete an existing CBZ or CBT, downloading only its missing or empty pages"),
+		resume:        fs.Bool("resume", false, "keep the pages of an EPUB next to it until it is complete, so an interrupted download resumes where it stopped"),
+		titlePages:    fs.Bool("title-pages", false, "insert a page with the chapter's number and name before each chapter"),
+		settings:      addSettingsFlags(fs),
+		// Each chapter downloads in its own tab, so the tabs add up to
+		// chapter workers plus workers
+		chapterWorkers:  fs.Int("chapter-workers", 1, "number of chapters downloaded at once, each in its own tab (default from config)"),
+		continueOnError: fs.Bool("continue-on-error", false, "skip chapters that fail and list them at the end instead of stopping"),
+		// Text pages written from the metadata, unlike -title-pages
+		frontMatter:      fs.String("front-matter", "", "comma-separated EPUB pages opening the book: title (title, author and source) and colophon"),
+		frontMatterFirst: fs.Bool("front-matter-before-cover", false, "place the -front-matter pages before the cover instead of after it"),
+		grayscale:        fs.Bool("grayscale", false, "store page images in shades of gray, for e-ink screens"),
+		maxWidth:         fs.Int("max-width", 0, "scale page images wider than this many pixels down to it (default keeps their size)"),
+		direction:        fs.String("direction", "", "reading direction of EPUBs: rtl turns the pages from right to left like manga, ltr from left to right (default leaves it to the reader)"),
+		epubVersion:      fs.Int("epub-version", 0, "EPUB version to write, 2 or 3 (default 3 for WebP images, else 2)"),
+		fixedLayout:      fs.Bool("fixed-layout", false, "write a fixed-layout EPUB 3, whose pages keep the size of their image"),
+		// Flags given on the command line override the preset
+		reader: fs.String("reader", "", "preset the flags for an e-reader or app: "+strings.Join(readerNames(), ", ")),
+	}
+}
+
+// resolve loads the settings and builds a job from the parsed flags, taking
+// the -reader preset, then the config defaults, for flags not given on the
+// command line
+func (f *downloadFlags) resolve(fs *flag.FlagSet) (*config.Settings, downloadJob) {
+	settings := f.settings.load()
+	if err := applyReaderPreset(fs, *f.reader); err != nil {
+		fatal(err)
+	}
+	imageFormat, err := epub.ParseImageFormat(*f.imageFormat)
+	if err != nil {
+		fatal(err)
+	}
+	frontMatter, err := epub.ParseFrontMatter(*f.frontMatter)
+	if err != nil {
+		fatal(err)
+	}
+	frontMatter.BeforeCover = *f.frontMatterFirst
+	if *f.imageQuality < 0 || *f.imageQuality > 100 {
+		fatalf("invalid image quality: %d. Use a value from 1 to 100", *f.imageQuality)
+	}
+	if *f.maxWidth < 0 {
+		fatalf("invalid max width: %d. Use a positive number of pixels", *f.maxWidth)
+	}
+	rightToLeft, err := parseDirection(*f.direction)
+	if err != nil {
+		fatal(err)
+	}
+	if err := checkEPUBVersion(*f.epubVersion, *f.fixedLayout, imageFormat); err != nil {
+		fatal(err)
+	}
+
+	var pageCSS string
+	if *f.pageCSS != "" {
+		data, err := os.ReadFile(*f.pageCSS)
+		if err != nil {
+			fatalf("failed to read page CSS: %v", err)
+		}
+		pageCSS = string(data)
+	}
+
+	job := downloadJob{
+		format:        *f.format,
+		outputDir:     config.ExpandPath(*f.outputDir),
+		output:        config.ExpandPath(*f.output),
+		workers:       *f.workers,
+		cover:         *f.cover,
+		pageCover:     *f.pageCover,
+		cropCover:     *f.cropCover,
+		imageFormat:   imageFormat,
+		imageQuality:  *f.imageQuality,
+		transform:     epub.Transform{Grayscale: *f.grayscale, MaxWidth: *f.maxWidth},
+		overwrite:     *f.overwrite,
+		metadata:      *f.metadata,
+		manifest:      *f.manifest,
+		opf:           *f.opf,
+		checksum:      *f.checksum,
+		checksumFile:  *f.checksumFile,
+		flattenTitles: *f.flattenTitles,
+		pageCSS:       pageCSS,
+		ocr:           *f.ocr,
+		ocrLang:       *f.ocrLang,
+		imageOnly:     *f.imageOnly,
+		frontMatter:   frontMatter,
+		epubVersion:   *f.epubVersion,
+		fixedLayout:   *f.fixedLayout,
+		rightToLeft:   rightToLeft,
+		quiet:         *f.quiet,
+		retryFailed:   *f.retryFailed,
+		resume:        *f.resume,
+		titlePages:    *f.titlePages,
+	}
+	if !flagSet(fs, "format") {
+		job.format = settings.Format
+	}
+	if !flagSet(fs, "output-dir") {
+		job.outputDir = settings.OutputDir
+	}
+	if !flagSet(fs, "workers") {
+		job.workers = settings.Workers
+	}
+	job.chapterWorkers = *f.chapterWorkers
+	if !flagSet(fs, "chapter-workers") {
+		job.chapterWorkers = settings.ChapterWorkers
+	}
+	if job.chapterWorkers < 1 {
+		fatalf("invalid chapter workers: %d. Use at least 1", job.chapterWorkers)
+	}
+	job.continueOnError = *f.continueOnError
+	if job.continueOnError && job.retryFailed {
+		// Skipped chapters would shift the pages -retry-failed matches by position
+		fatalf("-continue-on-error cannot be combined with -retry-failed")
+	}
+	if job.continueOnError && job.resume {
+		fatalf("-continue-on-error cannot be combined with -resume")
+	}
+	if job.retryFailed && job.resume {
+		fatalf("-retry-failed cannot be combined with -resume, which is for EPUB")
+	}
+	if job.output == "-" && (job.retryFailed || job.resume || job.opf || job.checksumFile) {
+		fatalf("-o - cannot be combined with -retry-failed, -resume, -opf or -checksum-file, which need a file")
+	}
+	if !flagSet(fs, "ocr-lang") {
+		job.ocrLang = settings.OCRLang
+	}
+	job.maxInflight = settings.MaxInflight
+	return settings, job
+}
+
+// splitTitle separates the optional title from the chapter IDs following the
+// comic ID. Chapter IDs are numeric, so a non-numeric first argument is the
+// title: "1128 566271" is one chapter without a title, "1128 東大特訓班 566271"
+// one with a title, and with -all, "1128 東大特訓班" only a title.
+func splitTitle(args []string) (string, []string) {
+	if len(args) == 0 || isChapterArg(args[0]) {
+		return "", args
+	}
+	return args[0], args[1:]
+}
+
+// defaultTitle names a download that was given no title after the comic. A
+// single chapter is named after the chapter too, using its ID when it is not
+// listed in ci.
+func defaultTitle(ci *info.ComicInfo, chapterIDs []string) string {
+	if len(chapterIDs) != 1 {
+		return naming.Sanitize(ci.Title)
+	}
+	chapterTitle := chapterIDs[0]
+	for _, chapter := range ci.Chapters {
+		if chapter.ID == chapterIDs[0] && chapter.Title != "" {
+			chapterTitle = chapter.Title
+			break
+		}
+	}
+	return naming.Sanitize(ci.Title + " " + chapterTitle)
+}
+
+func isNumeric(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// parseDirection reports whether -direction turns the pages from right to
+// left
+func parseDirection(direction string) (bool, error) {
+	switch strings.ToLower(direction) {
+	case "", "ltr":
+		return false, nil
+	case "rtl":
+		return true, nil
+	}
+	return false, fmt.Errorf("invalid direction: %s. Use 'rtl' or 'ltr'", direction)
+}
+
+// checkEPUBVersion validates -epub-version against the flags needing EPUB 3
+func checkEPUBVersion(version int, fixedLayout bool, imageFormat epub.ImageFormat) error {
+	switch {
+	case version != 0 && version != 2 && version != 3:
+		return fmt.Errorf("invalid EPUB version: %d. Use 2 or 3", version)
+	case version == 2 && fixedLayout:
+		return fmt.Errorf("-fixed-layout writes EPUB 3, not -epub-version 2")
+	case version == 2 && imageFormat == epub.ImageWebP:
+		return fmt.Errorf("-image-format webp needs EPUB 3, not -epub-version 2")
+	}
+	return nil
+}
+
+// checkFormat validates an output format name
+func checkFormat(format string) error {
+	return archive.Check(format)
+}
+
+// readPlan loads a download plan from path, or from stdin when path is "-"
+func readPlan(path string) (*info.DownloadPlan, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var plan info.DownloadPlan
+	if err := json.NewDecoder(r).Decode(&plan); err != nil {
+		return nil, fmt.Errorf("failed to read download plan: %w", err)
+	}
+	if err := plan.Validate(); err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
+// readInfoFile reads comic info saved by info -format json
+func readInfoFile(path string) (*info.ComicInfo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var ci info.ComicInfo
+	if err := dec.Decode(&ci); err != nil {
+		return nil, fmt.Errorf("failed to read comic info %s: %w", path, err)
+	}
+	if err := ci.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid comic info %s: %w", path, err)
+	}
+	return &ci, nil
+}
+
+// checkChapters fails when a chapter ID is not listed in the comic info
+func checkChapters(ci *info.ComicInfo, chapterIDs []string) error {
+	listed := make(map[string]bool, len(ci.Chapters))
+	for _, chapter := range ci.Chapters {
+		listed[chapter.ID] = true
+	}
+	for _, id := range chapterIDs {
+		if !listed[id] {
+			return fmt.Errorf("chapter %s not found in comic %s", id, ci.ID)
+		}
+	}
+	return nil
+}
+
+// openChapters prepares the chapters of a download. Defined as a variable for tests.
+var openChapters = downloader.OpenChapters
+
+// openChapterTabs prepares the chapters of a download fetching several at
+// once. Defined as a variable for tests.
+var openChapterTabs = downloader.OpenChaptersInTabs
+
+// downloadReport summarizes a finished download
+type downloadReport struct {
+	stats downloader.Stats
+	// fetched is the number of pages downloaded, less than the pages in
+	// the archive with -retry-failed
+	fetched int
+	// info is the comic's metadata, nil when it could not be fetched
+	info *info.ComicInfo
+	// cover is the fetched cover image, nil when there is none
+	cover []byte
+	// skipped are the chapters given up on with -continue-on-error
+	skipped skippedChapters
+}
+
+// skippedChapters are the errors of the chapters a download skipped, which
+// it fails with once the rest is written
+type skippedChapters []error
+
+func (s skippedChapters) Error() string {
+	return fmt.Sprintf("%d chapters failed", len(s))
+}
+
+// partial returns the number of chapters of s whose first pages were kept
+func (s skippedChapters) partial() int {
+	n := 0
+	for _, err := range s {
+		var partial *partialChapter
+		if errors.As(err, &partial) {
+			n++
+		}
+	}
+	return n
+}
+
+// partialChapter is the error of a chapter that failed after some of its
+// pages were written, which stay in the archive
+type partialChapter struct {
+	err   error
+	kept  int
+	pages int
+}
+
+func (p *partialChapter) Error() string {
+	return fmt.Sprintf("%v (kept %d of %d pages)", p.err, p.kept, p.pages)
+}
+
+func (p *partialChapter) Unwrap() error { return p.err }
+
+// archiveStdout receives the archive of -o -. Defined as a variable for tests.
+var archiveStdout io.Writer = os.Stdout
+
+// runDownload downloads the job's chapters into a single archive in the output
+// directory, the job's output file or stdout
+func runDownload(ctx context.Context, job downloadJob) error {
+	if job.output == "-" {
+		return runDownloadToStdout(ctx, job)
+	}
+	job.dedupeChapters()
+	job.format = archive.Resolve(job.format, len(job.chapterIDs))
+	start := time.Now()
+	retries := downloader.Retries()
+	path := job.outputPath()
+	var file *os.File
+	var err error
+	if job.retryFailed {
+		// Write the completed archive next to the existing one and replace it at the end
+		if job.existing, err = readArchivePages(job.format, path); err != nil {
+			return fmt.Errorf("cannot retry failed pages: %w", err)
+		}
+		file, err = os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(file.Name())
+	} else if job.resume {
+		// Write the EPUB next to its final name, keeping its pages in parts
+		// until it is complete
+		if job.format != "epub" {
+			return fmt.Errorf("-resume supports epub, not %s; use -retry-failed for cbz and cbt", job.format)
+		}
+		if !job.overwrite {
+			complete, err := upToDate(ctx, job, path)
+			if err != nil {
+				return err
+			}
+			if complete {
+				fmt.Printf("%s is already up to date\n", path)
+				return nil
+			}
+			if _, err := os.Stat(path); err == nil {
+				return fmt.Errorf("%w: %s (use -overwrite)", downloader.ErrOutputExists, path)
+			}
+		}
+		if job.parts, job.existing, err = openPageParts(path, job); err != nil {
+			return fmt.Errorf("cannot resume: %w", err)
+		}
+		if len(job.existing) > 0 {
+			fmt.Printf("Resuming with %d pages from %s\n", len(job.existing), job.parts.dir)
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			return fmt.Errorf("cannot create output directory: %w", err)
+		}
+		file, err = os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(file.Name())
+	} else {
+		if !job.overwrite {
+			complete, err := upToDate(ctx, job, path)
+			if err != nil {
+				return err
+			}
+			if complete {
+				fmt.Printf("%s is already up to date\n", path)
+				return nil
+			}
+		}
+		file, err = downloader.CreateOutput(path, job.overwrite)
+		if errors.Is(err, downloader.ErrOutputExists) {
+			return fmt.Errorf("%w (use -overwrite or -retry-failed)", err)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	defer file.Close()
+
+	job.progress = newProgress(job.quiet)
+	report, err := writeArchive(ctx, job, file)
+	job.progress.finish()
+	if err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if job.retryFailed {
+		if err := os.Rename(file.Name(), path); err != nil {
+			return err
+		}
+		fmt.Printf("Fetched %d missing pages, kept %d\n", report.fetched, report.stats.Pages-report.fetched)
+	}
+	if job.resume {
+		if err := os.Rename(file.Name(), path); err != nil {
+			return err
+		}
+		if err := job.parts.remove(); err != nil {
+			log.Printf("cannot remove %s: %v", job.parts.dir, err)
+		}
+	}
+	report.stats.Retries = downloader.Retries() - retries
+	report.stats.Duration = time.Since(start)
+	if fi, err := os.Stat(path); err == nil {
+		report.stats.Bytes = fi.Size()
+	}
+	fmt.Printf("Downloaded %d chapters (%d pages) to %s\n", report.stats.Chapters, report.stats.Pages, path)
+	if report.info != nil {
+		fmt.Printf("%s by %s, %s\n", report.info.Title, report.info.Author, report.info.URL())
+	}
+	fmt.Print(report.stats.Summary())
+
+	if job.opf {
+		if report.info == nil {
+			log.Println("skipping OPF: no comic info")
+		} else if err := writeSidecar(path, report.info, job.title, report.cover); err != nil {
+			return fmt.Errorf("failed to write OPF: %w", err)
+		}
+	}
+
+	if job.checksum || job.checksumFile {
+		sum, err := fileChecksum(path)
+		if err != nil {
+			return fmt.Errorf("failed to compute checksum: %w", err)
+		}
+		fmt.Printf("SHA-256 %s\n", sum)
+		if job.checksumFile {
+			if err := writeChecksumFile(path, sum); err != nil {
+				return fmt.Errorf("failed to write checksum file: %w", err)
+			}
+		}
+	}
+
+	return reportSkipped(os.Stdout, job, report.skipped)
+}
+
+// runDownloadToStdout downloads the job's chapters into an archive written to
+// archiveStdout, reporting on stderr
+func runDownloadToStdout(ctx context.Context, job downloadJob) error {
+	job.dedupeChapters()
+	job.format = archive.Resolve(job.format, len(job.chapterIDs))
+	start := time.Now()
+	retries := downloader.Retries()
+	buf := bufio.NewWriter(archiveStdout)
+	out := &countingWriter{w: buf}
+	sum := sha256.New()
+
+	job.progress = newProgress(job.quiet)
+	report, err := writeArchive(ctx, job, io.MultiWriter(out, sum))
+	job.progress.finish()
+	if err != nil {
+		return err
+	}
+	if err := buf.Flush(); err != nil {
+		return err
+	}
+	report.stats.Retries = downloader.Retries() - retries
+	report.stats.Duration = time.Since(start)
+	report.stats.Bytes = out.n
+	msg := job.messages()
+	fmt.Fprintf(msg, "Downloaded %d chapters (%d pages) to stdout\n", report.stats.Chapters, report.stats.Pages)
+	if report.info != nil {
+		fmt.Fprintf(msg, "%s by %s, %s\n", report.info.Title, report.info.Author, report.info.URL())
+	}
+	fmt.Fprint(msg, report.stats.Summary())
+	if job.checksum {
+		fmt.Fprintf(msg, "SHA-256 %s\n", hex.EncodeToString(sum.Sum(nil)))
+	}
+	return reportSkipped(msg, job, report.skipped)
+}
+
+// reportSkipped lists the chapters skipped by -continue-on-error to w, and
+// apart from them those only partly written, and returns them as the error
+// of the download
+func reportSkipped(w io.Writer, job downloadJob, skipped skippedChapters) error {
+	if len(skipped) == 0 {
+		return nil
+	}
+	list := func(header string, count int, partial bool) {
+		if count == 0 {
+			return
+		}
+		fmt.Fprintf(w, header, count, len(job.chapterIDs))
+		for _, err := range skipped {
+			var p *partialChapter
+			if errors.As(err, &p) == partial {
+				fmt.Fprintf(w, "  %v\n", err)
+			}
+		}
+	}
+	partial := skipped.partial()
+	list("Skipped %d of %d chapters:\n", len(skipped)-partial, false)
+	list("Kept part of %d of %d chapters:\n", partial, true)
+	return skipped
+}
+
+// countingWriter counts the bytes written to w
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// writeArchive downloads the job's chapters into file. The comic info is
+// fetched once, when not already known, to provide both the cover and the
+// archive metadata.
+func writeArchive(ctx context.Context, job downloadJob, file io.Writer) (*downloadReport, error) {
+	if job.info == nil && (job.cover || job.metadata || job.opf) {
+		job.info = fetchInfo(info.NewComicInfoFetcher(ctx), job.comicID)
+	}
+	var cover []byte
+	if job.cover {
+		cover = fetchCover(ctx, job.info)
+	}
+	// The first page only stands in for a missing cover
+	job.pageCover = job.pageCover && job.cover && cover == nil
+
+	pages, err := downloadToArchive(ctx, job, cover, file)
+	var skipped skippedChapters
+	if errors.As(err, &skipped) {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	fetched := pages
+	for index := range job.existing {
+		if index < pages {
+			fetched--
+		}
+	}
+	return &downloadReport{
+		// Partly written chapters are in the archive
+		stats:   downloader.Stats{Chapters: len(job.chapterIDs) - len(skipped) + skipped.partial(), Pages: pages},
+		fetched: fetched,
+		info:    job.info,
+		cover:   cover,
+		skipped: skipped,
+	}, nil
+}
+
+// fetchInfo returns the comic info, or nil when it cannot be retrieved
+func fetchInfo(fetcher info.Fetcher, comicID string) *info.ComicInfo {
+	ci, err := fetcher.GetComicInfo(comicID)
+	if err != nil {
+		log.Printf("skipping cover and metadata: %v", err)
+		return nil
+	}
+	return ci
+}
+
+// fetchCover returns the comic's cover image, or nil when it cannot be retrieved
+func fetchCover(ctx context.Context, ci *info.ComicInfo) []byte {
+	if ci == nil {
+		return nil
+	}
+	if ci.CoverURL == "" {
+		log.Println("skipping cover: comic has no cover")
+		return nil
+	}
+	data, err := downloader.DownloadCover(ctx, ci.CoverURL)
+	if err != nil {
+		log.Printf("skipping cover: %v", err)
+		return nil
+	}
+	return data
+}
+
+// downloadToArchive writes the job's pages into an archive of the job's
+// format and returns the number of pages
+func downloadToArchive(ctx context.Context, job downloadJob, cover []byte, file io.Writer) (int, error) {
+	w, err := newJobWriter(job, cover, file)
+	if err != nil {
+		return 0, err
+	}
+	pages, err := addPages(ctx, job, w)
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	return pages, err
+}
+
+// addPages downloads the job's chapters into w and returns the number of pages.
+// Pages are fetched ahead of the writer, up to the job's in-flight limit.
+func addPages(ctx context.Context, job downloadJob, w archive.ArchiveWriter) (int, error) {
+	job.chapterWorkers = job.fitChapterWorkers()
+	open := openChapters
+	if job.chapterWorkers > 1 {
+		open = openChapterTabs
+	}
+	openChapter, err := open(ctx, job.comicID, job.chapterIDs, job.workers)
+	if err != nil {
+		return 0, err
+	}
+	report := job.reporter()
+	origins, _ := w.(pageOrigins)
+	starts, _ := w.(chapterStarts)
+	failures, _ := w.(chapterFailures)
+	var skipped skippedChapters
+	// started is the chapter being written, -1 once it failed, of which
+	// kept of its pages were written
+	started, pages, kept := -1, 0, 0
+	covers, needCover := w.(coverWriter)
+	needCover = needCover && job.pageCover
+
+	inflight := make(chan struct{}, job.inflightLimit())
+	out := make(chan downloader.FetchedPage, cap(inflight))
+	done := make(chan struct{})
+	fetchErr := make(chan error, 1)
+	go func() {
+		fetchErr <- downloader.FetchPages(job.fetch(), openChapter, out, inflight, done)
+		close(out)
+	}()
+
+	page := 0
+	for p := range out {
+		if p.Failed != nil {
+			log.Printf("Skipping the rest of chapter %d/%d: %v", p.Chapter+1, len(job.chapterIDs), p.Failed)
+			// A chapter failing before its start wrote nothing
+			if p.Chapter != started {
+				skipped = append(skipped, p.Failed)
+				continue
+			}
+			if kept > 0 {
+				skipped = append(skipped, &partialChapter{err: p.Failed, kept: kept, pages: pages})
+			} else {
+				skipped = append(skipped, p.Failed)
+			}
+			started = -1
+			if failures != nil {
+				if err = failures.failChapter(kept); err != nil {
+					close(done)
+					break
+				}
+			}
+			continue
+		}
+		if p.Start {
+			started, pages, kept = p.Chapter, p.Pages, 0
+			report.chapter(p.Chapter, len(job.chapterIDs), p.Pages)
+			if starts != nil {
+				if err = starts.startChapter(p.Chapter); err != nil {
+					close(done)
+					break
+				}
+			}
+			continue
+		}
+		if origins != nil {
+			origins.setOrigin(p.ChapterID, p.ID)
+		}
+		if err = w.AddPage(naming.PageEntryName(page, 0, ".jpg"), p.Data); err != nil {
+			close(done)
+			break
+		}
+		if job.parts != nil && !p.Title {
+			if err = job.parts.save(page, p.Data); err != nil {
+				close(done)
+				break
+			}
+		}
+		if needCover && !p.Title {
+			needCover = false
+			if err = setPageCover(covers, p.Data, job.cropCover); err != nil {
+				close(done)
+				break
+			}
+		}
+		<-inflight
+		if !p.Title {
+			report.page(int64(len(p.Data)))
+			kept++
+		}
+		page++
+	}
+	if ferr := <-fetchErr; err == nil {
+		err = ferr
+	}
+	if err == nil && skipped != nil {
+		err = skipped
+	}
+	return page, err
+}
+
+// newJobWriter returns the archive writer of the job's format, set up with
+// the job's options and cover
+func newJobWriter(job downloadJob, cover []byte, file io.Writer) (archive.ArchiveWriter, error) {
+	if job.format == archive.Series {
+		return newSeriesArchive(job, cover, file), nil
+	}
+	if job.format != "epub" {
+		cbz := &comicArchive{
+			ComicWriter: &archive.ComicWriter{
+				Archive: archive.NewComicArchive(job.format, file),
+				// Known with the page counts of info -pages output
+				PageWidth: len(strconv.Itoa(job.knownPageCount())),
+			},
+			job: job,
+		}
+		if cover != nil {
+			if err := cbz.SetCover("cover.jpg", cover); err != nil {
+				return nil, err
+			}
+		}
+		return cbz, nil
+	}
+
+	writer := epub.NewEPUBWriter(file, job.title)
+	writer.SetImageFormat(job.imageFormat)
+	writer.SetImageQuality(job.imageQuality)
+	writer.SetImageOnly(job.imageOnly)
+	writer.SetFrontMatter(job.frontMatter)
+	writer.SetTransform(job.transform)
+	writer.SetVersion(job.epubVersion)
+	writer.SetFixedLayout(job.fixedLayout)
+	writer.SetRightToLeft(job.rightToLeft)
+	// Known with the page counts of info -pages output passed to -info-file
+	writer.SetExpectedPages(job.knownPageCount())
+	if job.pageCSS != "" {
+		writer.SetPageCSS(job.pageCSS)
+	}
+	if job.ocr && job.imageOnly {
+		log.Println("skipping OCR: image-only EPUBs have no pages to hold the text")
+	} else if job.ocr {
+		tess, err := ocr.NewTesseract(job.ocrLang)
+		if err != nil {
+			log.Printf("skipping OCR: %v", err)
+		} else {
+			writer.SetTextRecognizer(tess)
+		}
+	}
+	if job.metadata && job.info != nil {
+		metadata := epub.Metadata{
+			Creator:     job.info.Author,
+			Description: job.info.Description,
+			Year:        job.info.Year,
+		}
+		// A book converted from an archive without links has no comic ID
+		if job.info.ID != "" {
+			metadata.Source = job.info.URL()
+			// Each chapter's reader, so the book can be traced back to it
+			metadata.ChapterSources = job.chapterURLs()
+		}
+		writer.SetMetadata(metadata)
+	}
+	if cover != nil {
+		if err := writer.SetCover("cover.jpg", cover); err != nil {
+			return nil, err
+		}
+	}
+	return writer, nil
+}
+
+// chapterStarts is implemented by writers keeping the chapters apart
+type chapterStarts interface {
+	// startChapter begins the i-th chapter of the job, whose pages are
+	// added next
+	startChapter(i int) error
+}
+
+// chapterFailures is implemented by writers keeping the chapters apart that
+// tell a chapter failing part-way from the complete ones
+type chapterFailures interface {
+	// failChapter ends the chapter being written, which failed after kept
+	// of its pages were added
+	failChapter(kept int) error
+}
+
+// pageOrigins is implemented by writers recording where each page came from
+type pageOrigins interface {
+	// setOrigin describes the page added next
+	setOrigin(chapterID, pageID string)
+}
+
+// comicArchive writes the pages of a CBZ or CBT, transcoding them when the
+// job asks for another image format, and adds the manifest and metadata on
+// Close
+type comicArchive struct {
+	*archive.ComicWriter
+	job   downloadJob
+	cover bool
+	// origin describes the page added next
+	origin   manifestEntry
+	manifest []manifestEntry
+	// chapterInfo, when set, is the only chapter of the archive, numbered
+	// number in its series
+	chapterInfo *info.Chapter
+	number      info.ChapterNumber
+}
+
+// SetCover stores the cover image under naming.CoverName, counted in
+// ComicInfo.xml
+func (c *comicArchive) SetCover(name string, data []byte) error {
+	if err := writeArchiveEntry(c, naming.CoverName+path.Ext(name), data); err != nil {
+		return err
+	}
+	c.cover = true
+	return nil
+}
+
+func (c *comicArchive) setOrigin(chapterID, pageID string) {
+	c.origin = manifestEntry{ChapterID: chapterID, PageID: pageID}
+}
+
+// AddPage stores a page image and records it in the manifest
+func (c *comicArchive) AddPage(name string, data []byte) error {
+	name, data, err := epub.TransformImage(name, data, c.job.transform, c.job.imageFormat, c.job.imageQuality)
+	if err != nil {
+		return err
+	}
+	name = c.PageName(name)
+	if err := c.ComicWriter.AddPage(name, data); err != nil {
+		return err
+	}
+	entry := c.origin
+	entry.Name = name
+	entry.Format = imageFormat(data)
+	entry.Size = int64(len(data))
+	c.manifest = append(c.manifest, entry)
+	return nil
+}
+
+// Close adds the manifest and ComicInfo.xml the job asks for and closes the
+// archive
+func (c *comicArchive) Close() error {
+	if c.job.manifest {
+		data, err := json.MarshalIndent(c.manifest, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := writeArchiveEntry(c, "pages.json", data); err != nil {
+			return err
+		}
+	}
+	if c.job.metadata && c.job.info != nil {
+		imageCount := len(c.manifest)
+		if c.cover {
+			imageCount++
+		}
+		data, err := c.job.info.ComicRackXML(c.job.title, imageCount, c.job.chapterIDs...)
+		if c.chapterInfo != nil {
+			data, err = c.job.info.ChapterComicRackXML(*c.chapterInfo, c.number, imageCount)
+		}
+		if err != nil {
+			return err
+		}
+		if err := writeArchiveEntry(c, "ComicInfo.xml", data); err != nil {
+			return err
+		}
+	}
+	return c.ComicWriter.Close()
+}
+
+// writeArchiveEntry stores data in the archive under name
+func writeArchiveEntry(cbz cbt.Archive, name string, data []byte) error {
+	w, err := cbz.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
@@ -0,0 +1,648 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"comicsd/internal/archive"
+	"comicsd/internal/downloader"
+	"comicsd/internal/epub"
+	"comicsd/internal/info"
+)
+
+// fakeChapter serves the page IDs, after an optional prefix, as the page
+// contents, failing on the page fail
+type fakeChapter struct {
+	id     string
+	pages  []string
+	prefix string
+	fail   string
+	closed *int
+}
+
+func (c *fakeChapter) PageIDs() []string { return c.pages }
+
+func (c *fakeChapter) DownloadPageTo(page string, w io.Writer) error {
+	if page == c.fail {
+		return errors.New("no such image")
+	}
+	_, err := fmt.Fprintf(w, "%s%s/%s", c.prefix, c.id, page)
+	return err
+}
+
+func (c *fakeChapter) Close() { *c.closed++ }
+
+// stubChapters makes the download builders read the given chapter pages and
+// returns a counter of closed chapters
+func stubChapters(t *testing.T, pages map[string][]string) *int {
+	t.Helper()
+	orig := openChapters
+	t.Cleanup(func() { openChapters = orig })
+
+	closed := new(int)
+	openChapters = func(ctx context.Context, comicID string, chapterIDs []string, workers int) (downloader.ChapterOpener, error) {
+		return func(i int) (downloader.PageSource, error) {
+			return &fakeChapter{id: chapterIDs[i], pages: pages[chapterIDs[i]], closed: closed}, nil
+		}, nil
+	}
+	return closed
+}
+
+// readZip returns the entries of the archive at path by name, in archive order
+func readZip(t *testing.T, path string) ([]string, map[string]string) {
+	t.Helper()
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatalf("open archive: %v", err)
+	}
+	defer zr.Close()
+
+	names := make([]string, 0, len(zr.File))
+	contents := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("open %s: %v", f.Name, err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("read %s: %v", f.Name, err)
+		}
+		names = append(names, f.Name)
+		contents[f.Name] = string(data)
+	}
+	return names, contents
+}
+
+func testJob(format string) downloadJob {
+	return downloadJob{
+		comicID:    "1128",
+		title:      "東大特訓班",
+		chapterIDs: []string{"a", "b"},
+		format:     format,
+		workers:    1,
+		metadata:   true,
+		info:       &info.ComicInfo{ID: "1128", Title: "東大特訓班", Author: "三田紀房"},
+	}
+}
+
+func TestDownloadToCBZNumbersPagesAcrossChapters(t *testing.T) {
+	closed := stubChapters(t, map[string][]string{"a": {"1", "2"}, "b": {"1"}})
+	path := filepath.Join(t.TempDir(), "out.cbz")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pages, err := downloadToArchive(context.Background(), testJob("cbz"), []byte("cover"), file)
+	file.Close()
+	if err != nil {
+		t.Fatalf("downloadToArchive failed: %v", err)
+	}
+	if pages != 3 {
+		t.Errorf("expected 3 pages, got %d", pages)
+	}
+	if *closed != 2 {
+		t.Errorf("expected both chapters closed, got %d", *closed)
+	}
+
+	names, contents := readZip(t, path)
+	expected := []string{"!cover.jpg", "0000.jpg", "0001.jpg", "0002.jpg", "ComicInfo.xml"}
+	if strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Fatalf("unexpected entries: %v", names)
+	}
+	for name, want := range map[string]string{"0000.jpg": "a/1", "0001.jpg": "a/2", "0002.jpg": "b/1"} {
+		if contents[name] != want {
+			t.Errorf("%s: expected %q, got %q", name, want, contents[name])
+		}
+	}
+	if !strings.Contains(contents["ComicInfo.xml"], "<PageCount>4</PageCount>") {
+		t.Errorf("ComicInfo.xml should count the cover and pages: %s", contents["ComicInfo.xml"])
+	}
+	if !strings.Contains(contents["ComicInfo.xml"], "https://tw.manhuagui.com/comic/1128/a.html https://tw.manhuagui.com/comic/1128/b.html</Web>") {
+		t.Errorf("ComicInfo.xml should link the chapters: %s", contents["ComicInfo.xml"])
+	}
+}
+
+func TestDownloadToCBTWritesTar(t *testing.T) {
+	stubChapters(t, map[string][]string{"a": {"1", "2"}, "b": {"1"}})
+	path := filepath.Join(t.TempDir(), "out.cbt")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pages, err := downloadToArchive(context.Background(), testJob("cbt"), nil, file)
+	file.Close()
+	if err != nil {
+		t.Fatalf("downloadToArchive failed: %v", err)
+	}
+	if pages != 3 {
+		t.Errorf("expected 3 pages, got %d", pages)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tr := tar.NewReader(f)
+	var got []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("read archive: %v", err)
+		}
+		data, _ := io.ReadAll(tr)
+		if hdr.Name != "ComicInfo.xml" {
+			hdr.Name += "=" + string(data)
+		}
+		got = append(got, hdr.Name)
+	}
+	expected := "0000.jpg=a/1,0001.jpg=a/2,0002.jpg=b/1,ComicInfo.xml"
+	if strings.Join(got, ",") != expected {
+		t.Errorf("unexpected entries: %v", got)
+	}
+}
+
+func TestDownloadToEPUBBuildsBook(t *testing.T) {
+	stubChapters(t, map[string][]string{"a": {"1"}, "b": {"1", "2"}})
+	path := filepath.Join(t.TempDir(), "out.epub")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pages, err := downloadToArchive(context.Background(), testJob("epub"), nil, file)
+	file.Close()
+	if err != nil {
+		t.Fatalf("downloadToArchive failed: %v", err)
+	}
+	if pages != 3 {
+		t.Errorf("expected 3 pages, got %d", pages)
+	}
+
+	_, contents := readZip(t, path)
+	for name, want := range map[string]string{
+		"OEBPS/images/0.jpg": "a/1",
+		"OEBPS/images/2.jpg": "b/2",
+	} {
+		if contents[name] != want {
+			t.Errorf("%s: expected %q, got %q", name, want, contents[name])
+		}
+	}
+	opf := contents["OEBPS/content.opf"]
+	if !strings.Contains(opf, `<itemref idref="page3"/>`) || !strings.Contains(opf, "<dc:creator>三田紀房</dc:creator>") {
+		t.Errorf("unexpected content.opf: %s", opf)
+	}
+}
+
+func TestDownloadToEPUBPageCSS(t *testing.T) {
+	stubChapters(t, map[string][]string{"a": {"1"}, "b": {"1"}})
+	path := filepath.Join(t.TempDir(), "out.epub")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job := testJob("epub")
+	job.pageCSS = "body { background: black; }"
+	_, err = downloadToArchive(context.Background(), job, nil, file)
+	file.Close()
+	if err != nil {
+		t.Fatalf("downloadToArchive failed: %v", err)
+	}
+
+	_, contents := readZip(t, path)
+	if contents["OEBPS/style.css"] != job.pageCSS {
+		t.Errorf("unexpected style.css: %q", contents["OEBPS/style.css"])
+	}
+}
+
+func TestDownloadToEPUBFrontMatter(t *testing.T) {
+	stubChapters(t, map[string][]string{"a": {"1"}, "b": {"1"}})
+	path := filepath.Join(t.TempDir(), "out.epub")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job := testJob("epub")
+	job.frontMatter = epub.FrontMatter{TitlePage: true}
+	_, err = downloadToArchive(context.Background(), job, nil, file)
+	file.Close()
+	if err != nil {
+		t.Fatalf("downloadToArchive failed: %v", err)
+	}
+
+	_, contents := readZip(t, path)
+	if title := contents["OEBPS/title.xhtml"]; !strings.Contains(title, "<p>三田紀房</p>") {
+		t.Errorf("unexpected title page: %q", title)
+	}
+	if _, ok := contents["OEBPS/colophon.xhtml"]; ok {
+		t.Error("unexpected colophon")
+	}
+}
+
+func TestDownloadToEPUBLayout(t *testing.T) {
+	stubChapters(t, map[string][]string{"a": {"1"}, "b": {"1"}})
+	path := filepath.Join(t.TempDir(), "out.epub")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job := testJob("epub")
+	job.fixedLayout = true
+	job.rightToLeft = true
+	_, err = downloadToArchive(context.Background(), job, nil, file)
+	file.Close()
+	if err != nil {
+		t.Fatalf("downloadToArchive failed: %v", err)
+	}
+
+	_, contents := readZip(t, path)
+	opf := contents["OEBPS/content.opf"]
+	if !strings.Contains(opf, "pre-paginated") || !strings.Contains(opf, `page-progression-direction="rtl"`) {
+		t.Errorf("expected a fixed-layout, right-to-left book: %s", opf)
+	}
+}
+
+func TestParseDirection(t *testing.T) {
+	for direction, want := range map[string]bool{"": false, "ltr": false, "RTL": true} {
+		if got, err := parseDirection(direction); err != nil || got != want {
+			t.Errorf("parseDirection(%q) = %v, %v; want %v", direction, got, err, want)
+		}
+	}
+	if _, err := parseDirection("ttb"); err == nil {
+		t.Error("expected an error for an unknown direction")
+	}
+}
+
+func TestCheckEPUBVersion(t *testing.T) {
+	tests := []struct {
+		version     int
+		fixedLayout bool
+		imageFormat epub.ImageFormat
+		valid       bool
+	}{
+		{0, true, epub.ImageWebP, true},
+		{2, false, epub.ImageJPEG, true},
+		{3, true, epub.ImageWebP, true},
+		{4, false, epub.ImagePassthrough, false},
+		{2, true, epub.ImagePassthrough, false},
+		{2, false, epub.ImageWebP, false},
+	}
+	for _, tt := range tests {
+		if err := checkEPUBVersion(tt.version, tt.fixedLayout, tt.imageFormat); (err == nil) != tt.valid {
+			t.Errorf("checkEPUBVersion(%d, %v, %q) = %v, want valid %v", tt.version, tt.fixedLayout, tt.imageFormat, err, tt.valid)
+		}
+	}
+}
+
+func TestDownloadToCBZManifest(t *testing.T) {
+	orig := openChapters
+	defer func() { openChapters = orig }()
+	openChapters = func(ctx context.Context, comicID string, chapterIDs []string, workers int) (downloader.ChapterOpener, error) {
+		return func(i int) (downloader.PageSource, error) {
+			// The JPEG signature lets the manifest detect the format
+			return &fakeChapter{id: chapterIDs[i], pages: []string{"p1"}, prefix: "\xff\xd8\xff", closed: new(int)}, nil
+		}, nil
+	}
+	path := filepath.Join(t.TempDir(), "out.cbz")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job := testJob("cbz")
+	job.manifest = true
+	if _, err := downloadToArchive(context.Background(), job, nil, file); err != nil {
+		t.Fatalf("downloadToArchive failed: %v", err)
+	}
+	file.Close()
+
+	_, contents := readZip(t, path)
+	var manifest []manifestEntry
+	if err := json.Unmarshal([]byte(contents["pages.json"]), &manifest); err != nil {
+		t.Fatalf("invalid pages.json: %v\n%s", err, contents["pages.json"])
+	}
+	expected := []manifestEntry{
+		{Name: "0000.jpg", ChapterID: "a", PageID: "p1", Format: "jpeg", Size: int64(len(contents["0000.jpg"]))},
+		{Name: "0001.jpg", ChapterID: "b", PageID: "p1", Format: "jpeg", Size: int64(len(contents["0001.jpg"]))},
+	}
+	if fmt.Sprint(manifest) != fmt.Sprint(expected) {
+		t.Errorf("unexpected manifest: %+v", manifest)
+	}
+}
+
+func TestDownloadToCBZWithoutManifest(t *testing.T) {
+	stubChapters(t, map[string][]string{"a": {"1"}, "b": {"1"}})
+	path := filepath.Join(t.TempDir(), "out.cbz")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := downloadToArchive(context.Background(), testJob("cbz"), nil, file); err != nil {
+		t.Fatalf("downloadToArchive failed: %v", err)
+	}
+	file.Close()
+
+	if _, contents := readZip(t, path); contents["pages.json"] != "" {
+		t.Errorf("pages.json written without -manifest")
+	}
+}
+
+func TestDownloadToCBZPageRanges(t *testing.T) {
+	stubChapters(t, map[string][]string{"a": {"1", "2", "3"}, "b": {"1", "2"}})
+	path := filepath.Join(t.TempDir(), "out.cbz")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job := testJob("cbz")
+	job.metadata = false
+	job.pageRanges = []pageRange{{2, 0}, {}}
+	pages, err := downloadToArchive(context.Background(), job, nil, file)
+	file.Close()
+	if err != nil {
+		t.Fatalf("downloadToArchive failed: %v", err)
+	}
+	if pages != 4 {
+		t.Errorf("expected 4 pages, got %d", pages)
+	}
+	_, contents := readZip(t, path)
+	for name, want := range map[string]string{"0000.jpg": "a/2", "0001.jpg": "a/3", "0002.jpg": "b/1", "0003.jpg": "b/2"} {
+		if contents[name] != want {
+			t.Errorf("%s: expected %q, got %q", name, want, contents[name])
+		}
+	}
+
+	job.pageRanges = []pageRange{{1, 5}, {}}
+	file, err = os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := downloadToArchive(context.Background(), job, nil, file); err == nil || !strings.Contains(err.Error(), "chapter a") {
+		t.Errorf("expected an out of bounds error for chapter a, got %v", err)
+	}
+}
+
+func TestDownloadToCBZReportsFailedPage(t *testing.T) {
+	orig := openChapters
+	t.Cleanup(func() { openChapters = orig })
+	openChapters = func(ctx context.Context, comicID string, chapterIDs []string, workers int) (downloader.ChapterOpener, error) {
+		return func(i int) (downloader.PageSource, error) {
+			return &fakeChapter{id: chapterIDs[i], pages: []string{"1", "2"}, fail: "2", closed: new(int)}, nil
+		}, nil
+	}
+	file, err := os.Create(filepath.Join(t.TempDir(), "out.cbz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	job := testJob("cbz")
+	job.metadata = false
+	_, err = downloadToArchive(context.Background(), job, nil, file)
+	if err == nil || err.Error() != "comic 1128 chapter a page 2: no such image" {
+		t.Errorf("expected the failed comic, chapter and page in the error, got %v", err)
+	}
+}
+
+func TestKnownPageCount(t *testing.T) {
+	job := testJob("epub")
+	job.info.Chapters = []info.Chapter{{ID: "a", PageCount: 40}, {ID: "b", PageCount: 960}}
+	if n := job.knownPageCount(); n != 1000 {
+		t.Errorf("expected 1000 pages, got %d", n)
+	}
+	job.titlePages = true
+	if n := job.knownPageCount(); n != 1002 {
+		t.Errorf("expected 1002 pages with title pages, got %d", n)
+	}
+	job.info.Chapters[1].PageCount = 0
+	if n := job.knownPageCount(); n != 0 {
+		t.Errorf("expected 0 with an unknown count, got %d", n)
+	}
+}
+
+func TestDedupeChaptersKeepsPageRanges(t *testing.T) {
+	job := testJob("cbz")
+	job.chapterIDs = []string{"b", "a", "b", "c", "a"}
+	job.pageRanges = []pageRange{{1, 2}, {3, 0}, {5, 6}, {}, {7, 8}}
+	job.dedupeChapters()
+
+	if expected := []string{"b", "a", "c"}; !reflect.DeepEqual(job.chapterIDs, expected) {
+		t.Errorf("expected chapters %v, got %v", expected, job.chapterIDs)
+	}
+	if expected := []pageRange{{1, 2}, {3, 0}, {}}; !reflect.DeepEqual(job.pageRanges, expected) {
+		t.Errorf("expected the first page ranges %v, got %v", expected, job.pageRanges)
+	}
+}
+
+func TestSplitTitle(t *testing.T) {
+	tests := []struct {
+		args     []string
+		title    string
+		chapters []string
+	}{
+		{[]string{"東大特訓班", "566271", "564917"}, "東大特訓班", []string{"566271", "564917"}},
+		{[]string{"566271", "564917"}, "", []string{"566271", "564917"}},
+		{[]string{"566271:10-25"}, "", []string{"566271:10-25"}},
+		{[]string{"東大特訓班"}, "東大特訓班", []string{}},
+		{nil, "", nil},
+	}
+	for _, tt := range tests {
+		title, chapters := splitTitle(tt.args)
+		if title != tt.title || fmt.Sprint(chapters) != fmt.Sprint(tt.chapters) {
+			t.Errorf("splitTitle(%v) = %q, %v; want %q, %v", tt.args, title, chapters, tt.title, tt.chapters)
+		}
+	}
+}
+
+func TestDefaultTitle(t *testing.T) {
+	ci := &info.ComicInfo{Title: "東大特訓班", Chapters: []info.Chapter{
+		{ID: "566271", Title: "第1卷"},
+		{ID: "566272", Title: "第2/3卷"},
+	}}
+	tests := []struct {
+		chapterIDs []string
+		title      string
+	}{
+		{nil, "東大特訓班"},
+		{[]string{"566271", "566272"}, "東大特訓班"},
+		{[]string{"566271"}, "東大特訓班 第1卷"},
+		{[]string{"566272"}, "東大特訓班 第2_3卷"},
+		{[]string{"999999"}, "東大特訓班 999999"},
+	}
+	for _, tt := range tests {
+		if title := defaultTitle(ci, tt.chapterIDs); title != tt.title {
+			t.Errorf("defaultTitle(%v) = %q, want %q", tt.chapterIDs, title, tt.title)
+		}
+	}
+}
+
+func TestReadInfoFile(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	ci := &info.ComicInfo{ID: "1128", Title: "東大特訓班", Chapters: []info.Chapter{{ID: "7778", Title: "第2話"}, {ID: "7777", Title: "第1話"}}}
+	saved, _ := ci.ToJSON()
+	got, err := readInfoFile(write("info.json", saved))
+	if err != nil {
+		t.Fatalf("readInfoFile failed: %v", err)
+	}
+	if got.ID != "1128" || got.Title != "東大特訓班" || len(got.Chapters) != 2 {
+		t.Errorf("unexpected comic info: %+v", got)
+	}
+	if err := checkChapters(got, []string{"7777"}); err != nil {
+		t.Errorf("expected listed chapter to pass: %v", err)
+	}
+	if err := checkChapters(got, []string{"7777", "9999"}); err == nil || !strings.Contains(err.Error(), "9999") {
+		t.Errorf("expected error naming the unlisted chapter, got %v", err)
+	}
+
+	for name, content := range map[string]string{
+		"plan.json":      `{"comic_id": "1128", "title": "東大特訓班", "chapter_ids": ["7777"]}`,
+		"nochap.json":    `{"id": "1128", "title": "東大特訓班", "chapters": []}`,
+		"noid.json":      `{"title": "東大特訓班", "chapters": [{"id": "7777"}]}`,
+		"chapterid.json": `{"id": "1128", "chapters": [{"title": "第1話"}]}`,
+	} {
+		if _, err := readInfoFile(write(name, content)); err == nil {
+			t.Errorf("expected %s to be rejected", name)
+		}
+	}
+}
+
+func TestDownloadToCBZTitlePages(t *testing.T) {
+	stubChapters(t, map[string][]string{"100": {"a", "b"}, "101": {"c"}})
+	job := testJob("cbz")
+	job.chapterIDs = []string{"100", "101"}
+	job.titlePages = true
+	job.info = &info.ComicInfo{ID: "1", Chapters: []info.Chapter{{ID: "101", Title: "Extra 2.5"}, {ID: "100", Title: "第1話"}}}
+
+	path := filepath.Join(t.TempDir(), "out.cbz")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages, err := downloadToArchive(context.Background(), job, nil, file)
+	if err != nil {
+		t.Fatalf("downloadToArchive failed: %v", err)
+	}
+	if pages != 5 {
+		t.Errorf("expected 3 pages and 2 title pages, got %d", pages)
+	}
+
+	_, contents := readZip(t, path)
+	if contents["0001.jpg"] != "100/a" || contents["0004.jpg"] != "101/c" {
+		t.Errorf("expected chapter pages after their title pages: %v", contents)
+	}
+	for _, name := range []string{"0000.jpg", "0003.jpg"} {
+		if imageFormat([]byte(contents[name])) != "jpeg" {
+			t.Errorf("expected %s to be a title page", name)
+		}
+	}
+}
+
+func TestTitlePageHeading(t *testing.T) {
+	job := testJob("cbz")
+	job.chapterIDs = []string{"100", "101"}
+	job.info = &info.ComicInfo{Chapters: []info.Chapter{{ID: "100", Title: "第12話"}}}
+
+	numbered, err := job.titlePage(0)
+	if err != nil {
+		t.Fatalf("titlePage failed: %v", err)
+	}
+	unknown, err := job.titlePage(1)
+	if err != nil {
+		t.Fatalf("titlePage failed: %v", err)
+	}
+	if bytes.Equal(numbered, unknown) {
+		t.Error("expected different pages for chapter 12 and the second chapter")
+	}
+}
+
+func TestRunDownloadToStdout(t *testing.T) {
+	stubChapters(t, map[string][]string{"a": {"1", "2"}, "b": {"1"}})
+	orig := archiveStdout
+	t.Cleanup(func() { archiveStdout = orig })
+	var out bytes.Buffer
+	archiveStdout = &out
+
+	job := testJob("cbz")
+	job.outputDir = t.TempDir()
+	job.output = "-"
+	if err := runDownload(context.Background(), job); err != nil {
+		t.Fatalf("runDownload failed: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	if err != nil {
+		t.Fatalf("stdout is not a complete archive: %v", err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	if got := strings.Join(names, ","); got != "0000.jpg,0001.jpg,0002.jpg,ComicInfo.xml" {
+		t.Errorf("unexpected entries: %s", got)
+	}
+	if files, _ := os.ReadDir(job.outputDir); len(files) > 0 {
+		t.Errorf("expected no file in the output directory, got %d", len(files))
+	}
+}
+
+func TestRunDownloadToOutputFile(t *testing.T) {
+	stubChapters(t, map[string][]string{"a": {"1"}, "b": {"1"}})
+	job := testJob("cbz")
+	job.outputDir = t.TempDir()
+	job.output = filepath.Join(t.TempDir(), "chapters.cbz")
+	if err := runDownload(context.Background(), job); err != nil {
+		t.Fatalf("runDownload failed: %v", err)
+	}
+	if names, _ := readZip(t, job.output); len(names) != 3 {
+		t.Errorf("unexpected entries: %v", names)
+	}
+	if files, _ := os.ReadDir(job.outputDir); len(files) > 0 {
+		t.Errorf("expected -o to replace the output directory, got %d files there", len(files))
+	}
+}
+
+func TestRunDownloadResolvesAutoFormat(t *testing.T) {
+	stubChapters(t, map[string][]string{"a": {"1"}, "b": {"1"}})
+	for chapters, want := range map[int]string{1: "東大特訓班.epub", 2: "東大特訓班.cbz"} {
+		job := testJob(archive.Auto)
+		job.chapterIDs = job.chapterIDs[:chapters]
+		job.cover = false
+		job.outputDir = t.TempDir()
+		if err := runDownload(context.Background(), job); err != nil {
+			t.Fatalf("%d chapters: runDownload failed: %v", chapters, err)
+		}
+		if _, err := os.Stat(filepath.Join(job.outputDir, want)); err != nil {
+			t.Errorf("%d chapters: expected %s: %v", chapters, want, err)
+		}
+	}
+}
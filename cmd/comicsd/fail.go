@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+// failure describes the running command for the report of its error
+type failure struct {
+	command string
+	comicID string
+	// json reports errors as a JSON object instead of a log line
+	json bool
+}
+
+// current is the running command, filled in as its arguments are parsed
+var current failure
+
+// errorReport is the JSON form of a command's error
+type errorReport struct {
+	Error   string `json:"error"`
+	Command string `json:"command"`
+	ComicID string `json:"comic_id,omitempty"`
+}
+
+// report writes err to w as a log line, or as an errorReport in JSON mode
+func (f failure) report(w io.Writer, err error) {
+	if !f.json {
+		log.New(w, "", log.LstdFlags).Println(err)
+		return
+	}
+	data, _ := json.Marshal(errorReport{Error: err.Error(), Command: f.command, ComicID: f.comicID})
+	fmt.Fprintln(w, string(data))
+}
+
+// fatal reports err on stderr, and in the log file if any, and exits non-zero
+func fatal(err error) {
+	current.report(os.Stderr, err)
+	if logFile != nil {
+		current.report(logFile, err)
+	}
+	os.Exit(1)
+}
+
+// fatalf is fatal with a formatted error
+func fatalf(format string, args ...any) {
+	fatal(fmt.Errorf(format, args...))
+}
+
+// parseCommand parses the flags of a command. Errors are reported as JSON
+// with -json-errors or when the command prints JSON (-format json).
+func parseCommand(fs *flag.FlagSet, args []string) {
+	fs.Parse(args)
+	current.command = fs.Name()
+	if f := fs.Lookup("json-errors"); f != nil && f.Value.String() == "true" {
+		current.json = true
+	}
+	if f := fs.Lookup("format"); f != nil && f.Value.String() == "json" {
+		current.json = true
+	}
+}
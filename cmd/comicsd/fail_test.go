@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"strings"
+	"testing"
+)
+
+func TestFailureReportJSON(t *testing.T) {
+	var out bytes.Buffer
+	f := failure{command: "info", comicID: "1128", json: true}
+	f.report(&out, errors.New("comic not found"))
+
+	var got errorReport
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON %q: %v", out.String(), err)
+	}
+	expected := errorReport{Error: "comic not found", Command: "info", ComicID: "1128"}
+	if got != expected {
+		t.Errorf("unexpected report: %+v", got)
+	}
+}
+
+func TestFailureReportText(t *testing.T) {
+	var out bytes.Buffer
+	failure{command: "info"}.report(&out, errors.New("comic not found"))
+	if !strings.HasSuffix(out.String(), " comic not found\n") || strings.Contains(out.String(), "{") {
+		t.Errorf("unexpected report: %q", out.String())
+	}
+}
+
+func TestParseCommandPicksJSONErrors(t *testing.T) {
+	defer func() { current = failure{} }()
+	tests := []struct {
+		args []string
+		json bool
+	}{
+		{nil, false},
+		{[]string{"-json-errors"}, true},
+		{[]string{"-format", "json"}, true},
+		{[]string{"-format", "text"}, false},
+	}
+	for _, tt := range tests {
+		current = failure{}
+		fs := flag.NewFlagSet("search", flag.ContinueOnError)
+		fs.String("format", "text", "")
+		addSettingsFlags(fs)
+		parseCommand(fs, tt.args)
+		if current.json != tt.json || current.command != "search" {
+			t.Errorf("%v: unexpected failure %+v", tt.args, current)
+		}
+	}
+}
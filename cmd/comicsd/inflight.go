@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"comicsd/internal/downloader"
+)
+
+// minPagesPerChapterWorker is the fewest known pages worth a chapter tab of
+// their own: for fewer, opening the tab takes about as long as downloading
+// them in the current one
+const minPagesPerChapterWorker = 20
+
+// fitChapterWorkers returns the job's chapter workers cut to what it can use:
+// one per chapter, one per minPagesPerChapterWorker pages when the page
+// counts are known, and one per in-flight page, each needing one to
+// download. A single worker downloads the chapters one after another
+// in the current tab, without opening tabs. The cut is logged with its reason.
+func (job downloadJob) fitChapterWorkers() int {
+	if job.chapterWorkers <= 1 {
+		return job.chapterWorkers
+	}
+	workers := min(job.chapterWorkers, len(job.chapterIDs))
+	reason := fmt.Sprintf("%d chapters", len(job.chapterIDs))
+	if pages := job.knownPageCount(); pages > 0 && pages/minPagesPerChapterWorker < workers {
+		workers = max(pages/minPagesPerChapterWorker, 1)
+		reason = fmt.Sprintf("%d pages", pages)
+	}
+	if limit := job.inflightLimit(); limit < workers {
+		workers = limit
+		reason = fmt.Sprintf("max_inflight %d", limit)
+	}
+	workers = max(workers, 1)
+	if workers < job.chapterWorkers {
+		log.Printf("Using %d of %d chapter workers for %s", workers, job.chapterWorkers, reason)
+	}
+	return workers
+}
+
+// inflightLimit returns the number of page buffers the job may hold between
+// download and write
+func (job downloadJob) inflightLimit() int {
+	return downloader.InflightLimit(job.maxInflight, max(job.workers, 1))
+}
+
+// fetch returns what downloader.FetchPages downloads for the job: the pages
+// of its page range, with title pages when asked for, keeping the pages of
+// -resume
+func (job downloadJob) fetch() downloader.Fetch {
+	f := downloader.Fetch{
+		ComicID:         job.comicID,
+		ChapterIDs:      job.chapterIDs,
+		ChapterWorkers:  job.chapterWorkers,
+		ContinueOnError: job.continueOnError,
+		ChapterPages:    job.chapterPages,
+		Existing:        job.existing,
+	}
+	if job.titlePages {
+		f.TitlePage = job.titlePage
+	}
+	return f
+}
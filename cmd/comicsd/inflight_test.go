@@ -0,0 +1,471 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"comicsd/internal/downloader"
+	"comicsd/internal/info"
+)
+
+// countingChapter serves pages while counting the ones fetched
+type countingChapter struct {
+	pages   []string
+	mu      *sync.Mutex
+	fetched *int
+}
+
+func (c *countingChapter) PageIDs() []string { return c.pages }
+
+func (c *countingChapter) DownloadPageTo(page string, w io.Writer) error {
+	c.mu.Lock()
+	*c.fetched++
+	c.mu.Unlock()
+	_, err := io.WriteString(w, page)
+	return err
+}
+
+func (c *countingChapter) Close() {}
+
+// slowWriter records the pages added to it, taking a while for each
+type slowWriter struct {
+	mu          *sync.Mutex
+	fetched     *int
+	names       []string
+	maxInflight int
+	fail        error
+}
+
+func (w *slowWriter) AddPage(name string, data []byte) error {
+	w.mu.Lock()
+	w.maxInflight = max(w.maxInflight, *w.fetched-len(w.names))
+	w.mu.Unlock()
+	time.Sleep(time.Millisecond)
+	if w.fail != nil {
+		return w.fail
+	}
+	w.names = append(w.names, name)
+	return nil
+}
+
+func (w *slowWriter) Close() error { return nil }
+
+func stubCountingChapters(t *testing.T, pages int) (*sync.Mutex, *int) {
+	t.Helper()
+	orig := openChapters
+	t.Cleanup(func() { openChapters = orig })
+
+	mu, fetched := new(sync.Mutex), new(int)
+	ids := make([]string, pages)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("p%d", i)
+	}
+	openChapters = func(ctx context.Context, comicID string, chapterIDs []string, workers int) (downloader.ChapterOpener, error) {
+		return func(i int) (downloader.PageSource, error) {
+			return &countingChapter{pages: ids, mu: mu, fetched: fetched}, nil
+		}, nil
+	}
+	return mu, fetched
+}
+
+func TestAddPagesBoundsInflightPages(t *testing.T) {
+	mu, fetched := stubCountingChapters(t, 20)
+	job := testJob("cbz")
+	job.chapterIDs = []string{"c1", "c2"}
+	job.maxInflight = 3
+
+	w := &slowWriter{mu: mu, fetched: fetched}
+	pages, err := addPages(context.Background(), job, w)
+	if err != nil {
+		t.Fatalf("addPages failed: %v", err)
+	}
+	if pages != 40 || len(w.names) != 40 || w.names[39] != "39.jpg" {
+		t.Fatalf("expected 40 pages in order, got %d: %v", pages, w.names)
+	}
+	if w.maxInflight > job.maxInflight {
+		t.Errorf("expected at most %d pages in flight, saw %d", job.maxInflight, w.maxInflight)
+	}
+}
+
+// heldPages counts the pages downloaded but not yet written, and their peak
+type heldPages struct {
+	mu         sync.Mutex
+	held, peak int
+}
+
+func (h *heldPages) add(n int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.held += n
+	h.peak = max(h.peak, h.held)
+}
+
+// heldChapter counts its pages as held from the start of their download
+type heldChapter struct {
+	pages []string
+	held  *heldPages
+}
+
+func (c *heldChapter) PageIDs() []string { return c.pages }
+
+func (c *heldChapter) DownloadPageTo(page string, w io.Writer) error {
+	c.held.add(1)
+	_, err := io.WriteString(w, page)
+	return err
+}
+
+func (c *heldChapter) Close() {}
+
+// heldWriter releases the held pages as it slowly writes them
+type heldWriter struct {
+	held *heldPages
+}
+
+func (w *heldWriter) AddPage(name string, data []byte) error {
+	time.Sleep(time.Millisecond)
+	w.held.add(-1)
+	return nil
+}
+
+func (w *heldWriter) Close() error { return nil }
+
+func TestAddPagesBoundsInflightPagesAcrossChapterWorkers(t *testing.T) {
+	held := &heldPages{}
+	stubChapterTabs(t, func(i int, chapterID string) downloader.PageSource {
+		return &heldChapter{pages: []string{"1", "2", "3", "4", "5", "6", "7", "8"}, held: held}
+	})
+	for _, chapterWorkers := range []int{2, 3, 5} {
+		held.peak = 0
+		job := testJob("cbz")
+		job.chapterIDs = []string{"a", "b", "c", "d", "e"}
+		job.chapterWorkers = chapterWorkers
+		job.maxInflight = 3
+
+		pages, err := addPages(context.Background(), job, &heldWriter{held: held})
+		if err != nil || pages != 40 {
+			t.Fatalf("chapter workers %d: expected 40 pages, got %d (%v)", chapterWorkers, pages, err)
+		}
+		if held.peak > job.maxInflight {
+			t.Errorf("chapter workers %d: expected at most %d pages held, saw %d", chapterWorkers, job.maxInflight, held.peak)
+		}
+	}
+}
+
+func TestAddPagesStopsFetchingOnWriteError(t *testing.T) {
+	mu, fetched := stubCountingChapters(t, 50)
+	job := testJob("cbz")
+	job.chapterIDs = []string{"c1"}
+	job.maxInflight = 2
+
+	w := &slowWriter{mu: mu, fetched: fetched, fail: errors.New("disk full")}
+	if _, err := addPages(context.Background(), job, w); err == nil || err.Error() != "disk full" {
+		t.Fatalf("expected the write error, got %v", err)
+	}
+	if *fetched > job.maxInflight+1 {
+		t.Errorf("expected fetching to stop after the write error, fetched %d pages", *fetched)
+	}
+}
+
+func TestInflightLimitDefault(t *testing.T) {
+	job := downloadJob{workers: 4}
+	if got := job.inflightLimit(); got != 8 {
+		t.Errorf("expected twice the workers, got %d", got)
+	}
+	job.maxInflight = 1
+	if got := job.inflightLimit(); got != 1 {
+		t.Errorf("expected the configured limit, got %d", got)
+	}
+}
+
+func TestAddPagesPausesBetweenChapters(t *testing.T) {
+	defer func(d time.Duration) { downloader.ChapterDelay = d }(downloader.ChapterDelay)
+	downloader.ChapterDelay = 30 * time.Millisecond
+	stubCountingChapters(t, 1)
+	job := testJob("cbz")
+	job.chapterIDs = []string{"c1", "c2", "c3"}
+
+	start := time.Now()
+	if _, err := addPages(context.Background(), job, &slowWriter{mu: new(sync.Mutex), fetched: new(int)}); err != nil {
+		t.Fatalf("addPages failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 2*downloader.ChapterDelay {
+		t.Errorf("expected a pause before the second and third chapters, took %v", elapsed)
+	}
+}
+
+// gatedChapter serves pages named after the chapter, waiting for wait to be
+// closed before its first page when set
+type gatedChapter struct {
+	id      string
+	pages   []string
+	wait    <-chan struct{}
+	fetched func()
+	closed  *int32
+}
+
+func (c *gatedChapter) PageIDs() []string { return c.pages }
+
+func (c *gatedChapter) DownloadPageTo(page string, w io.Writer) error {
+	if c.fetched != nil {
+		c.fetched()
+	}
+	if c.wait != nil {
+		select {
+		case <-c.wait:
+		case <-time.After(time.Second):
+			return errors.New("chapters fetched one at a time")
+		}
+	}
+	_, err := fmt.Fprintf(w, "%s/%s", c.id, page)
+	return err
+}
+
+func (c *gatedChapter) Close() { atomic.AddInt32(c.closed, 1) }
+
+// pageWriter records the data of the pages added to it
+type pageWriter struct {
+	pages []string
+}
+
+func (w *pageWriter) AddPage(name string, data []byte) error {
+	w.pages = append(w.pages, string(data))
+	return nil
+}
+
+func (w *pageWriter) Close() error { return nil }
+
+// stubChapterTabs makes several chapter downloads open the given chapters
+func stubChapterTabs(t *testing.T, open func(i int, chapterID string) downloader.PageSource) {
+	t.Helper()
+	orig := openChapterTabs
+	t.Cleanup(func() { openChapterTabs = orig })
+	openChapterTabs = func(ctx context.Context, comicID string, chapterIDs []string, workers int) (downloader.ChapterOpener, error) {
+		return func(i int) (downloader.PageSource, error) {
+			return open(i, chapterIDs[i]), nil
+		}, nil
+	}
+}
+
+func TestAddPagesFetchesChaptersAtOnce(t *testing.T) {
+	// The first chapter only downloads once the second started, which
+	// happens only when both download at once
+	secondStarted := make(chan struct{})
+	var once sync.Once
+	closed := new(int32)
+	stubChapterTabs(t, func(i int, chapterID string) downloader.PageSource {
+		c := &gatedChapter{id: chapterID, pages: []string{"1", "2", "3"}, closed: closed}
+		switch i {
+		case 0:
+			c.wait = secondStarted
+		case 1:
+			c.fetched = func() { once.Do(func() { close(secondStarted) }) }
+		}
+		return c
+	})
+	job := testJob("cbz")
+	job.chapterIDs = []string{"a", "b", "c"}
+	job.chapterWorkers = 2
+	job.titlePages = true
+	job.existing = map[int][]byte{6: []byte("kept")}
+	// Enough slots for the second chapter's title page and first page
+	// while the first chapter waits
+	job.maxInflight = 4
+
+	w := &pageWriter{}
+	pages, err := addPages(context.Background(), job, w)
+	if err != nil {
+		t.Fatalf("addPages failed: %v", err)
+	}
+	if pages != 12 {
+		t.Fatalf("expected 12 pages, got %d", pages)
+	}
+	expected := []string{"a/1", "a/2", "a/3", "b/1", "kept", "b/3", "c/1", "c/2", "c/3"}
+	var got []string
+	for i, p := range w.pages {
+		if i%4 != 0 {
+			got = append(got, p)
+		}
+	}
+	if strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected the pages in chapter order, got %v", got)
+	}
+	if *closed != 3 {
+		t.Errorf("expected every chapter closed, got %d", *closed)
+	}
+}
+
+func TestAddPagesReportsFailedChapterInOrder(t *testing.T) {
+	var opened int32
+	closed := new(int32)
+	stubChapterTabs(t, func(i int, chapterID string) downloader.PageSource {
+		atomic.AddInt32(&opened, 1)
+		if chapterID == "b" {
+			return &failingChapter{gatedChapter: gatedChapter{id: chapterID, pages: []string{"1", "2"}, closed: closed}}
+		}
+		return &gatedChapter{id: chapterID, pages: []string{"1", "2"}, closed: closed}
+	})
+	job := testJob("cbz")
+	job.chapterIDs = []string{"a", "b", "c", "d"}
+	job.chapterWorkers = 3
+
+	w := &pageWriter{}
+	_, err := addPages(context.Background(), job, w)
+	if err == nil || err.Error() != "comic 1128 chapter b page 1: no such image" {
+		t.Fatalf("expected the failed page in the error, got %v", err)
+	}
+	if strings.Join(w.pages, ",") != "a/1,a/2" {
+		t.Errorf("expected only the chapter before the failed one, got %v", w.pages)
+	}
+	if atomic.LoadInt32(closed) != atomic.LoadInt32(&opened) {
+		t.Errorf("expected the %d opened chapters closed, got %d", opened, *closed)
+	}
+}
+
+// failingChapter serves its first kept pages and fails the others
+type failingChapter struct {
+	gatedChapter
+	kept int
+}
+
+func (c *failingChapter) DownloadPageTo(page string, w io.Writer) error {
+	if slices.Index(c.pages, page) < c.kept {
+		return c.gatedChapter.DownloadPageTo(page, w)
+	}
+	return errors.New("no such image")
+}
+
+func TestAddPagesContinuesPastFailedChapters(t *testing.T) {
+	origOpen, origTabs := openChapters, openChapterTabs
+	t.Cleanup(func() { openChapters, openChapterTabs = origOpen, origTabs })
+	closed := new(int32)
+	open := func(ctx context.Context, comicID string, chapterIDs []string, workers int) (downloader.ChapterOpener, error) {
+		return func(i int) (downloader.PageSource, error) {
+			switch chapterIDs[i] {
+			case "b":
+				return nil, downloader.ChapterError(comicID, "b", errors.New("chapter missing"))
+			case "c":
+				return &failingChapter{gatedChapter: gatedChapter{id: "c", pages: []string{"1", "2"}, closed: closed}}, nil
+			}
+			return &gatedChapter{id: chapterIDs[i], pages: []string{"1", "2"}, closed: closed}, nil
+		}, nil
+	}
+	openChapters, openChapterTabs = open, open
+
+	for _, chapterWorkers := range []int{1, 3} {
+		atomic.StoreInt32(closed, 0)
+		job := testJob("cbz")
+		job.chapterIDs = []string{"a", "b", "c", "d"}
+		job.chapterWorkers = chapterWorkers
+		job.continueOnError = true
+
+		w := &pageWriter{}
+		pages, err := addPages(context.Background(), job, w)
+		var skipped skippedChapters
+		if !errors.As(err, &skipped) || len(skipped) != 2 {
+			t.Fatalf("chapter workers %d: expected 2 skipped chapters, got %v", chapterWorkers, err)
+		}
+		if skipped[0].Error() != "comic 1128 chapter b: chapter missing" || skipped[1].Error() != "comic 1128 chapter c page 1: no such image" {
+			t.Errorf("chapter workers %d: unexpected failures: %v", chapterWorkers, []error(skipped))
+		}
+		if got := strings.Join(w.pages, ","); pages != 4 || got != "a/1,a/2,d/1,d/2" {
+			t.Errorf("chapter workers %d: expected the other chapters written, got %d pages: %s", chapterWorkers, pages, got)
+		}
+		if *closed != 3 {
+			t.Errorf("chapter workers %d: expected the opened chapters closed, got %d", chapterWorkers, *closed)
+		}
+	}
+}
+
+func TestAddPagesReportsPartlyWrittenChapters(t *testing.T) {
+	origOpen, origTabs := openChapters, openChapterTabs
+	t.Cleanup(func() { openChapters, openChapterTabs = origOpen, origTabs })
+	closed := new(int32)
+	open := func(ctx context.Context, comicID string, chapterIDs []string, workers int) (downloader.ChapterOpener, error) {
+		return func(i int) (downloader.PageSource, error) {
+			if chapterIDs[i] == "b" {
+				return &failingChapter{gatedChapter: gatedChapter{id: "b", pages: []string{"1", "2", "3"}, closed: closed}, kept: 2}, nil
+			}
+			return &gatedChapter{id: chapterIDs[i], pages: []string{"1", "2"}, closed: closed}, nil
+		}, nil
+	}
+	openChapters, openChapterTabs = open, open
+
+	for _, chapterWorkers := range []int{1, 3} {
+		job := testJob("cbz")
+		job.chapterIDs = []string{"a", "b", "c"}
+		job.chapterWorkers = chapterWorkers
+		job.continueOnError = true
+
+		w := &pageWriter{}
+		pages, err := addPages(context.Background(), job, w)
+		var skipped skippedChapters
+		if !errors.As(err, &skipped) || len(skipped) != 1 || skipped.partial() != 1 {
+			t.Fatalf("chapter workers %d: expected a partly written chapter, got %v", chapterWorkers, err)
+		}
+		if got := skipped[0].Error(); got != "comic 1128 chapter b page 3: no such image (kept 2 of 3 pages)" {
+			t.Errorf("chapter workers %d: unexpected failure: %s", chapterWorkers, got)
+		}
+		if got := strings.Join(w.pages, ","); pages != 6 || got != "a/1,a/2,b/1,b/2,c/1,c/2" {
+			t.Errorf("chapter workers %d: expected the kept pages written, got %d pages: %s", chapterWorkers, pages, got)
+		}
+
+		var out strings.Builder
+		reportSkipped(&out, job, skipped)
+		if got := out.String(); got != "Kept part of 1 of 3 chapters:\n  comic 1128 chapter b page 3: no such image (kept 2 of 3 pages)\n" {
+			t.Errorf("chapter workers %d: unexpected report: %q", chapterWorkers, got)
+		}
+	}
+}
+
+func TestFitChapterWorkers(t *testing.T) {
+	job := testJob("cbz")
+	job.chapterIDs = []string{"a", "b", "c"}
+	job.chapterWorkers = 4
+	job.maxInflight = 8
+	if n := job.fitChapterWorkers(); n != 3 {
+		t.Errorf("expected a worker per chapter, got %d", n)
+	}
+	job.maxInflight = 2
+	if n := job.fitChapterWorkers(); n != 2 {
+		t.Errorf("expected a worker per in-flight page, got %d", n)
+	}
+	job.maxInflight = 8
+
+	job.info.Chapters = []info.Chapter{{ID: "a", PageCount: 30}, {ID: "b", PageCount: 12}, {ID: "c", PageCount: 3}}
+	if n := job.fitChapterWorkers(); n != 2 {
+		t.Errorf("expected a worker per 20 known pages, got %d", n)
+	}
+	job.info.Chapters[0].PageCount = 5
+	if n := job.fitChapterWorkers(); n != 1 {
+		t.Errorf("expected a single worker for 20 pages, got %d", n)
+	}
+
+	job.chapterIDs = []string{"a"}
+	job.info.Chapters = nil
+	if n := job.fitChapterWorkers(); n != 1 {
+		t.Errorf("expected a single worker for one chapter, got %d", n)
+	}
+}
+
+func TestAddPagesDownloadsSingleChapterInCurrentTab(t *testing.T) {
+	stubChapters(t, map[string][]string{"a": {"1", "2"}})
+	stubChapterTabs(t, func(i int, chapterID string) downloader.PageSource {
+		t.Errorf("opened chapter %s in a new tab", chapterID)
+		return &fakeChapter{id: chapterID}
+	})
+	job := testJob("cbz")
+	job.chapterIDs = []string{"a"}
+	job.chapterWorkers = 4
+	w := &pageWriter{}
+	if pages, err := addPages(context.Background(), job, w); err != nil || pages != 2 {
+		t.Fatalf("expected 2 pages, got %d (%v)", pages, err)
+	}
+}
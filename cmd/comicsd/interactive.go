@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"comicsd/internal/archive"
+	"comicsd/internal/info"
+
+	"golang.org/x/term"
+)
+
+// stdinIsTerminal reports whether stdin is a terminal. Defined as a variable for tests.
+var stdinIsTerminal = func() bool {
+	return term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// errNoSelection is returned when the input ends before chapters are picked
+var errNoSelection = errors.New("no chapters selected")
+
+// pickDownload lists the comic's chapters in reading order to w and reads the
+// chapters to download from r, asking again after invalid input. With
+// askFormat it then asks for the archive format, keeping format on an empty
+// answer. It returns the picked chapter IDs, oldest first, and the format.
+func pickDownload(r io.Reader, w io.Writer, ci *info.ComicInfo, format string, askFormat bool) ([]string, string, error) {
+	chapters, _ := ci.ChaptersSince("")
+	if len(chapters) == 0 {
+		return nil, "", fmt.Errorf("comic %s has no chapters", ci.ID)
+	}
+	width := len(strconv.Itoa(len(chapters)))
+	for i, chapter := range chapters {
+		fmt.Fprintf(w, "%*d  %s  %s\n", width, i+1, chapter.ID, chapter.Title)
+	}
+
+	in := bufio.NewScanner(r)
+	var picked []int
+	for picked == nil {
+		fmt.Fprintf(w, "Chapters to download (e.g. 1-3,5 or all): ")
+		if !in.Scan() {
+			fmt.Fprintln(w)
+			return nil, "", errNoSelection
+		}
+		var err error
+		if picked, err = parseSelection(in.Text(), len(chapters)); err != nil {
+			fmt.Fprintln(w, err)
+		}
+	}
+	chapterIDs := make([]string, len(picked))
+	for i, n := range picked {
+		chapterIDs[i] = chapters[n-1].ID
+	}
+
+	for askFormat {
+		fmt.Fprintf(w, "Format (%s) [%s]: ", strings.Join(archive.SupportedFormats(), ", "), format)
+		if !in.Scan() {
+			fmt.Fprintln(w)
+			break
+		}
+		answer := strings.TrimSpace(in.Text())
+		if answer == "" {
+			break
+		}
+		if err := checkFormat(answer); err != nil {
+			fmt.Fprintln(w, err)
+			continue
+		}
+		format = answer
+		break
+	}
+	return chapterIDs, format, nil
+}
+
+// parseSelection parses a comma-separated list of 1-based chapter numbers and
+// ranges ("1-3,5") or "all" into the sorted numbers it selects out of n
+func parseSelection(s string, n int) ([]int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, errors.New("pick at least one chapter")
+	}
+	if strings.EqualFold(s, "all") {
+		all := make([]int, n)
+		for i := range all {
+			all[i] = i + 1
+		}
+		return all, nil
+	}
+
+	var picked []int
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		from, to, isRange := strings.Cut(part, "-")
+		first, err := strconv.Atoi(strings.TrimSpace(from))
+		last := first
+		if err == nil && isRange {
+			last, err = strconv.Atoi(strings.TrimSpace(to))
+		}
+		if err != nil || first < 1 || last < first {
+			return nil, fmt.Errorf("invalid selection %q", part)
+		}
+		if last > n {
+			return nil, fmt.Errorf("selection %q is out of bounds: there are %d chapters", part, n)
+		}
+		for i := first; i <= last; i++ {
+			picked = append(picked, i)
+		}
+	}
+	slices.Sort(picked)
+	return slices.Compact(picked), nil
+}
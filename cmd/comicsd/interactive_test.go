@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"comicsd/internal/info"
+)
+
+func TestParseSelection(t *testing.T) {
+	tests := map[string][]int{
+		"1-3,5":   {1, 2, 3, 5},
+		" 4 , 2 ": {2, 4},
+		"2-3,3-4": {2, 3, 4},
+		"ALL":     {1, 2, 3, 4, 5},
+		"5":       {5},
+	}
+	for s, want := range tests {
+		got, err := parseSelection(s, 5)
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("parseSelection(%q) = %v (%v), want %v", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"", "0", "6", "3-2", "1,x", "2-", "-2"} {
+		if _, err := parseSelection(s, 5); err == nil {
+			t.Errorf("parseSelection(%q) should fail", s)
+		}
+	}
+}
+
+func TestPickDownload(t *testing.T) {
+	// Chapters are listed newest first, as on the site
+	ci := &info.ComicInfo{ID: "1128", Chapters: []info.Chapter{
+		{ID: "300", Title: "第3話"},
+		{ID: "200", Title: "第2話"},
+		{ID: "100", Title: "第1話"},
+	}}
+	var out strings.Builder
+	ids, format, err := pickDownload(strings.NewReader("4\n1,3\nzip\nepub\n"), &out, ci, "cbz", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"100", "300"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("chapters = %v, want %v", ids, want)
+	}
+	if format != "epub" {
+		t.Errorf("format = %q, want epub", format)
+	}
+	for _, want := range []string{"1  100  第1話\n", "3  300  第3話\n", "out of bounds", "invalid format: zip"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestPickDownloadKeepsFormat(t *testing.T) {
+	ci := &info.ComicInfo{ID: "1128", Chapters: []info.Chapter{{ID: "100"}}}
+	_, format, err := pickDownload(strings.NewReader("all\n\n"), &strings.Builder{}, ci, "cbt", true)
+	if err != nil || format != "cbt" {
+		t.Errorf("format = %q (%v), want cbt", format, err)
+	}
+	var out strings.Builder
+	_, format, err = pickDownload(strings.NewReader("1\n"), &out, ci, "epub", false)
+	if err != nil || format != "epub" || strings.Contains(out.String(), "Format") {
+		t.Errorf("format = %q (%v), want epub without asking:\n%s", format, err, out.String())
+	}
+}
+
+func TestPickDownloadNoSelection(t *testing.T) {
+	ci := &info.ComicInfo{ID: "1128", Chapters: []info.Chapter{{ID: "100"}}}
+	if _, _, err := pickDownload(strings.NewReader(""), &strings.Builder{}, ci, "cbz", true); !errors.Is(err, errNoSelection) {
+		t.Errorf("err = %v, want errNoSelection", err)
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// logFile is the file of -log-file the log is copied to, nil without one
+var logFile io.Writer
+
+// openLogFile copies the log, which still goes to stderr, to the file at
+// path. The file is truncated, so it only holds the current run, which it
+// starts with the command line.
+func openLogFile(path string) error {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0777); err != nil {
+			return fmt.Errorf("cannot create log file directory: %w", err)
+		}
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("cannot open log file: %w", err)
+	}
+	logFile = file
+	log.New(file, "", log.LstdFlags).Printf("comicsd %s", strings.Join(os.Args[1:], " "))
+	log.SetOutput(io.MultiWriter(os.Stderr, file))
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// useLogFile opens the log file at path, restoring the log output afterwards
+func useLogFile(t *testing.T, path string) {
+	t.Helper()
+	orig := log.Writer()
+	t.Cleanup(func() {
+		log.SetOutput(orig)
+		logFile = nil
+	})
+	if err := openLogFile(path); err != nil {
+		t.Fatalf("openLogFile failed: %v", err)
+	}
+}
+
+func TestOpenLogFileCopiesLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "download.log")
+	os.WriteFile(path, []byte("previous run\n"), 0644)
+	useLogFile(t, path)
+	log.Print("Skipping the rest of chapter 2/3")
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "previous run") {
+		t.Errorf("log file not truncated:\n%s", data)
+	}
+	for _, want := range []string{"comicsd ", "Skipping the rest of chapter 2/3"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("log file missing %q:\n%s", want, data)
+		}
+	}
+}
+
+func TestProgressBarLogsPagesToLogFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "download.log")
+	useLogFile(t, path)
+	orig := stderrIsTerminal
+	defer func() { stderrIsTerminal = orig }()
+	stderrIsTerminal = func() bool { return true }
+
+	p := newProgress(false)
+	p.chapter(0, 1, 2)
+	p.page(10)
+	p.finish()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "Downloaded page 1/2 of chapter 1/1") {
+		t.Errorf("log file missing the page:\n%s", data)
+	}
+}
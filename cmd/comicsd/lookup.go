@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"comicsd/internal/archive"
+	"comicsd/internal/downloader"
+	"comicsd/internal/info"
+)
+
+// infoOptions select what the info command prints
+type infoOptions struct {
+	format  string
+	plan    bool
+	pages   bool
+	workers int
+	// sort orders the chapters of text and JSON output
+	sort string
+}
+
+// runSearch searches for keyword and prints the results to w as text or JSON
+func runSearch(w io.Writer, fetcher info.Fetcher, keyword, format string) error {
+	results, err := fetcher.SearchComics(keyword)
+	if err != nil {
+		return err
+	}
+	return printResults(w, results, format)
+}
+
+// runLookup skips the search for a known comic ID, printing the comic to w
+// as the only search result
+func runLookup(w io.Writer, fetcher info.Fetcher, comicID, format string) error {
+	log.Printf("Looking up comic %s by ID, not searching", comicID)
+	ci, err := fetcher.GetComicInfo(comicID)
+	if err != nil {
+		return err
+	}
+	result := info.SearchResult{ID: ci.ID, Title: ci.Title, URL: ci.URL(), CoverURL: ci.CoverURL}
+	return printResults(w, []info.SearchResult{result}, format)
+}
+
+// printResults prints search results to w as text or JSON
+func printResults(w io.Writer, results []info.SearchResult, format string) error {
+	if format == "json" {
+		data, _ := json.MarshalIndent(results, "", "  ")
+		fmt.Fprintln(w, string(data))
+		return nil
+	}
+	for _, r := range results {
+		fmt.Fprintf(w, "%s %s\n", r.ID, r.Title)
+	}
+	return nil
+}
+
+// runFormats prints the supported output formats to w as text or JSON
+func runFormats(w io.Writer, format string) {
+	if format == "json" {
+		data, _ := json.MarshalIndent(archive.Formats(), "", "  ")
+		fmt.Fprintln(w, string(data))
+		return
+	}
+	width := 0
+	for _, f := range archive.Formats() {
+		width = max(width, len(f.Name))
+	}
+	for _, f := range archive.Formats() {
+		fmt.Fprintf(w, "%-*s %s\n", width, f.Name, f.Description)
+	}
+}
+
+// printMirrors prints the probed mirrors to w as text or JSON and fails
+// when none is up
+func printMirrors(w io.Writer, statuses []downloader.MirrorStatus, format string) error {
+	up := 0
+	for _, s := range statuses {
+		if s.Up {
+			up++
+		}
+	}
+	if format == "json" {
+		data, _ := json.MarshalIndent(statuses, "", "  ")
+		fmt.Fprintln(w, string(data))
+	} else {
+		for _, s := range statuses {
+			if s.Up {
+				fmt.Fprintf(w, "%-20s up    %s\n", s.Host, s.Latency.Round(time.Millisecond))
+			} else {
+				fmt.Fprintf(w, "%-20s down  %s\n", s.Host, s.Error)
+			}
+		}
+	}
+	if up == 0 {
+		return fmt.Errorf("no mirror is reachable")
+	}
+	return nil
+}
+
+// runInfo fetches a comic and prints it to w as text, JSON or a download plan
+func runInfo(w io.Writer, fetcher info.Fetcher, comicID string, opts infoOptions) error {
+	ci, err := fetcher.GetComicInfo(comicID)
+	if err != nil {
+		return err
+	}
+	if opts.pages {
+		if err := fetcher.FillChapterPageCounts(ci, opts.workers); err != nil {
+			return err
+		}
+	}
+	// The plan always lists chapters in reading order
+	if !opts.plan {
+		if err := ci.SortChapters(opts.sort); err != nil {
+			return err
+		}
+	}
+	if opts.plan {
+		data, _ := json.MarshalIndent(ci.Plan(), "", "  ")
+		fmt.Fprintln(w, string(data))
+	} else if opts.format == "json" {
+		j, _ := ci.ToJSON()
+		fmt.Fprintln(w, j)
+	} else {
+		fmt.Fprint(w, ci.ToPlainText())
+	}
+	return nil
+}
+
+// pickComic searches for keyword and returns the comic it identifies: the only
+// result, the result titled exactly keyword, or with first the top result.
+// Ambiguous results are listed to w.
+func pickComic(w io.Writer, fetcher info.Fetcher, keyword string, first bool) (info.SearchResult, error) {
+	results, err := fetcher.SearchComics(keyword)
+	if err != nil {
+		return info.SearchResult{}, err
+	}
+	if len(results) == 0 {
+		return info.SearchResult{}, fmt.Errorf("no comics found for %q", keyword)
+	}
+	if len(results) == 1 || first {
+		return results[0], nil
+	}
+
+	var exact []info.SearchResult
+	for _, r := range results {
+		if r.Title == keyword {
+			exact = append(exact, r)
+		}
+	}
+	if len(exact) == 1 {
+		return exact[0], nil
+	}
+
+	for _, r := range results {
+		fmt.Fprintf(w, "%s %s\n", r.ID, r.Title)
+	}
+	return info.SearchResult{}, fmt.Errorf("%d comics match %q, refine the keyword, use -first or download by comic ID", len(results), keyword)
+}
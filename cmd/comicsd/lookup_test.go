@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"comicsd/internal/downloader"
+	"comicsd/internal/info"
+	"comicsd/internal/info/infotest"
+)
+
+func lookupFetcher() *infotest.Fetcher {
+	return &infotest.Fetcher{
+		Results: []info.SearchResult{
+			{ID: "1128", Title: "東大特訓班"},
+			{ID: "2250", Title: "東大特訓班2"},
+		},
+		Comics: map[string]*info.ComicInfo{
+			"1128": {
+				ID:    "1128",
+				Title: "東大特訓班",
+				Chapters: []info.Chapter{
+					{ID: "b", Title: "第2話"},
+					{ID: "a", Title: "第1話"},
+				},
+			},
+		},
+		PageCounts: map[string]int{"a": 20, "b": 18},
+	}
+}
+
+func TestRunSearchText(t *testing.T) {
+	var out bytes.Buffer
+	if err := runSearch(&out, lookupFetcher(), "東大", "text"); err != nil {
+		t.Fatalf("runSearch failed: %v", err)
+	}
+	if out.String() != "1128 東大特訓班\n2250 東大特訓班2\n" {
+		t.Errorf("unexpected output: %q", out.String())
+	}
+}
+
+func TestRunSearchJSON(t *testing.T) {
+	var out bytes.Buffer
+	if err := runSearch(&out, lookupFetcher(), "東大", "json"); err != nil {
+		t.Fatalf("runSearch failed: %v", err)
+	}
+	if !strings.Contains(out.String(), `"id": "2250"`) || !strings.HasPrefix(out.String(), "[") {
+		t.Errorf("unexpected output: %s", out.String())
+	}
+}
+
+func TestRunLookupSkipsSearch(t *testing.T) {
+	fetcher := lookupFetcher()
+	fetcher.Results = nil
+	var out bytes.Buffer
+	if err := runLookup(&out, fetcher, "1128", "text"); err != nil {
+		t.Fatalf("runLookup failed: %v", err)
+	}
+	if out.String() != "1128 東大特訓班\n" {
+		t.Errorf("unexpected output: %q", out.String())
+	}
+
+	out.Reset()
+	if err := runLookup(&out, fetcher, "1128", "json"); err != nil {
+		t.Fatalf("runLookup failed: %v", err)
+	}
+	if !strings.Contains(out.String(), `"url": "https://tw.manhuagui.com/comic/1128/"`) || !strings.HasPrefix(out.String(), "[") {
+		t.Errorf("unexpected output: %s", out.String())
+	}
+}
+
+func TestRunInfoFormats(t *testing.T) {
+	tests := []struct {
+		name string
+		opts infoOptions
+		want string
+	}{
+		{"text", infoOptions{format: "text"}, "東大特訓班"},
+		{"text with pages", infoOptions{format: "text", pages: true}, "(20 pages)"},
+		{"json", infoOptions{format: "json"}, `"chapters": [`},
+		{"plan", infoOptions{plan: true}, "\"chapter_ids\": [\n    \"a\",\n    \"b\"\n  ]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := runInfo(&out, lookupFetcher(), "1128", tt.opts); err != nil {
+				t.Fatalf("runInfo failed: %v", err)
+			}
+			if !strings.Contains(out.String(), tt.want) {
+				t.Errorf("output missing %q:\n%s", tt.want, out.String())
+			}
+		})
+	}
+}
+
+func TestRunInfoSortsChapters(t *testing.T) {
+	var out bytes.Buffer
+	if err := runInfo(&out, lookupFetcher(), "1128", infoOptions{format: "json", sort: "asc"}); err != nil {
+		t.Fatalf("runInfo failed: %v", err)
+	}
+	if strings.Index(out.String(), "第1話") > strings.Index(out.String(), "第2話") {
+		t.Errorf("chapters not in ascending order:\n%s", out.String())
+	}
+}
+
+func TestRunInfoUnknownComic(t *testing.T) {
+	var out bytes.Buffer
+	if err := runInfo(&out, lookupFetcher(), "404", infoOptions{}); err == nil {
+		t.Errorf("expected an error for an unknown comic")
+	}
+}
+
+func TestPickComic(t *testing.T) {
+	tests := []struct {
+		name    string
+		keyword string
+		first   bool
+		want    string
+		listed  bool
+	}{
+		{"exact title", "東大特訓班", false, "1128", false},
+		{"first", "東大", true, "1128", false},
+		{"ambiguous", "東大", false, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			got, err := pickComic(&out, lookupFetcher(), tt.keyword, tt.first)
+			if tt.want == "" {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", got)
+				}
+			} else if err != nil || got.ID != tt.want {
+				t.Fatalf("expected %s, got %v (%v)", tt.want, got, err)
+			}
+			if listed := out.Len() > 0; listed != tt.listed {
+				t.Errorf("unexpected listing: %q", out.String())
+			}
+		})
+	}
+}
+
+func TestPickComicSingleResult(t *testing.T) {
+	fetcher := &infotest.Fetcher{Results: []info.SearchResult{{ID: "2250", Title: "東大特訓班2"}}}
+	got, err := pickComic(&bytes.Buffer{}, fetcher, "特訓", false)
+	if err != nil || got.ID != "2250" {
+		t.Errorf("expected 2250, got %v (%v)", got, err)
+	}
+	if _, err := pickComic(&bytes.Buffer{}, &infotest.Fetcher{}, "none", false); err == nil {
+		t.Errorf("expected an error without results")
+	}
+}
+
+func TestRunFormats(t *testing.T) {
+	var out bytes.Buffer
+	runFormats(&out, "text")
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 5 || !strings.HasPrefix(lines[0], "cbz   ") || !strings.HasPrefix(lines[2], "epub  ") || !strings.HasPrefix(lines[3], "cbz-series zip") || !strings.HasPrefix(lines[4], "auto  ") {
+		t.Errorf("unexpected formats: %q", out.String())
+	}
+
+	out.Reset()
+	runFormats(&out, "json")
+	if !strings.Contains(out.String(), `"name": "cbt"`) {
+		t.Errorf("unexpected JSON: %s", out.String())
+	}
+}
+
+func TestPrintMirrors(t *testing.T) {
+	statuses := []downloader.MirrorStatus{
+		{Host: "tw.manhuagui.com", Up: true, Latency: 812 * time.Millisecond},
+		{Host: "cn.manhuagui.com", Error: "net::ERR_NAME_NOT_RESOLVED"},
+	}
+	var out bytes.Buffer
+	if err := printMirrors(&out, statuses, "text"); err != nil {
+		t.Fatalf("printMirrors failed: %v", err)
+	}
+	expected := "tw.manhuagui.com     up    812ms\ncn.manhuagui.com     down  net::ERR_NAME_NOT_RESOLVED\n"
+	if out.String() != expected {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+
+	if err := printMirrors(&out, statuses[1:], "json"); err == nil {
+		t.Error("expected an error when every mirror is down")
+	}
+}
@@ -1,26 +1,25 @@
 package main
 
 import (
-	"archive/zip"
-	"bytes"
 	"context"
-	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"strings"
+	"time"
 
+	"comicsd/internal/browser"
+	"comicsd/internal/config"
 	"comicsd/internal/downloader"
-	"comicsd/internal/epub"
 	"comicsd/internal/info"
 	"comicsd/internal/mcp"
-
-	"github.com/chromedp/chromedp"
+	"comicsd/internal/naming"
 )
 
 func main() {
 	if len(os.Args) < 2 {
-		fmt.Println("usage: comicsd <command> [args]\ncommands: search, info, download, mcp")
+		fmt.Println("usage: comicsd <command> [args]\ncommands: search, info, cover, download, download-plan, get, update, dedupe-dir, convert, formats, validate-config, list-mirrors, serve, mcp")
 		os.Exit(1)
 	}
 
@@ -28,81 +27,374 @@ func main() {
 	case "search":
 		searchCmd := flag.NewFlagSet("search", flag.ExitOnError)
 		format := searchCmd.String("format", "text", "output format (text or json)")
-		searchCmd.Parse(os.Args[2:])
+		byID := searchCmd.Bool("id", false, "treat the keyword as a comic ID and look the comic up directly instead of searching")
+		settingsFlags := addSettingsFlags(searchCmd)
+		parseCommand(searchCmd, os.Args[2:])
 		if searchCmd.NArg() < 1 {
-			log.Fatal("keyword required")
+			fatalf("keyword required")
 		}
 		keyword := searchCmd.Arg(0)
-		ctx, cancel := chromedp.NewContext(context.Background(), chromedp.WithLogf(func(string, ...interface{}) {}))
-		defer cancel()
-		fetcher := info.NewComicInfoFetcher(ctx)
-		results, err := fetcher.SearchComics(keyword)
-		if err != nil {
-			log.Fatal(err)
-		}
-		if *format == "json" {
-			data, _ := json.MarshalIndent(results, "", "  ")
-			fmt.Println(string(data))
-		} else {
-			for _, r := range results {
-				fmt.Printf("%s %s\n", r.ID, r.Title)
+		if *byID {
+			current.comicID = keyword
+			if err := downloader.ValidateIDs(keyword); err != nil {
+				fatal(err)
 			}
 		}
+		settings := settingsFlags.load()
+		ctx, cancel := openTab(settings)
+		defer cancel()
+		search := runSearch
+		if *byID {
+			search = runLookup
+		}
+		if err := search(os.Stdout, info.NewComicInfoFetcher(ctx), keyword, *format); err != nil {
+			fatal(err)
+		}
 
 	case "info":
 		infoCmd := flag.NewFlagSet("info", flag.ExitOnError)
 		format := infoCmd.String("format", "text", "output format (text or json)")
-		infoCmd.Parse(os.Args[2:])
+		plan := infoCmd.Bool("plan", false, "print a JSON download plan of every chapter for download-plan")
+		pageCounts := infoCmd.Bool("pages", false, "count the pages of every chapter (loads each chapter, slow)")
+		workers := infoCmd.Int("workers", config.DefaultWorkers, "number of concurrent browser tabs (default from config)")
+		sortOrder := infoCmd.String("sort", info.SortSource, "chapter order: asc (reading order), desc or source (site order, newest first)")
+		settingsFlags := addSettingsFlags(infoCmd)
+		parseCommand(infoCmd, os.Args[2:])
 		if infoCmd.NArg() < 1 {
-			log.Fatal("comic id required")
+			fatalf("comic id required")
 		}
 		comicID := infoCmd.Arg(0)
-		ctx, cancel := chromedp.NewContext(context.Background(), chromedp.WithLogf(func(string, ...interface{}) {}))
+		current.comicID = comicID
+		if err := downloader.ValidateIDs(comicID); err != nil {
+			fatal(err)
+		}
+		settings := settingsFlags.load()
+		if !flagSet(infoCmd, "workers") {
+			*workers = settings.Workers
+		}
+		ctx, cancel := openTab(settings)
 		defer cancel()
-		fetcher := info.NewComicInfoFetcher(ctx)
-		ci, err := fetcher.GetComicInfo(comicID)
-		if err != nil {
-			log.Fatal(err)
+		opts := infoOptions{format: *format, plan: *plan, pages: *pageCounts, workers: *workers, sort: *sortOrder}
+		if err := runInfo(os.Stdout, info.NewComicInfoFetcher(ctx), comicID, opts); err != nil {
+			fatal(err)
 		}
-		if *format == "json" {
-			j, _ := ci.ToJSON()
-			fmt.Println(j)
-		} else {
-			fmt.Print(ci.ToPlainText())
+
+	case "cover":
+		coverCmd := flag.NewFlagSet("cover", flag.ExitOnError)
+		output := coverCmd.String("o", "", "file to write the cover to, - for stdout (default <title>.<ext> in the current directory)")
+		overwrite := coverCmd.Bool("overwrite", false, "replace the output file if it already exists")
+		settingsFlags := addSettingsFlags(coverCmd)
+		parseCommand(coverCmd, os.Args[2:])
+		if coverCmd.NArg() < 1 {
+			fatalf("usage: comicsd cover [-o <file|->] <comic_id>")
+		}
+		current.comicID = coverCmd.Arg(0)
+		if err := downloader.ValidateIDs(coverCmd.Arg(0)); err != nil {
+			fatal(err)
+		}
+		settings := settingsFlags.load()
+		ctx, cancel := openTab(settings)
+		defer cancel()
+		opts := coverOptions{output: config.ExpandPath(*output), overwrite: *overwrite}
+		if err := runCover(ctx, os.Stderr, os.Stdout, info.NewComicInfoFetcher(ctx), coverCmd.Arg(0), opts); err != nil {
+			fatal(err)
 		}
 
 	case "download":
 		dlCmd := flag.NewFlagSet("download", flag.ExitOnError)
-		format := dlCmd.String("format", "cbz", "output format (cbz or epub)")
-		dlCmd.Parse(os.Args[2:])
+		flags := addDownloadFlags(dlCmd)
+		all := dlCmd.Bool("all", false, "download every chapter of the comic, oldest first")
+		since := dlCmd.String("since", "", "with -all, only download chapters newer than this chapter ID")
+		infoFile := dlCmd.String("info-file", "", "take the title and chapters from saved info -format json output instead of the site")
+		interactive := dlCmd.Bool("interactive", false, "pick the chapters and format from the comic's chapter list")
+		parseCommand(dlCmd, os.Args[2:])
 		args := dlCmd.Args()
-		if len(args) < 3 {
-			log.Fatal("usage: comicsd download [-format cbz|epub] <comic_id> <title> <chapter_ids...>")
+		settings, job := flags.resolve(dlCmd)
+		if err := checkFormat(job.format); err != nil {
+			fatal(err)
 		}
-		comicID := args[0]
-		title := args[1]
-		chapterIDs := args[2:]
-		ctx, cancel := chromedp.NewContext(context.Background(), chromedp.WithLogf(func(string, ...interface{}) {}))
+		if *since != "" && !*all {
+			fatalf("-since requires -all")
+		}
+		if *interactive && !stdinIsTerminal() {
+			log.Println("stdin is not a terminal, ignoring -interactive")
+			*interactive = false
+		}
+		if *infoFile != "" {
+			ci, err := readInfoFile(*infoFile)
+			if err != nil {
+				fatal(err)
+			}
+			// The comic ID comes from the file, the arguments only pick the
+			// title and chapters
+			job.info = ci
+			args = append([]string{ci.ID}, args...)
+		}
+		if len(args) > 0 {
+			job.comicID = args[0]
+			job.title, job.chapterIDs = splitTitle(args[1:])
+			if strings.Contains(args[0], "://") {
+				comicID, chapterID, err := downloader.ParseChapterURL(args[0])
+				if err != nil {
+					fatal(err)
+				}
+				job.comicID = comicID
+				job.chapterIDs = append([]string{chapterID}, job.chapterIDs...)
+			}
+			var err error
+			if job.chapterIDs, job.pageRanges, err = parseChapterArgs(job.chapterIDs); err != nil {
+				fatal(err)
+			}
+		}
+		if *interactive && (*all || len(job.chapterIDs) > 0) {
+			fatalf("-interactive cannot be combined with -all or chapter IDs")
+		}
+		if job.comicID == "" || !*interactive && *all == (len(job.chapterIDs) > 0) {
+			fatalf("usage: comicsd download [-format cbz|cbt|epub] <comic_id> [title] <chapter_id[:pages]...>\n       comicsd download [-format cbz|cbt|epub] <chapter_url> [title] [chapter_ids...]\n       comicsd download [-format cbz|cbt|epub] -all [-since <chapter_id>] <comic_id> [title]\n       comicsd download [-format cbz|cbt|epub] -info-file <info.json> [-all] [title] [chapter_ids...]\n       comicsd download -interactive <comic_id> [title]")
+		}
+		current.comicID = job.comicID
+		if err := downloader.ValidateIDs(job.comicID, job.chapterIDs...); err != nil {
+			fatal(err)
+		}
+		if job.info != nil {
+			if err := checkChapters(job.info, job.chapterIDs); err != nil {
+				fatal(err)
+			}
+		}
+		ctx, cancel := openTab(settings)
 		defer cancel()
-		file, err := os.Create(fmt.Sprintf("%s.%s", title, *format))
+		if (*all || *interactive || job.title == "") && job.info == nil {
+			ci, err := info.NewComicInfoFetcher(ctx).GetComicInfo(job.comicID)
+			if err != nil {
+				fatal(err)
+			}
+			job.info = ci
+		}
+		if *interactive {
+			var err error
+			job.chapterIDs, job.format, err = pickDownload(os.Stdin, job.messages(), job.info, job.format, !flagSet(dlCmd, "format"))
+			if err != nil {
+				fatal(err)
+			}
+		}
+		if job.title == "" {
+			job.title = defaultTitle(job.info, job.chapterIDs)
+			if job.title == "" {
+				fatalf("could not determine the comic title, pass one after the comic ID")
+			}
+		}
+		if *all {
+			chapters, err := job.info.ChaptersSince(*since)
+			if err != nil {
+				fatal(err)
+			}
+			if len(chapters) == 0 {
+				fmt.Fprintf(job.messages(), "no new chapters since %s\n", *since)
+				return
+			}
+			job.chapterIDs = make([]string, 0, len(chapters))
+			for _, chapter := range chapters {
+				job.chapterIDs = append(job.chapterIDs, chapter.ID)
+			}
+		}
+		if err := runDownload(ctx, job); err != nil {
+			fatal(err)
+		}
+
+	case "download-plan":
+		planCmd := flag.NewFlagSet("download-plan", flag.ExitOnError)
+		flags := addDownloadFlags(planCmd)
+		parseCommand(planCmd, os.Args[2:])
+		if planCmd.NArg() < 1 {
+			fatalf("usage: comicsd download-plan [flags] <plan.json|->")
+		}
+		plan, err := readPlan(planCmd.Arg(0))
+		if err != nil {
+			fatal(err)
+		}
+		settings, job := flags.resolve(planCmd)
+		if plan.Format != "" && !flagSet(planCmd, "format") {
+			job.format = plan.Format
+		}
+		if err := checkFormat(job.format); err != nil {
+			fatal(err)
+		}
+		job.comicID = plan.ComicID
+		job.title = plan.Title
+		job.chapterIDs = plan.ChapterIDs
+		current.comicID = job.comicID
+		ctx, cancel := openTab(settings)
+		defer cancel()
+		if err := runDownload(ctx, job); err != nil {
+			fatal(err)
+		}
+
+	case "get":
+		getCmd := flag.NewFlagSet("get", flag.ExitOnError)
+		flags := addDownloadFlags(getCmd)
+		first := getCmd.Bool("first", false, "download the top search result when several comics match")
+		since := getCmd.String("since", "", "only download chapters newer than this chapter ID")
+		parseCommand(getCmd, os.Args[2:])
+		if getCmd.NArg() < 1 {
+			fatalf("usage: comicsd get [-first] [-format cbz|cbt|epub] [-since <chapter_id>] <keyword> [chapter_id[:pages]...]")
+		}
+		settings, job := flags.resolve(getCmd)
+		if err := checkFormat(job.format); err != nil {
+			fatal(err)
+		}
+		var err error
+		if job.chapterIDs, job.pageRanges, err = parseChapterArgs(getCmd.Args()[1:]); err != nil {
+			fatal(err)
+		}
+		if *since != "" && len(job.chapterIDs) > 0 {
+			fatalf("-since cannot be combined with chapter IDs")
+		}
+		ctx, cancel := openTab(settings)
+		defer cancel()
+		fetcher := info.NewComicInfoFetcher(ctx)
+		result, err := pickComic(job.messages(), fetcher, getCmd.Arg(0), *first)
 		if err != nil {
-			log.Fatal(err)
+			fatal(err)
 		}
-		defer file.Close()
-		if *format == "cbz" {
-			if err := downloadToCBZ(ctx, comicID, chapterIDs, file); err != nil {
-				log.Fatal(err)
+		job.comicID = result.ID
+		current.comicID = job.comicID
+		if err := downloader.ValidateIDs(job.comicID, job.chapterIDs...); err != nil {
+			fatal(err)
+		}
+		job.info, err = fetcher.GetComicInfo(job.comicID)
+		if err != nil {
+			fatal(err)
+		}
+		job.title = naming.Sanitize(job.info.Title)
+		if job.title == "" {
+			job.title = naming.Sanitize(result.Title)
+		}
+		if len(job.chapterIDs) == 0 {
+			chapters, err := job.info.ChaptersSince(*since)
+			if err != nil {
+				fatal(err)
+			}
+			if len(chapters) == 0 {
+				fmt.Fprintf(job.messages(), "no new chapters since %s\n", *since)
+				return
 			}
-		} else {
-			if err := downloadToEPUB(ctx, title, comicID, chapterIDs, file); err != nil {
-				log.Fatal(err)
+			for _, chapter := range chapters {
+				job.chapterIDs = append(job.chapterIDs, chapter.ID)
 			}
 		}
+		fmt.Fprintf(job.messages(), "Downloading %s (%s)\n", job.info.Title, job.comicID)
+		if err := runDownload(ctx, job); err != nil {
+			fatal(err)
+		}
+
+	case "update":
+		updateCmd := flag.NewFlagSet("update", flag.ExitOnError)
+		flags := addDownloadFlags(updateCmd)
+		cacheDir := updateCmd.String("cache-dir", info.DefaultCacheDir(), "directory remembering the chapters of updated comics")
+		parseCommand(updateCmd, os.Args[2:])
+		if updateCmd.NArg() != 1 {
+			fatalf("usage: comicsd update [-format cbz|cbt|epub] [-cache-dir <dir>] <comic_id>")
+		}
+		settings, job := flags.resolve(updateCmd)
+		if err := checkFormat(job.format); err != nil {
+			fatal(err)
+		}
+		job.comicID = updateCmd.Arg(0)
+		current.comicID = job.comicID
+		if err := downloader.ValidateIDs(job.comicID); err != nil {
+			fatal(err)
+		}
+		ctx, cancel := openTab(settings)
+		defer cancel()
+		if err := runUpdate(ctx, job.messages(), info.NewComicInfoFetcher(ctx), config.ExpandPath(*cacheDir), job); err != nil {
+			fatal(err)
+		}
+
+	case "dedupe-dir":
+		dedupeCmd := flag.NewFlagSet("dedupe-dir", flag.ExitOnError)
+		remove := dedupeCmd.Bool("remove", false, "remove the duplicates, keeping the first file of each group")
+		yes := dedupeCmd.Bool("yes", false, "with -remove, do not ask for confirmation")
+		parseCommand(dedupeCmd, os.Args[2:])
+		if dedupeCmd.NArg() != 1 {
+			fatalf("usage: comicsd dedupe-dir [-remove [-yes]] <dir>")
+		}
+		if err := runDedupeDir(os.Stdin, os.Stdout, dedupeCmd.Arg(0), *remove, *yes); err != nil {
+			fatal(err)
+		}
+
+	case "convert":
+		convertCmd := flag.NewFlagSet("convert", flag.ExitOnError)
+		format := convertCmd.String("format", "", "format to write: cbz, cbt or epub (default epub, or cbz for an EPUB)")
+		output := convertCmd.String("o", "", "file to write (default the input's name with the format's extension)")
+		overwrite := convertCmd.Bool("overwrite", false, "replace the output file if it already exists")
+		parseCommand(convertCmd, os.Args[2:])
+		if convertCmd.NArg() != 1 {
+			fatalf("usage: comicsd convert [-format cbz|cbt|epub] [-o file] [-overwrite] <archive>")
+		}
+		if err := runConvert(os.Stdout, convertCmd.Arg(0), config.ExpandPath(*output), *format, *overwrite); err != nil {
+			fatal(err)
+		}
+
+	case "formats":
+		formatsCmd := flag.NewFlagSet("formats", flag.ExitOnError)
+		format := formatsCmd.String("format", "text", "output format (text or json)")
+		parseCommand(formatsCmd, os.Args[2:])
+		runFormats(os.Stdout, *format)
+
+	case "validate-config":
+		validateCmd := flag.NewFlagSet("validate-config", flag.ExitOnError)
+		online := validateCmd.Bool("online", false, "also check that every comic and chapter exists on the site")
+		settingsFlags := addSettingsFlags(validateCmd)
+		parseCommand(validateCmd, os.Args[2:])
+		path := "summarize.toml"
+		if validateCmd.NArg() > 0 {
+			path = validateCmd.Arg(0)
+		}
+		var fetcher info.Fetcher
+		if *online {
+			ctx, cancel := openTab(settingsFlags.load())
+			defer cancel()
+			fetcher = info.NewComicInfoFetcher(ctx)
+		}
+		if err := runValidateConfig(os.Stdout, path, fetcher); err != nil {
+			fatal(err)
+		}
+
+	case "list-mirrors":
+		mirrorsCmd := flag.NewFlagSet("list-mirrors", flag.ExitOnError)
+		format := mirrorsCmd.String("format", "text", "output format (text or json)")
+		timeout := mirrorsCmd.Duration("timeout", 15*time.Second, "time allowed for each mirror's home page to load")
+		settingsFlags := addSettingsFlags(mirrorsCmd)
+		parseCommand(mirrorsCmd, os.Args[2:])
+		ctx, cancel := openTab(settingsFlags.load())
+		defer cancel()
+		statuses, err := downloader.ProbeMirrors(ctx, downloader.Mirrors, *timeout)
+		if err != nil {
+			fatal(err)
+		}
+		if err := printMirrors(os.Stdout, statuses, *format); err != nil {
+			fatal(err)
+		}
+
+	case "serve":
+		serveCmd := flag.NewFlagSet("serve", flag.ExitOnError)
+		addr := serveCmd.String("addr", ":8080", "address to listen on")
+		timeout := serveCmd.Duration("timeout", time.Minute, "timeout of search and info requests")
+		downloadTimeout := serveCmd.Duration("download-timeout", 30*time.Minute, "timeout of download requests")
+		settingsFlags := addSettingsFlags(serveCmd)
+		parseCommand(serveCmd, os.Args[2:])
+		settings := settingsFlags.load()
+		if err := serve(settings, *addr, *timeout, *downloadTimeout); err != nil {
+			fatal(err)
+		}
 
 	case "mcp":
-		server := mcp.NewMCPServer()
+		mcpCmd := flag.NewFlagSet("mcp", flag.ExitOnError)
+		settingsFlags := addSettingsFlags(mcpCmd)
+		parseCommand(mcpCmd, os.Args[2:])
+		server := mcp.NewMCPServer(settingsFlags.load())
 		if err := server.Serve(); err != nil {
-			log.Fatal(err)
+			fatal(err)
 		}
 
 	default:
@@ -111,49 +403,91 @@ func main() {
 	}
 }
 
-func downloadToCBZ(ctx context.Context, comicID string, chapters []string, file *os.File) error {
-	cbz := zip.NewWriter(file)
-	defer cbz.Close()
-	page := 0
-	for _, chapterID := range chapters {
-		cc, err := downloader.NewDownload(ctx, comicID, chapterID)
-		if err != nil {
-			return err
-		}
-		for _, p := range cc.Pages {
-			w, err := cbz.Create(fmt.Sprintf("%d.jpg", page))
-			if err != nil {
-				return err
-			}
-			if err := cc.DownloadPageTo(p, w); err != nil {
-				return err
-			}
-			page++
-		}
+// settingsFlags are the flags of every command that loads the settings
+type settingsFlags struct {
+	configPath *string
+	container  *bool
+	jsonErrors *bool
+	strictInfo *bool
+	logFile    *string
+}
+
+func addSettingsFlags(fs *flag.FlagSet) *settingsFlags {
+	return &settingsFlags{
+		configPath: fs.String("config", config.DefaultPath(), "path to the config file"),
+		container:  fs.Bool("container", false, "launch Chrome with --no-sandbox and the other flags needed in Docker and CI"),
+		jsonErrors: fs.Bool("json-errors", false, `print a failure as a JSON object {"error", "command", "comic_id"} on stderr (implied by -format json)`),
+		strictInfo: fs.Bool("strict-info", false, "fail when any field of a comic's page is missing, not only its title or chapters"),
+		logFile:    fs.String("log-file", "", "also write the log (chapters, pages, retries and errors) to this file, replacing it"),
 	}
-	return nil
 }
 
-func downloadToEPUB(ctx context.Context, title, comicID string, chapters []string, file *os.File) error {
-	writer := epub.NewEPUBWriter(file, title)
-	defer writer.Close()
-	page := 0
-	for _, chapterID := range chapters {
-		cc, err := downloader.NewDownload(ctx, comicID, chapterID)
-		if err != nil {
-			return err
-		}
-		for _, p := range cc.Pages {
-			var buf bytes.Buffer
-			if err := cc.DownloadPageTo(p, &buf); err != nil {
-				return err
-			}
-			fname := fmt.Sprintf("%d.jpg", page)
-			if err := writer.AddPage(fname, buf.Bytes()); err != nil {
-				return err
-			}
-			page++
+// load loads the settings, applying -container and -strict-info, and opens
+// the -log-file
+func (f *settingsFlags) load() *config.Settings {
+	if *f.logFile != "" {
+		if err := openLogFile(config.ExpandPath(*f.logFile)); err != nil {
+			fatal(err)
 		}
 	}
-	return nil
+	settings := loadSettings(*f.configPath)
+	if *f.container {
+		settings.Container = true
+	}
+	if *f.strictInfo {
+		settings.StrictInfo = true
+	}
+	info.Strict = settings.StrictInfo
+	return settings
+}
+
+// loadSettings loads the config file and environment, applying the options
+// that are global to the downloader
+func loadSettings(path string) *config.Settings {
+	settings, err := config.Load(path)
+	if err != nil {
+		fatal(err)
+	}
+	if settings.BlockResources {
+		downloader.BlockedURLs = downloader.DefaultBlockedURLs
+	}
+	downloader.SkipReload = settings.SkipReload
+	downloader.StaleRetries = settings.StaleRetries
+	downloader.SortPages = settings.SortPages
+	if downloader.Wait, err = downloader.ParseWaitStrategy(settings.WaitStrategy); err != nil {
+		fatal(err)
+	}
+	downloader.ImageSelectors = downloader.ParseImageSelectors(settings.ImageSelectors)
+	downloader.ImageWait = settings.ImageWait
+	downloader.ChapterDelay = settings.ChapterDelay
+	downloader.Jitter = settings.Jitter
+	downloader.MinPageBytes = settings.MinPageBytes
+	downloader.MinPageSize = settings.MinPageSize
+	downloader.SetMaxBPS(settings.MaxBPS)
+	return settings
+}
+
+// openTab launches a browser for a one-shot command and returns a tab in it
+func openTab(settings *config.Settings) (context.Context, func()) {
+	pool := browser.NewPool(context.Background(), settings, 1)
+	ctx, release, err := pool.Acquire(context.Background())
+	if err != nil {
+		pool.Close()
+		fatal(err)
+	}
+	return ctx, func() {
+		release()
+		pool.Close()
+	}
+}
+
+// flagSet reports whether the named flag was given on the command line
+func flagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
 }
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// manifestEntry describes one page of a CBZ or CBT in its pages.json manifest
+type manifestEntry struct {
+	Name      string `json:"name"`
+	ChapterID string `json:"chapter_id"`
+	PageID    string `json:"page_id"`
+	Format    string `json:"format"`
+	Size      int64  `json:"size"`
+}
+
+// imageFormat returns the detected image format of data, such as "jpeg" or
+// "webp", or the content type when it is not an image
+func imageFormat(data []byte) string {
+	contentType := http.DetectContentType(data)
+	if strings.HasPrefix(contentType, "image/") {
+		return strings.TrimPrefix(contentType, "image/")
+	}
+	return contentType
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"comicsd/internal/epub"
+	"comicsd/internal/info"
+)
+
+// sidecarPaths returns the OPF sidecar and cover image written next to the
+// archive at path, named like it so Calibre imports them as one book
+func sidecarPaths(path string, cover []byte) (opf, coverPath string) {
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	return base + ".opf", base + imageExt(cover)
+}
+
+// comicSidecar describes the comic of an archive named title
+func comicSidecar(ci *info.ComicInfo, title, cover string) epub.Sidecar {
+	tags := []string{"Manga"}
+	if ci.Completed != nil {
+		if *ci.Completed {
+			tags = append(tags, "Completed")
+		} else {
+			tags = append(tags, "Ongoing")
+		}
+	}
+	var authors []string
+	if ci.Author != "" {
+		authors = []string{ci.Author}
+	}
+	return epub.Sidecar{
+		Title:       title,
+		Authors:     authors,
+		Series:      ci.Title,
+		Description: ci.Description,
+		Source:      ci.URL(),
+		Year:        ci.Year,
+		Tags:        tags,
+		Cover:       cover,
+	}
+}
+
+// writeSidecar writes the Calibre OPF sidecar of the archive at path, and the
+// cover image it references when there is one
+func writeSidecar(path string, ci *info.ComicInfo, title string, cover []byte) error {
+	opfPath, coverPath := sidecarPaths(path, cover)
+	var coverName string
+	if cover != nil {
+		if err := os.WriteFile(coverPath, cover, 0644); err != nil {
+			return err
+		}
+		coverName = filepath.Base(coverPath)
+	}
+	return os.WriteFile(opfPath, comicSidecar(ci, title, coverName).OPF(), 0644)
+}
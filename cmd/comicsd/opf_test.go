@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"comicsd/internal/info"
+)
+
+func TestWriteSidecar(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "東大特訓班.cbz")
+	completed := true
+	ci := &info.ComicInfo{ID: "1128", Title: "東大特訓班", Author: "三田紀房", Completed: &completed}
+
+	if err := writeSidecar(path, ci, "東大特訓班", append(pngHeader, 0)); err != nil {
+		t.Fatalf("writeSidecar failed: %v", err)
+	}
+	opf, err := os.ReadFile(filepath.Join(dir, "東大特訓班.opf"))
+	if err != nil {
+		t.Fatalf("read OPF: %v", err)
+	}
+	for _, want := range []string{"<dc:subject>Completed</dc:subject>", `href="東大特訓班.png"`, "https://tw.manhuagui.com/comic/1128/"} {
+		if !strings.Contains(string(opf), want) {
+			t.Errorf("OPF missing %s:\n%s", want, opf)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "東大特訓班.png")); err != nil {
+		t.Errorf("expected the cover next to the OPF: %v", err)
+	}
+}
+
+func TestWriteSidecarWithoutCover(t *testing.T) {
+	dir := t.TempDir()
+	if err := writeSidecar(filepath.Join(dir, "t.epub"), &info.ComicInfo{ID: "1", Title: "t"}, "t", nil); err != nil {
+		t.Fatalf("writeSidecar failed: %v", err)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 || entries[0].Name() != "t.opf" {
+		t.Errorf("expected only t.opf, got %v", entries)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// pageRange selects the pages first to last (1-based, inclusive) of a chapter.
+// A last of zero runs to the end; the zero value selects every page.
+type pageRange struct {
+	first, last int
+}
+
+// String formats the range as accepted by parsePageRange
+func (r pageRange) String() string {
+	if r.last == 0 {
+		return fmt.Sprintf("%d-", r.first)
+	}
+	return fmt.Sprintf("%d-%d", r.first, r.last)
+}
+
+// parsePageRange parses "10-25", "10-" (to the last page) or "10"
+func parsePageRange(s string) (pageRange, error) {
+	from, to, isRange := strings.Cut(s, "-")
+	first, err := strconv.Atoi(from)
+	if err != nil || first < 1 {
+		return pageRange{}, fmt.Errorf("invalid page range %q: pages are numbered from 1", s)
+	}
+	r := pageRange{first: first, last: first}
+	if isRange {
+		r.last = 0
+		if to != "" {
+			if r.last, err = strconv.Atoi(to); err != nil || r.last < first {
+				return pageRange{}, fmt.Errorf("invalid page range %q", s)
+			}
+		}
+	}
+	return r, nil
+}
+
+// apply returns the pages of the range, failing when it reaches past the chapter
+func (r pageRange) apply(pages []string) ([]string, error) {
+	if r == (pageRange{}) {
+		return pages, nil
+	}
+	last := r.last
+	if last == 0 {
+		last = len(pages)
+	}
+	if r.first > len(pages) || last > len(pages) {
+		return nil, fmt.Errorf("page range %s is out of bounds: the chapter has %d pages", r, len(pages))
+	}
+	return pages[r.first-1 : last], nil
+}
+
+// isChapterArg reports whether arg is a chapter ID, optionally with a page range
+func isChapterArg(arg string) bool {
+	id, _, _ := strings.Cut(arg, ":")
+	return isNumeric(id)
+}
+
+// parseChapterArgs splits "<chapter_id>[:<pages>]" arguments into chapter IDs
+// and their page ranges. The ranges are nil when no argument has one.
+func parseChapterArgs(args []string) ([]string, []pageRange, error) {
+	ids := make([]string, len(args))
+	var ranges []pageRange
+	for i, arg := range args {
+		id, spec, found := strings.Cut(arg, ":")
+		ids[i] = id
+		if !found {
+			continue
+		}
+		r, err := parsePageRange(spec)
+		if err != nil {
+			return nil, nil, fmt.Errorf("chapter %s: %w", id, err)
+		}
+		if ranges == nil {
+			ranges = make([]pageRange, len(args))
+		}
+		ranges[i] = r
+	}
+	return ids, ranges, nil
+}
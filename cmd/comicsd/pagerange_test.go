@@ -0,0 +1,70 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePageRange(t *testing.T) {
+	tests := map[string]pageRange{
+		"10-25": {10, 25},
+		"10-":   {10, 0},
+		"7":     {7, 7},
+	}
+	for s, want := range tests {
+		got, err := parsePageRange(s)
+		if err != nil || got != want {
+			t.Errorf("parsePageRange(%q) = %v (%v), want %v", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"", "0-3", "5-2", "a-b", "3-x", "-4"} {
+		if _, err := parsePageRange(s); err == nil {
+			t.Errorf("parsePageRange(%q) should fail", s)
+		}
+	}
+}
+
+func TestPageRangeApply(t *testing.T) {
+	pages := []string{"1", "2", "3", "4", "5"}
+	tests := []struct {
+		r    pageRange
+		want string
+	}{
+		{pageRange{}, "1,2,3,4,5"},
+		{pageRange{2, 4}, "2,3,4"},
+		{pageRange{4, 0}, "4,5"},
+		{pageRange{5, 5}, "5"},
+	}
+	for _, tt := range tests {
+		got, err := tt.r.apply(pages)
+		if err != nil || strings.Join(got, ",") != tt.want {
+			t.Errorf("%v.apply = %v (%v), want %s", tt.r, got, err, tt.want)
+		}
+	}
+	for _, r := range []pageRange{{6, 0}, {3, 6}} {
+		if _, err := r.apply(pages); err == nil {
+			t.Errorf("%v.apply should fail for 5 pages", r)
+		}
+	}
+}
+
+func TestParseChapterArgs(t *testing.T) {
+	ids, ranges, err := parseChapterArgs([]string{"566271", "566272:10-25"})
+	if err != nil {
+		t.Fatalf("parseChapterArgs failed: %v", err)
+	}
+	if !reflect.DeepEqual(ids, []string{"566271", "566272"}) {
+		t.Errorf("unexpected IDs: %v", ids)
+	}
+	if !reflect.DeepEqual(ranges, []pageRange{{}, {10, 25}}) {
+		t.Errorf("unexpected ranges: %v", ranges)
+	}
+
+	if _, ranges, _ := parseChapterArgs([]string{"1", "2"}); ranges != nil {
+		t.Errorf("expected no ranges, got %v", ranges)
+	}
+	if _, _, err := parseChapterArgs([]string{"1:0"}); err == nil {
+		t.Errorf("expected an error for page 0")
+	}
+}
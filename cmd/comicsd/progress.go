@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"comicsd/internal/downloader"
+
+	"golang.org/x/term"
+)
+
+// progress follows the pages of a download as they are written
+type progress interface {
+	// chapter starts the i-th (from zero) of n chapters, which has pages pages
+	chapter(i, n, pages int)
+	// page records a written page of size bytes
+	page(size int64)
+	// finish ends the report once the download stops
+	finish()
+}
+
+// stderrIsTerminal reports whether stderr is a terminal. Defined as a variable for tests.
+var stderrIsTerminal = func() bool {
+	return term.IsTerminal(int(os.Stderr.Fd()))
+}
+
+// newProgress returns a progress bar on stderr when it is a terminal, else
+// one log line per page. The bar still logs the pages to the log file, if any.
+func newProgress(quiet bool) progress {
+	if quiet || !stderrIsTerminal() {
+		return &lineProgress{}
+	}
+	if logFile != nil {
+		return multiProgress{newBarProgress(os.Stderr), &lineProgress{logger: log.New(logFile, "", log.LstdFlags)}}
+	}
+	return newBarProgress(os.Stderr)
+}
+
+// multiProgress reports the progress to each of its progresses
+type multiProgress []progress
+
+func (m multiProgress) chapter(i, n, pages int) {
+	for _, p := range m {
+		p.chapter(i, n, pages)
+	}
+}
+
+func (m multiProgress) page(size int64) {
+	for _, p := range m {
+		p.page(size)
+	}
+}
+
+func (m multiProgress) finish() {
+	for _, p := range m {
+		p.finish()
+	}
+}
+
+// noProgress ignores the download's progress
+type noProgress struct{}
+
+func (noProgress) chapter(i, n, pages int) {}
+func (noProgress) page(size int64)         {}
+func (noProgress) finish()                 {}
+
+// lineProgress logs every page, to logger or else the standard logger
+type lineProgress struct {
+	logger              *log.Logger
+	chapterNo, chapters int
+	done, pages         int
+}
+
+func (p *lineProgress) chapter(i, n, pages int) {
+	p.chapterNo, p.chapters = i+1, n
+	p.done, p.pages = 0, pages
+}
+
+func (p *lineProgress) page(size int64) {
+	p.done++
+	logf := log.Printf
+	if p.logger != nil {
+		logf = p.logger.Printf
+	}
+	logf("Downloaded page %d/%d of chapter %d/%d", p.done, p.pages, p.chapterNo, p.chapters)
+}
+
+func (p *lineProgress) finish() {}
+
+// barWidth is the number of cells of the progress bar
+const barWidth = 20
+
+// barProgress redraws a single line showing the pages of the current chapter
+type barProgress struct {
+	w                   io.Writer
+	start               time.Time
+	now                 func() time.Time
+	chapterNo, chapters int
+	done, pages         int
+	bytes               int64
+	// width is the length of the last line drawn, to clear a longer one
+	width int
+}
+
+func newBarProgress(w io.Writer) *barProgress {
+	return &barProgress{w: w, start: time.Now(), now: time.Now}
+}
+
+func (p *barProgress) chapter(i, n, pages int) {
+	p.chapterNo, p.chapters = i+1, n
+	p.done, p.pages = 0, pages
+	p.draw()
+}
+
+func (p *barProgress) page(size int64) {
+	p.done++
+	p.bytes += size
+	p.draw()
+}
+
+func (p *barProgress) finish() {
+	if p.width > 0 {
+		fmt.Fprintln(p.w)
+	}
+}
+
+func (p *barProgress) draw() {
+	percent := 100
+	if p.pages > 0 {
+		percent = p.done * 100 / p.pages
+	}
+	filled := percent * barWidth / 100
+	line := fmt.Sprintf("Chapter %d/%d [%s%s] %d/%d pages %3d%%",
+		p.chapterNo, p.chapters, strings.Repeat("#", filled), strings.Repeat("-", barWidth-filled),
+		p.done, p.pages, percent)
+	if seconds := p.now().Sub(p.start).Seconds(); seconds > 0 {
+		line += fmt.Sprintf(" %s/s", downloader.FormatBytes(float64(p.bytes)/seconds))
+	}
+	pad := ""
+	if len(line) < p.width {
+		pad = strings.Repeat(" ", p.width-len(line))
+	}
+	p.width = len(line)
+	fmt.Fprintf(p.w, "\r%s%s", line, pad)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBarProgress(t *testing.T) {
+	var out strings.Builder
+	p := newBarProgress(&out)
+	start := p.start
+	p.now = func() time.Time { return start.Add(2 * time.Second) }
+
+	p.chapter(0, 2, 4)
+	p.page(1024)
+	p.page(1024)
+	p.finish()
+
+	lines := strings.Split(out.String(), "\r")
+	last := lines[len(lines)-1]
+	expected := "Chapter 1/2 [##########----------] 2/4 pages  50% 1.0 KiB/s\n"
+	if last != expected {
+		t.Errorf("unexpected last line: %q", last)
+	}
+	if strings.Count(out.String(), "\n") != 1 {
+		t.Errorf("expected a single line, got %q", out.String())
+	}
+}
+
+func TestBarProgressClearsLongerLine(t *testing.T) {
+	var out strings.Builder
+	p := newBarProgress(&out)
+	p.now = func() time.Time { return p.start }
+
+	p.chapter(9, 10, 100)
+	p.chapter(0, 1, 1)
+
+	lines := strings.Split(out.String(), "\r")
+	if len(lines[1]) != len(lines[2]) {
+		t.Errorf("expected the shorter line padded to %d, got %q", len(lines[1]), lines[2])
+	}
+}
+
+func TestNewProgressFallsBackToLines(t *testing.T) {
+	orig := stderrIsTerminal
+	defer func() { stderrIsTerminal = orig }()
+
+	stderrIsTerminal = func() bool { return false }
+	if _, ok := newProgress(false).(*lineProgress); !ok {
+		t.Errorf("expected line logging without a terminal")
+	}
+	stderrIsTerminal = func() bool { return true }
+	if _, ok := newProgress(true).(*lineProgress); !ok {
+		t.Errorf("expected line logging with -quiet")
+	}
+	if _, ok := newProgress(false).(*barProgress); !ok {
+		t.Errorf("expected a progress bar in a terminal")
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// readerPreset bundles the download flags suited to an e-reader or app
+type readerPreset struct {
+	// flags are flag values as given on the command line, by flag name
+	flags map[string]string
+}
+
+// readerPresets are the presets of -reader by name. The pages of the site's
+// manga turn from right to left.
+var readerPresets = map[string]readerPreset{
+	// Send to Kindle and Calibre take EPUB but not WebP. The e-ink screen
+	// shows gray and is 1236 pixels wide on a Paperwhite.
+	"kindle": {flags: map[string]string{
+		"format": "epub", "image-format": "jpeg", "crop-cover": "true",
+		"grayscale": "true", "max-width": "1236", "fixed-layout": "true", "direction": "rtl",
+	}},
+	// Kobo opens EPUB 3, so WebP pages are kept, and color models show them
+	// in color. The Libra 2 is 1264 pixels wide.
+	"kobo": {flags: map[string]string{
+		"format": "epub", "crop-cover": "true",
+		"max-width": "1264", "fixed-layout": "true", "direction": "rtl",
+	}},
+	// KOReader pages through CBZ images without a layout to render
+	"koreader": {flags: map[string]string{"format": "cbz"}},
+	// The local source of Tachiyomi and its forks reads CBZ and ComicInfo.xml
+	"tachiyomi": {flags: map[string]string{"format": "cbz", "metadata": "true"}},
+}
+
+// readerNames returns the preset names in order
+func readerNames() []string {
+	names := make([]string, 0, len(readerPresets))
+	for name := range readerPresets {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// applyReaderPreset sets the flags of the named preset, leaving the flags
+// given on the command line as they are. Preset values count as given, so
+// they also take precedence over the config defaults.
+func applyReaderPreset(fs *flag.FlagSet, name string) error {
+	if name == "" {
+		return nil
+	}
+	preset, ok := readerPresets[strings.ToLower(name)]
+	if !ok {
+		return fmt.Errorf("unknown reader: %s. Use %s", name, strings.Join(readerNames(), ", "))
+	}
+	for flagName, value := range preset.flags {
+		if flagSet(fs, flagName) {
+			continue
+		}
+		if err := fs.Set(flagName, value); err != nil {
+			return fmt.Errorf("reader %s: %w", name, err)
+		}
+	}
+	return nil
+}
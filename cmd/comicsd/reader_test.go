@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"testing"
+)
+
+func TestApplyReaderPreset(t *testing.T) {
+	fs := flag.NewFlagSet("download", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	f := addDownloadFlags(fs)
+	if err := fs.Parse([]string{"-reader", "Kindle", "-image-format", "png"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyReaderPreset(fs, *f.reader); err != nil {
+		t.Fatalf("applyReaderPreset failed: %v", err)
+	}
+	if *f.format != "epub" || !*f.cropCover {
+		t.Errorf("format = %s, crop cover = %v, want the preset's epub and true", *f.format, *f.cropCover)
+	}
+	if *f.imageFormat != "png" {
+		t.Errorf("image format = %s, want the given png", *f.imageFormat)
+	}
+	if !*f.grayscale || *f.maxWidth != 1236 || !*f.fixedLayout || *f.direction != "rtl" {
+		t.Errorf("grayscale = %v, max width = %d, fixed layout = %v, direction = %s, want the kindle transform and layout",
+			*f.grayscale, *f.maxWidth, *f.fixedLayout, *f.direction)
+	}
+	if !flagSet(fs, "format") {
+		t.Error("preset format not taking precedence over the config")
+	}
+
+	if err := applyReaderPreset(fs, "nook"); err == nil {
+		t.Error("expected an error for an unknown reader")
+	}
+	for _, name := range readerNames() {
+		fs := flag.NewFlagSet("download", flag.ContinueOnError)
+		addDownloadFlags(fs)
+		if err := applyReaderPreset(fs, name); err != nil {
+			t.Errorf("preset %s: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+)
+
+// partsManifestName is the manifest file in a -resume parts directory
+const partsManifestName = "manifest.json"
+
+// partsManifest lists the pages kept in a parts directory, along with what
+// their indexes depend on so that another download never reuses them
+type partsManifest struct {
+	ComicID string `json:"comic_id"`
+	// Chapters are the chapter IDs, each followed by its page range if any
+	Chapters   []string `json:"chapters"`
+	TitlePages bool     `json:"title_pages"`
+	// Pages maps page indexes to their files in the directory
+	Pages map[int]string `json:"pages"`
+}
+
+// pageParts keeps the pages of an EPUB download in a directory next to it as
+// they are written. An EPUB cannot be completed in place like a CBZ, so this
+// lets -resume pick up an interrupted download where it stopped.
+type pageParts struct {
+	dir      string
+	manifest partsManifest
+}
+
+// partsDir returns the directory -resume keeps the pages of path in
+func partsDir(path string) string {
+	return path + ".parts"
+}
+
+// jobParts returns the manifest of a fresh parts directory for the job
+func jobParts(job downloadJob) partsManifest {
+	m := partsManifest{ComicID: job.comicID, TitlePages: job.titlePages, Pages: make(map[int]string)}
+	for i, id := range job.chapterIDs {
+		if job.pageRanges != nil {
+			id += ":" + job.pageRanges[i].String()
+		}
+		m.Chapters = append(m.Chapters, id)
+	}
+	return m
+}
+
+// openPageParts opens the parts directory of path for the job and returns it
+// with the pages it already holds by index. A directory left by a different
+// download, or one whose manifest cannot be read, is started over.
+func openPageParts(path string, job downloadJob) (*pageParts, map[int][]byte, error) {
+	p := &pageParts{dir: partsDir(path), manifest: jobParts(job)}
+	data, err := os.ReadFile(filepath.Join(p.dir, partsManifestName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return p, nil, os.MkdirAll(p.dir, 0777)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	var saved partsManifest
+	if err := json.Unmarshal(data, &saved); err != nil {
+		log.Printf("starting over: unreadable %s: %v", filepath.Join(p.dir, partsManifestName), err)
+		return p, nil, p.reset()
+	}
+	if saved.ComicID != p.manifest.ComicID || saved.TitlePages != p.manifest.TitlePages ||
+		!slices.Equal(saved.Chapters, p.manifest.Chapters) {
+		log.Printf("starting over: %s holds the pages of other chapters", p.dir)
+		return p, nil, p.reset()
+	}
+
+	pages := make(map[int][]byte)
+	for index, name := range saved.Pages {
+		data, err := os.ReadFile(filepath.Join(p.dir, name))
+		if err != nil || len(data) == 0 {
+			// Fetched again below
+			continue
+		}
+		pages[index] = data
+		p.manifest.Pages[index] = name
+	}
+	return p, pages, nil
+}
+
+// reset empties the directory
+func (p *pageParts) reset() error {
+	if err := os.RemoveAll(p.dir); err != nil {
+		return err
+	}
+	return os.MkdirAll(p.dir, 0777)
+}
+
+// save stores the page at index and records it in the manifest. The manifest
+// is replaced whole, so an interruption leaves either the old or the new one.
+func (p *pageParts) save(index int, data []byte) error {
+	if _, ok := p.manifest.Pages[index]; ok {
+		return nil
+	}
+	name := strconv.Itoa(index)
+	if err := os.WriteFile(filepath.Join(p.dir, name), data, 0666); err != nil {
+		return err
+	}
+	p.manifest.Pages[index] = name
+	manifest, err := json.Marshal(p.manifest)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(p.dir, partsManifestName+".tmp")
+	if err := os.WriteFile(tmp, manifest, 0666); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(p.dir, partsManifestName))
+}
+
+// remove deletes the directory once the EPUB is complete
+func (p *pageParts) remove() error {
+	return os.RemoveAll(p.dir)
+}
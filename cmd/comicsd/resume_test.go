@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"comicsd/internal/downloader"
+)
+
+func TestResumeReusesPagesOfInterruptedEPUB(t *testing.T) {
+	orig := openChapters
+	t.Cleanup(func() { openChapters = orig })
+	// The first run fails on the last page, the second serves every page
+	// with a prefix telling the fetched pages from the kept ones
+	prefix, fail := "", "b/2"
+	openChapters = func(ctx context.Context, comicID string, chapterIDs []string, workers int) (downloader.ChapterOpener, error) {
+		return func(i int) (downloader.PageSource, error) {
+			id := chapterIDs[i]
+			c := &fakeChapter{id: id, pages: []string{"1", "2"}, prefix: prefix, closed: new(int)}
+			if id+"/2" == fail {
+				c.fail = "2"
+			}
+			return c, nil
+		}, nil
+	}
+
+	job := testJob("epub")
+	job.cover = false
+	job.quiet = true
+	job.resume = true
+	job.outputDir = t.TempDir()
+	path := filepath.Join(job.outputDir, job.fileName())
+	if err := runDownload(context.Background(), job); err == nil {
+		t.Fatal("expected the first run to fail")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("incomplete EPUB written: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(partsDir(path), partsManifestName)); err != nil {
+		t.Fatalf("no manifest kept: %v", err)
+	}
+
+	prefix, fail = "new ", ""
+	if err := runDownload(context.Background(), job); err != nil {
+		t.Fatalf("runDownload failed: %v", err)
+	}
+	_, contents := readZip(t, path)
+	var kept, fetched int
+	for name, data := range contents {
+		if !strings.HasPrefix(name, "OEBPS/images/") {
+			continue
+		}
+		if strings.HasPrefix(data, "new ") {
+			fetched++
+		} else {
+			kept++
+		}
+	}
+	if kept != 3 || fetched != 1 {
+		t.Errorf("kept %d and fetched %d pages, want 3 and 1", kept, fetched)
+	}
+	if _, err := os.Stat(partsDir(path)); !os.IsNotExist(err) {
+		t.Errorf("parts directory left behind: %v", err)
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(job.outputDir, "*.tmp")); len(leftovers) > 0 {
+		t.Errorf("temporary files left behind: %v", leftovers)
+	}
+}
+
+func TestOpenPagePartsStartsOverForOtherChapters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.epub")
+	job := testJob("epub")
+	parts, pages, err := openPageParts(path, job)
+	if err != nil || len(pages) > 0 {
+		t.Fatalf("openPageParts = %v, %v", pages, err)
+	}
+	if err := parts.save(0, []byte("a/1")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, pages, err = openPageParts(path, job); err != nil || string(pages[0]) != "a/1" {
+		t.Errorf("same chapters: pages = %v (%v), want page 0 kept", pages, err)
+	}
+	job.chapterIDs = []string{"a", "c"}
+	if _, pages, err = openPageParts(path, job); err != nil || len(pages) > 0 {
+		t.Errorf("other chapters: pages = %v (%v), want none", pages, err)
+	}
+}
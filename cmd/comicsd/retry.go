@@ -0,0 +1,90 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// readArchivePages returns the non-empty pages of an existing CBZ or CBT by
+// page index, for -retry-failed to keep them
+func readArchivePages(format, file string) (map[int][]byte, error) {
+	pages := make(map[int][]byte)
+	add := func(name string, r io.Reader) error {
+		index, err := strconv.Atoi(strings.TrimSuffix(name, path.Ext(name)))
+		if err != nil || index < 0 {
+			// Not a page, such as the cover or ComicInfo.xml
+			return nil
+		}
+		data, err := io.ReadAll(r)
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			// Cut off by an interrupted download, so fetch it again
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read %s: %w", name, err)
+		}
+		if len(data) > 0 {
+			pages[index] = data
+		}
+		return nil
+	}
+
+	if format != "cbz" && format != "cbt" {
+		return nil, fmt.Errorf("-retry-failed supports cbz and cbt, not %s", format)
+	}
+	if err := walkArchive(format, file, add); err != nil {
+		return nil, err
+	}
+	return pages, nil
+}
+
+// walkArchive calls fn with the name and content of every entry of a CBZ,
+// CBT or EPUB in archive order. A CBT cut off by an interrupted download ends
+// at its last complete entry.
+func walkArchive(format, file string, fn func(name string, r io.Reader) error) error {
+	if format != "cbt" {
+		zr, err := zip.OpenReader(file)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		for _, f := range zr.File {
+			rc, err := f.Open()
+			if err != nil {
+				return fmt.Errorf("open %s: %w", f.Name, err)
+			}
+			err = fn(f.Name, rc)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(hdr.Name, tr); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTestZip writes a CBZ with the given entries in order
+func writeTestZip(t *testing.T, path string, entries [][2]string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for _, e := range entries {
+		w, err := zw.Create(e[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(e[1]))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+}
+
+func TestRetryFailedFetchesOnlyMissingPages(t *testing.T) {
+	stubChapters(t, map[string][]string{"a": {"1", "2"}, "b": {"1"}})
+	job := testJob("cbz")
+	job.outputDir = t.TempDir()
+	job.retryFailed = true
+	path := filepath.Join(job.outputDir, job.fileName())
+	writeTestZip(t, path, [][2]string{{"0.jpg", "kept"}, {"1.jpg", ""}})
+
+	if err := runDownload(context.Background(), job); err != nil {
+		t.Fatalf("runDownload failed: %v", err)
+	}
+
+	names, contents := readZip(t, path)
+	expected := "0000.jpg,0001.jpg,0002.jpg,ComicInfo.xml"
+	if strings.Join(names, ",") != expected {
+		t.Fatalf("unexpected entries: %v", names)
+	}
+	for name, want := range map[string]string{"0000.jpg": "kept", "0001.jpg": "a/2", "0002.jpg": "b/1"} {
+		if contents[name] != want {
+			t.Errorf("%s: expected %q, got %q", name, want, contents[name])
+		}
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(job.outputDir, "*.tmp")); len(leftovers) > 0 {
+		t.Errorf("temporary files left behind: %v", leftovers)
+	}
+}
+
+func TestRetryFailedNeedsExistingArchive(t *testing.T) {
+	stubChapters(t, map[string][]string{"a": {"1"}, "b": {"1"}})
+	job := testJob("cbz")
+	job.outputDir = t.TempDir()
+	job.retryFailed = true
+
+	err := runDownload(context.Background(), job)
+	if err == nil || !strings.Contains(err.Error(), "cannot retry failed pages") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestReadArchivePagesCBT(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "t.cbt")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw := tar.NewWriter(f)
+	for _, e := range [][2]string{{"cover.jpg", "cover"}, {"0.webp", "page"}, {"1.webp", ""}} {
+		tw.WriteHeader(&tar.Header{Name: e[0], Mode: 0644, Size: int64(len(e[1]))})
+		tw.Write([]byte(e[1]))
+	}
+	tw.Close()
+	f.Close()
+
+	pages, err := readArchivePages("cbt", path)
+	if err != nil {
+		t.Fatalf("readArchivePages failed: %v", err)
+	}
+	if len(pages) != 1 || string(pages[0]) != "page" {
+		t.Errorf("unexpected pages: %v", pages)
+	}
+	if _, err := readArchivePages("epub", path); err == nil {
+		t.Error("expected an error for EPUB")
+	}
+}
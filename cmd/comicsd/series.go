@@ -0,0 +1,197 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"comicsd/internal/archive"
+	"comicsd/internal/info"
+	"comicsd/internal/naming"
+)
+
+// seriesArchive writes a ZIP holding a CBZ of each chapter, named and
+// numbered for comic servers, with the series' cover and ComicInfo.xml next
+// to them
+type seriesArchive struct {
+	zip *zip.Writer
+	job downloadJob
+	// chapter is the CBZ of the chapter being written, nil before the first.
+	// It is spooled to chapterFile and stored as chapterName once done, so a
+	// chapter failing part-way can still be marked or left out.
+	chapter     *comicArchive
+	chapterFile *os.File
+	chapterName string
+	pages       int
+	// names are the chapter file names used so far
+	names map[string]bool
+	// cover is written on Close, as a chapter entry may be open when it is set
+	cover     []byte
+	coverName string
+}
+
+func newSeriesArchive(job downloadJob, cover []byte, file io.Writer) *seriesArchive {
+	return &seriesArchive{
+		zip:       zip.NewWriter(file),
+		job:       job,
+		names:     make(map[string]bool),
+		cover:     cover,
+		coverName: "cover.jpg",
+	}
+}
+
+// SetCover stores the series cover, replacing any set before
+func (s *seriesArchive) SetCover(name string, data []byte) error {
+	s.cover, s.coverName = data, name
+	return nil
+}
+
+// startChapter closes the CBZ of the previous chapter and begins the one of
+// the i-th chapter of the job
+func (s *seriesArchive) startChapter(i int) error {
+	if err := s.closeChapter(); err != nil {
+		return err
+	}
+	chapter, number := s.job.seriesChapter(i)
+	kind := "Ch."
+	if number.Volume {
+		kind = "Vol."
+	}
+	name := naming.Sanitize(fmt.Sprintf("%s - %s %s", s.job.title, kind, padChapterNumber(number.String())))
+	if s.names[name] {
+		name = naming.Sanitize(fmt.Sprintf("%s - %s %s (%s)", s.job.title, kind, padChapterNumber(number.String()), chapter.ID))
+	}
+	s.names[name] = true
+	file, err := os.CreateTemp("", "comicsd-chapter-*.cbz")
+	if err != nil {
+		return err
+	}
+	s.chapterFile, s.chapterName = file, name
+	s.chapter = &comicArchive{
+		ComicWriter: &archive.ComicWriter{Archive: zip.NewWriter(file)},
+		job:         s.job,
+		chapterInfo: &chapter,
+		number:      number,
+	}
+	s.pages = 0
+	return nil
+}
+
+func (s *seriesArchive) setOrigin(chapterID, pageID string) {
+	if s.chapter != nil {
+		s.chapter.setOrigin(chapterID, pageID)
+	}
+}
+
+// AddPage stores a page in the CBZ of the current chapter, numbered from 0
+// within the chapter
+func (s *seriesArchive) AddPage(name string, data []byte) error {
+	if s.chapter == nil {
+		return fmt.Errorf("page %s added before its chapter", name)
+	}
+	if err := s.chapter.AddPage(naming.PageEntryName(s.pages, 0, path.Ext(name)), data); err != nil {
+		return err
+	}
+	s.pages++
+	return nil
+}
+
+// failChapter ends the CBZ of the current chapter, which failed after kept
+// of its pages: it is stored marked as incomplete, or left out when it kept
+// none
+func (s *seriesArchive) failChapter(kept int) error {
+	if s.chapter == nil {
+		return nil
+	}
+	if kept == 0 {
+		s.chapterName = ""
+	} else {
+		s.chapterName += " (incomplete)"
+	}
+	return s.closeChapter()
+}
+
+// closeChapter finishes the CBZ of the current chapter, if any, and stores
+// it in the ZIP unless its name was cleared
+func (s *seriesArchive) closeChapter() error {
+	if s.chapter == nil {
+		return nil
+	}
+	file := s.chapterFile
+	defer os.Remove(file.Name())
+	defer file.Close()
+	err := s.chapter.Close()
+	s.chapter = nil
+	if err != nil || s.chapterName == "" {
+		return err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	// Pages are compressed images already
+	w, err := s.zip.CreateHeader(&zip.FileHeader{Name: s.chapterName + ".cbz", Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, file)
+	return err
+}
+
+// Close finishes the last chapter, adds the cover and the series'
+// ComicInfo.xml and closes the ZIP
+func (s *seriesArchive) Close() error {
+	if err := s.closeChapter(); err != nil {
+		return err
+	}
+	if s.cover != nil {
+		if err := writeArchiveEntry(s.zip, s.coverName, s.cover); err != nil {
+			return err
+		}
+	}
+	if s.job.metadata && s.job.info != nil {
+		data, err := s.job.info.ComicRackXML(s.job.title, 0, s.job.chapterIDs...)
+		if err != nil {
+			return err
+		}
+		if err := writeArchiveEntry(s.zip, "ComicInfo.xml", data); err != nil {
+			return err
+		}
+	}
+	return s.zip.Close()
+}
+
+// seriesChapter returns the i-th chapter of the job and its number in the
+// series: the number in its title, such as 12 for "第12話" or volume 3 for
+// "第3卷", else its position in the job counted from 1
+func (job downloadJob) seriesChapter(i int) (info.Chapter, info.ChapterNumber) {
+	chapter, ok := job.chapter(i)
+	if ok {
+		if n, ok := info.ParseChapterNumber(chapter.Title); ok {
+			return chapter, n
+		}
+	}
+	number := info.ChapterNumber{First: float64(i + 1), Last: float64(i + 1)}
+	if !ok {
+		chapter = info.Chapter{ID: job.chapterIDs[i], Title: "Chapter " + number.String()}
+	}
+	return chapter, number
+}
+
+// padChapterNumber pads the whole part of a chapter number, or of both ends
+// of a range, to three digits, so file names sort in reading order
+func padChapterNumber(number string) string {
+	if first, last, isRange := strings.Cut(number, "-"); isRange {
+		return padChapterNumber(first) + "-" + padChapterNumber(last)
+	}
+	whole, fraction, found := strings.Cut(number, ".")
+	if len(whole) < 3 {
+		whole = strings.Repeat("0", 3-len(whole)) + whole
+	}
+	if found {
+		return whole + "." + fraction
+	}
+	return whole
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"comicsd/internal/downloader"
+	"comicsd/internal/info"
+)
+
+func TestDownloadToSeriesWritesChapterCBZs(t *testing.T) {
+	stubChapters(t, map[string][]string{"a": {"1", "2"}, "b": {"1"}})
+	path := filepath.Join(t.TempDir(), "out.zip")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job := testJob("cbz-series")
+	job.info.Chapters = []info.Chapter{{ID: "b", Title: "番外篇"}, {ID: "a", Title: "第1話"}}
+	pages, err := downloadToArchive(context.Background(), job, []byte("cover"), file)
+	file.Close()
+	if err != nil {
+		t.Fatalf("downloadToArchive failed: %v", err)
+	}
+	if pages != 3 {
+		t.Errorf("expected 3 pages, got %d", pages)
+	}
+
+	names, contents := readZip(t, path)
+	expected := []string{"東大特訓班 - Ch. 001.cbz", "東大特訓班 - Ch. 002.cbz", "cover.jpg", "ComicInfo.xml"}
+	if strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Fatalf("unexpected entries: %v", names)
+	}
+	if !strings.Contains(contents["ComicInfo.xml"], "<Series>東大特訓班</Series>") {
+		t.Errorf("expected the series metadata: %s", contents["ComicInfo.xml"])
+	}
+
+	chapter := readChapterZip(t, contents["東大特訓班 - Ch. 001.cbz"])
+	if chapter["0000.jpg"] != "a/1" || chapter["0001.jpg"] != "a/2" {
+		t.Errorf("expected the first chapter's pages numbered from 0, got %v", chapter)
+	}
+	if xml := chapter["ComicInfo.xml"]; !strings.Contains(xml, "<Number>1</Number>") || !strings.Contains(xml, "<Title>第1話</Title>") {
+		t.Errorf("expected the chapter's number and title: %s", xml)
+	}
+	// 番外篇 holds no number, so it is numbered by its position
+	chapter = readChapterZip(t, contents["東大特訓班 - Ch. 002.cbz"])
+	if chapter["0000.jpg"] != "b/1" || !strings.Contains(chapter["ComicInfo.xml"], "<Number>2</Number>") {
+		t.Errorf("unexpected second chapter: %v", chapter)
+	}
+}
+
+func TestDownloadToSeriesNamesVolumesAndRanges(t *testing.T) {
+	stubChapters(t, map[string][]string{"a": {"1"}, "b": {"1"}})
+	path := filepath.Join(t.TempDir(), "out.zip")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job := testJob("cbz-series")
+	job.info.Chapters = []info.Chapter{{ID: "b", Title: "第11-12話"}, {ID: "a", Title: "第三卷"}}
+	_, err = downloadToArchive(context.Background(), job, nil, file)
+	file.Close()
+	if err != nil {
+		t.Fatalf("downloadToArchive failed: %v", err)
+	}
+
+	names, contents := readZip(t, path)
+	expected := []string{"東大特訓班 - Vol. 003.cbz", "東大特訓班 - Ch. 011-012.cbz", "ComicInfo.xml"}
+	if strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Fatalf("unexpected entries: %v", names)
+	}
+	if xml := readChapterZip(t, contents[expected[0]])["ComicInfo.xml"]; !strings.Contains(xml, "<Volume>3</Volume>") {
+		t.Errorf("expected the volume number: %s", xml)
+	}
+	if xml := readChapterZip(t, contents[expected[1]])["ComicInfo.xml"]; !strings.Contains(xml, "<Number>11</Number>") {
+		t.Errorf("expected the range's first number: %s", xml)
+	}
+}
+
+func TestDownloadToSeriesMarksPartlyWrittenChapters(t *testing.T) {
+	orig := openChapters
+	t.Cleanup(func() { openChapters = orig })
+	fail := map[string]string{"b": "2", "c": "1"}
+	openChapters = func(ctx context.Context, comicID string, chapterIDs []string, workers int) (downloader.ChapterOpener, error) {
+		return func(i int) (downloader.PageSource, error) {
+			id := chapterIDs[i]
+			return &fakeChapter{id: id, pages: []string{"1", "2"}, fail: fail[id], closed: new(int)}, nil
+		}, nil
+	}
+	path := filepath.Join(t.TempDir(), "out.zip")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job := testJob("cbz-series")
+	job.chapterIDs = []string{"a", "b", "c", "d"}
+	job.continueOnError = true
+	report, err := writeArchive(context.Background(), job, file)
+	file.Close()
+	if err != nil {
+		t.Fatalf("writeArchive failed: %v", err)
+	}
+	if len(report.skipped) != 2 || report.stats.Chapters != 3 || report.stats.Pages != 5 {
+		t.Errorf("expected 3 chapters of 5 pages and 2 failures, got %+v, %v", report.stats, []error(report.skipped))
+	}
+
+	// The chapter failing on its first page is left out
+	names, contents := readZip(t, path)
+	expected := []string{"東大特訓班 - Ch. 001.cbz", "東大特訓班 - Ch. 002 (incomplete).cbz", "東大特訓班 - Ch. 004.cbz", "ComicInfo.xml"}
+	if strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Fatalf("unexpected entries: %v", names)
+	}
+	if chapter := readChapterZip(t, contents[expected[1]]); chapter["0000.jpg"] != "b/1" || chapter["0001.jpg"] != "" {
+		t.Errorf("expected the kept page of the incomplete chapter, got %v", chapter)
+	}
+}
+
+// readChapterZip returns the entries of a CBZ held in a series ZIP by name
+func readChapterZip(t *testing.T, data string) map[string]string {
+	t.Helper()
+	zr, err := zip.NewReader(strings.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("invalid chapter CBZ: %v", err)
+	}
+	contents := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("open %s: %v", f.Name, err)
+		}
+		var buf bytes.Buffer
+		_, err = io.Copy(&buf, rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("read %s: %v", f.Name, err)
+		}
+		contents[f.Name] = buf.String()
+	}
+	return contents
+}
+
+func TestSeriesFileName(t *testing.T) {
+	job := testJob("cbz-series")
+	if name := job.fileName(); name != "東大特訓班.zip" {
+		t.Errorf("expected a .zip, got %s", name)
+	}
+}
+
+func TestPadChapterNumber(t *testing.T) {
+	for number, want := range map[string]string{"1": "001", "10.5": "010.5", "1234": "1234", "11-12": "011-012"} {
+		if got := padChapterNumber(number); got != want {
+			t.Errorf("padChapterNumber(%q) = %q, want %q", number, got, want)
+		}
+	}
+}
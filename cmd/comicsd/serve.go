@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"comicsd/internal/archive"
+	"comicsd/internal/browser"
+	"comicsd/internal/config"
+	"comicsd/internal/downloader"
+	"comicsd/internal/info"
+)
+
+// apiServer serves the HTTP API, running every request in a tab of one shared browser
+type apiServer struct {
+	pool            *browser.Pool
+	settings        *config.Settings
+	timeout         time.Duration
+	downloadTimeout time.Duration
+}
+
+func newAPIServer(pool *browser.Pool, settings *config.Settings, timeout, downloadTimeout time.Duration) *apiServer {
+	return &apiServer{
+		pool:            pool,
+		settings:        settings,
+		timeout:         timeout,
+		downloadTimeout: downloadTimeout,
+	}
+}
+
+func (s *apiServer) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/search", s.handleSearch)
+	mux.HandleFunc("/info", s.handleInfo)
+	mux.HandleFunc("/download", s.handleDownload)
+	return mux
+}
+
+// newTab opens a browser tab bound to the request and the given timeout,
+// waiting while all tabs are in use
+func (s *apiServer) newTab(r *http.Request, timeout time.Duration) (context.Context, context.CancelFunc, error) {
+	tabCtx, release, err := s.pool.Acquire(r.Context())
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx, cancel := context.WithTimeout(tabCtx, timeout)
+	return ctx, func() {
+		cancel()
+		release()
+	}, nil
+}
+
+func (s *apiServer) handleSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	keyword := r.URL.Query().Get("q")
+	if keyword == "" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("query parameter q is required"))
+		return
+	}
+
+	ctx, cancel, err := s.newTab(r, s.timeout)
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	defer cancel()
+
+	results, err := info.NewComicInfoFetcher(ctx).SearchComics(keyword)
+	if err != nil {
+		log.Printf("search comics error: %v", err)
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, results)
+}
+
+func (s *apiServer) handleInfo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	comicID := r.URL.Query().Get("id")
+	if comicID == "" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("query parameter id is required"))
+		return
+	}
+	if err := downloader.ValidateIDs(comicID); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx, cancel, err := s.newTab(r, s.timeout)
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	defer cancel()
+
+	ci, err := info.NewComicInfoFetcher(ctx).GetComicInfo(comicID)
+	if err != nil {
+		log.Printf("get comic info error: %v", err)
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, ci)
+}
+
+// handleDownload accepts a download plan and responds with the generated archive
+func (s *apiServer) handleDownload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	var plan info.DownloadPlan
+	if err := json.NewDecoder(r.Body).Decode(&plan); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid download plan: %w", err))
+		return
+	}
+	if err := plan.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	job := downloadJob{
+		comicID:    plan.ComicID,
+		title:      plan.Title,
+		chapterIDs: plan.ChapterIDs,
+		format:     plan.Format,
+		workers:    s.settings.Workers,
+		cover:      true,
+		metadata:   true,
+	}
+	if job.format == "" {
+		job.format = s.settings.Format
+	}
+	if err := checkFormat(job.format); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	job.format = archive.Resolve(job.format, len(job.chapterIDs))
+
+	ctx, cancel, err := s.newTab(r, s.downloadTimeout)
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	defer cancel()
+
+	file, err := os.CreateTemp("", "comicsd-*."+archive.Extension(job.format))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	if _, err := writeArchive(ctx, job, file); err != nil {
+		log.Printf("download error: %v", err)
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	filename := job.fileName()
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename*=UTF-8''%s", url.PathEscape(filename)))
+	http.ServeContent(w, r, filename, time.Now(), file)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// serve runs the HTTP API until it fails or is interrupted. On interrupt it
+// waits for running requests before closing the browser.
+func serve(settings *config.Settings, addr string, timeout, downloadTimeout time.Duration) error {
+	pool := browser.NewServerPool(context.Background(), settings)
+	defer pool.Close()
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           newAPIServer(pool, settings, timeout, downloadTimeout).routes(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	shutdown := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		// A second interrupt exits right away
+		stop()
+		shutdown <- srv.Shutdown(context.Background())
+	}()
+
+	log.Printf("HTTP API listening on %s", addr)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return <-shutdown
+}
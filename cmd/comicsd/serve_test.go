@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"comicsd/internal/browser"
+	"comicsd/internal/config"
+)
+
+func TestAPIServerRejectsBadRequests(t *testing.T) {
+	settings := &config.Settings{Workers: 1, Format: "cbz"}
+	pool := browser.NewPool(context.Background(), settings, 1)
+	defer pool.Close()
+	handler := newAPIServer(pool, settings, time.Second, time.Second).routes()
+
+	tests := []struct {
+		method, target, body string
+		status               int
+	}{
+		{http.MethodGet, "/search", "", http.StatusBadRequest},
+		{http.MethodPost, "/search?q=x", "", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/info", "", http.StatusBadRequest},
+		{http.MethodGet, "/info?id=../s/x", "", http.StatusBadRequest},
+		{http.MethodGet, "/download", "", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/download", "not json", http.StatusBadRequest},
+		{http.MethodPost, "/download", `{"comic_id":"1","title":"t"}`, http.StatusBadRequest},
+		{http.MethodPost, "/download", `{"comic_id":"1","title":"t","chapter_ids":["2"],"format":"pdf"}`, http.StatusBadRequest},
+		{http.MethodPost, "/download", `{"comic_id":"1","title":"t","chapter_ids":["2.html?x"],"format":"cbz"}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s %s: expected status %d, got %d (%s)", tt.method, tt.target, tt.status, rec.Code, rec.Body)
+		}
+		if !strings.Contains(rec.Body.String(), `"error"`) {
+			t.Errorf("%s %s: expected JSON error body, got %s", tt.method, tt.target, rec.Body)
+		}
+	}
+}
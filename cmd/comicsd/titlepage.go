@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+
+	"comicsd/internal/info"
+	"comicsd/internal/titlepage"
+)
+
+// titlePage renders the page inserted before the i-th chapter of the job. It
+// shows the number in the chapter's title, else its position in the download,
+// and the title itself when the font can draw it.
+func (job downloadJob) titlePage(i int) ([]byte, error) {
+	heading := fmt.Sprintf("Chapter %d", i+1)
+	var subtitle string
+	if chapter, ok := job.chapter(i); ok {
+		if n, ok := info.ParseChapterNumber(chapter.Title); ok && n.Volume {
+			heading = "Volume " + n.String()
+		} else if ok {
+			heading = "Chapter " + n.String()
+		}
+		if titlepage.Renderable(chapter.Title) {
+			subtitle = chapter.Title
+		}
+	}
+	return titlepage.Render(heading, subtitle)
+}
+
+// chapter looks up the i-th chapter of the job in the comic info, if fetched
+func (job downloadJob) chapter(i int) (info.Chapter, bool) {
+	if job.info == nil {
+		return info.Chapter{}, false
+	}
+	for _, chapter := range job.info.Chapters {
+		if chapter.ID == job.chapterIDs[i] {
+			return chapter, true
+		}
+	}
+	return info.Chapter{}, false
+}
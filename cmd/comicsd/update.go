@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"comicsd/internal/info"
+	"comicsd/internal/naming"
+)
+
+// runUpdate downloads the chapters of the job's comic added since the last
+// update into a new archive, then remembers the current chapter list in
+// cacheDir. The first update of a comic only records its chapters. The cache
+// is left alone when the download fails, so the next update retries it.
+func runUpdate(ctx context.Context, w io.Writer, fetcher info.Fetcher, cacheDir string, job downloadJob) error {
+	current, err := fetcher.GetComicInfo(job.comicID)
+	if err != nil {
+		return err
+	}
+	prev, err := info.LoadCached(cacheDir, job.comicID)
+	if err != nil {
+		return err
+	}
+	if prev == nil {
+		if err := info.SaveCached(cacheDir, current); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "Recorded %d chapters of %s; later updates download the chapters added after now\n", len(current.Chapters), current.Title)
+		return nil
+	}
+
+	chapters := current.NewChapters(prev)
+	if len(chapters) == 0 {
+		fmt.Fprintf(w, "%s has no new chapters\n", current.Title)
+		return info.SaveCached(cacheDir, current)
+	}
+
+	job.info = current
+	job.title = updateTitle(current, chapters)
+	job.chapterIDs = make([]string, 0, len(chapters))
+	for _, chapter := range chapters {
+		job.chapterIDs = append(job.chapterIDs, chapter.ID)
+	}
+	fmt.Fprintf(w, "Downloading %d new chapters of %s\n", len(chapters), current.Title)
+	if err := runDownload(ctx, job); err != nil {
+		return err
+	}
+	return info.SaveCached(cacheDir, current)
+}
+
+// updateTitle names the archive of an update after the comic and its first
+// and last new chapters, so successive updates do not collide
+func updateTitle(ci *info.ComicInfo, chapters []info.Chapter) string {
+	title := naming.Sanitize(ci.Title)
+	if title == "" {
+		title = ci.ID
+	}
+	first, last := chapters[0], chapters[len(chapters)-1]
+	name := func(c info.Chapter) string {
+		if c.Title != "" {
+			return naming.Sanitize(c.Title)
+		}
+		return c.ID
+	}
+	if len(chapters) == 1 {
+		return fmt.Sprintf("%s %s", title, name(first))
+	}
+	return fmt.Sprintf("%s %s-%s", title, name(first), name(last))
+}
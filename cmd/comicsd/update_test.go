@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"comicsd/internal/downloader"
+	"comicsd/internal/info"
+	"comicsd/internal/info/infotest"
+)
+
+func TestRunUpdate(t *testing.T) {
+	stubChapters(t, map[string][]string{"3": {"p"}, "4": {"p"}})
+	cacheDir := filepath.Join(t.TempDir(), "cache")
+	job := testJob("cbz")
+	job.outputDir = t.TempDir()
+	job.info = nil
+	job.metadata = false
+
+	comic := &info.ComicInfo{ID: "1128", Title: "東大特訓班", Chapters: []info.Chapter{{ID: "2", Title: "第2話"}, {ID: "1", Title: "第1話"}}}
+	fetcher := &infotest.Fetcher{Comics: map[string]*info.ComicInfo{"1128": comic}}
+
+	// The first update only records the chapters
+	var out bytes.Buffer
+	if err := runUpdate(context.Background(), &out, fetcher, cacheDir, job); err != nil {
+		t.Fatalf("runUpdate failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "Recorded 2 chapters") {
+		t.Errorf("unexpected output: %s", out.String())
+	}
+
+	comic.Chapters = append([]info.Chapter{{ID: "4", Title: "第4話"}, {ID: "3", Title: "第3話"}}, comic.Chapters...)
+	out.Reset()
+	if err := runUpdate(context.Background(), &out, fetcher, cacheDir, job); err != nil {
+		t.Fatalf("runUpdate failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(job.outputDir, "東大特訓班 第3話-第4話.cbz")); err != nil {
+		t.Errorf("expected an archive of the new chapters: %v", err)
+	}
+
+	cached, err := info.LoadCached(cacheDir, "1128")
+	if err != nil || len(cached.Chapters) != 4 {
+		t.Fatalf("expected the cache updated to 4 chapters, got %v, %v", cached, err)
+	}
+
+	out.Reset()
+	if err := runUpdate(context.Background(), &out, fetcher, cacheDir, job); err != nil {
+		t.Fatalf("runUpdate failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "no new chapters") {
+		t.Errorf("unexpected output: %s", out.String())
+	}
+}
+
+func TestRunUpdateKeepsCacheOnFailure(t *testing.T) {
+	orig := openChapters
+	defer func() { openChapters = orig }()
+	openChapters = func(ctx context.Context, comicID string, chapterIDs []string, workers int) (downloader.ChapterOpener, error) {
+		return nil, errors.New("browser crashed")
+	}
+	cacheDir := t.TempDir()
+	job := testJob("cbz")
+	job.outputDir = t.TempDir()
+
+	prev := &info.ComicInfo{ID: "1128", Chapters: []info.Chapter{{ID: "1"}}}
+	if err := info.SaveCached(cacheDir, prev); err != nil {
+		t.Fatal(err)
+	}
+	comic := &info.ComicInfo{ID: "1128", Title: "東大特訓班", Chapters: []info.Chapter{{ID: "2"}, {ID: "1"}}}
+	fetcher := &infotest.Fetcher{Comics: map[string]*info.ComicInfo{"1128": comic}}
+
+	if err := runUpdate(context.Background(), &bytes.Buffer{}, fetcher, cacheDir, job); err == nil {
+		t.Fatal("expected the download to fail")
+	}
+	cached, _ := info.LoadCached(cacheDir, "1128")
+	if len(cached.Chapters) != 1 {
+		t.Errorf("expected the cache left alone, got %d chapters", len(cached.Chapters))
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// epubPagePattern matches the spine items of EPUB pages: their XHTML pages,
+// or the images themselves in image-only books
+var epubPagePattern = regexp.MustCompile(`^OEBPS/(page\d+\.xhtml|images/\d+\.\w+)$`)
+
+// upToDate reports whether the job's output at path already holds every page
+// the download would write. The chapters are enumerated to count them, so
+// this is only done when a readable archive exists.
+func upToDate(ctx context.Context, job downloadJob, path string) (bool, error) {
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	have, err := archivePageCount(job.format, path)
+	if err != nil {
+		// Unreadable, such as cut off by an interrupted download
+		return false, nil
+	}
+	want, err := expectedPageCount(ctx, job)
+	if err != nil {
+		return false, err
+	}
+	return have == want, nil
+}
+
+// archivePageCount returns the number of non-empty pages of an existing archive
+func archivePageCount(format, path string) (int, error) {
+	if format != "epub" {
+		pages, err := readArchivePages(format, path)
+		return len(pages), err
+	}
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return 0, err
+	}
+	defer zr.Close()
+	pages, images := 0, 0
+	for _, f := range zr.File {
+		if m := epubPagePattern.FindStringSubmatch(f.Name); m != nil {
+			if strings.HasPrefix(m[1], "images/") {
+				images++
+			} else {
+				pages++
+			}
+		}
+	}
+	if pages == 0 {
+		return images, nil
+	}
+	return pages, nil
+}
+
+// expectedPageCount enumerates the job's chapters and returns the number of
+// pages downloading them writes, title pages included
+func expectedPageCount(ctx context.Context, job downloadJob) (int, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	openChapter, err := openChapters(ctx, job.comicID, job.chapterIDs, job.workers)
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	for i := range job.chapterIDs {
+		cc, err := openChapter(i)
+		if err != nil {
+			return 0, err
+		}
+		pages, err := job.chapterPages(i, cc)
+		cc.Close()
+		if err != nil {
+			return 0, err
+		}
+		total += len(pages)
+		if job.titlePages {
+			total++
+		}
+	}
+	return total, nil
+}
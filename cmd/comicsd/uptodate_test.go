@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"comicsd/internal/downloader"
+)
+
+func TestRunDownloadSkipsUpToDateArchive(t *testing.T) {
+	stubChapters(t, map[string][]string{"a": {"1", "2"}, "b": {"1"}})
+	job := testJob("cbz")
+	job.outputDir = t.TempDir()
+	path := filepath.Join(job.outputDir, job.fileName())
+	writeTestZip(t, path, [][2]string{{"0.jpg", "a/1"}, {"1.jpg", "a/2"}, {"2.jpg", "b/1"}, {"ComicInfo.xml", "<ComicInfo/>"}})
+
+	if err := runDownload(context.Background(), job); err != nil {
+		t.Fatalf("expected the complete archive to be skipped, got %v", err)
+	}
+	if _, contents := readZip(t, path); contents["ComicInfo.xml"] != "<ComicInfo/>" {
+		t.Errorf("expected the archive to be left alone")
+	}
+}
+
+func TestRunDownloadKeepsRefusingIncompleteArchive(t *testing.T) {
+	stubChapters(t, map[string][]string{"a": {"1", "2"}, "b": {"1"}})
+	job := testJob("cbz")
+	job.outputDir = t.TempDir()
+	path := filepath.Join(job.outputDir, job.fileName())
+	writeTestZip(t, path, [][2]string{{"0.jpg", "a/1"}, {"1.jpg", ""}, {"2.jpg", "b/1"}})
+
+	if err := runDownload(context.Background(), job); !errors.Is(err, downloader.ErrOutputExists) {
+		t.Fatalf("expected ErrOutputExists for an archive with a failed page, got %v", err)
+	}
+}
+
+func TestArchivePageCountEPUB(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.epub")
+	writeTestZip(t, path, [][2]string{
+		{"mimetype", "application/epub+zip"},
+		{"OEBPS/cover.xhtml", ""},
+		{"OEBPS/page1.xhtml", ""},
+		{"OEBPS/page2.xhtml", ""},
+		{"OEBPS/images/0.jpg", "x"},
+	})
+
+	count, err := archivePageCount("epub", path)
+	if err != nil {
+		t.Fatalf("archivePageCount failed: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 pages, got %d", count)
+	}
+}
+
+func TestArchivePageCountImageOnlyEPUB(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.epub")
+	writeTestZip(t, path, [][2]string{
+		{"mimetype", "application/epub+zip"},
+		{"OEBPS/images/cover.jpg", "c"},
+		{"OEBPS/images/0.jpg", "x"},
+		{"OEBPS/images/1.webp", "y"},
+		{"OEBPS/content.opf", ""},
+	})
+
+	count, err := archivePageCount("epub", path)
+	if err != nil {
+		t.Fatalf("archivePageCount failed: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 pages, got %d", count)
+	}
+}
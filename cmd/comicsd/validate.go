@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"comicsd/internal/archive"
+	"comicsd/internal/config"
+	"comicsd/internal/info"
+)
+
+// runValidateConfig checks the summarize config at path and prints every
+// problem to w. The comics and chapters are also looked up when fetcher is
+// not nil.
+func runValidateConfig(w io.Writer, path string, fetcher info.Fetcher) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	entries, err := config.ParseSummarize(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	problems := validateSummarize(entries, fetcher)
+	for _, p := range problems {
+		fmt.Fprintf(w, "%s: %s\n", path, p)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s: %d problems found", path, len(problems))
+	}
+	fmt.Fprintf(w, "%s: %d entries OK\n", path, len(entries))
+	return nil
+}
+
+// validateSummarize returns the problems of every entry, ordered by entry name
+func validateSummarize(entries map[string]config.SummarizeEntry, fetcher info.Fetcher) []string {
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var problems []string
+	for _, name := range names {
+		entry := entries[name]
+		report := func(format string, args ...any) {
+			problems = append(problems, fmt.Sprintf("[%s] ", name)+fmt.Sprintf(format, args...))
+		}
+		if !isNumeric(entry.MangaID) {
+			report("invalid mangaid %q", entry.MangaID)
+		}
+		if entry.Title == "" {
+			report("title is empty")
+		}
+		if len(entry.Chapters) == 0 {
+			report("no chapters")
+		}
+		for _, chapterID := range entry.Chapters {
+			if !isNumeric(chapterID) {
+				report("invalid chapter ID %q", chapterID)
+			}
+		}
+		if entry.Format != "" {
+			if err := archive.Check(entry.Format); err != nil {
+				report("%v", err)
+			}
+		}
+
+		if fetcher == nil || !isNumeric(entry.MangaID) {
+			continue
+		}
+		ci, err := fetcher.GetComicInfo(entry.MangaID)
+		if err != nil {
+			report("%v", err)
+			continue
+		}
+		known := make(map[string]bool, len(ci.Chapters))
+		for _, chapter := range ci.Chapters {
+			known[chapter.ID] = true
+		}
+		for _, chapterID := range entry.Chapters {
+			if isNumeric(chapterID) && !known[chapterID] {
+				report("chapter %s not found in %s", chapterID, ci.Title)
+			}
+		}
+	}
+	return problems
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"comicsd/internal/info"
+	"comicsd/internal/info/infotest"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "summarize.toml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestValidateConfigReportsEveryProblem(t *testing.T) {
+	path := writeConfig(t, `
+[good]
+title = "Good"
+mangaid = "1128"
+chapters = ["566271"]
+
+[bad]
+title = ""
+mangaid = "abc"
+chapters = []
+format = "pdf"
+`)
+	var out bytes.Buffer
+	err := runValidateConfig(&out, path, nil)
+	if err == nil || !strings.Contains(err.Error(), "4 problems found") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{`[bad] invalid mangaid "abc"`, "[bad] title is empty", "[bad] no chapters", "[bad] invalid format: pdf"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("missing %q in:\n%s", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "[good]") {
+		t.Errorf("valid entry reported:\n%s", out.String())
+	}
+}
+
+func TestValidateConfigOnline(t *testing.T) {
+	path := writeConfig(t, `
+[tokyo]
+title = "東大特訓班"
+mangaid = "1128"
+chapters = ["1", "9"]
+
+[missing]
+title = "Missing"
+mangaid = "2250"
+chapters = ["1"]
+`)
+	fetcher := &infotest.Fetcher{Comics: map[string]*info.ComicInfo{
+		"1128": {ID: "1128", Title: "東大特訓班", Chapters: []info.Chapter{{ID: "1"}, {ID: "2"}}},
+	}}
+	var out bytes.Buffer
+	if err := runValidateConfig(&out, path, fetcher); err == nil {
+		t.Fatal("expected problems")
+	}
+	for _, want := range []string{"[tokyo] chapter 9 not found in 東大特訓班", "[missing] failed to get comic info: comic 2250 not found"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("missing %q in:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestValidateConfigOK(t *testing.T) {
+	path := writeConfig(t, "[a]\ntitle = \"A\"\nmangaid = \"1\"\nchapters = [\"2\"]\nformat = \"cbt\"\n")
+	var out bytes.Buffer
+	if err := runValidateConfig(&out, path, nil); err != nil {
+		t.Fatalf("runValidateConfig failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "1 entries OK") {
+		t.Errorf("unexpected output: %s", out.String())
+	}
+}
@@ -0,0 +1,160 @@
+// Package archive is the registry of output formats and the writers that
+// produce them.
+package archive
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"strings"
+
+	"comicsd/internal/cbt"
+	"comicsd/internal/epub"
+	"comicsd/internal/naming"
+)
+
+// Default is the format used when none is configured
+const Default = "cbz"
+
+// Series is the format of a ZIP holding one CBZ per chapter, which comic
+// servers such as Komga and Kavita import as a series
+const Series = "cbz-series"
+
+// Auto picks the format by the download: EPUB for a single chapter, read as
+// a book on e-readers, else CBZ, the format comic libraries expect. Resolve
+// turns it into one of the other formats before anything is written.
+const Auto = "auto"
+
+// Format describes a supported output format. The name is also the file
+// extension, except for Series, which is a .zip.
+type Format struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+var formats = []Format{
+	{Name: "cbz", Description: "comic book zip archive"},
+	{Name: "cbt", Description: "comic book tar archive"},
+	{Name: "epub", Description: "EPUB 2 book of one page per image, EPUB 3 with WebP images or a fixed layout"},
+	{Name: Series, Description: "zip of one CBZ per chapter, for comic servers"},
+	{Name: Auto, Description: "epub for a single chapter, else cbz"},
+}
+
+// Formats returns the supported formats
+func Formats() []Format {
+	return append([]Format(nil), formats...)
+}
+
+// SupportedFormats returns the names of the supported formats
+func SupportedFormats() []string {
+	names := make([]string, len(formats))
+	for i, f := range formats {
+		names[i] = f.Name
+	}
+	return names
+}
+
+// Check validates an output format name
+func Check(format string) error {
+	names := SupportedFormats()
+	for _, name := range names {
+		if format == name {
+			return nil
+		}
+	}
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = "'" + name + "'"
+	}
+	last := len(quoted) - 1
+	return fmt.Errorf("invalid format: %s. Use %s or %s", format, strings.Join(quoted[:last], ", "), quoted[last])
+}
+
+// CheckWriter validates a format NewWriter can write: any but Series, whose
+// writer needs to know where each chapter starts
+func CheckWriter(format string) error {
+	if err := Check(format); err != nil {
+		return err
+	}
+	if format == Series {
+		return fmt.Errorf("format %s is only supported by the download command", Series)
+	}
+	return nil
+}
+
+// Resolve returns the format writing a download of chapters chapters: Auto
+// resolved by the number of chapters, any other format unchanged
+func Resolve(format string, chapters int) string {
+	if format != Auto {
+		return format
+	}
+	if chapters == 1 {
+		return "epub"
+	}
+	return Default
+}
+
+// Extension returns the file extension of format, without the dot
+func Extension(format string) string {
+	if format == Series {
+		return "zip"
+	}
+	return format
+}
+
+// ArchiveWriter adds pages to an archive of any format
+type ArchiveWriter interface {
+	AddPage(name string, data []byte) error
+	Close() error
+}
+
+var _ ArchiveWriter = (*epub.EPUBWriter)(nil)
+
+// NewWriter returns the writer of a new archive in format on w. The title is
+// the book title of EPUBs.
+func NewWriter(format string, w io.Writer, title string) (ArchiveWriter, error) {
+	if err := CheckWriter(format); err != nil {
+		return nil, err
+	}
+	if format == Auto {
+		return nil, fmt.Errorf("format %s must be resolved before writing", Auto)
+	}
+	if format == "epub" {
+		return epub.NewEPUBWriter(w, title), nil
+	}
+	return &ComicWriter{Archive: NewComicArchive(format, w)}, nil
+}
+
+// NewComicArchive returns the entry writer of a CBT for format "cbt", else of a CBZ
+func NewComicArchive(format string, w io.Writer) cbt.Archive {
+	if format == "cbt" {
+		return cbt.NewWriter(w)
+	}
+	return zip.NewWriter(w)
+}
+
+// ComicWriter adds pages to a CBZ or CBT, whose other entries can still be
+// created directly. Page names are zero-padded to at least
+// naming.MinPageWidth digits, so readers sorting the entries by name keep
+// the reading order.
+type ComicWriter struct {
+	cbt.Archive
+	// PageWidth is the number of digits of page names when the book has
+	// more pages than naming.MinPageWidth digits number
+	PageWidth int
+}
+
+// PageName returns the entry name of the page image name
+func (c *ComicWriter) PageName(name string) string {
+	return naming.PadPageName(name, max(c.PageWidth, naming.MinPageWidth))
+}
+
+// AddPage stores a page image under its PageName
+func (c *ComicWriter) AddPage(name string, data []byte) error {
+	w, err := c.Create(c.PageName(name))
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
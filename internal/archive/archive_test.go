@@ -0,0 +1,121 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"comicsd/internal/epub"
+)
+
+func TestSupportedFormats(t *testing.T) {
+	if got := strings.Join(SupportedFormats(), ","); got != "cbz,cbt,epub,cbz-series,auto" {
+		t.Errorf("unexpected formats: %s", got)
+	}
+	for _, format := range SupportedFormats() {
+		if err := Check(format); err != nil {
+			t.Errorf("Check(%q): %v", format, err)
+		}
+	}
+	err := Check("pdf")
+	if err == nil || err.Error() != "invalid format: pdf. Use 'cbz', 'cbt', 'epub', 'cbz-series' or 'auto'" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestNewWriterRejectsSeries(t *testing.T) {
+	if err := CheckWriter("cbz"); err != nil {
+		t.Errorf("CheckWriter(cbz): %v", err)
+	}
+	if _, err := NewWriter(Series, &bytes.Buffer{}, "t"); err == nil {
+		t.Errorf("expected %s to need the download command", Series)
+	}
+	if ext := Extension(Series); ext != "zip" {
+		t.Errorf("expected a .zip, got .%s", ext)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		format   string
+		chapters int
+		want     string
+	}{
+		{Auto, 1, "epub"},
+		{Auto, 3, "cbz"},
+		{"cbt", 1, "cbt"},
+		{"epub", 5, "epub"},
+		{Series, 1, Series},
+	}
+	for _, tt := range tests {
+		if got := Resolve(tt.format, tt.chapters); got != tt.want {
+			t.Errorf("Resolve(%q, %d) = %q, want %q", tt.format, tt.chapters, got, tt.want)
+		}
+	}
+	if _, err := NewWriter(Auto, &bytes.Buffer{}, "t"); err == nil {
+		t.Errorf("expected %s to be resolved before writing", Auto)
+	}
+}
+
+func TestNewWriterCBZ(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter("cbz", &buf, "t")
+	if err != nil {
+		t.Fatalf("NewWriter failed: %v", err)
+	}
+	if err := w.AddPage("0.jpg", []byte("page")); err != nil {
+		t.Fatalf("AddPage failed: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("invalid zip: %v", err)
+	}
+	if len(zr.File) != 1 || zr.File[0].Name != "0000.jpg" {
+		t.Errorf("unexpected entries: %v", zr.File)
+	}
+}
+
+func TestNewWriterCBT(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter("cbt", &buf, "t")
+	if err != nil {
+		t.Fatalf("NewWriter failed: %v", err)
+	}
+	w.AddPage("0.jpg", []byte("page"))
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	tr := tar.NewReader(&buf)
+	hdr, err := tr.Next()
+	if err != nil {
+		t.Fatalf("invalid tar: %v", err)
+	}
+	data, _ := io.ReadAll(tr)
+	if hdr.Name != "0000.jpg" || string(data) != "page" {
+		t.Errorf("unexpected entry %s: %q", hdr.Name, data)
+	}
+}
+
+func TestNewWriterEPUB(t *testing.T) {
+	w, err := NewWriter("epub", io.Discard, "t")
+	if err != nil {
+		t.Fatalf("NewWriter failed: %v", err)
+	}
+	if _, ok := w.(*epub.EPUBWriter); !ok {
+		t.Errorf("expected an EPUB writer, got %T", w)
+	}
+}
+
+func TestNewWriterRejectsUnknownFormat(t *testing.T) {
+	if _, err := NewWriter("pdf", io.Discard, "t"); err == nil {
+		t.Error("expected an error")
+	}
+}
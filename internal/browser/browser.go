@@ -0,0 +1,65 @@
+package browser
+
+import (
+	"context"
+	"strings"
+
+	"comicsd/internal/config"
+
+	"github.com/chromedp/chromedp"
+)
+
+// ContainerFlags are the Chrome flags needed to start in Docker and CI, where
+// the kernel sandbox is unavailable, there is no GPU and /dev/shm is small.
+// --no-sandbox removes Chrome's isolation of web content, so only use it in
+// an environment that is itself isolated.
+var ContainerFlags = []string{"--no-sandbox", "--disable-gpu", "--disable-dev-shm-usage"}
+
+// chromeFlag is a Chrome command line flag without its leading dashes
+type chromeFlag struct {
+	name  string
+	value interface{}
+}
+
+// chromeFlags returns the extra flags selected by settings: the container
+// set, then the configured ones, which may override it
+func chromeFlags(s *config.Settings) []chromeFlag {
+	var args []string
+	if s.Container {
+		args = append(args, ContainerFlags...)
+	}
+	args = append(args, strings.Fields(s.ChromeFlags)...)
+
+	flags := make([]chromeFlag, 0, len(args))
+	for _, arg := range args {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if hasValue {
+			flags = append(flags, chromeFlag{name, value})
+		} else {
+			flags = append(flags, chromeFlag{name, true})
+		}
+	}
+	return flags
+}
+
+// NewContext starts a chromedp browser context configured by settings.
+// Browser log output is discarded.
+func NewContext(parent context.Context, s *config.Settings) (context.Context, context.CancelFunc) {
+	opts := append([]chromedp.ExecAllocatorOption{}, chromedp.DefaultExecAllocatorOptions[:]...)
+	if s.Proxy != "" {
+		opts = append(opts, chromedp.ProxyServer(s.Proxy))
+	}
+	if s.UserAgent != "" {
+		opts = append(opts, chromedp.UserAgent(s.UserAgent))
+	}
+	for _, f := range chromeFlags(s) {
+		opts = append(opts, chromedp.Flag(f.name, f.value))
+	}
+
+	allocCtx, cancelAlloc := chromedp.NewExecAllocator(parent, opts...)
+	ctx, cancel := chromedp.NewContext(allocCtx, chromedp.WithLogf(func(string, ...interface{}) {}))
+	return ctx, func() {
+		cancel()
+		cancelAlloc()
+	}
+}
@@ -0,0 +1,27 @@
+package browser
+
+import (
+	"fmt"
+	"testing"
+
+	"comicsd/internal/config"
+)
+
+func TestChromeFlags(t *testing.T) {
+	tests := []struct {
+		settings config.Settings
+		want     string
+	}{
+		{config.Settings{}, "[]"},
+		{config.Settings{Container: true}, "[{no-sandbox true} {disable-gpu true} {disable-dev-shm-usage true}]"},
+		{
+			config.Settings{Container: true, ChromeFlags: " --window-size=1280,800  --disable-gpu=false"},
+			"[{no-sandbox true} {disable-gpu true} {disable-dev-shm-usage true} {window-size 1280,800} {disable-gpu false}]",
+		},
+	}
+	for _, tt := range tests {
+		if got := fmt.Sprint(chromeFlags(&tt.settings)); got != tt.want {
+			t.Errorf("chromeFlags(%+v) = %s, want %s", tt.settings, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package browser
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"comicsd/internal/config"
+
+	"github.com/chromedp/chromedp"
+)
+
+// ErrPoolClosed is returned by Acquire once the pool has been closed
+var ErrPoolClosed = errors.New("browser pool is closed")
+
+// Pool shares a single browser between operations. It hands out tabs on
+// demand and keeps released tabs open for the next operation.
+type Pool struct {
+	browserCtx context.Context
+	cancel     context.CancelFunc
+	slots      chan struct{}
+	// closed is closed by Close to turn away waiting and later Acquires
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	startOnce sync.Once
+	startErr  error
+
+	mu   sync.Mutex
+	idle []*tab
+}
+
+type tab struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewPool creates a pool handing out at most size tabs at once. The browser
+// is launched by the first Acquire.
+func NewPool(parent context.Context, s *config.Settings, size int) *Pool {
+	if size < 1 {
+		size = 1
+	}
+	ctx, cancel := NewContext(parent, s)
+	return &Pool{
+		browserCtx: ctx,
+		cancel:     cancel,
+		slots:      make(chan struct{}, size),
+		closed:     make(chan struct{}),
+	}
+}
+
+// NewServerPool creates the pool shared by the requests of the HTTP and MCP
+// servers, handing out max_browsers tabs at once or workers when unset
+func NewServerPool(parent context.Context, s *config.Settings) *Pool {
+	size := s.MaxBrowsers
+	if size == 0 {
+		size = s.Workers
+	}
+	return NewPool(parent, s, size)
+}
+
+// Acquire returns a tab context bound to ctx and a function releasing the tab
+// back to the pool. It blocks while all tabs are in use, and fails with
+// ErrPoolClosed once the pool is closed.
+func (p *Pool) Acquire(ctx context.Context) (context.Context, func(), error) {
+	select {
+	case <-p.closed:
+		return nil, nil, ErrPoolClosed
+	default:
+	}
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	case <-p.closed:
+		return nil, nil, ErrPoolClosed
+	}
+
+	t, err := p.get()
+	if err != nil {
+		<-p.slots
+		return nil, nil, err
+	}
+
+	// Cancelling a context derived from the tab ends the operation but keeps the tab open
+	opCtx, cancel := context.WithCancel(t.ctx)
+	stop := context.AfterFunc(ctx, cancel)
+	var once sync.Once
+	return opCtx, func() {
+		once.Do(func() {
+			stop()
+			cancel()
+			p.put(t)
+			<-p.slots
+		})
+	}, nil
+}
+
+// get returns an idle tab, opening a new one when none is idle
+func (p *Pool) get() (*tab, error) {
+	p.mu.Lock()
+	if n := len(p.idle); n > 0 {
+		t := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		p.mu.Unlock()
+		return t, nil
+	}
+	p.mu.Unlock()
+
+	// Launch the browser once so every tab opens in it
+	p.startOnce.Do(func() {
+		p.startErr = chromedp.Run(p.browserCtx)
+	})
+	if p.startErr != nil {
+		return nil, p.startErr
+	}
+
+	ctx, cancel := chromedp.NewContext(p.browserCtx)
+	if err := chromedp.Run(ctx); err != nil {
+		cancel()
+		return nil, err
+	}
+	return &tab{ctx: ctx, cancel: cancel}, nil
+}
+
+// put keeps a released tab for reuse unless it or the pool has been closed
+func (p *Pool) put(t *tab) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	select {
+	case <-p.closed:
+		t.cancel()
+		return
+	default:
+	}
+	if t.ctx.Err() != nil {
+		t.cancel()
+		return
+	}
+	p.idle = append(p.idle, t)
+}
+
+// Close closes every idle tab and the browser. Tabs still in use end with
+// the browser and are closed when released. Close may be called more than once.
+func (p *Pool) Close() {
+	p.closeOnce.Do(func() {
+		p.mu.Lock()
+		close(p.closed)
+		for _, t := range p.idle {
+			t.cancel()
+		}
+		p.idle = nil
+		p.mu.Unlock()
+		p.cancel()
+	})
+}
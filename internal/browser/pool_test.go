@@ -0,0 +1,59 @@
+package browser
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"comicsd/internal/config"
+)
+
+func TestPoolAcquireWaitsForFreeTab(t *testing.T) {
+	pool := NewPool(context.Background(), &config.Settings{}, 1)
+	defer pool.Close()
+
+	// Occupy the only slot so Acquire has to wait
+	pool.slots <- struct{}{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := pool.Acquire(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected Acquire to give up when ctx is cancelled, got %v", err)
+	}
+}
+
+func TestPoolCloseWakesWaitingAcquire(t *testing.T) {
+	pool := NewPool(context.Background(), &config.Settings{}, 1)
+	pool.slots <- struct{}{}
+
+	errc := make(chan error, 1)
+	go func() {
+		_, _, err := pool.Acquire(context.Background())
+		errc <- err
+	}()
+	pool.Close()
+	if err := <-errc; !errors.Is(err, ErrPoolClosed) {
+		t.Fatalf("expected the waiting Acquire to fail with ErrPoolClosed, got %v", err)
+	}
+	if _, _, err := pool.Acquire(context.Background()); !errors.Is(err, ErrPoolClosed) {
+		t.Fatalf("expected Acquire after Close to fail with ErrPoolClosed, got %v", err)
+	}
+	pool.Close()
+}
+
+func TestNewServerPoolSize(t *testing.T) {
+	tests := []struct {
+		settings config.Settings
+		expected int
+	}{
+		{config.Settings{Workers: 4}, 4},
+		{config.Settings{Workers: 4, MaxBrowsers: 2}, 2},
+	}
+	for _, tt := range tests {
+		pool := NewServerPool(context.Background(), &tt.settings)
+		if cap(pool.slots) != tt.expected {
+			t.Errorf("expected %d tabs for %+v, got %d", tt.expected, tt.settings, cap(pool.slots))
+		}
+		pool.Close()
+	}
+}
@@ -0,0 +1,75 @@
+// Package cbt writes CBT comic archives: uncompressed tar files of page images
+package cbt
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"time"
+)
+
+// Archive is the entry API shared by zip.Writer and Writer, letting the
+// page loops fill a CBZ or a CBT alike
+type Archive interface {
+	Create(name string) (io.Writer, error)
+	Close() error
+}
+
+var _ Archive = (*Writer)(nil)
+
+// Writer writes a CBT. A tar header records the entry size, so each entry is
+// buffered until the next Create or Close; memory stays bounded by one page.
+type Writer struct {
+	tw      *tar.Writer
+	name    string
+	buf     bytes.Buffer
+	pending bool
+	modTime time.Time
+}
+
+// NewWriter returns a Writer writing a CBT to w
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{tw: tar.NewWriter(w), modTime: time.Now()}
+}
+
+// Create adds an entry named name and returns a writer for its contents,
+// valid until the next call to Create or Close
+func (c *Writer) Create(name string) (io.Writer, error) {
+	if err := c.flush(); err != nil {
+		return nil, err
+	}
+	c.name = name
+	c.pending = true
+	return &c.buf, nil
+}
+
+// Close writes the last entry and the tar trailer. It does not close the
+// underlying writer.
+func (c *Writer) Close() error {
+	if err := c.flush(); err != nil {
+		return err
+	}
+	return c.tw.Close()
+}
+
+func (c *Writer) flush() error {
+	if !c.pending {
+		return nil
+	}
+	c.pending = false
+	defer c.buf.Reset()
+
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     c.name,
+		Mode:     0644,
+		Size:     int64(c.buf.Len()),
+		ModTime:  c.modTime,
+		Format:   tar.FormatPAX,
+	}
+	if err := c.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := c.tw.Write(c.buf.Bytes())
+	return err
+}
@@ -0,0 +1,56 @@
+package cbt
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+var _ Archive = (*zip.Writer)(nil)
+
+func TestWriterEntries(t *testing.T) {
+	var out bytes.Buffer
+	w := NewWriter(&out)
+	for i, content := range []string{"page one", "", "第三頁"} {
+		entry, err := w.Create(fmt.Sprintf("%d.jpg", i))
+		if err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		io.WriteString(entry, content)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	tr := tar.NewReader(&out)
+	var got []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("read archive: %v", err)
+		}
+		data, _ := io.ReadAll(tr)
+		got = append(got, hdr.Name+"="+string(data))
+	}
+	expected := "0.jpg=page one,1.jpg=,2.jpg=第三頁"
+	if strings.Join(got, ",") != expected {
+		t.Errorf("unexpected entries: %v", got)
+	}
+}
+
+func TestWriterEmpty(t *testing.T) {
+	var out bytes.Buffer
+	if err := NewWriter(&out).Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if _, err := tar.NewReader(&out).Next(); err != io.EOF {
+		t.Errorf("expected an empty archive, got %v", err)
+	}
+}
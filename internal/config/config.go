@@ -0,0 +1,179 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// DefaultWorkers is the number of concurrent browser tabs used when not configured
+const DefaultWorkers = 4
+
+// Settings holds the defaults shared by every command. Values come from the
+// config file, overridden by COMICSD_* environment variables, overridden by
+// command line flags.
+type Settings struct {
+	Workers        int    `mapstructure:"workers"`
+	Format         string `mapstructure:"format"`
+	OutputDir      string `mapstructure:"output_dir"`
+	Proxy          string `mapstructure:"proxy"`
+	UserAgent      string `mapstructure:"user_agent"`
+	BlockResources bool   `mapstructure:"block_resources"`
+	// SkipReload downloads pages without reloading the reader first, falling
+	// back to the reload when a page shows no image
+	SkipReload bool `mapstructure:"skip_reload"`
+	// StaleRetries bounds the reloads of a page whose image the browser
+	// evicted from its cache before it was read
+	StaleRetries int `mapstructure:"stale_retries"`
+	// SortPages orders each chapter's pages by the numbers of the reader's
+	// page selector instead of its order, dropping repeated pages
+	SortPages bool `mapstructure:"sort_pages"`
+	// WaitStrategy is what page downloads wait for before reading an image:
+	// "visible" or "loaded"
+	WaitStrategy string `mapstructure:"wait_strategy"`
+	// ImageSelectors are comma-separated CSS selectors tried for the page
+	// image when #mangaFile has no src, empty for the built-in ones
+	ImageSelectors string `mapstructure:"image_selectors"`
+	// ImageWait bounds the wait for #mangaFile or an image selector to
+	// appear in a page, after which the largest image is taken
+	ImageWait time.Duration `mapstructure:"image_wait"`
+	// ChapterDelay pauses between chapters of a download, such as "5s"
+	ChapterDelay time.Duration `mapstructure:"chapter_delay"`
+	// Jitter is the longest random wait before each page download, such as
+	// "300ms", putting tabs downloading at once out of step
+	Jitter time.Duration `mapstructure:"jitter"`
+	// MinPageBytes and MinPageSize flag pages smaller than this many bytes
+	// or pixels wide or high as placeholders, 0 to skip the check
+	MinPageBytes int `mapstructure:"min_page_bytes"`
+	MinPageSize  int `mapstructure:"min_page_size"`
+	// MaxBPS caps the combined download rate in bytes per second, 0 for unlimited
+	MaxBPS int `mapstructure:"max_bps"`
+	// ChapterWorkers is the number of chapters of a download fetched at
+	// once, each in a tab of its own
+	ChapterWorkers int `mapstructure:"chapter_workers"`
+	// MaxInflight bounds the pages downloaded but not yet written, 0 for
+	// twice the workers
+	MaxInflight int `mapstructure:"max_inflight"`
+	// MaxBrowsers bounds the browser tabs the HTTP and MCP servers use at
+	// once, 0 for workers; further requests wait for a free tab
+	MaxBrowsers int `mapstructure:"max_browsers"`
+	// OCRLang is the Tesseract language used by -ocr, empty for traditional Chinese
+	OCRLang string `mapstructure:"ocr_lang"`
+	// StrictInfo fails comic lookups when any field of the comic page is
+	// missing, not only the title or chapters
+	StrictInfo bool `mapstructure:"strict_info"`
+	// Container launches Chrome with the flags needed in Docker and CI,
+	// including --no-sandbox
+	Container bool `mapstructure:"container"`
+	// ChromeFlags are extra space-separated Chrome command line flags
+	ChromeFlags string `mapstructure:"chrome_flags"`
+}
+
+// DefaultPath returns the location of the config file, ~/.config/comicsd/config.toml
+func DefaultPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "comicsd", "config.toml")
+}
+
+// Load reads the settings from the TOML config file at path and the environment.
+// A missing file at the default path is not an error.
+func Load(path string) (*Settings, error) {
+	v := viper.New()
+	v.SetDefault("workers", DefaultWorkers)
+	v.SetDefault("format", "cbz")
+	v.SetDefault("output_dir", "")
+	v.SetDefault("proxy", "")
+	v.SetDefault("user_agent", "")
+	v.SetDefault("block_resources", false)
+	v.SetDefault("skip_reload", false)
+	v.SetDefault("stale_retries", 2)
+	v.SetDefault("sort_pages", false)
+	v.SetDefault("wait_strategy", "visible")
+	v.SetDefault("image_selectors", "")
+	v.SetDefault("image_wait", 10*time.Second)
+	v.SetDefault("chapter_delay", 0)
+	v.SetDefault("jitter", 0)
+	v.SetDefault("min_page_bytes", 0)
+	v.SetDefault("min_page_size", 0)
+	v.SetDefault("max_bps", 0)
+	v.SetDefault("chapter_workers", 1)
+	v.SetDefault("max_inflight", 0)
+	v.SetDefault("max_browsers", 0)
+	v.SetDefault("ocr_lang", "")
+	v.SetDefault("strict_info", false)
+	v.SetDefault("container", false)
+	v.SetDefault("chrome_flags", "")
+	v.SetEnvPrefix("COMICSD")
+	v.AutomaticEnv()
+
+	if path != "" {
+		v.SetConfigFile(path)
+		v.SetConfigType("toml")
+		if err := v.ReadInConfig(); err != nil {
+			if !errors.Is(err, fs.ErrNotExist) || path != DefaultPath() {
+				return nil, fmt.Errorf("failed to read config %s: %w", path, err)
+			}
+		}
+	}
+
+	var s Settings
+	if err := v.Unmarshal(&s); err != nil {
+		return nil, fmt.Errorf("invalid settings: %w", err)
+	}
+	if s.Workers < 1 {
+		return nil, fmt.Errorf("invalid settings: workers must be at least 1, got %d", s.Workers)
+	}
+	if s.StaleRetries < 0 {
+		return nil, fmt.Errorf("invalid settings: stale_retries must not be negative, got %d", s.StaleRetries)
+	}
+	if s.ChapterDelay < 0 {
+		return nil, fmt.Errorf("invalid settings: chapter_delay must not be negative, got %v", s.ChapterDelay)
+	}
+	if s.ImageWait <= 0 {
+		return nil, fmt.Errorf("invalid settings: image_wait must be positive, got %v", s.ImageWait)
+	}
+	if s.Jitter < 0 {
+		return nil, fmt.Errorf("invalid settings: jitter must not be negative, got %v", s.Jitter)
+	}
+	if s.MinPageBytes < 0 {
+		return nil, fmt.Errorf("invalid settings: min_page_bytes must not be negative, got %d", s.MinPageBytes)
+	}
+	if s.MinPageSize < 0 {
+		return nil, fmt.Errorf("invalid settings: min_page_size must not be negative, got %d", s.MinPageSize)
+	}
+	if s.MaxBPS < 0 {
+		return nil, fmt.Errorf("invalid settings: max_bps must not be negative, got %d", s.MaxBPS)
+	}
+	if s.ChapterWorkers < 1 {
+		return nil, fmt.Errorf("invalid settings: chapter_workers must be at least 1, got %d", s.ChapterWorkers)
+	}
+	if s.MaxInflight < 0 {
+		return nil, fmt.Errorf("invalid settings: max_inflight must not be negative, got %d", s.MaxInflight)
+	}
+	if s.MaxBrowsers < 0 {
+		return nil, fmt.Errorf("invalid settings: max_browsers must not be negative, got %d", s.MaxBrowsers)
+	}
+	s.OutputDir = ExpandPath(s.OutputDir)
+	return &s, nil
+}
+
+// ExpandPath expands environment variables and a leading ~ in path, so
+// settings like "$HOME/comics" or "~/comics" name the user's directory
+func ExpandPath(path string) string {
+	path = os.ExpandEnv(path)
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, path[1:])
+		}
+	}
+	return path
+}
@@ -0,0 +1,265 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	s, err := Load("")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if s.Workers != DefaultWorkers || s.Format != "cbz" || s.BlockResources {
+		t.Fatalf("unexpected defaults: %+v", s)
+	}
+}
+
+func TestLoadFileOverriddenByEnv(t *testing.T) {
+	path := writeConfig(t, `
+workers = 2
+format = "epub"
+output_dir = "/comics"
+proxy = "socks5://127.0.0.1:1080"
+`)
+	t.Setenv("COMICSD_WORKERS", "6")
+
+	s, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if s.Workers != 6 {
+		t.Errorf("env should override file workers, got %d", s.Workers)
+	}
+	if s.Format != "epub" || s.OutputDir != "/comics" || s.Proxy != "socks5://127.0.0.1:1080" {
+		t.Errorf("file values not loaded: %+v", s)
+	}
+}
+
+func TestLoadMissingExplicitFile(t *testing.T) {
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.toml")); err == nil {
+		t.Fatalf("expected error for missing explicit config")
+	}
+}
+
+func TestLoadRejectsInvalidWorkers(t *testing.T) {
+	t.Setenv("COMICSD_WORKERS", "0")
+	if _, err := Load(""); err == nil {
+		t.Fatalf("expected error for zero workers")
+	}
+}
+
+func TestLoadMaxBPSFromEnv(t *testing.T) {
+	t.Setenv("COMICSD_MAX_BPS", "524288")
+	s, err := Load("")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if s.MaxBPS != 524288 {
+		t.Errorf("expected max_bps 524288, got %d", s.MaxBPS)
+	}
+
+	t.Setenv("COMICSD_MAX_BPS", "-1")
+	if _, err := Load(""); err == nil {
+		t.Fatalf("expected error for negative max_bps")
+	}
+}
+
+func TestLoadMaxInflightFromEnv(t *testing.T) {
+	t.Setenv("COMICSD_MAX_INFLIGHT", "3")
+	s, err := Load("")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if s.MaxInflight != 3 {
+		t.Errorf("expected max_inflight 3, got %d", s.MaxInflight)
+	}
+
+	t.Setenv("COMICSD_MAX_INFLIGHT", "-1")
+	if _, err := Load(""); err == nil {
+		t.Fatalf("expected error for negative max_inflight")
+	}
+}
+
+func TestLoadMaxBrowsersFromEnv(t *testing.T) {
+	t.Setenv("COMICSD_MAX_BROWSERS", "2")
+	s, err := Load("")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if s.MaxBrowsers != 2 {
+		t.Errorf("expected max_browsers 2, got %d", s.MaxBrowsers)
+	}
+
+	t.Setenv("COMICSD_MAX_BROWSERS", "-1")
+	if _, err := Load(""); err == nil {
+		t.Fatalf("expected error for negative max_browsers")
+	}
+}
+
+func TestLoadExpandsOutputDir(t *testing.T) {
+	t.Setenv("HOME", "/home/reader")
+	t.Setenv("COMICS", "manga")
+	path := writeConfig(t, `output_dir = "$HOME/${COMICS}"`)
+
+	s, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if s.OutputDir != "/home/reader/manga" {
+		t.Errorf("unexpected output dir: %s", s.OutputDir)
+	}
+}
+
+func TestExpandPath(t *testing.T) {
+	t.Setenv("HOME", "/home/reader")
+	tests := map[string]string{
+		"~":             "/home/reader",
+		"~/comics":      "/home/reader/comics",
+		"$HOME/comics":  "/home/reader/comics",
+		"/data/~/x":     "/data/~/x",
+		"~other/comics": "~other/comics",
+		"":              "",
+	}
+	for in, want := range tests {
+		if got := ExpandPath(in); got != want {
+			t.Errorf("ExpandPath(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestLoadChapterDelayFromEnv(t *testing.T) {
+	t.Setenv("COMICSD_CHAPTER_DELAY", "1m30s")
+	s, err := Load("")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if s.ChapterDelay != 90*time.Second {
+		t.Errorf("expected chapter_delay 1m30s, got %v", s.ChapterDelay)
+	}
+
+	t.Setenv("COMICSD_CHAPTER_DELAY", "-1s")
+	if _, err := Load(""); err == nil {
+		t.Fatalf("expected error for negative chapter_delay")
+	}
+}
+
+func TestLoadJitterFromEnv(t *testing.T) {
+	s, err := Load("")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if s.Jitter != 0 {
+		t.Errorf("expected no jitter by default, got %v", s.Jitter)
+	}
+
+	t.Setenv("COMICSD_JITTER", "300ms")
+	if s, err = Load(""); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if s.Jitter != 300*time.Millisecond {
+		t.Errorf("expected jitter 300ms, got %v", s.Jitter)
+	}
+
+	t.Setenv("COMICSD_JITTER", "-1s")
+	if _, err := Load(""); err == nil {
+		t.Fatalf("expected error for negative jitter")
+	}
+}
+
+func TestLoadImageWaitFromEnv(t *testing.T) {
+	s, err := Load("")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if s.ImageWait != 10*time.Second {
+		t.Errorf("expected image wait 10s by default, got %v", s.ImageWait)
+	}
+
+	t.Setenv("COMICSD_IMAGE_WAIT", "30s")
+	if s, err = Load(""); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if s.ImageWait != 30*time.Second {
+		t.Errorf("expected image wait 30s, got %v", s.ImageWait)
+	}
+
+	t.Setenv("COMICSD_IMAGE_WAIT", "0s")
+	if _, err := Load(""); err == nil {
+		t.Fatalf("expected error for no image wait")
+	}
+}
+
+func TestLoadStaleRetriesFromEnv(t *testing.T) {
+	s, err := Load("")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if s.StaleRetries != 2 {
+		t.Errorf("expected default stale_retries 2, got %d", s.StaleRetries)
+	}
+
+	t.Setenv("COMICSD_STALE_RETRIES", "5")
+	if s, err = Load(""); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if s.StaleRetries != 5 {
+		t.Errorf("expected stale_retries 5, got %d", s.StaleRetries)
+	}
+
+	t.Setenv("COMICSD_STALE_RETRIES", "-1")
+	if _, err := Load(""); err == nil {
+		t.Fatalf("expected error for negative stale_retries")
+	}
+}
+
+func TestLoadChapterWorkersFromEnv(t *testing.T) {
+	s, err := Load("")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if s.ChapterWorkers != 1 {
+		t.Errorf("expected chapter_workers to default to 1, got %d", s.ChapterWorkers)
+	}
+
+	t.Setenv("COMICSD_CHAPTER_WORKERS", "3")
+	if s, err = Load(""); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if s.ChapterWorkers != 3 {
+		t.Errorf("expected chapter_workers 3, got %d", s.ChapterWorkers)
+	}
+
+	t.Setenv("COMICSD_CHAPTER_WORKERS", "0")
+	if _, err := Load(""); err == nil {
+		t.Fatalf("expected error for chapter_workers 0")
+	}
+}
+
+func TestLoadPageMinimumsFromEnv(t *testing.T) {
+	t.Setenv("COMICSD_MIN_PAGE_BYTES", "5120")
+	t.Setenv("COMICSD_MIN_PAGE_SIZE", "100")
+	s, err := Load("")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if s.MinPageBytes != 5120 || s.MinPageSize != 100 {
+		t.Errorf("expected min_page_bytes 5120 and min_page_size 100, got %d and %d", s.MinPageBytes, s.MinPageSize)
+	}
+
+	t.Setenv("COMICSD_MIN_PAGE_SIZE", "-1")
+	if _, err := Load(""); err == nil {
+		t.Fatalf("expected error for negative min_page_size")
+	}
+}
@@ -0,0 +1,29 @@
+package config
+
+import (
+	"github.com/pelletier/go-toml/v2"
+)
+
+// SummarizeEntry is one comic of a summarize.toml, keyed by its config name
+type SummarizeEntry struct {
+	Title    string   `toml:"title"`
+	MangaID  string   `toml:"mangaid"`
+	Chapters []string `toml:"chapters"`
+	// Format is the output format, empty for the default
+	Format string `toml:"format,omitempty"`
+}
+
+// MarshalSummarize encodes entries as a summarize.toml, one table per
+// config name, escaping every value
+func MarshalSummarize(entries map[string]SummarizeEntry) ([]byte, error) {
+	return toml.Marshal(entries)
+}
+
+// ParseSummarize decodes a summarize.toml
+func ParseSummarize(data []byte) (map[string]SummarizeEntry, error) {
+	var entries map[string]SummarizeEntry
+	if err := toml.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,29 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSummarizeRoundTrip(t *testing.T) {
+	entries := map[string]SummarizeEntry{
+		`my "manga"`: {
+			Title:    "He said \"hi\"\nthen left \\ 東大特訓班 'quoted'",
+			MangaID:  "1128",
+			Chapters: []string{"566271", `"odd"`},
+			Format:   "epub",
+		},
+		"plain": {Title: "Plain", MangaID: "1", Chapters: []string{"2"}},
+	}
+	data, err := MarshalSummarize(entries)
+	if err != nil {
+		t.Fatalf("MarshalSummarize failed: %v", err)
+	}
+	got, err := ParseSummarize(data)
+	if err != nil {
+		t.Fatalf("generated config does not parse: %v\n%s", err, data)
+	}
+	if !reflect.DeepEqual(got, entries) {
+		t.Errorf("round trip changed the config:\n%s\ngot %#v", data, got)
+	}
+}
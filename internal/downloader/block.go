@@ -0,0 +1,39 @@
+package downloader
+
+import (
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+)
+
+// DefaultBlockedURLs are the non-essential resources skipped when resource
+// blocking is enabled. The manga image host is deliberately absent so page
+// images still load.
+var DefaultBlockedURLs = []string{
+	"*.css",
+	"*.woff",
+	"*.woff2",
+	"*.ttf",
+	"*.otf",
+	"*google-analytics.com*",
+	"*googletagmanager.com*",
+	"*googlesyndication.com*",
+	"*doubleclick.net*",
+	"*cnzz.com*",
+	"*hm.baidu.com*",
+}
+
+// BlockedURLs are the URL patterns reader tabs refuse to load. It is empty by
+// default; set it to DefaultBlockedURLs to save bandwidth.
+var BlockedURLs []string
+
+// blockURLs stops the tab from loading resources matching patterns.
+// It does nothing when patterns is empty.
+func blockURLs(patterns []string) chromedp.Action {
+	if len(patterns) == 0 {
+		return chromedp.Tasks{}
+	}
+	return chromedp.Tasks{
+		network.Enable(),
+		network.SetBlockedURLS(patterns),
+	}
+}
@@ -0,0 +1,67 @@
+package downloader
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+)
+
+// matchesPattern reports whether url matches a SetBlockedURLS wildcard pattern
+func matchesPattern(pattern, url string) bool {
+	parts := strings.Split(pattern, "*")
+	for i, p := range parts {
+		parts[i] = regexp.QuoteMeta(p)
+	}
+	return regexp.MustCompile("^" + strings.Join(parts, ".*") + "$").MatchString(url)
+}
+
+func blocked(url string) bool {
+	for _, p := range DefaultBlockedURLs {
+		if matchesPattern(p, url) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestDefaultBlockedURLsKeepImages(t *testing.T) {
+	for _, url := range []string{
+		"https://i.hamreus.com/ps3/d/dongdatebanzc/%E7%AC%AC07%E5%9B%9E/001.jpg.webp?e=1&m=2",
+		"https://cf.hamreus.com/cpic/b/26964.jpg",
+		"https://tw.manhuagui.com/comic/26964/718179.html",
+	} {
+		if blocked(url) {
+			t.Errorf("%s should not be blocked", url)
+		}
+	}
+	for _, url := range []string{
+		"https://cf.hamreus.com/css/view.css",
+		"https://www.google-analytics.com/analytics.js",
+		"https://hm.baidu.com/hm.js?abc",
+	} {
+		if !blocked(url) {
+			t.Errorf("%s should be blocked", url)
+		}
+	}
+}
+
+func TestBlockURLsAppliesPatterns(t *testing.T) {
+	if tasks := blockURLs(nil).(chromedp.Tasks); len(tasks) != 0 {
+		t.Fatalf("expected no actions without patterns, got %d", len(tasks))
+	}
+
+	tasks := blockURLs(DefaultBlockedURLs).(chromedp.Tasks)
+	if len(tasks) != 2 {
+		t.Fatalf("expected enable and block actions, got %d", len(tasks))
+	}
+	params, ok := tasks[1].(*network.SetBlockedURLSParams)
+	if !ok {
+		t.Fatalf("unexpected action %T", tasks[1])
+	}
+	if strings.Join(params.Urls, ",") != strings.Join(DefaultBlockedURLs, ",") {
+		t.Fatalf("blocked patterns not applied: %v", params.Urls)
+	}
+}
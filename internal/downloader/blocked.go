@@ -0,0 +1,62 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"comicsd/internal/site"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/chromedp"
+)
+
+// ErrBlocked is returned when the site serves an anti-bot or CAPTCHA page
+// instead of the requested one
+var ErrBlocked = errors.New("blocked by the site's anti-bot check; wait before retrying, slow down with chapter_delay, jitter or max_bps, or switch proxy")
+
+// blockCheckInterval is how often WaitReady looks for the block page
+const blockCheckInterval = 500 * time.Millisecond
+
+// WaitReady waits until the element ready of the page in the tab shows. It
+// fails with ErrBlocked once s's block page shows instead, rather than
+// waiting for an element that never comes.
+func WaitReady(s site.Adapter, ready string) chromedp.Action {
+	blocked := s.Blocked()
+	if blocked == "" {
+		return chromedp.WaitVisible(ready)
+	}
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		waitCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		found := make(chan struct{})
+		go func() {
+			ticker := time.NewTicker(blockCheckInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+				case <-waitCtx.Done():
+					return
+				}
+				var nodes []*cdp.Node
+				if err := chromedp.Nodes(blocked, &nodes, chromedp.ByQueryAll, chromedp.AtLeast(0)).Do(waitCtx); err == nil && len(nodes) > 0 {
+					close(found)
+					cancel()
+					return
+				}
+			}
+		}()
+
+		err := chromedp.WaitVisible(ready).Do(waitCtx)
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-found:
+			return ErrBlocked
+		default:
+			return err
+		}
+	})
+}
@@ -0,0 +1,197 @@
+package downloader
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+)
+
+// DefaultImageSelectors are the elements tried for the page image when
+// #mangaFile has no src, covering layouts that show the page as a CSS
+// background instead of an <img>
+var DefaultImageSelectors = []string{
+	"#mangaBox img",
+	"#mangaBox [style*=\"background\"]",
+}
+
+// ImageSelectors are the alternative elements of new downloads, tried in
+// order. Layouts drawing the page into a canvas have none and fall back to
+// the largest image the page loaded.
+var ImageSelectors = DefaultImageSelectors
+
+// ParseImageSelectors splits a comma-separated list of CSS selectors, empty
+// for DefaultImageSelectors
+func ParseImageSelectors(list string) []string {
+	var selectors []string
+	for _, s := range strings.Split(list, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			selectors = append(selectors, s)
+		}
+	}
+	if len(selectors) == 0 {
+		return DefaultImageSelectors
+	}
+	return selectors
+}
+
+// DefaultImageWait is the default of ImageWait
+const DefaultImageWait = 10 * time.Second
+
+// ImageWait bounds the wait of new downloads for the reader's image or an
+// alternative element to appear in the page. Layouts drawing the page into a
+// canvas have neither, so their downloads go on to the largest image once it
+// elapsed. An image that appeared is waited for as long as the download runs.
+var ImageWait = DefaultImageWait
+
+// imageSelector returns the CSS selector list matching the reader's image or
+// any of the alternative selectors
+func imageSelector(image string, selectors []string) string {
+	return strings.Join(append([]string{image}, selectors...), ", ")
+}
+
+// waitImage waits until the reader's image or an alternative element shows
+// the page. Only when none of them appears within dl.imageWait, as in
+// layouts drawing the page into a canvas, does it give up, leaving the page
+// to the largest image.
+func (dl *ComicsDL) waitImage(ctx context.Context) error {
+	sel := imageSelector(dl.site.Reader().Image, dl.selectors)
+	present, err := waitImagePresent(ctx, sel, dl.imageWait)
+	if err != nil {
+		return err
+	}
+	if !present {
+		log.Printf("no %s after %s, looking for the largest image", sel, dl.imageWait)
+		return nil
+	}
+	// However slow the mirror, the element shows the page once loaded
+	return waitImageShown(ctx, sel, imageSourceJS(dl.site.Reader().Image, dl.selectors))
+}
+
+// waitImagePresent waits at most wait for an element matching sel to be in
+// the page, reporting whether one is. Defined as a variable for tests.
+var waitImagePresent = func(ctx context.Context, sel string, wait time.Duration) (bool, error) {
+	js := fmt.Sprintf("document.querySelector(%s) !== null", jsString(sel))
+	err := chromedp.Poll(js, nil, chromedp.WithPollingTimeout(wait)).Do(ctx)
+	if errors.Is(err, chromedp.ErrPollingTimeout) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// waitImageShown waits until an element matching sel is visible and the
+// source lookup expr finds the image it shows loaded. Defined as a variable
+// for tests.
+var waitImageShown = func(ctx context.Context, sel, expr string) error {
+	if err := chromedp.WaitVisible(sel, chromedp.ByQuery).Do(ctx); err != nil {
+		return err
+	}
+	return chromedp.Poll(fmt.Sprintf("(%s).loaded", expr), nil, chromedp.WithPollingTimeout(0)).Do(ctx)
+}
+
+// jsString quotes s as a JavaScript string literal
+func jsString(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
+
+// imageSource is the page image found by imageSourceJS
+type imageSource struct {
+	// Present is set when the reader's image or an alternative element is
+	// in the page, even without an image yet
+	Present bool `json:"present"`
+	// Src is the URL of the image, empty when none is shown yet
+	Src string `json:"src"`
+	// Loaded is set once the browser finished loading an <img> source;
+	// background images count as loaded
+	Loaded bool `json:"loaded"`
+}
+
+// evalImageSource evaluates the image source lookup in the tab. Defined as a
+// variable for tests.
+var evalImageSource = func(ctx context.Context, expr string, src *imageSource) error {
+	return chromedp.Evaluate(expr, src).Do(ctx)
+}
+
+// imageSourceJS returns the script finding the URL of the page image among
+// the reader's image and selectors: the src of an <img>, else a CSS
+// background image
+func imageSourceJS(image string, selectors []string) string {
+	list, _ := json.Marshal(append([]string{image}, selectors...))
+	return fmt.Sprintf(`(() => {
+	let present = false;
+	for (const sel of %s) {
+		for (const el of document.querySelectorAll(sel)) {
+			present = true;
+			if (el.tagName === 'IMG' && el.getAttribute('src')) {
+				return {present, src: el.getAttribute('src'), loaded: el.complete && el.naturalWidth > 0};
+			}
+			const bg = getComputedStyle(el).backgroundImage.match(/url\(["']?(.*?)["']?\)/);
+			if (bg) return {present, src: bg[1], loaded: true};
+		}
+	}
+	return {present, src: '', loaded: false};
+})()`, list)
+}
+
+// errNoImageSource fails a page whose image element shows no image yet
+var errNoImageSource = errors.New("the page image has no source yet")
+
+// pageRequestID finds the request of the page image: the src of #mangaFile,
+// else the image of the first alternative selector showing one. Only when
+// none of them is in the page, as in layouts drawing the page into a canvas,
+// is the largest image the page loaded taken, since it may be a preloaded
+// neighbouring page.
+func (dl *ComicsDL) pageRequestID(ctx context.Context) (network.RequestID, error) {
+	var src imageSource
+	if err := evalImageSource(ctx, imageSourceJS(dl.site.Reader().Image, dl.selectors), &src); err != nil {
+		return "", err
+	}
+	if src.Src != "" {
+		return dl.findRequestID(src.Src)
+	}
+	if src.Present {
+		return "", errNoImageSource
+	}
+	if v, ok := dl.largestImage(); ok {
+		return v, nil
+	}
+	return "", errors.New("no such image")
+}
+
+// trackImage records an image response of the page so it can be picked by
+// size once it finished loading. The caller holds dl.mu.
+func (dl *ComicsDL) trackImage(id network.RequestID, mimeType string) {
+	if strings.HasPrefix(mimeType, "image/") {
+		dl.images[id] = 0
+	}
+}
+
+// imageLoaded records the size of a finished image response. The caller
+// holds dl.mu.
+func (dl *ComicsDL) imageLoaded(id network.RequestID, size float64) {
+	if _, ok := dl.images[id]; ok {
+		dl.images[id] = size
+	}
+}
+
+// largestImage returns the request of the largest image loaded since the
+// last page load
+func (dl *ComicsDL) largestImage() (network.RequestID, bool) {
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+	var largest network.RequestID
+	var max float64
+	for id, size := range dl.images {
+		if size > max {
+			largest, max = id, size
+		}
+	}
+	return largest, max > 0
+}
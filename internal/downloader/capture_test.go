@@ -0,0 +1,174 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"comicsd/internal/site"
+
+	"github.com/chromedp/cdproto/network"
+)
+
+func TestParseImageSelectors(t *testing.T) {
+	got := ParseImageSelectors(" #mangaBox img , .page ,")
+	if strings.Join(got, "|") != "#mangaBox img|.page" {
+		t.Errorf("unexpected selectors: %q", got)
+	}
+	if got := ParseImageSelectors(""); len(got) != len(DefaultImageSelectors) {
+		t.Errorf("expected the default selectors, got %q", got)
+	}
+}
+
+func TestImageSourceJSTriesMangaFileFirst(t *testing.T) {
+	js := imageSourceJS(site.Default.Reader().Image, []string{".page img"})
+	if !strings.Contains(js, `["#mangaFile",".page img"]`) {
+		t.Errorf("unexpected selector list: %s", js)
+	}
+}
+
+// stubImageSource makes the image source lookup return src
+func stubImageSource(t *testing.T, src imageSource) {
+	t.Helper()
+	orig := evalImageSource
+	t.Cleanup(func() { evalImageSource = orig })
+	evalImageSource = func(ctx context.Context, expr string, res *imageSource) error {
+		*res = src
+		return nil
+	}
+}
+
+func TestPageRequestIDUsesSelectorSource(t *testing.T) {
+	stubImageSource(t, imageSource{Present: true, Src: "https://i.hamreus.com/bg.jpg", Loaded: true})
+	dl := trackingDL()
+	dl.onEvent(&network.EventRequestWillBeSent{RequestID: "7", Request: &network.Request{URL: "https://i.hamreus.com/bg.jpg"}})
+
+	v, err := dl.pageRequestID(context.Background())
+	if err != nil || v != "7" {
+		t.Errorf("expected request 7, got %q, %v", v, err)
+	}
+}
+
+func TestPageRequestIDKeepsUnmatchedSource(t *testing.T) {
+	stubImageSource(t, imageSource{Present: true, Src: "https://i.hamreus.com/other.jpg", Loaded: true})
+	dl := trackingDL()
+	dl.onEvent(&network.EventResponseReceived{RequestID: "2", Response: &network.Response{MimeType: "image/jpeg"}})
+	dl.onEvent(&network.EventLoadingFinished{RequestID: "2", EncodedDataLength: 250000})
+
+	// The largest image may be a neighbouring page, so a source that was
+	// found but not loaded fails instead
+	if v, err := dl.pageRequestID(context.Background()); err == nil {
+		t.Errorf("expected an error, got request %q", v)
+	}
+}
+
+func TestImageSelector(t *testing.T) {
+	if got := imageSelector("#mangaFile", []string{"#mangaBox img", ".page"}); got != "#mangaFile, #mangaBox img, .page" {
+		t.Errorf("unexpected selector: %s", got)
+	}
+}
+
+func TestPageRequestIDTakesLargestImage(t *testing.T) {
+	stubImageSource(t, imageSource{})
+	dl := trackingDL()
+	for _, r := range []struct {
+		id   network.RequestID
+		mime string
+		size float64
+	}{
+		{"1", "image/gif", 800},
+		{"2", "image/jpeg", 250000},
+		{"3", "text/html", 900000},
+		{"4", "image/webp", 0},
+	} {
+		dl.onEvent(&network.EventResponseReceived{RequestID: r.id, Response: &network.Response{MimeType: r.mime}})
+		if r.size > 0 {
+			dl.onEvent(&network.EventLoadingFinished{RequestID: r.id, EncodedDataLength: r.size})
+		}
+	}
+
+	v, err := dl.pageRequestID(context.Background())
+	if err != nil || v != "2" {
+		t.Errorf("expected the largest loaded image 2, got %q, %v", v, err)
+	}
+
+	dl.resetRequests()
+	if _, err := dl.pageRequestID(context.Background()); err == nil || err.Error() != "no such image" {
+		t.Errorf("expected no image after a reset, got %v", err)
+	}
+}
+
+// loadLargeImage makes dl load a large image, as a preloaded neighbouring
+// page would be
+func loadLargeImage(dl *ComicsDL) {
+	dl.onEvent(&network.EventResponseReceived{RequestID: "9", Response: &network.Response{MimeType: "image/jpeg"}})
+	dl.onEvent(&network.EventLoadingFinished{RequestID: "9", EncodedDataLength: 900000})
+}
+
+func TestPageRequestIDWaitsForMangaFileSource(t *testing.T) {
+	stubImageSource(t, imageSource{Present: true})
+	dl := trackingDL()
+	loadLargeImage(dl)
+
+	if v, err := dl.pageRequestID(context.Background()); !errors.Is(err, errNoImageSource) {
+		t.Errorf("expected no image source, got request %q, %v", v, err)
+	}
+}
+
+func TestPageRequestIDTakesLoadingSource(t *testing.T) {
+	stubImageSource(t, imageSource{Present: true, Src: "https://i.hamreus.com/1.jpg"})
+	dl := trackingDL()
+	loadLargeImage(dl)
+	dl.onEvent(&network.EventRequestWillBeSent{RequestID: "1", Request: &network.Request{URL: "https://i.hamreus.com/1.jpg"}})
+	dl.onEvent(&network.EventResponseReceived{RequestID: "1", Response: &network.Response{MimeType: "image/jpeg"}})
+
+	v, err := dl.pageRequestID(context.Background())
+	if err != nil || v != "1" {
+		t.Errorf("expected the loading request 1, got %q, %v", v, err)
+	}
+}
+
+// stubImageWait makes the image element present or not, recording whether
+// waitImage went on to wait for it to show
+func stubImageWait(t *testing.T, present bool) *bool {
+	t.Helper()
+	origPresent, origShown := waitImagePresent, waitImageShown
+	t.Cleanup(func() { waitImagePresent, waitImageShown = origPresent, origShown })
+	waitImagePresent = func(ctx context.Context, sel string, wait time.Duration) (bool, error) {
+		if wait != time.Second {
+			t.Errorf("expected to wait a second for %s, got %s", sel, wait)
+		}
+		return present, nil
+	}
+	shown := false
+	waitImageShown = func(ctx context.Context, sel, expr string) error {
+		if _, ok := ctx.Deadline(); ok {
+			t.Error("expected to wait for the image without a deadline")
+		}
+		shown = true
+		return nil
+	}
+	return &shown
+}
+
+func TestWaitImageGoesOnWithoutElement(t *testing.T) {
+	shown := stubImageWait(t, false)
+	dl := trackingDL()
+	dl.imageWait = time.Second
+
+	if err := dl.waitImage(context.Background()); err != nil || *shown {
+		t.Errorf("expected to go on to the largest image, got %v, shown %v", err, *shown)
+	}
+}
+
+func TestWaitImageWaitsForPresentElement(t *testing.T) {
+	shown := stubImageWait(t, true)
+	dl := trackingDL()
+	dl.imageWait = time.Second
+
+	if err := dl.waitImage(context.Background()); err != nil || !*shown {
+		t.Errorf("expected to wait for the image to show, got %v, shown %v", err, *shown)
+	}
+}
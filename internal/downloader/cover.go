@@ -0,0 +1,37 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"comicsd/internal/site"
+)
+
+// DownloadCover fetches the cover image at coverURL with a direct HTTP GET.
+// The image host rejects requests without the site's referer.
+func DownloadCover(ctx context.Context, coverURL string) ([]byte, error) {
+	if strings.HasPrefix(coverURL, "//") {
+		coverURL = "https:" + coverURL
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, coverURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Referer", site.Default.Referer())
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status fetching cover: %s", resp.Status)
+	}
+
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,37 @@
+package downloader_test
+
+import (
+	"comicsd/internal/downloader"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDownloadCoverSendsReferer(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Referer") == "" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		w.Write([]byte("cover"))
+	}))
+	defer srv.Close()
+
+	data, err := downloader.DownloadCover(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatalf("DownloadCover failed: %v", err)
+	}
+	if string(data) != "cover" {
+		t.Fatalf("unexpected data: %q", data)
+	}
+}
+
+func TestDownloadCoverMissing(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	if _, err := downloader.DownloadCover(context.Background(), srv.URL); err == nil {
+		t.Fatalf("expected error for missing cover")
+	}
+}
@@ -0,0 +1,48 @@
+package downloader
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+)
+
+// ChapterDelay is the pause between finishing one chapter and starting the
+// next, easing the rapid chapter switching the site may block. Zero for none.
+var ChapterDelay time.Duration
+
+// PauseChapter waits ChapterDelay before the next chapter. It returns false
+// when stop is closed first.
+func PauseChapter(stop <-chan struct{}) bool {
+	if ChapterDelay <= 0 {
+		return true
+	}
+	timer := time.NewTimer(ChapterDelay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-stop:
+		return false
+	}
+}
+
+// Jitter is the longest a page download waits, for a random time, before
+// loading its reader, so tabs downloading at once fall out of step instead of
+// hitting the site together. Zero for none.
+var Jitter time.Duration
+
+// pauseJitter waits a random time of up to Jitter. It returns the context's
+// error when it is done first.
+func pauseJitter(ctx context.Context) error {
+	if Jitter <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(rand.N(Jitter))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
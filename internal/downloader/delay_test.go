@@ -0,0 +1,51 @@
+package downloader
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPauseChapter(t *testing.T) {
+	defer func(d time.Duration) { ChapterDelay = d }(ChapterDelay)
+
+	ChapterDelay = 0
+	if !PauseChapter(nil) {
+		t.Error("expected no pause without a delay")
+	}
+
+	ChapterDelay = 20 * time.Millisecond
+	start := time.Now()
+	if !PauseChapter(nil) || time.Since(start) < ChapterDelay {
+		t.Errorf("expected a pause of %v, got %v", ChapterDelay, time.Since(start))
+	}
+
+	ChapterDelay = time.Hour
+	stop := make(chan struct{})
+	close(stop)
+	if PauseChapter(stop) {
+		t.Error("expected the pause to end when stopped")
+	}
+}
+
+func TestPauseJitter(t *testing.T) {
+	defer func(d time.Duration) { Jitter = d }(Jitter)
+
+	Jitter = 20 * time.Millisecond
+	for range 5 {
+		start := time.Now()
+		if err := pauseJitter(context.Background()); err != nil {
+			t.Fatalf("pauseJitter failed: %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > Jitter+50*time.Millisecond {
+			t.Errorf("paused %v, longer than the jitter of %v", elapsed, Jitter)
+		}
+	}
+
+	Jitter = time.Hour
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := pauseJitter(ctx); err != context.Canceled {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+}
@@ -3,10 +3,13 @@ package downloader
 import (
 	"context"
 	"errors"
-	"fmt"
 	"io"
 	"log"
 	"net/url"
+	"sync"
+	"time"
+
+	"comicsd/internal/site"
 
 	"github.com/chromedp/cdproto/cdp"
 	"github.com/chromedp/cdproto/dom"
@@ -15,59 +18,141 @@ import (
 )
 
 type ComicsDL struct {
-	url    string
-	urlMap map[string]network.RequestID
-	ctx    context.Context
-	Pages  []string
+	mu      sync.Mutex
+	urlMap  map[string]network.RequestID
+	ctx     context.Context
+	cancel  context.CancelFunc
+	blocked []string
+	// loads tracks when the requests of the current page load finish
+	loads map[network.RequestID]*requestLoad
+	// skipReload tries each page without reloading it first
+	skipReload bool
+	wait       WaitStrategy
+	Pages      []string
+	// selectors are tried for the page image when #mangaFile has no src
+	selectors []string
+	// imageWait bounds the wait for the page image element to appear
+	imageWait time.Duration
+	// images are the sizes of the image responses of the current page load,
+	// zero until loaded
+	images map[network.RequestID]float64
+	// site locates the reader of the chapter comicID/chapterID
+	site      site.Adapter
+	comicID   string
+	chapterID string
 }
 
 func NewDownload(ctx context.Context, id1, id2 string) (*ComicsDL, error) {
-	baseUrl := fmt.Sprintf("https://tw.manhuagui.com/comic/%s/%s.html", id1, id2)
-	dl := &ComicsDL{
-		baseUrl,
-		make(map[string]network.RequestID),
-		ctx,
-		make([]string, 0),
+	if err := ValidateIDs(id1, id2); err != nil {
+		return nil, err
 	}
-
-	//setup listeners
-	chromedp.ListenTarget(ctx, func(v interface{}) {
-		switch ev := v.(type) {
-		case *network.EventRequestWillBeSent:
-			unEscaped, err := url.PathUnescape(ev.Request.URL)
-			dl.urlMap[ev.Request.URL] = ev.RequestID
-
-			if err == nil {
-				dl.urlMap[unEscaped] = ev.RequestID
-			}
-		}
-	})
+	dl := newComicsDL(ctx, id1, id2, make([]string, 0))
 
 	if err := chromedp.Run(ctx,
-		chromedp.Navigate(baseUrl),
-		chromedp.WaitVisible(`#mangaBox`),
+		blockURLs(dl.blocked),
+		NavigateMirrors(dl.site, func(s site.Adapter) string { return s.ChapterURL(dl.comicID, dl.chapterID) }, &dl.site),
+		WaitReady(dl.site, dl.site.Reader().Ready),
 	); err != nil {
+		dl.Close()
 		return nil, err
 	}
 
 	if err := dl.GetPages(); err != nil {
+		dl.Close()
 		return nil, err
 	}
 
 	return dl, nil
 }
 
+// NewDownloadWithPages prepares a chapter download whose pages are already known,
+// skipping the reader page visit NewDownload uses to enumerate them
+func NewDownloadWithPages(ctx context.Context, id1, id2 string, pages []string) *ComicsDL {
+	return newComicsDL(ctx, id1, id2, pages)
+}
+
+func newComicsDL(ctx context.Context, id1, id2 string, pages []string) *ComicsDL {
+	// The listener is scoped to its own context so Close can detach it; otherwise
+	// every download created on a tab keeps receiving that tab's events
+	lctx, cancel := context.WithCancel(ctx)
+	dl := &ComicsDL{
+		site:       OnWorkingMirror(site.Default),
+		comicID:    id1,
+		chapterID:  id2,
+		urlMap:     make(map[string]network.RequestID),
+		loads:      make(map[network.RequestID]*requestLoad),
+		images:     make(map[network.RequestID]float64),
+		ctx:        ctx,
+		cancel:     cancel,
+		blocked:    BlockedURLs,
+		skipReload: SkipReload,
+		wait:       Wait,
+		selectors:  ImageSelectors,
+		imageWait:  ImageWait,
+		Pages:      pages,
+	}
+
+	//setup listeners
+	chromedp.ListenTarget(lctx, dl.onEvent)
+
+	return dl
+}
+
+// onEvent tracks the requests of the tab: the request ID of every URL, when
+// each response finished loading and the sizes of the images
+func (dl *ComicsDL) onEvent(v interface{}) {
+	switch ev := v.(type) {
+	case *network.EventRequestWillBeSent:
+		unEscaped, err := url.PathUnescape(ev.Request.URL)
+		dl.mu.Lock()
+		dl.urlMap[ev.Request.URL] = ev.RequestID
+
+		if err == nil {
+			dl.urlMap[unEscaped] = ev.RequestID
+		}
+		dl.mu.Unlock()
+	case *network.EventResponseReceived:
+		dl.mu.Lock()
+		dl.trackImage(ev.RequestID, ev.Response.MimeType)
+		dl.mu.Unlock()
+	case *network.EventLoadingFinished:
+		dl.mu.Lock()
+		dl.imageLoaded(ev.RequestID, ev.EncodedDataLength)
+		dl.mu.Unlock()
+		dl.finishLoad(ev.RequestID, nil)
+	case *network.EventLoadingFailed:
+		dl.finishLoad(ev.RequestID, errors.New("image failed to load: "+ev.ErrorText))
+	}
+}
+
+// Close detaches the network listener of the download
+func (dl *ComicsDL) Close() {
+	dl.cancel()
+}
+
 func (dl *ComicsDL) GetPages() error {
 	var nodes []*cdp.Node
 	if err := chromedp.Run(dl.ctx,
-		chromedp.Nodes("#pageSelect", &nodes),
+		chromedp.Nodes(dl.site.Reader().Pages, &nodes),
 		chromedp.ActionFunc(func(ctx context.Context) error {
-			dom.RequestChildNodes(nodes[0].NodeID).WithDepth(1).Do(ctx)
+			// Depth 2 includes the text of each option, its label
+			dom.RequestChildNodes(nodes[0].NodeID).WithDepth(2).Do(ctx)
+			var options []pageOption
 			for _, n := range nodes[0].Children {
 				if page, existed := n.Attribute("value"); existed {
-					dl.Pages = append(dl.Pages, page)
+					options = append(options, pageOption{value: page, label: optionLabel(n)})
 				}
 			}
+			pages := orderPages(dl.chapterID, options)
+			// A long chapter's select may not list every page
+			if sel := dl.site.Reader().PageCount; sel != "" {
+				var label string
+				if err := chromedp.Evaluate(pageCountJS(sel), &label).Do(ctx); err != nil {
+					log.Printf("chapter %s: cannot read the page count: %v", dl.chapterID, err)
+				}
+				pages = completePages(dl.chapterID, pages, parsePageTotal(label))
+			}
+			dl.Pages = append(dl.Pages, pages...)
 			return nil
 		}),
 	); err != nil {
@@ -76,7 +161,20 @@ func (dl *ComicsDL) GetPages() error {
 	return nil
 }
 
+// resetRequests forgets the request IDs of earlier page loads, so a lookup
+// can only match a response of the load that follows
+func (dl *ComicsDL) resetRequests() {
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+	dl.urlMap = make(map[string]network.RequestID)
+	dl.loads = make(map[network.RequestID]*requestLoad)
+	dl.images = make(map[network.RequestID]float64)
+}
+
 func (dl *ComicsDL) findRequestID(src string) (network.RequestID, error) {
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+
 	if v, b := dl.urlMap[src]; b {
 		return v, nil
 	}
@@ -91,33 +189,63 @@ func (dl *ComicsDL) findRequestID(src string) (network.RequestID, error) {
 }
 
 func (dl *ComicsDL) DownloadPageTo(pageNo string, writer io.Writer) error {
-	var src string
-	var b bool
-	return chromedp.Run(dl.ctx,
-		chromedp.Navigate(fmt.Sprintf(`%s#p=%s`, dl.url, pageNo)),
-		chromedp.Reload(),
-		chromedp.WaitVisible(`#mangaFile`),
-		chromedp.AttributeValue(`#mangaFile`, "src", &src, &b),
+	if err := pauseJitter(dl.ctx); err != nil {
+		return err
+	}
+	data, err := fetchChecked(dl.ctx, pageNo, func() ([]byte, error) {
+		return fetchFresh(dl.ctx, pageNo, func() ([]byte, error) {
+			if dl.skipReload {
+				return loadWithoutReload(dl.ctx, pageNo, func(reload bool) ([]byte, error) {
+					return dl.fetchPage(pageNo, reload)
+				})
+			}
+			return dl.fetchPage(pageNo, true)
+		})
+	})
+	if err != nil {
+		return err
+	}
+	_, err = throttle(dl.ctx, writer).Write(data)
+	return err
+}
+
+// fetchPage loads the reader at pageNo, reloading it after the navigation when
+// reload is set, and returns the body of the image it shows. Without the
+// reload the image must show up within noReloadWait.
+func (dl *ComicsDL) fetchPage(pageNo string, reload bool) ([]byte, error) {
+	var data []byte
+	dl.resetRequests()
+
+	ctx := dl.ctx
+	load := chromedp.Tasks{
+		blockURLs(dl.blocked),
+		chromedp.Navigate(dl.site.PageURL(dl.comicID, dl.chapterID, pageNo)),
+	}
+	if reload {
+		load = append(load, chromedp.Reload())
+	} else {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, noReloadWait)
+		defer cancel()
+	}
+	err := chromedp.Run(ctx,
+		load,
+		// Some layouts show the page as a background or in a canvas
+		chromedp.ActionFunc(dl.waitImage),
 		chromedp.ActionFunc(func(ctx context.Context) error {
-			if b {
-				if v, err := dl.findRequestID(src); err == nil {
-					log.Println(v)
-
-					data, err := network.GetResponseBody(v).Do(ctx)
-					if err == nil {
-						if _, err := writer.Write(data); err != nil {
-							return err
-						}
-					} else {
-						return err
-					}
-				} else {
+			v, err := dl.pageRequestID(ctx)
+			if err != nil {
+				return err
+			}
+			log.Println(v)
+			if dl.wait == WaitLoaded {
+				if err := dl.waitLoaded(ctx, v); err != nil {
 					return err
 				}
-			} else {
-				return errors.New("no such image")
 			}
-			return nil
+			data, err = network.GetResponseBody(v).Do(ctx)
+			return err
 		}),
 	)
+	return data, err
 }
@@ -0,0 +1,151 @@
+package downloader
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/chromedp/chromedp"
+)
+
+// chapterPages loads a chapter in its own tab and returns its page list.
+// Defined as a variable for tests.
+var chapterPages = func(ctx context.Context, comicID, chapterID string) ([]string, error) {
+	tabCtx, cancel := chromedp.NewContext(ctx)
+	defer cancel()
+
+	dl, err := NewDownload(tabCtx, comicID, chapterID)
+	if err != nil {
+		return nil, err
+	}
+	defer dl.Close()
+
+	return dl.Pages, nil
+}
+
+// startBrowser starts the browser of ctx up front, so every tab shares it
+// rather than allocating its own
+func startBrowser(ctx context.Context) error {
+	if c := chromedp.FromContext(ctx); c != nil && c.Browser == nil {
+		return chromedp.Run(ctx)
+	}
+	return nil
+}
+
+// EnumeratePages collects the page lists of the given chapters using up to
+// workers concurrent tabs. The result is in the same order as chapterIDs.
+func EnumeratePages(ctx context.Context, comicID string, chapterIDs []string, workers int) ([][]string, error) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	if err := startBrowser(ctx); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	pages := make([][]string, len(chapterIDs))
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+
+	for i, chapterID := range chapterIDs {
+		wg.Add(1)
+		go func(i int, chapterID string) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-sem }()
+
+			log.Printf("Preparing chapter %s (%d/%d)", chapterID, i+1, len(chapterIDs))
+			p, err := chapterPages(ctx, comicID, chapterID)
+			if err != nil {
+				once.Do(func() {
+					firstErr = ChapterError(comicID, chapterID, err)
+					cancel()
+				})
+				return
+			}
+			pages[i] = p
+		}(i, chapterID)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return pages, nil
+}
+
+// chapterResult is the enumerated page list of one chapter
+type chapterResult struct {
+	pages []string
+	err   error
+	// enumerated is set when the chapter holds a worker until it is taken
+	enumerated bool
+}
+
+// StreamPages enumerates the page lists of the given chapters in the
+// background and returns a function waiting for the list of the i-th chapter.
+// At most workers chapters are enumerated or waiting to be taken at a time,
+// so enumerating the next chapters overlaps downloading the current one.
+// The lists must be taken in order, each once.
+func StreamPages(ctx context.Context, comicID string, chapterIDs []string, workers int) (func(i int) ([]string, error), error) {
+	if workers < 1 {
+		workers = 1
+	}
+	if err := startBrowser(ctx); err != nil {
+		return nil, err
+	}
+
+	results := make([]chan chapterResult, len(chapterIDs))
+	for i := range results {
+		results[i] = make(chan chapterResult, 1)
+	}
+	sem := make(chan struct{}, workers)
+	go func() {
+		for i, chapterID := range chapterIDs {
+			acquired := false
+			select {
+			case sem <- struct{}{}:
+				acquired = true
+			case <-ctx.Done():
+			}
+			// Either case may be picked once cancelled, so check again
+			if err := ctx.Err(); err != nil {
+				if acquired {
+					<-sem
+				}
+				for _, r := range results[i:] {
+					r <- chapterResult{err: err}
+				}
+				return
+			}
+			go func(i int, chapterID string) {
+				log.Printf("Preparing chapter %s (%d/%d)", chapterID, i+1, len(chapterIDs))
+				pages, err := chapterPages(ctx, comicID, chapterID)
+				if err != nil {
+					err = ChapterError(comicID, chapterID, err)
+				}
+				results[i] <- chapterResult{pages: pages, err: err, enumerated: true}
+			}(i, chapterID)
+		}
+	}()
+
+	return func(i int) ([]string, error) {
+		r := <-results[i]
+		if r.enumerated {
+			<-sem
+		}
+		return r.pages, r.err
+	}, nil
+}
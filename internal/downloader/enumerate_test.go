@@ -0,0 +1,137 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEnumeratePagesPreservesOrder(t *testing.T) {
+	orig := chapterPages
+	defer func() { chapterPages = orig }()
+
+	var active, maxActive int32
+	chapterPages = func(ctx context.Context, comicID, chapterID string) ([]string, error) {
+		n := atomic.AddInt32(&active, 1)
+		defer atomic.AddInt32(&active, -1)
+		for {
+			m := atomic.LoadInt32(&maxActive)
+			if n <= m || atomic.CompareAndSwapInt32(&maxActive, m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		return []string{chapterID + "-1", chapterID + "-2"}, nil
+	}
+
+	chapters := []string{"a", "b", "c", "d", "e", "f"}
+	pages, err := EnumeratePages(context.Background(), "1", chapters, 2)
+	if err != nil {
+		t.Fatalf("EnumeratePages failed: %v", err)
+	}
+	for i, chapterID := range chapters {
+		if pages[i][0] != chapterID+"-1" {
+			t.Errorf("chapter %d out of order: %v", i, pages[i])
+		}
+	}
+	if maxActive > 2 {
+		t.Errorf("expected at most 2 concurrent enumerations, got %d", maxActive)
+	}
+}
+
+func TestEnumeratePagesReturnsError(t *testing.T) {
+	orig := chapterPages
+	defer func() { chapterPages = orig }()
+
+	chapterPages = func(ctx context.Context, comicID, chapterID string) ([]string, error) {
+		if chapterID == "bad" {
+			return nil, errors.New("chapter missing")
+		}
+		return []string{"1"}, nil
+	}
+
+	_, err := EnumeratePages(context.Background(), "1", []string{"a", "bad", "c"}, 2)
+	if err == nil || err.Error() != "comic 1 chapter bad: chapter missing" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestStreamPagesStaysWithinWorkers(t *testing.T) {
+	orig := chapterPages
+	defer func() { chapterPages = orig }()
+
+	var started int32
+	chapterPages = func(ctx context.Context, comicID, chapterID string) ([]string, error) {
+		atomic.AddInt32(&started, 1)
+		return []string{chapterID + "-1"}, nil
+	}
+
+	chapters := []string{"a", "b", "c", "d", "e"}
+	next, err := StreamPages(context.Background(), "1", chapters, 2)
+	if err != nil {
+		t.Fatalf("StreamPages failed: %v", err)
+	}
+	// Nothing is taken yet, so only the first two chapters may be enumerated
+	time.Sleep(20 * time.Millisecond)
+	if n := atomic.LoadInt32(&started); n != 2 {
+		t.Errorf("expected 2 chapters enumerated ahead, got %d", n)
+	}
+	for i, chapterID := range chapters {
+		pages, err := next(i)
+		if err != nil {
+			t.Fatalf("chapter %s: %v", chapterID, err)
+		}
+		if pages[0] != chapterID+"-1" {
+			t.Errorf("chapter %d out of order: %v", i, pages)
+		}
+	}
+}
+
+func TestStreamPagesReturnsErrors(t *testing.T) {
+	orig := chapterPages
+	defer func() { chapterPages = orig }()
+
+	chapterPages = func(ctx context.Context, comicID, chapterID string) ([]string, error) {
+		if chapterID == "bad" {
+			return nil, errors.New("chapter missing")
+		}
+		return []string{"1"}, nil
+	}
+
+	next, err := StreamPages(context.Background(), "1", []string{"a", "bad"}, 2)
+	if err != nil {
+		t.Fatalf("StreamPages failed: %v", err)
+	}
+	if _, err := next(0); err != nil {
+		t.Errorf("chapter a: %v", err)
+	}
+	if _, err := next(1); err == nil || err.Error() != "comic 1 chapter bad: chapter missing" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestStreamPagesStopsWhenCancelled(t *testing.T) {
+	orig := chapterPages
+	defer func() { chapterPages = orig }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	chapterPages = func(ctx context.Context, comicID, chapterID string) ([]string, error) {
+		return []string{"1"}, nil
+	}
+
+	next, err := StreamPages(ctx, "1", []string{"a", "b", "c"}, 1)
+	if err != nil {
+		t.Fatalf("StreamPages failed: %v", err)
+	}
+	if _, err := next(0); err != nil {
+		t.Fatalf("chapter a: %v", err)
+	}
+	cancel()
+	// Chapter b may have started before the cancellation; c cannot have
+	next(1)
+	if _, err := next(2); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
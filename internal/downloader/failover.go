@@ -0,0 +1,102 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"comicsd/internal/site"
+
+	"github.com/chromedp/chromedp"
+	"go.uber.org/multierr"
+)
+
+// navigate loads url in the tab of ctx. Defined as a variable for tests.
+var navigate = func(ctx context.Context, url string) error {
+	return chromedp.Navigate(url).Do(ctx)
+}
+
+var (
+	mirrorMu sync.Mutex
+	// workingMirror is the host that last loaded a page, tried first by the
+	// following loads of the session
+	workingMirror string
+)
+
+// OnWorkingMirror returns s reading from the mirror that last loaded a page,
+// or s itself when no page loaded yet or s has no mirrors
+func OnWorkingMirror(s site.Adapter) site.Adapter {
+	m, ok := s.(site.Mirrored)
+	mirrorMu.Lock()
+	host := workingMirror
+	mirrorMu.Unlock()
+	if !ok || host == "" {
+		return s
+	}
+	return m.OnHost(host)
+}
+
+// NavigateMirrors navigates the tab to the page of s that page names. When
+// the host cannot be reached, the page is loaded from the other Mirrors in
+// turn, and *used, unless nil, is set to s on the mirror that loaded it. A page that loads
+// but shows an error, such as not found, is not retried. When every mirror
+// fails, their errors are returned together.
+func NavigateMirrors(s site.Adapter, page func(site.Adapter) string, used *site.Adapter) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		m, ok := s.(site.Mirrored)
+		if !ok {
+			if used != nil {
+				*used = s
+			}
+			return navigate(ctx, page(s))
+		}
+
+		var errs error
+		for _, host := range mirrorOrder(m.HostName()) {
+			adapter := m.OnHost(host)
+			err := navigate(ctx, page(adapter))
+			if err == nil {
+				mirrorMu.Lock()
+				workingMirror = host
+				mirrorMu.Unlock()
+				if used != nil {
+					*used = adapter
+				}
+				return nil
+			}
+			if ctx.Err() != nil || !unreachable(err) {
+				return err
+			}
+			log.Printf("mirror %s unreachable, trying the next one: %v", host, err)
+			errs = multierr.Append(errs, fmt.Errorf("%s: %w", host, err))
+		}
+		return fmt.Errorf("no mirror reachable: %w", errs)
+	})
+}
+
+// mirrorOrder returns the hosts to try for a page of host: the mirror that
+// last worked, host itself, then the other Mirrors
+func mirrorOrder(host string) []string {
+	mirrorMu.Lock()
+	hosts := []string{workingMirror, host}
+	mirrorMu.Unlock()
+	hosts = append(hosts, Mirrors...)
+
+	seen := make(map[string]bool, len(hosts))
+	order := make([]string, 0, len(hosts))
+	for _, h := range hosts {
+		if h != "" && !seen[h] {
+			seen[h] = true
+			order = append(order, h)
+		}
+	}
+	return order
+}
+
+// unreachable tells network failures, such as an unresolved host, a refused
+// connection or a timeout, from the other navigation errors
+func unreachable(err error) bool {
+	return strings.Contains(err.Error(), "net::ERR_") && !strings.Contains(err.Error(), "net::ERR_ABORTED")
+}
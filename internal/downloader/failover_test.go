@@ -0,0 +1,87 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"comicsd/internal/site"
+)
+
+// stubNavigate fails loading pages of the given hosts with err and records
+// the loaded URLs
+func stubNavigate(t *testing.T, down map[string]error) *[]string {
+	t.Helper()
+	origNavigate, origMirrors := navigate, Mirrors
+	t.Cleanup(func() {
+		navigate, Mirrors = origNavigate, origMirrors
+		workingMirror = ""
+	})
+	Mirrors = []string{"a.example", "b.example", "c.example"}
+	workingMirror = ""
+
+	urls := new([]string)
+	navigate = func(ctx context.Context, url string) error {
+		*urls = append(*urls, url)
+		for host, err := range down {
+			if strings.Contains(url, "//"+host+"/") {
+				return err
+			}
+		}
+		return nil
+	}
+	return urls
+}
+
+func comicPage(s site.Adapter) string { return s.ComicURL("1128") }
+
+func TestNavigateMirrorsFailsOver(t *testing.T) {
+	urls := stubNavigate(t, map[string]error{"a.example": errors.New("page load error net::ERR_NAME_NOT_RESOLVED")})
+
+	var used site.Adapter
+	if err := NavigateMirrors(site.Manhuagui{Host: "a.example"}, comicPage, &used).Do(context.Background()); err != nil {
+		t.Fatalf("NavigateMirrors failed: %v", err)
+	}
+	if used.ComicURL("1128") != "https://b.example/comic/1128/" {
+		t.Errorf("expected the next mirror, got %s", used.ComicURL("1128"))
+	}
+
+	// The working mirror is tried first from now on
+	*urls = nil
+	if err := NavigateMirrors(site.Manhuagui{Host: "a.example"}, comicPage, nil).Do(context.Background()); err != nil {
+		t.Fatalf("NavigateMirrors failed: %v", err)
+	}
+	if len(*urls) != 1 || (*urls)[0] != "https://b.example/comic/1128/" {
+		t.Errorf("expected only the working mirror loaded, got %v", *urls)
+	}
+	if s := OnWorkingMirror(site.Manhuagui{}); s.ComicURL("1128") != "https://b.example/comic/1128/" {
+		t.Errorf("expected new downloads on the working mirror, got %s", s.ComicURL("1128"))
+	}
+}
+
+func TestNavigateMirrorsKeepsOtherErrors(t *testing.T) {
+	urls := stubNavigate(t, map[string]error{"a.example": errors.New("page load error net::ERR_ABORTED")})
+
+	if err := NavigateMirrors(site.Manhuagui{Host: "a.example"}, comicPage, nil).Do(context.Background()); err == nil {
+		t.Fatalf("expected the navigation error")
+	}
+	if len(*urls) != 1 {
+		t.Errorf("expected no failover, loaded %v", *urls)
+	}
+}
+
+func TestNavigateMirrorsReportsEveryMirror(t *testing.T) {
+	down := errors.New("page load error net::ERR_CONNECTION_TIMED_OUT")
+	stubNavigate(t, map[string]error{"a.example": down, "b.example": down, "c.example": down})
+
+	err := NavigateMirrors(site.Manhuagui{Host: "a.example"}, comicPage, nil).Do(context.Background())
+	if err == nil {
+		t.Fatalf("expected an error when every mirror is down")
+	}
+	for _, host := range Mirrors {
+		if !strings.Contains(err.Error(), host+": page load error") {
+			t.Errorf("expected the error of %s in %v", host, err)
+		}
+	}
+}
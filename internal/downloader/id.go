@@ -0,0 +1,44 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// ErrInvalidID is returned for comic and chapter IDs that are not numeric
+var ErrInvalidID = errors.New("invalid ID")
+
+// idPattern matches the numeric comic and chapter IDs of manhuagui URLs
+var idPattern = regexp.MustCompile(`^\d+$`)
+
+// ValidateIDs checks that the comic ID and chapter IDs are numeric before
+// they are put into a URL to navigate to
+func ValidateIDs(comicID string, chapterIDs ...string) error {
+	if !idPattern.MatchString(comicID) {
+		return fmt.Errorf("%w: comic ID %q must be numeric", ErrInvalidID, comicID)
+	}
+	for _, id := range chapterIDs {
+		if !idPattern.MatchString(id) {
+			return fmt.Errorf("%w: chapter ID %q must be numeric", ErrInvalidID, id)
+		}
+	}
+	return nil
+}
+
+// DedupeIDs returns ids without repeats, keeping the first-seen order, and
+// each ID that was repeated
+func DedupeIDs(ids []string) (unique, duplicates []string) {
+	seen := make(map[string]int, len(ids))
+	unique = make([]string, 0, len(ids))
+	for _, id := range ids {
+		seen[id]++
+		switch seen[id] {
+		case 1:
+			unique = append(unique, id)
+		case 2:
+			duplicates = append(duplicates, id)
+		}
+	}
+	return unique, duplicates
+}
@@ -0,0 +1,47 @@
+package downloader
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestValidateIDs(t *testing.T) {
+	tests := []struct {
+		comicID    string
+		chapterIDs []string
+		valid      bool
+	}{
+		{"1128", []string{"566271", "566272"}, true},
+		{"1128", nil, true},
+		{"", nil, false},
+		{"11a8", nil, false},
+		{"1128", []string{"566271", "../../evil"}, false},
+		{"1128", []string{"566271?x=1"}, false},
+		{"1128", []string{" 566271"}, false},
+	}
+	for _, tt := range tests {
+		err := ValidateIDs(tt.comicID, tt.chapterIDs...)
+		if tt.valid && err != nil {
+			t.Errorf("ValidateIDs(%q, %q) failed: %v", tt.comicID, tt.chapterIDs, err)
+		}
+		if !tt.valid && !errors.Is(err, ErrInvalidID) {
+			t.Errorf("ValidateIDs(%q, %q) = %v, expected ErrInvalidID", tt.comicID, tt.chapterIDs, err)
+		}
+	}
+}
+
+func TestDedupeIDs(t *testing.T) {
+	unique, duplicates := DedupeIDs([]string{"3", "1", "3", "2", "1", "3"})
+	if expected := []string{"3", "1", "2"}; !reflect.DeepEqual(unique, expected) {
+		t.Errorf("expected %v in first-seen order, got %v", expected, unique)
+	}
+	if expected := []string{"3", "1"}; !reflect.DeepEqual(duplicates, expected) {
+		t.Errorf("expected duplicates %v, got %v", expected, duplicates)
+	}
+
+	unique, duplicates = DedupeIDs([]string{"1", "2"})
+	if !reflect.DeepEqual(unique, []string{"1", "2"}) || duplicates != nil {
+		t.Errorf("expected no change without duplicates, got %v, %v", unique, duplicates)
+	}
+}
@@ -0,0 +1,57 @@
+package downloader
+
+import (
+	"context"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+// Mirrors are the known hosts of the site
+var Mirrors = []string{"tw.manhuagui.com", "www.manhuagui.com", "cn.manhuagui.com"}
+
+// MirrorStatus is the result of probing one mirror
+type MirrorStatus struct {
+	Host string `json:"host"`
+	Up   bool   `json:"up"`
+	// Latency is the time to load the home page, zero when down
+	Latency time.Duration `json:"latency"`
+	// Error explains why the mirror is down
+	Error string `json:"error,omitempty"`
+}
+
+// loadPage loads url in a new tab of ctx. Defined as a variable for tests.
+var loadPage = func(ctx context.Context, url string) error {
+	tabCtx, cancel := chromedp.NewContext(ctx)
+	defer cancel()
+	return chromedp.Run(tabCtx, chromedp.Navigate(url))
+}
+
+// ProbeMirrors loads the home page of every mirror in turn, giving each up to
+// timeout, and reports which are up and how long they took
+func ProbeMirrors(ctx context.Context, mirrors []string, timeout time.Duration) ([]MirrorStatus, error) {
+	// Keep the browser start out of the first mirror's latency
+	if err := startBrowser(ctx); err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MirrorStatus, 0, len(mirrors))
+	for _, host := range mirrors {
+		if err := ctx.Err(); err != nil {
+			return statuses, err
+		}
+		probeCtx, cancel := context.WithTimeout(ctx, timeout)
+		start := time.Now()
+		err := loadPage(probeCtx, "https://"+host+"/")
+		cancel()
+
+		status := MirrorStatus{Host: host, Up: err == nil}
+		if err != nil {
+			status.Error = err.Error()
+		} else {
+			status.Latency = time.Since(start)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
@@ -0,0 +1,43 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestProbeMirrors(t *testing.T) {
+	orig := loadPage
+	defer func() { loadPage = orig }()
+
+	var urls []string
+	loadPage = func(ctx context.Context, url string) error {
+		urls = append(urls, url)
+		if url == "https://down.example/" {
+			return errors.New("net::ERR_NAME_NOT_RESOLVED")
+		}
+		if url == "https://slow.example/" {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		return nil
+	}
+
+	statuses, err := ProbeMirrors(context.Background(), []string{"up.example", "down.example", "slow.example"}, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("ProbeMirrors failed: %v", err)
+	}
+	if len(urls) != 3 || urls[0] != "https://up.example/" {
+		t.Errorf("unexpected probes: %v", urls)
+	}
+	if !statuses[0].Up || statuses[0].Error != "" {
+		t.Errorf("expected up.example up: %+v", statuses[0])
+	}
+	if statuses[1].Up || statuses[1].Error != "net::ERR_NAME_NOT_RESOLVED" {
+		t.Errorf("expected down.example down: %+v", statuses[1])
+	}
+	if statuses[2].Up || statuses[2].Error != context.DeadlineExceeded.Error() {
+		t.Errorf("expected slow.example to time out: %+v", statuses[2])
+	}
+}
@@ -0,0 +1,138 @@
+package downloader
+
+import (
+	"log"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/chromedp/cdproto/cdp"
+)
+
+// SortPages orders each chapter's pages by the number in their page selector
+// labels (第3頁), else in their values, instead of keeping the selector's
+// order, and drops repeated pages. It is off by default as the selector
+// lists the pages in reading order.
+var SortPages bool
+
+// pageOption is an option of the reader's page selector
+type pageOption struct {
+	// value is the page ID
+	value string
+	// label is the text shown for the page, such as 第3頁
+	label string
+}
+
+// optionLabel returns the text of an option node, empty when its children
+// were not loaded
+func optionLabel(n *cdp.Node) string {
+	var label strings.Builder
+	for _, child := range n.Children {
+		if child.NodeType == cdp.NodeTypeText {
+			label.WriteString(child.NodeValue)
+		}
+	}
+	return strings.TrimSpace(label.String())
+}
+
+// pageNumberPattern finds the page number in an option label or value
+var pageNumberPattern = regexp.MustCompile(`\d+`)
+
+// number returns the page number of the option: the first number in its
+// label, else in its value
+func (o pageOption) number() (int, bool) {
+	for _, s := range []string{o.label, o.value} {
+		if m := pageNumberPattern.FindString(s); m != "" {
+			if n, err := strconv.Atoi(m); err == nil {
+				return n, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// orderPages returns the page IDs of a chapter's page selector options,
+// logging repeated pages, gaps in the page numbers and pages listed out of
+// order. With SortPages the pages are sorted by number and repeats dropped;
+// otherwise they are returned as listed.
+func orderPages(chapterID string, options []pageOption) []string {
+	numbers := make([]int, len(options))
+	numbered := true
+	for i, o := range options {
+		n, ok := o.number()
+		numbers[i] = n
+		numbered = numbered && ok
+	}
+
+	seen := make(map[string]bool, len(options))
+	var repeated []string
+	for _, o := range options {
+		if seen[o.value] {
+			repeated = append(repeated, o.value)
+		}
+		seen[o.value] = true
+	}
+	if len(repeated) > 0 {
+		log.Printf("chapter %s: pages listed more than once: %s", chapterID, strings.Join(repeated, ", "))
+	}
+	if numbered {
+		if !slices.IsSorted(numbers) {
+			log.Printf("chapter %s: pages are not listed in reading order", chapterID)
+		}
+		if gaps := pageGaps(numbers); len(gaps) > 0 {
+			log.Printf("chapter %s: pages missing from the page list: %s", chapterID, strings.Join(gaps, ", "))
+		}
+	}
+
+	if SortPages && numbered {
+		// Stable, so pages of the same number keep their listed order
+		sorted := make([]int, len(options))
+		for i := range sorted {
+			sorted[i] = i
+		}
+		slices.SortStableFunc(sorted, func(a, b int) int {
+			return numbers[a] - numbers[b]
+		})
+		ordered := make([]pageOption, len(options))
+		for i, j := range sorted {
+			ordered[i] = options[j]
+		}
+		options = ordered
+	}
+	pages := make([]string, 0, len(options))
+	kept := make(map[string]bool, len(options))
+	for _, o := range options {
+		if SortPages && kept[o.value] {
+			continue
+		}
+		kept[o.value] = true
+		pages = append(pages, o.value)
+	}
+	return pages
+}
+
+// maxPageGaps bounds the missing pages pageGaps lists
+const maxPageGaps = 10
+
+// pageGaps returns the page numbers from 1 to the highest listed that are
+// not listed, the first maxPageGaps of them followed by "..." when there are more
+func pageGaps(numbers []int) []string {
+	listed := make(map[int]bool, len(numbers))
+	last := 0
+	for _, n := range numbers {
+		listed[n] = true
+		last = max(last, n)
+	}
+	var gaps []string
+	for n := 1; n <= last; n++ {
+		if listed[n] {
+			continue
+		}
+		if len(gaps) == maxPageGaps {
+			return append(gaps, "...")
+		}
+		gaps = append(gaps, strconv.Itoa(n))
+	}
+	return gaps
+}
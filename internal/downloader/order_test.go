@@ -0,0 +1,67 @@
+package downloader
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+)
+
+// captureLog returns what fn logs
+func captureLog(t *testing.T, fn func()) string {
+	t.Helper()
+	var buf bytes.Buffer
+	orig := log.Writer()
+	log.SetOutput(&buf)
+	defer log.SetOutput(orig)
+	fn()
+	return buf.String()
+}
+
+func TestOrderPagesKeepsListedOrder(t *testing.T) {
+	options := []pageOption{{"1", "第1頁"}, {"3", "第3頁"}, {"2", "第2頁"}, {"3", "第3頁"}, {"6", "第6頁"}}
+	var pages []string
+	logged := captureLog(t, func() { pages = orderPages("566271", options) })
+	if got := strings.Join(pages, ","); got != "1,3,2,3,6" {
+		t.Errorf("expected the listed order, got %s", got)
+	}
+	for _, want := range []string{"listed more than once: 3", "not listed in reading order", "missing from the page list: 4, 5"} {
+		if !strings.Contains(logged, want) {
+			t.Errorf("expected %q in the log:\n%s", want, logged)
+		}
+	}
+}
+
+func TestOrderPagesSorts(t *testing.T) {
+	defer func(sort bool) { SortPages = sort }(SortPages)
+	SortPages = true
+	// The labels number the pages when the values do not
+	options := []pageOption{{"a", "第2頁"}, {"b", "第1頁"}, {"a", "第2頁"}, {"c", "第3頁"}}
+	if got := strings.Join(orderPages("566271", options), ","); got != "b,a,c" {
+		t.Errorf("expected pages sorted by label without repeats, got %s", got)
+	}
+
+	// Without a number everywhere the listed order is kept
+	options = []pageOption{{"b", "第2頁"}, {"a", "cover"}}
+	if got := strings.Join(orderPages("566271", options), ","); got != "b,a" {
+		t.Errorf("expected the listed order, got %s", got)
+	}
+}
+
+func TestOrderPagesQuietForRegularChapters(t *testing.T) {
+	options := []pageOption{{"1", ""}, {"2", ""}, {"3", ""}}
+	var pages []string
+	if logged := captureLog(t, func() { pages = orderPages("566271", options) }); logged != "" {
+		t.Errorf("expected nothing logged, got %s", logged)
+	}
+	if got := strings.Join(pages, ","); got != "1,2,3" {
+		t.Errorf("unexpected pages %s", got)
+	}
+}
+
+func TestPageGapsBounded(t *testing.T) {
+	gaps := pageGaps([]int{1000000})
+	if len(gaps) != maxPageGaps+1 || gaps[maxPageGaps] != "..." {
+		t.Errorf("expected %d gaps and an ellipsis, got %v", maxPageGaps, gaps)
+	}
+}
@@ -0,0 +1,31 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// ErrOutputExists is returned by CreateOutput when the file is already there
+var ErrOutputExists = errors.New("output file already exists")
+
+// CreateOutput creates the archive file at path, and its directory if
+// needed. An existing file is only truncated when overwrite is set, so
+// re-running a download cannot destroy a previous one by accident.
+func CreateOutput(path string, overwrite bool) (*os.File, error) {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0777); err != nil {
+			return nil, fmt.Errorf("cannot create output directory: %w", err)
+		}
+	}
+	if overwrite {
+		return os.Create(path)
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+	if errors.Is(err, fs.ErrExist) {
+		return nil, fmt.Errorf("%w: %s", ErrOutputExists, path)
+	}
+	return file, err
+}
@@ -0,0 +1,62 @@
+package downloader_test
+
+import (
+	"comicsd/internal/downloader"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCreateOutputRefusesToClobber(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "comic.cbz")
+	if err := os.WriteFile(path, []byte("previous download"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := downloader.CreateOutput(path, false); !errors.Is(err, downloader.ErrOutputExists) {
+		t.Fatalf("expected ErrOutputExists, got %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "previous download" {
+		t.Errorf("existing file was modified: %q", data)
+	}
+
+	file, err := downloader.CreateOutput(path, true)
+	if err != nil {
+		t.Fatalf("overwrite failed: %v", err)
+	}
+	file.Close()
+	if data, _ := os.ReadFile(path); len(data) != 0 {
+		t.Errorf("expected the file to be truncated, got %q", data)
+	}
+}
+
+func TestCreateOutputNewFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "comic.epub")
+	file, err := downloader.CreateOutput(path, false)
+	if err != nil {
+		t.Fatalf("CreateOutput failed: %v", err)
+	}
+	file.Close()
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("file not created: %v", err)
+	}
+}
+
+func TestCreateOutputCreatesDirectory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "comics", "new", "comic.cbz")
+	file, err := downloader.CreateOutput(path, false)
+	if err != nil {
+		t.Fatalf("CreateOutput failed: %v", err)
+	}
+	file.Close()
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("file not created: %v", err)
+	}
+
+	blocker := filepath.Join(t.TempDir(), "file")
+	os.WriteFile(blocker, nil, 0644)
+	if _, err := downloader.CreateOutput(filepath.Join(blocker, "comic.cbz"), false); err == nil {
+		t.Error("expected an error when the directory cannot be created")
+	}
+}
@@ -0,0 +1,61 @@
+package downloader
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+)
+
+// pageCountJS returns the script reading the text of the page count label,
+// empty when the reader has none. Unlike chromedp.Text it does not wait for
+// the element.
+func pageCountJS(sel string) string {
+	quoted, _ := json.Marshal(sel)
+	return fmt.Sprintf(`(() => {
+	const el = document.querySelector(%s);
+	return el ? el.textContent : "";
+})()`, quoted)
+}
+
+// pageTotalPattern finds the page count in a label such as "(1/45)"
+var pageTotalPattern = regexp.MustCompile(`/\s*(\d+)`)
+
+// parsePageTotal returns the page count shown by a label, 0 when it shows none
+func parsePageTotal(label string) int {
+	m := pageTotalPattern.FindStringSubmatch(label)
+	if m == nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(m[1])
+	return n
+}
+
+// completePages adds the pages a truncated page select leaves out. Page IDs
+// are page numbers, so when the reader counts total pages but the select
+// lists fewer, the pages past the highest listed one are added up to total.
+// A shortfall of pages that are not numbered is only reported.
+func completePages(chapterID string, pages []string, total int) []string {
+	if total <= len(pages) {
+		return pages
+	}
+	last := 0
+	for _, page := range pages {
+		n, err := strconv.Atoi(page)
+		if err != nil {
+			log.Printf("chapter %s: page list shows %d of %d pages", chapterID, len(pages), total)
+			return pages
+		}
+		last = max(last, n)
+	}
+	if last >= total {
+		// Short of pages in between, which orderPages reports
+		return pages
+	}
+	log.Printf("chapter %s: page list shows %d of %d pages, adding pages %d to %d", chapterID, len(pages), total, last+1, total)
+	for n := last + 1; n <= total; n++ {
+		pages = append(pages, strconv.Itoa(n))
+	}
+	return pages
+}
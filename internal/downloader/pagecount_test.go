@@ -0,0 +1,66 @@
+package downloader
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParsePageTotal(t *testing.T) {
+	tests := map[string]int{
+		"(1/45)":       45,
+		"( 3 / 1200 )": 1200,
+		"第1頁":          0,
+		"":             0,
+	}
+	for label, want := range tests {
+		if got := parsePageTotal(label); got != want {
+			t.Errorf("parsePageTotal(%q) = %d, want %d", label, got, want)
+		}
+	}
+}
+
+func TestCompletePagesOfLongChapter(t *testing.T) {
+	// The select of a 1000 page chapter lists only the first 200
+	var listed []string
+	for n := 1; n <= 200; n++ {
+		listed = append(listed, strconv.Itoa(n))
+	}
+	var pages []string
+	logged := captureLog(t, func() { pages = completePages("566271", listed, 1000) })
+	if len(pages) != 1000 {
+		t.Fatalf("expected 1000 pages, got %d", len(pages))
+	}
+	for i, page := range pages {
+		if page != strconv.Itoa(i+1) {
+			t.Fatalf("page %d is %s", i+1, page)
+		}
+	}
+	if !strings.Contains(logged, "shows 200 of 1000 pages, adding pages 201 to 1000") {
+		t.Errorf("unexpected log: %s", logged)
+	}
+}
+
+func TestCompletePagesKeepsCompleteOrUnnumberedLists(t *testing.T) {
+	if got := strings.Join(completePages("566271", []string{"1", "2", "3"}, 3), ","); got != "1,2,3" {
+		t.Errorf("complete list changed: %s", got)
+	}
+	if got := strings.Join(completePages("566271", []string{"1", "2"}, 0), ","); got != "1,2" {
+		t.Errorf("list without a count changed: %s", got)
+	}
+	// Missing pages in between are not the select's truncation
+	if got := strings.Join(completePages("566271", []string{"1", "3"}, 3), ","); got != "1,3" {
+		t.Errorf("list with a gap changed: %s", got)
+	}
+	var pages []string
+	logged := captureLog(t, func() { pages = completePages("566271", []string{"a", "b"}, 5) })
+	if strings.Join(pages, ",") != "a,b" || !strings.Contains(logged, "shows 2 of 5 pages") {
+		t.Errorf("unnumbered pages = %v, log %q", pages, logged)
+	}
+}
+
+func TestPageCountJSQuotesSelector(t *testing.T) {
+	if js := pageCountJS(`.title span[data-x="1"]`); !strings.Contains(js, `document.querySelector(".title span[data-x=\"1\"]")`) {
+		t.Errorf("unexpected script: %s", js)
+	}
+}
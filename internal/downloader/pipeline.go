@@ -0,0 +1,363 @@
+package downloader
+
+import (
+	"bytes"
+	"sync"
+)
+
+// inflightPerWorker is the default number of downloaded but not yet written
+// pages allowed per worker
+const inflightPerWorker = 2
+
+// InflightLimit returns the number of page buffers a download may hold
+// between download and write: max when set, else two per worker
+func InflightLimit(max, workers int) int {
+	if max > 0 {
+		return max
+	}
+	return inflightPerWorker * workers
+}
+
+// Fetch describes the pages FetchPages downloads
+type Fetch struct {
+	ComicID    string
+	ChapterIDs []string
+	// ChapterWorkers is the number of chapters downloaded at once. With 1
+	// or less they download one after another.
+	ChapterWorkers int
+	// ContinueOnError skips the rest of a chapter that fails, announcing
+	// it with a FetchedPage, instead of stopping
+	ContinueOnError bool
+	// ChapterPages returns the pages to download of the i-th chapter, nil
+	// for all of them
+	ChapterPages func(i int, cc PageSource) ([]string, error)
+	// TitlePage renders the page inserted before the i-th chapter, nil for
+	// none
+	TitlePage func(i int) ([]byte, error)
+	// Existing holds pages already downloaded by their index in the
+	// download, which are sent without fetching them again
+	Existing map[int][]byte
+}
+
+// FetchedPage is a page downloaded but not yet written, or the start of a
+// chapter when Start is set
+type FetchedPage struct {
+	ChapterID string
+	ID        string
+	Data      []byte
+	// Title marks a chapter title page
+	Title bool
+	// Start announces the Chapter-th chapter holding Pages pages
+	Start   bool
+	Chapter int
+	Pages   int
+	// Failed skips the rest of the Chapter-th chapter, failed with this
+	// error, with ContinueOnError
+	Failed error
+}
+
+// chapterPages returns the pages to download of the i-th chapter
+func (f Fetch) chapterPages(i int, cc PageSource) ([]string, error) {
+	if f.ChapterPages == nil {
+		return cc.PageIDs(), nil
+	}
+	return f.ChapterPages(i, cc)
+}
+
+// FetchPages downloads the pages in order into out. A slot of inflight is
+// taken before fetching each page and must be freed by the writer once the
+// page is written, so fetching waits when writing falls behind. It stops
+// early when done is closed.
+func FetchPages(f Fetch, openChapter ChapterOpener, out chan<- FetchedPage, inflight chan struct{}, done <-chan struct{}) error {
+	// Each chapter downloading at once needs a slot
+	f.ChapterWorkers = min(f.ChapterWorkers, len(f.ChapterIDs), cap(inflight))
+	if f.ChapterWorkers > 1 {
+		return fetchChapters(f, openChapter, out, inflight, done)
+	}
+	send := func(p FetchedPage) bool {
+		select {
+		case out <- p:
+			return true
+		case <-done:
+			return false
+		}
+	}
+	acquire := func() bool {
+		select {
+		case inflight <- struct{}{}:
+			return true
+		case <-done:
+			return false
+		}
+	}
+
+	page := 0
+	// fetchChapter sends the i-th chapter, returning false when done is closed
+	fetchChapter := func(i int, chapterID string) (bool, error) {
+		cc, err := openChapter(i)
+		if err != nil {
+			return true, err
+		}
+		defer cc.Close()
+		pages, err := f.chapterPages(i, cc)
+		if err != nil {
+			return true, err
+		}
+		if !send(FetchedPage{Start: true, Chapter: i, Pages: len(pages)}) {
+			return false, nil
+		}
+		if f.TitlePage != nil {
+			data, err := f.TitlePage(i)
+			if err != nil {
+				return true, ChapterError(f.ComicID, chapterID, err)
+			}
+			if !acquire() || !send(FetchedPage{ChapterID: chapterID, Data: data, Title: true}) {
+				return false, nil
+			}
+			page++
+		}
+		for _, p := range pages {
+			if !acquire() {
+				return false, nil
+			}
+			data, ok := f.Existing[page]
+			if !ok {
+				var buf bytes.Buffer
+				if err := cc.DownloadPageTo(p, &buf); err != nil {
+					<-inflight
+					return true, PageError(f.ComicID, chapterID, p, err)
+				}
+				data = buf.Bytes()
+			}
+			if !send(FetchedPage{ChapterID: chapterID, ID: p, Data: data}) {
+				return false, nil
+			}
+			page++
+		}
+		return true, nil
+	}
+
+	for i, chapterID := range f.ChapterIDs {
+		if i > 0 && !PauseChapter(done) {
+			return nil
+		}
+		select {
+		case <-done:
+			return nil
+		default:
+		}
+		more, err := fetchChapter(i, chapterID)
+		if err != nil && f.ContinueOnError {
+			if !send(FetchedPage{Chapter: i, Failed: err}) {
+				return nil
+			}
+			continue
+		}
+		if err != nil || !more {
+			return err
+		}
+	}
+	return nil
+}
+
+// chapterFetch is a chapter fetchChapters downloads alongside others
+type chapterFetch struct {
+	index int
+	pages int
+	// fetched holds the chapter's pages in order, closed once it is done;
+	// err is then set when it failed
+	fetched chan FetchedPage
+	err     error
+	// openErr is set when the chapter could not be opened
+	openErr error
+	// quota holds a slot per page the chapter downloaded but did not hand
+	// on yet, so chapters ahead cannot take every slot of inflight
+	quota chan struct{}
+}
+
+// fetchChapters is FetchPages downloading up to f.ChapterWorkers chapters
+// at once. Chapters download ahead into buffers of their own, while out still
+// receives the pages in order. Each page takes a slot of inflight before it
+// is downloaded, and a chapter holds at most its share of the slots, so the
+// chapter being written always gets one.
+func fetchChapters(f Fetch, openChapter ChapterOpener, out chan<- FetchedPage, inflight chan struct{}, done <-chan struct{}) error {
+	// quit stops the chapters once done is closed or fetchChapters returns
+	quit := make(chan struct{})
+	var stop sync.Once
+	halt := func() { stop.Do(func() { close(quit) }) }
+	go func() {
+		select {
+		case <-done:
+			halt()
+		case <-quit:
+		}
+	}()
+	var wg sync.WaitGroup
+	defer func() {
+		halt()
+		wg.Wait()
+	}()
+
+	share := max(cap(inflight)/f.ChapterWorkers, 1)
+	chapters := make(chan *chapterFetch, f.ChapterWorkers)
+	slots := make(chan struct{}, f.ChapterWorkers)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(chapters)
+		page := 0
+		for i := range f.ChapterIDs {
+			if i > 0 && !PauseChapter(quit) {
+				return
+			}
+			select {
+			case slots <- struct{}{}:
+			case <-quit:
+				return
+			}
+			c := &chapterFetch{index: i, fetched: make(chan FetchedPage, share), quota: make(chan struct{}, share)}
+			cc, err := openChapter(i)
+			var pages []string
+			if err == nil {
+				if pages, err = f.chapterPages(i, cc); err != nil {
+					cc.Close()
+				}
+			}
+			if err != nil {
+				<-slots
+				c.openErr = err
+				close(c.fetched)
+				select {
+				case chapters <- c:
+				case <-quit:
+					return
+				}
+				if !f.ContinueOnError {
+					return
+				}
+				continue
+			}
+			c.pages = len(pages)
+			select {
+			case chapters <- c:
+			case <-quit:
+				<-slots
+				cc.Close()
+				return
+			}
+			wg.Add(1)
+			go func(first int) {
+				defer wg.Done()
+				c.err = f.fetchChapter(c, cc, pages, first, inflight, quit)
+				close(c.fetched)
+				cc.Close()
+				<-slots
+			}(page)
+			if f.TitlePage != nil {
+				page++
+			}
+			page += len(pages)
+		}
+	}()
+
+	for c := range chapters {
+		err := c.openErr
+		if err == nil {
+			select {
+			case out <- FetchedPage{Start: true, Chapter: c.index, Pages: c.pages}:
+			case <-done:
+				return nil
+			}
+			for p := range c.fetched {
+				// The page keeps its slot of inflight until written
+				<-c.quota
+				select {
+				case out <- p:
+				case <-done:
+					return nil
+				}
+			}
+			err = c.err
+		}
+		if err == nil {
+			continue
+		}
+		if !f.ContinueOnError {
+			return err
+		}
+		select {
+		case out <- FetchedPage{Chapter: c.index, Failed: err}:
+		case <-done:
+			return nil
+		}
+	}
+	return nil
+}
+
+// fetchChapter downloads the pages of a chapter of fetchChapters, the first
+// being the first-th page of the download, into c.fetched. A slot of c.quota
+// and one of inflight are taken before fetching each page. It stops early
+// when quit is closed.
+func (f Fetch) fetchChapter(c *chapterFetch, cc PageSource, pages []string, first int, inflight chan struct{}, quit <-chan struct{}) error {
+	chapterID := f.ChapterIDs[c.index]
+	send := func(p FetchedPage) bool {
+		select {
+		case c.fetched <- p:
+			return true
+		case <-quit:
+			return false
+		}
+	}
+	acquire := func() bool {
+		select {
+		case c.quota <- struct{}{}:
+		case <-quit:
+			return false
+		}
+		select {
+		case inflight <- struct{}{}:
+			return true
+		case <-quit:
+			return false
+		}
+	}
+	release := func() {
+		<-inflight
+		<-c.quota
+	}
+
+	page := first
+	if f.TitlePage != nil {
+		if !acquire() {
+			return nil
+		}
+		data, err := f.TitlePage(c.index)
+		if err != nil {
+			release()
+			return ChapterError(f.ComicID, chapterID, err)
+		}
+		if !send(FetchedPage{ChapterID: chapterID, Data: data, Title: true}) {
+			return nil
+		}
+		page++
+	}
+	for _, p := range pages {
+		if !acquire() {
+			return nil
+		}
+		data, ok := f.Existing[page]
+		if !ok {
+			var buf bytes.Buffer
+			if err := cc.DownloadPageTo(p, &buf); err != nil {
+				release()
+				return PageError(f.ComicID, chapterID, p, err)
+			}
+			data = buf.Bytes()
+		}
+		if !send(FetchedPage{ChapterID: chapterID, ID: p, Data: data}) {
+			return nil
+		}
+		page++
+	}
+	return nil
+}
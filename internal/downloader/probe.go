@@ -0,0 +1,73 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"log"
+
+	_ "github.com/gen2brain/webp"
+)
+
+// ErrPlaceholder is returned for pages whose image is too small to be a real
+// page, such as the blank or error images the site sometimes serves instead
+var ErrPlaceholder = errors.New("placeholder image")
+
+// MinPageBytes and MinPageSize are the smallest size in bytes and the
+// smallest width or height in pixels of a page image. Smaller pages are
+// reloaded and fail as ErrPlaceholder when they stay small. Zero disables
+// either check.
+var (
+	MinPageBytes int
+	MinPageSize  int
+)
+
+// maxPlaceholderRetries bounds the reloads of a page that shows a placeholder
+const maxPlaceholderRetries = 2
+
+// checkPage returns ErrPlaceholder when data is below MinPageBytes or its
+// dimensions below MinPageSize. Images that cannot be decoded are only
+// checked for their size in bytes.
+func checkPage(data []byte) error {
+	if len(data) < MinPageBytes {
+		return fmt.Errorf("%w: %d bytes, expected at least %d", ErrPlaceholder, len(data), MinPageBytes)
+	}
+	if MinPageSize <= 0 {
+		return nil
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+	if cfg.Width < MinPageSize || cfg.Height < MinPageSize {
+		return fmt.Errorf("%w: %dx%d pixels, expected at least %d", ErrPlaceholder, cfg.Width, cfg.Height, MinPageSize)
+	}
+	return nil
+}
+
+// fetchChecked calls fetch, calling it again while the image it returns looks
+// like a placeholder
+func fetchChecked(ctx context.Context, pageNo string, fetch func() ([]byte, error)) ([]byte, error) {
+	data, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+	err = checkPage(data)
+	for attempt := 1; attempt <= maxPlaceholderRetries && err != nil; attempt++ {
+		log.Printf("page %s: %v, reloading (%d/%d)", pageNo, err, attempt, maxPlaceholderRetries)
+		countRetry(ctx)
+		if data, err = fetch(); err != nil {
+			return nil, err
+		}
+		err = checkPage(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
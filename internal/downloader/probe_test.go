@@ -0,0 +1,89 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"testing"
+)
+
+// pngPage encodes a blank w by h PNG
+func pngPage(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// setPageMinimums sets MinPageBytes and MinPageSize for the test
+func setPageMinimums(t *testing.T, bytes, size int) {
+	origBytes, origSize := MinPageBytes, MinPageSize
+	t.Cleanup(func() { MinPageBytes, MinPageSize = origBytes, origSize })
+	MinPageBytes, MinPageSize = bytes, size
+}
+
+func TestCheckPage(t *testing.T) {
+	small, large := pngPage(t, 40, 60), pngPage(t, 800, 1200)
+
+	setPageMinimums(t, 0, 0)
+	if err := checkPage(small); err != nil {
+		t.Errorf("expected no check by default, got %v", err)
+	}
+
+	setPageMinimums(t, 0, 100)
+	if err := checkPage(small); !errors.Is(err, ErrPlaceholder) {
+		t.Errorf("expected a 40x60 page to be a placeholder, got %v", err)
+	}
+	if err := checkPage(large); err != nil {
+		t.Errorf("expected an 800x1200 page to pass, got %v", err)
+	}
+	if err := checkPage([]byte("not an image but long enough")); err != nil {
+		t.Errorf("expected undecodable pages to pass the dimension check, got %v", err)
+	}
+
+	setPageMinimums(t, len(large)+1, 0)
+	if err := checkPage(large); !errors.Is(err, ErrPlaceholder) {
+		t.Errorf("expected a page below %d bytes to be a placeholder, got %v", MinPageBytes, err)
+	}
+}
+
+func TestFetchCheckedRetriesPlaceholders(t *testing.T) {
+	setPageMinimums(t, 0, 100)
+	calls := 0
+	before := Retries()
+	data, err := fetchChecked(context.Background(), "3", func() ([]byte, error) {
+		calls++
+		if calls < 2 {
+			return pngPage(t, 1, 1), nil
+		}
+		return pngPage(t, 200, 300), nil
+	})
+	if err != nil || len(data) == 0 {
+		t.Fatalf("expected the real page, got %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 fetches, got %d", calls)
+	}
+	if n := Retries() - before; n != 1 {
+		t.Errorf("expected 1 counted retry, got %d", n)
+	}
+}
+
+func TestFetchCheckedGivesUp(t *testing.T) {
+	setPageMinimums(t, 0, 100)
+	calls := 0
+	_, err := fetchChecked(context.Background(), "3", func() ([]byte, error) {
+		calls++
+		return pngPage(t, 1, 1), nil
+	})
+	if !errors.Is(err, ErrPlaceholder) {
+		t.Errorf("expected ErrPlaceholder, got %v", err)
+	}
+	if calls != maxPlaceholderRetries+1 {
+		t.Errorf("expected %d fetches, got %d", maxPlaceholderRetries+1, calls)
+	}
+}
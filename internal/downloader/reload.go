@@ -0,0 +1,28 @@
+package downloader
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// SkipReload makes page downloads try the reader without the reload that
+// follows each navigation, reloading only when that yields no image. It is
+// off by default because some pages only show their image after a reload.
+var SkipReload bool
+
+// noReloadWait bounds the wait for a page's image when the reload is skipped,
+// so a page that needs the reload falls back to it quickly
+const noReloadWait = 10 * time.Second
+
+// loadWithoutReload calls load without the reload first, falling back to a
+// load with the reload when that fails. Fallbacks count as retries.
+func loadWithoutReload(ctx context.Context, pageNo string, load func(reload bool) ([]byte, error)) ([]byte, error) {
+	data, err := load(false)
+	if err == nil {
+		return data, nil
+	}
+	log.Printf("page %s: no image without a reload, reloading: %v", pageNo, err)
+	countRetry(ctx)
+	return load(true)
+}
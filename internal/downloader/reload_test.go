@@ -0,0 +1,42 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestLoadWithoutReload(t *testing.T) {
+	var calls []bool
+	data, err := loadWithoutReload(context.Background(), "1", func(reload bool) ([]byte, error) {
+		calls = append(calls, reload)
+		return []byte("image"), nil
+	})
+	if err != nil || string(data) != "image" {
+		t.Fatalf("unexpected result %q, %v", data, err)
+	}
+	if len(calls) != 1 || calls[0] {
+		t.Errorf("expected a single load without reload, got %v", calls)
+	}
+}
+
+func TestLoadWithoutReloadFallsBack(t *testing.T) {
+	before := Retries()
+	var calls []bool
+	data, err := loadWithoutReload(context.Background(), "1", func(reload bool) ([]byte, error) {
+		calls = append(calls, reload)
+		if !reload {
+			return nil, errors.New("no such url: https://i.hamreus.com/1.jpg")
+		}
+		return []byte("image"), nil
+	})
+	if err != nil || string(data) != "image" {
+		t.Fatalf("unexpected result %q, %v", data, err)
+	}
+	if len(calls) != 2 || calls[0] || !calls[1] {
+		t.Errorf("expected a load without then with reload, got %v", calls)
+	}
+	if Retries()-before != 1 {
+		t.Errorf("expected the fallback counted as a retry")
+	}
+}
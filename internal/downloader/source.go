@@ -0,0 +1,90 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/chromedp/chromedp"
+)
+
+// PageSource is a chapter whose pages can be downloaded. ComicsDL implements
+// it with a browser tab; tests feed archive builders with fakes.
+type PageSource interface {
+	// PageIDs lists the chapter's page IDs in reading order
+	PageIDs() []string
+	// DownloadPageTo writes the image of a page to w
+	DownloadPageTo(page string, w io.Writer) error
+	// Close releases the resources held by the chapter
+	Close()
+}
+
+var _ PageSource = (*ComicsDL)(nil)
+
+// PageIDs returns the chapter's pages
+func (dl *ComicsDL) PageIDs() []string {
+	return dl.Pages
+}
+
+// ChapterError adds the comic and chapter a failure happened in to err
+func ChapterError(comicID, chapterID string, err error) error {
+	return fmt.Errorf("comic %s chapter %s: %w", comicID, chapterID, err)
+}
+
+// PageError adds the comic, chapter and page a download failed on to err. The
+// page is the reader's page ID, its number counted from 1.
+func PageError(comicID, chapterID, pageID string, err error) error {
+	return fmt.Errorf("comic %s chapter %s page %s: %w", comicID, chapterID, pageID, err)
+}
+
+// ChapterOpener opens the i-th chapter of a download, waiting until its pages
+// are enumerated. Chapters are opened in order and callers close every
+// chapter they open.
+type ChapterOpener func(i int) (PageSource, error)
+
+// OpenChapters starts enumerating the pages of chapterIDs using up to workers
+// tabs and returns an opener downloading each chapter in the tab of ctx. The
+// following chapters are enumerated while earlier ones download.
+func OpenChapters(ctx context.Context, comicID string, chapterIDs []string, workers int) (ChapterOpener, error) {
+	nextPages, err := StreamPages(ctx, comicID, chapterIDs, workers)
+	if err != nil {
+		return nil, err
+	}
+	return func(i int) (PageSource, error) {
+		pages, err := nextPages(i)
+		if err != nil {
+			return nil, err
+		}
+		return NewDownloadWithPages(ctx, comicID, chapterIDs[i], pages), nil
+	}, nil
+}
+
+// OpenChaptersInTabs is OpenChapters downloading every chapter in a new tab
+// of the browser of ctx, closed with the chapter, so several chapters can
+// download at once
+func OpenChaptersInTabs(ctx context.Context, comicID string, chapterIDs []string, workers int) (ChapterOpener, error) {
+	nextPages, err := StreamPages(ctx, comicID, chapterIDs, workers)
+	if err != nil {
+		return nil, err
+	}
+	return func(i int) (PageSource, error) {
+		pages, err := nextPages(i)
+		if err != nil {
+			return nil, err
+		}
+		tabCtx, closeTab := chromedp.NewContext(ctx)
+		return &tabChapter{ComicsDL: NewDownloadWithPages(tabCtx, comicID, chapterIDs[i], pages), closeTab: closeTab}, nil
+	}, nil
+}
+
+// tabChapter is a chapter downloading in a tab of its own
+type tabChapter struct {
+	*ComicsDL
+	closeTab context.CancelFunc
+}
+
+// Close stops tracking the tab's requests and closes the tab
+func (c *tabChapter) Close() {
+	c.ComicsDL.Close()
+	c.closeTab()
+}
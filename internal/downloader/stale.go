@@ -0,0 +1,39 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// DefaultStaleRetries is the number of reloads of a page whose response body
+// the browser has already discarded
+const DefaultStaleRetries = 2
+
+// StaleRetries bounds the reloads of a page whose response body the browser
+// has already discarded, 0 to fail at once
+var StaleRetries = DefaultStaleRetries
+
+// isStaleResource reports whether err is the browser refusing a response body
+// because the request ID no longer refers to a kept response. A page image
+// that was never requested fails differently, with "no such url".
+func isStaleResource(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "No resource with given identifier")
+}
+
+// fetchFresh calls fetch, calling it again while it fails with a stale
+// request ID. Each call navigates to the page again, so the browser requests
+// the image anew.
+func fetchFresh(ctx context.Context, pageNo string, fetch func() ([]byte, error)) ([]byte, error) {
+	data, err := fetch()
+	for attempt := 1; attempt <= StaleRetries && isStaleResource(err); attempt++ {
+		log.Printf("page %s: response body no longer available, reloading (%d/%d)", pageNo, attempt, StaleRetries)
+		countRetry(ctx)
+		data, err = fetch()
+	}
+	if isStaleResource(err) {
+		return nil, fmt.Errorf("response body evicted from the browser cache after %d reloads: %w", StaleRetries, err)
+	}
+	return data, err
+}
@@ -0,0 +1,82 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/chromedp/cdproto/network"
+)
+
+var errStale = errors.New("No resource with given identifier found (-32000)")
+
+func TestFetchFreshRetriesStaleResources(t *testing.T) {
+	calls := 0
+	before := Retries()
+	data, err := fetchFresh(context.Background(), "3", func() ([]byte, error) {
+		calls++
+		if calls < 2 {
+			return nil, errStale
+		}
+		return []byte("page"), nil
+	})
+	if err != nil || string(data) != "page" {
+		t.Fatalf("expected the page, got %q (%v)", data, err)
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 fetches, got %d", calls)
+	}
+	if n := Retries() - before; n != 1 {
+		t.Errorf("expected 1 counted retry, got %d", n)
+	}
+}
+
+func TestFetchFreshGivesUp(t *testing.T) {
+	calls := 0
+	_, err := fetchFresh(context.Background(), "3", func() ([]byte, error) {
+		calls++
+		return nil, errStale
+	})
+	if !errors.Is(err, errStale) {
+		t.Errorf("expected the stale error, got %v", err)
+	}
+	if calls != StaleRetries+1 {
+		t.Errorf("expected %d fetches, got %d", StaleRetries+1, calls)
+	}
+}
+
+func TestFetchFreshConfiguredRetries(t *testing.T) {
+	defer func(n int) { StaleRetries = n }(StaleRetries)
+	StaleRetries = 0
+	calls := 0
+	_, err := fetchFresh(context.Background(), "3", func() ([]byte, error) {
+		calls++
+		return nil, errStale
+	})
+	if calls != 1 {
+		t.Errorf("expected a single fetch, got %d", calls)
+	}
+	if err == nil || !strings.Contains(err.Error(), "evicted from the browser cache") {
+		t.Errorf("expected the eviction to be reported, got %v", err)
+	}
+}
+
+func TestFetchFreshKeepsOtherErrors(t *testing.T) {
+	calls := 0
+	fail := errors.New("no such image")
+	if _, err := fetchFresh(context.Background(), "3", func() ([]byte, error) {
+		calls++
+		return nil, fail
+	}); err != fail || calls != 1 {
+		t.Errorf("expected one failed fetch, got %d (%v)", calls, err)
+	}
+}
+
+func TestResetRequestsDropsEarlierLoads(t *testing.T) {
+	dl := &ComicsDL{urlMap: map[string]network.RequestID{"https://i.hamreus.com/1.jpg": "old"}}
+	dl.resetRequests()
+	if _, err := dl.findRequestID("https://i.hamreus.com/1.jpg"); err == nil {
+		t.Errorf("expected the earlier request to be forgotten")
+	}
+}
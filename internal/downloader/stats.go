@@ -0,0 +1,76 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// retries counts the page reloads of every download in the process
+var retries atomic.Int64
+
+// Retries returns the number of page reloads so far. It is shared by all
+// downloads, so callers report the difference across their own download, or
+// count it with WithRetryCounter when downloads run at once.
+func Retries() int64 {
+	return retries.Load()
+}
+
+// retryCounterKey is the context key of the counter of WithRetryCounter
+type retryCounterKey struct{}
+
+// WithRetryCounter returns a context whose downloads also count their page
+// reloads in the returned counter, for a download sharing the process with
+// others
+func WithRetryCounter(ctx context.Context) (context.Context, *atomic.Int64) {
+	counter := new(atomic.Int64)
+	return context.WithValue(ctx, retryCounterKey{}, counter), counter
+}
+
+// countRetry counts a page reload of a download in ctx
+func countRetry(ctx context.Context) {
+	retries.Add(1)
+	if counter, ok := ctx.Value(retryCounterKey{}).(*atomic.Int64); ok {
+		counter.Add(1)
+	}
+}
+
+// Stats summarizes a finished download
+type Stats struct {
+	Chapters int
+	Pages    int
+	// Retries is the number of page reloads
+	Retries  int64
+	Bytes    int64
+	Duration time.Duration
+}
+
+// Summary formats the stats as one aligned "Name: value" line each
+func (s Stats) Summary() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Chapters:  %d\n", s.Chapters)
+	fmt.Fprintf(&b, "Pages:     %d\n", s.Pages)
+	fmt.Fprintf(&b, "Retried:   %d\n", s.Retries)
+	fmt.Fprintf(&b, "Written:   %s\n", FormatBytes(float64(s.Bytes)))
+	fmt.Fprintf(&b, "Duration:  %s\n", s.Duration.Round(time.Second))
+	if seconds := s.Duration.Seconds(); seconds > 0 {
+		fmt.Fprintf(&b, "Speed:     %s/s\n", FormatBytes(float64(s.Bytes)/seconds))
+	}
+	return b.String()
+}
+
+// FormatBytes renders a byte count with a binary unit
+func FormatBytes(n float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB"}
+	i := 0
+	for n >= 1024 && i < len(units)-1 {
+		n /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%.0f %s", n, units[i])
+	}
+	return fmt.Sprintf("%.1f %s", n, units[i])
+}
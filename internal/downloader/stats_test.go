@@ -0,0 +1,39 @@
+package downloader
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestStatsSummary(t *testing.T) {
+	s := Stats{Chapters: 3, Pages: 57, Retries: 1, Bytes: 12 << 20, Duration: 80 * time.Second}
+	expected := "Chapters:  3\n" +
+		"Pages:     57\n" +
+		"Retried:   1\n" +
+		"Written:   12.0 MiB\n" +
+		"Duration:  1m20s\n" +
+		"Speed:     153.6 KiB/s\n"
+	if got := s.Summary(); got != expected {
+		t.Errorf("unexpected summary:\n%s", got)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := map[float64]string{0: "0 B", 1023: "1023 B", 1536: "1.5 KiB", 5 << 30: "5.0 GiB"}
+	for n, want := range tests {
+		if got := FormatBytes(n); got != want {
+			t.Errorf("FormatBytes(%v) = %q, want %q", n, got, want)
+		}
+	}
+}
+
+func TestWithRetryCounterCountsItsOwnRetries(t *testing.T) {
+	ctx, counter := WithRetryCounter(context.Background())
+	countRetry(ctx)
+	countRetry(context.Background())
+	countRetry(ctx)
+	if n := counter.Load(); n != 2 {
+		t.Errorf("expected 2 retries counted in the context, got %d", n)
+	}
+}
@@ -0,0 +1,54 @@
+package downloader
+
+import (
+	"context"
+	"io"
+
+	"golang.org/x/time/rate"
+)
+
+// limiter caps the bytes per second written by every download together.
+// It is nil when throughput is unlimited.
+var limiter *rate.Limiter
+
+// SetMaxBPS limits the combined page write rate of all downloads to bps bytes
+// per second. Zero or less removes the limit. Call it before downloading.
+func SetMaxBPS(bps int) {
+	if bps <= 0 {
+		limiter = nil
+		return
+	}
+	limiter = rate.NewLimiter(rate.Limit(bps), bps)
+}
+
+// throttledWriter blocks writes until the limiter has budget for them
+type throttledWriter struct {
+	ctx     context.Context
+	w       io.Writer
+	limiter *rate.Limiter
+}
+
+// throttle wraps w with the global limiter, if one is set
+func throttle(ctx context.Context, w io.Writer) io.Writer {
+	if limiter == nil {
+		return w
+	}
+	return &throttledWriter{ctx: ctx, w: w, limiter: limiter}
+}
+
+func (t *throttledWriter) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		// WaitN rejects requests larger than the burst, so write in burst sized chunks
+		n := min(len(p)-written, t.limiter.Burst())
+		if err := t.limiter.WaitN(t.ctx, n); err != nil {
+			return written, err
+		}
+		m, err := t.w.Write(p[written : written+n])
+		written += m
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
@@ -0,0 +1,47 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestThrottleUnlimitedByDefault(t *testing.T) {
+	SetMaxBPS(0)
+	var buf bytes.Buffer
+	if w := throttle(context.Background(), &buf); w != &buf {
+		t.Errorf("expected the writer to be returned unwrapped")
+	}
+}
+
+func TestThrottleLimitsWriteRate(t *testing.T) {
+	SetMaxBPS(1000)
+	defer SetMaxBPS(0)
+
+	var buf bytes.Buffer
+	w := throttle(context.Background(), &buf)
+	start := time.Now()
+	// The first 1000 bytes use the burst, the next 500 must wait half a second
+	if _, err := w.Write(make([]byte, 1500)); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("write finished in %v, expected it to be throttled", elapsed)
+	}
+	if buf.Len() != 1500 {
+		t.Errorf("expected 1500 bytes written, got %d", buf.Len())
+	}
+}
+
+func TestThrottleStopsOnCancel(t *testing.T) {
+	SetMaxBPS(10)
+	defer SetMaxBPS(0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var buf bytes.Buffer
+	if _, err := throttle(ctx, &buf).Write(make([]byte, 100)); err == nil {
+		t.Errorf("expected an error writing with a cancelled context")
+	}
+}
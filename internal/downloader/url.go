@@ -0,0 +1,23 @@
+package downloader
+
+import (
+	"context"
+
+	"comicsd/internal/site"
+)
+
+// ParseChapterURL extracts the comic and chapter IDs from a reader URL of the
+// default site, such as https://tw.manhuagui.com/comic/1128/566271.html
+func ParseChapterURL(rawURL string) (comicID, chapterID string, err error) {
+	return site.Default.ParseChapterURL(rawURL)
+}
+
+// NewDownloadFromURL prepares the download of the chapter at a reader URL
+// copied from the browser
+func NewDownloadFromURL(ctx context.Context, rawURL string) (*ComicsDL, error) {
+	comicID, chapterID, err := ParseChapterURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return NewDownload(ctx, comicID, chapterID)
+}
@@ -0,0 +1,37 @@
+package downloader_test
+
+import (
+	"comicsd/internal/downloader"
+	"testing"
+)
+
+func TestParseChapterURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		comic   string
+		chapter string
+	}{
+		{"https://tw.manhuagui.com/comic/1128/566271.html", "1128", "566271"},
+		{"https://www.manhuagui.com/comic/1128/566271.html#p=3", "1128", "566271"},
+		{"https://m.manhuagui.com/comic/1128/566271.html?from=share", "1128", "566271"},
+	}
+	for _, tt := range tests {
+		comic, chapter, err := downloader.ParseChapterURL(tt.url)
+		if err != nil || comic != tt.comic || chapter != tt.chapter {
+			t.Errorf("ParseChapterURL(%q) = %q, %q, %v", tt.url, comic, chapter, err)
+		}
+	}
+}
+
+func TestParseChapterURLRejectsOtherURLs(t *testing.T) {
+	for _, u := range []string{
+		"https://tw.manhuagui.com/comic/1128/",
+		"https://example.com/comic/1128/566271.html",
+		"https://tw.manhuagui.com/comic/abc/566271.html",
+		"1128",
+	} {
+		if _, _, err := downloader.ParseChapterURL(u); err == nil {
+			t.Errorf("expected an error for %q", u)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/chromedp/cdproto/network"
+)
+
+// WaitStrategy selects what a page download waits for before reading the
+// image's response body
+type WaitStrategy string
+
+const (
+	// WaitVisible reads the body once the image element is visible
+	WaitVisible WaitStrategy = "visible"
+	// WaitLoaded also waits until the browser finished loading the image's
+	// response, so the body is in the network cache when it is read
+	WaitLoaded WaitStrategy = "loaded"
+)
+
+// Wait is the wait strategy of new downloads
+var Wait = WaitVisible
+
+// ParseWaitStrategy parses a wait strategy name, empty for WaitVisible
+func ParseWaitStrategy(name string) (WaitStrategy, error) {
+	switch WaitStrategy(name) {
+	case "", WaitVisible:
+		return WaitVisible, nil
+	case WaitLoaded:
+		return WaitLoaded, nil
+	}
+	return "", fmt.Errorf("invalid wait strategy: %s. Use 'visible' or 'loaded'", name)
+}
+
+// requestLoad is the loading state of one request of the tab
+type requestLoad struct {
+	// done is closed once the response finished or failed loading
+	done chan struct{}
+	err  error
+}
+
+// load returns the loading state of request id, tracking it when new. The
+// caller holds dl.mu.
+func (dl *ComicsDL) load(id network.RequestID) *requestLoad {
+	l, ok := dl.loads[id]
+	if !ok {
+		l = &requestLoad{done: make(chan struct{})}
+		dl.loads[id] = l
+	}
+	return l
+}
+
+// finishLoad records that request id finished loading, failed with err when
+// not nil
+func (dl *ComicsDL) finishLoad(id network.RequestID, err error) {
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+	l := dl.load(id)
+	select {
+	case <-l.done:
+		// already finished
+	default:
+		l.err = err
+		close(l.done)
+	}
+}
+
+// waitLoaded waits until request id finished loading
+func (dl *ComicsDL) waitLoaded(ctx context.Context, id network.RequestID) error {
+	dl.mu.Lock()
+	l := dl.load(id)
+	dl.mu.Unlock()
+
+	select {
+	case <-l.done:
+		return l.err
+	case <-ctx.Done():
+		return fmt.Errorf("waiting for image to load: %w", ctx.Err())
+	}
+}
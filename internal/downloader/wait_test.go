@@ -0,0 +1,70 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"comicsd/internal/site"
+
+	"github.com/chromedp/cdproto/network"
+)
+
+func TestParseWaitStrategy(t *testing.T) {
+	for name, want := range map[string]WaitStrategy{"": WaitVisible, "visible": WaitVisible, "loaded": WaitLoaded} {
+		if got, err := ParseWaitStrategy(name); err != nil || got != want {
+			t.Errorf("ParseWaitStrategy(%q) = %q, %v, want %q", name, got, err, want)
+		}
+	}
+	if _, err := ParseWaitStrategy("networkidle"); err == nil {
+		t.Error("expected an error for an unknown strategy")
+	}
+}
+
+// trackingDL returns a download tracking requests without a browser tab
+func trackingDL() *ComicsDL {
+	return &ComicsDL{
+		site:   site.Default,
+		urlMap: make(map[string]network.RequestID),
+		loads:  make(map[network.RequestID]*requestLoad),
+		images: make(map[network.RequestID]float64),
+	}
+}
+
+func TestWaitLoaded(t *testing.T) {
+	dl := trackingDL()
+
+	dl.onEvent(&network.EventRequestWillBeSent{RequestID: "1", Request: &network.Request{URL: "https://i.hamreus.com/1.jpg"}})
+	done := make(chan error, 1)
+	go func() { done <- dl.waitLoaded(context.Background(), "1") }()
+
+	select {
+	case err := <-done:
+		t.Fatalf("returned before the image loaded: %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+	dl.onEvent(&network.EventLoadingFinished{RequestID: "1"})
+	if err := <-done; err != nil {
+		t.Errorf("waitLoaded failed: %v", err)
+	}
+	// A finished request does not block later waits
+	if err := dl.waitLoaded(context.Background(), "1"); err != nil {
+		t.Errorf("waitLoaded failed: %v", err)
+	}
+}
+
+func TestWaitLoadedFailure(t *testing.T) {
+	dl := trackingDL()
+
+	dl.onEvent(&network.EventLoadingFailed{RequestID: "1", ErrorText: "net::ERR_CONNECTION_RESET"})
+	if err := dl.waitLoaded(context.Background(), "1"); err == nil || err.Error() != "image failed to load: net::ERR_CONNECTION_RESET" {
+		t.Errorf("expected the loading error, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := dl.waitLoaded(ctx, "2"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+}
@@ -0,0 +1,43 @@
+package epub
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DefaultDeflateLevel is the compression of the text entries (XHTML, OPF,
+// NCX and CSS). They are small and repetitive, so fast compression gets
+// nearly all of the gain.
+const DefaultDeflateLevel = flate.BestSpeed
+
+// SetDeflateLevel sets the compress/flate level of the text entries, from
+// flate.HuffmanOnly to flate.BestCompression. Images and the mimetype are
+// always stored uncompressed.
+func (e *EPUBWriter) SetDeflateLevel(level int) error {
+	if level < flate.HuffmanOnly || level > flate.BestCompression {
+		return fmt.Errorf("invalid deflate level: %d", level)
+	}
+	e.deflateLevel = level
+	return nil
+}
+
+// registerCompressor makes the deflated entries of zw use the writer's level
+func (e *EPUBWriter) registerCompressor(zw *zip.Writer) {
+	zw.RegisterCompressor(zip.Deflate, func(w io.Writer) (io.WriteCloser, error) {
+		return flate.NewWriter(w, e.deflateLevel)
+	})
+}
+
+// create adds an entry to the book. Images are already compressed and gain
+// nothing from deflate, and the EPUB container requires the mimetype
+// uncompressed, so those are stored.
+func (e *EPUBWriter) create(name string) (io.Writer, error) {
+	method := zip.Deflate
+	if name == "mimetype" || strings.HasPrefix(name, "OEBPS/images/") {
+		method = zip.Store
+	}
+	return e.zipWriter.CreateHeader(&zip.FileHeader{Name: name, Method: method})
+}
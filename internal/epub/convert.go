@@ -0,0 +1,199 @@
+package epub
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"path/filepath"
+	"strings"
+
+	"github.com/gen2brain/webp"
+	xdraw "golang.org/x/image/draw"
+)
+
+// ImageFormat selects how page images are stored in the archive
+type ImageFormat string
+
+const (
+	// ImagePassthrough stores page images as they were downloaded
+	ImagePassthrough ImageFormat = ""
+	// ImageJPEG transcodes page images to JPEG
+	ImageJPEG ImageFormat = "jpeg"
+	// ImagePNG transcodes page images to PNG
+	ImagePNG ImageFormat = "png"
+	// ImageWebP transcodes page images to lossy WebP. EPUBs holding WebP
+	// images are written as EPUB 3, the first version to allow them.
+	ImageWebP ImageFormat = "webp"
+)
+
+const (
+	// jpegQuality is the quality used when transcoding to JPEG
+	jpegQuality = 90
+	// DefaultWebPQuality is the quality used when transcoding to WebP
+	DefaultWebPQuality = 80
+)
+
+// ParseImageFormat converts a user supplied format name into an ImageFormat
+func ParseImageFormat(name string) (ImageFormat, error) {
+	switch strings.ToLower(name) {
+	case "", "original":
+		return ImagePassthrough, nil
+	case "jpeg", "jpg":
+		return ImageJPEG, nil
+	case "png":
+		return ImagePNG, nil
+	case "webp":
+		return ImageWebP, nil
+	}
+	return ImagePassthrough, fmt.Errorf("unsupported image format: %s. Use 'jpeg', 'png' or 'webp'", name)
+}
+
+// extension returns the file extension used for images of this format
+func (f ImageFormat) extension() string {
+	if f == ImageJPEG {
+		return ".jpg"
+	}
+	return "." + string(f)
+}
+
+// CropImage cuts the widest centered region with the aspect ratio width:height
+// out of data and returns it as a JPEG
+func CropImage(data []byte, width, height int) ([]byte, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decode image: %w", err)
+	}
+	b := img.Bounds()
+	crop := b
+	if b.Dx()*height > b.Dy()*width {
+		// Too wide: keep the middle
+		w := b.Dy() * width / height
+		crop.Min.X = b.Min.X + (b.Dx()-w)/2
+		crop.Max.X = crop.Min.X + w
+	} else {
+		// Too tall: keep the top, where titles usually are
+		crop.Max.Y = b.Min.Y + b.Dx()*height/width
+	}
+	if sub, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		img = sub.SubImage(crop)
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return nil, fmt.Errorf("encode image: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// ConvertImage re-encodes data to the target format and renames filename to match.
+// Images already in the target format are only renamed. quality applies to
+// the lossy formats; zero selects the format's default.
+func ConvertImage(filename string, data []byte, format ImageFormat, quality int) (string, []byte, error) {
+	if format == ImagePassthrough {
+		return filename, data, nil
+	}
+
+	filename = strings.TrimSuffix(filename, filepath.Ext(filename)) + format.extension()
+
+	img, source, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", nil, fmt.Errorf("decode %s: %w", filename, err)
+	}
+	if source == string(format) {
+		return filename, data, nil
+	}
+
+	if data, err = encodeImage(img, format, quality); err != nil {
+		return "", nil, fmt.Errorf("encode %s: %w", filename, err)
+	}
+	return filename, data, nil
+}
+
+// Transform changes page images for the screen they are read on
+type Transform struct {
+	// Grayscale stores pages in shades of gray, smaller and as shown on
+	// e-ink screens
+	Grayscale bool
+	// MaxWidth scales pages wider than it down to it, zero for no limit
+	MaxWidth int
+}
+
+// TransformImage applies t to data and stores it as ConvertImage does.
+// Images t leaves as they are are only converted; transformed ones kept in
+// their format are re-encoded in it, GIFs as PNG.
+func TransformImage(filename string, data []byte, t Transform, format ImageFormat, quality int) (string, []byte, error) {
+	if t == (Transform{}) {
+		return ConvertImage(filename, data, format, quality)
+	}
+	img, source, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", nil, fmt.Errorf("decode %s: %w", filename, err)
+	}
+	transformed := t.apply(img)
+	if transformed == img {
+		return ConvertImage(filename, data, format, quality)
+	}
+	if format == ImagePassthrough {
+		format, err = ParseImageFormat(source)
+		if err != nil {
+			format = ImagePNG
+		}
+	}
+
+	filename = strings.TrimSuffix(filename, filepath.Ext(filename)) + format.extension()
+	if data, err = encodeImage(transformed, format, quality); err != nil {
+		return "", nil, fmt.Errorf("encode %s: %w", filename, err)
+	}
+	return filename, data, nil
+}
+
+// apply returns img scaled down to t.MaxWidth and in gray as t asks, or img
+// itself when it needs neither
+func (t Transform) apply(img image.Image) image.Image {
+	b := img.Bounds()
+	_, gray := img.(*image.Gray)
+	resize := t.MaxWidth > 0 && b.Dx() > t.MaxWidth
+	if !resize && (gray || !t.Grayscale) {
+		return img
+	}
+	size := b.Size()
+	if resize {
+		size = image.Pt(t.MaxWidth, max(b.Dy()*t.MaxWidth/b.Dx(), 1))
+	}
+	var dst draw.Image = image.NewRGBA(image.Rectangle{Max: size})
+	if t.Grayscale || gray {
+		dst = image.NewGray(image.Rectangle{Max: size})
+	}
+	if resize {
+		xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, b, xdraw.Src, nil)
+	} else {
+		draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Src)
+	}
+	return dst
+}
+
+// encodeImage encodes img in format, with quality as in ConvertImage
+func encodeImage(img image.Image, format ImageFormat, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case ImageJPEG:
+		if quality == 0 {
+			quality = jpegQuality
+		}
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	case ImagePNG:
+		err = png.Encode(&buf, img)
+	case ImageWebP:
+		if quality == 0 {
+			quality = DefaultWebPQuality
+		}
+		err = webp.Encode(&buf, img, webp.Options{Quality: quality, Method: webp.DefaultMethod})
+	}
+	return buf.Bytes(), err
+}
@@ -0,0 +1,269 @@
+package epub
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/gen2brain/webp"
+)
+
+func pngImage(t *testing.T) []byte {
+	t.Helper()
+	return encodePNG(t, 4, 4)
+}
+
+// encodePNG returns a PNG image of the given size
+func encodePNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	img.Set(1, 1, color.RGBA{R: 255, A: 255})
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("encode png: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// Test that pages are transcoded to JPEG and the manifest reflects the new name and type
+func TestEPUBWriterTranscodesToJPEG(t *testing.T) {
+	var buf bytes.Buffer
+	writer := NewEPUBWriter(&buf, "Test Title")
+	writer.SetImageFormat(ImageJPEG)
+
+	if err := writer.AddPage("0.png", pngImage(t)); err != nil {
+		t.Fatalf("AddPage failed: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	contentOpf := readEntry(t, buf.Bytes(), "OEBPS/content.opf")
+	if !strings.Contains(contentOpf, `href="images/0.jpg" media-type="image/jpeg"`) {
+		t.Errorf("manifest missing transcoded image: %s", contentOpf)
+	}
+
+	data := readEntry(t, buf.Bytes(), "OEBPS/images/0.jpg")
+	if _, err := jpeg.Decode(strings.NewReader(data)); err != nil {
+		t.Errorf("stored image is not a JPEG: %v", err)
+	}
+}
+
+func TestConvertImagePassthrough(t *testing.T) {
+	name, data, err := ConvertImage("0.jpg", []byte("not an image"), ImagePassthrough, 0)
+	if err != nil || name != "0.jpg" || string(data) != "not an image" {
+		t.Fatalf("passthrough modified the image: %s %q %v", name, data, err)
+	}
+}
+
+func TestParseImageFormat(t *testing.T) {
+	if f, err := ParseImageFormat("JPG"); err != nil || f != ImageJPEG {
+		t.Errorf("expected jpeg, got %q (%v)", f, err)
+	}
+	if f, err := ParseImageFormat("webp"); err != nil || f != ImageWebP {
+		t.Errorf("expected webp, got %q (%v)", f, err)
+	}
+	if _, err := ParseImageFormat("bmp"); err == nil {
+		t.Errorf("expected error for unsupported format")
+	}
+}
+
+// samplePage returns a JPEG resembling a scanned page: smooth shading with line art
+func samplePage(t *testing.T) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 400, 600))
+	for y := 0; y < 600; y++ {
+		for x := 0; x < 400; x++ {
+			shade := uint8(255 - (x+y)/8)
+			if x%50 < 2 || y%75 < 2 {
+				shade = 0
+			}
+			img.Set(x, y, color.RGBA{R: shade, G: shade, B: shade, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+		t.Fatalf("encode jpeg: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// Test that transcoding a typical page to WebP shrinks it
+func TestConvertImageWebPIsSmaller(t *testing.T) {
+	original := samplePage(t)
+
+	name, data, err := ConvertImage("0.jpg", original, ImageWebP, jpegQuality)
+	if err != nil {
+		t.Fatalf("ConvertImage failed: %v", err)
+	}
+	if name != "0.webp" {
+		t.Errorf("expected 0.webp, got %s", name)
+	}
+	if _, err := webp.Decode(bytes.NewReader(data)); err != nil {
+		t.Fatalf("converted image is not a WebP: %v", err)
+	}
+
+	t.Logf("jpeg %d bytes, webp %d bytes", len(original), len(data))
+	if len(data) >= len(original) {
+		t.Errorf("webp (%d bytes) is not smaller than jpeg (%d bytes)", len(data), len(original))
+	}
+}
+
+// Test that WebP pages switch the book to EPUB 3 with the image/webp media type
+func TestEPUBWriterWebPUsesEPUB3(t *testing.T) {
+	var buf bytes.Buffer
+	writer := NewEPUBWriter(&buf, "Test Title")
+	writer.SetImageFormat(ImageWebP)
+
+	if err := writer.AddPage("0.jpg", samplePage(t)); err != nil {
+		t.Fatalf("AddPage failed: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	contentOpf := readEntry(t, buf.Bytes(), "OEBPS/content.opf")
+	for _, want := range []string{
+		`<package version="3.0"`,
+		`href="images/0.webp" media-type="image/webp"`,
+		`properties="nav"`,
+		`property="dcterms:modified"`,
+	} {
+		if !strings.Contains(contentOpf, want) {
+			t.Errorf("content.opf missing %s: %s", want, contentOpf)
+		}
+	}
+
+	nav := readEntry(t, buf.Bytes(), "OEBPS/nav.xhtml")
+	if !strings.Contains(nav, `<a href="page1.xhtml">Page 1</a>`) {
+		t.Errorf("nav.xhtml missing page link: %s", nav)
+	}
+}
+
+func TestCropImage(t *testing.T) {
+	tests := []struct {
+		width, height int
+		expected      image.Point
+	}{
+		{300, 200, image.Pt(133, 200)},
+		{200, 600, image.Pt(200, 300)},
+		{200, 300, image.Pt(200, 300)},
+	}
+	for _, tt := range tests {
+		data, err := CropImage(encodePNG(t, tt.width, tt.height), 2, 3)
+		if err != nil {
+			t.Fatalf("CropImage failed: %v", err)
+		}
+		cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("decode cropped image: %v", err)
+		}
+		if format != "jpeg" || image.Pt(cfg.Width, cfg.Height) != tt.expected {
+			t.Errorf("%dx%d: expected a %v jpeg, got %dx%d %s", tt.width, tt.height, tt.expected, cfg.Width, cfg.Height, format)
+		}
+	}
+	if _, err := CropImage([]byte("not an image"), 2, 3); err == nil {
+		t.Error("expected an error for data that is not an image")
+	}
+}
+
+func TestTransformImage(t *testing.T) {
+	tests := []struct {
+		name      string
+		transform Transform
+		format    ImageFormat
+		// expected name, decoded format, size and color model
+		expected  string
+		decoded   string
+		size      image.Point
+		gray      bool
+		unchanged bool
+	}{
+		{"none", Transform{}, ImagePassthrough, "0.png", "png", image.Pt(400, 600), false, true},
+		{"narrow enough", Transform{MaxWidth: 800}, ImagePassthrough, "0.png", "png", image.Pt(400, 600), false, true},
+		{"scaled", Transform{MaxWidth: 200}, ImagePassthrough, "0.png", "png", image.Pt(200, 300), false, false},
+		{"gray", Transform{Grayscale: true}, ImagePassthrough, "0.png", "png", image.Pt(400, 600), true, false},
+		{"gray jpeg", Transform{Grayscale: true, MaxWidth: 100}, ImageJPEG, "0.jpg", "jpeg", image.Pt(100, 150), true, false},
+	}
+	original := encodePNG(t, 400, 600)
+	for _, tt := range tests {
+		name, data, err := TransformImage("0.png", original, tt.transform, tt.format, 0)
+		if err != nil {
+			t.Fatalf("%s: TransformImage failed: %v", tt.name, err)
+		}
+		img, format, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: decode: %v", tt.name, err)
+		}
+		if name != tt.expected || format != tt.decoded || img.Bounds().Size() != tt.size {
+			t.Errorf("%s: got %s, a %v %s, want %s, a %v %s", tt.name, name, img.Bounds().Size(), format, tt.expected, tt.size, tt.decoded)
+		}
+		if _, gray := img.(*image.Gray); gray != tt.gray {
+			t.Errorf("%s: gray = %v, want %v", tt.name, gray, tt.gray)
+		}
+		if same := bytes.Equal(data, original); same != tt.unchanged {
+			t.Errorf("%s: unchanged = %v, want %v", tt.name, same, tt.unchanged)
+		}
+	}
+}
+
+// Test that a fixed-layout book is EPUB 3 with pre-paginated pages sized to their image
+func TestEPUBWriterFixedLayoutRightToLeft(t *testing.T) {
+	var buf bytes.Buffer
+	writer := NewEPUBWriter(&buf, "Test Title")
+	writer.SetFixedLayout(true)
+	writer.SetRightToLeft(true)
+
+	if err := writer.AddPage("0.png", encodePNG(t, 400, 600)); err != nil {
+		t.Fatalf("AddPage failed: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	contentOpf := readEntry(t, buf.Bytes(), "OEBPS/content.opf")
+	for _, want := range []string{
+		`<package version="3.0"`,
+		`<meta property="rendition:layout">pre-paginated</meta>`,
+		`<spine toc="ncx" page-progression-direction="rtl">`,
+	} {
+		if !strings.Contains(contentOpf, want) {
+			t.Errorf("content.opf missing %s: %s", want, contentOpf)
+		}
+	}
+	page := readEntry(t, buf.Bytes(), "OEBPS/page1.xhtml")
+	if !strings.Contains(page, `<meta name="viewport" content="width=400, height=600"/>`) {
+		t.Errorf("page missing its viewport: %s", page)
+	}
+	if _, _, err := ParsePackage([]byte(contentOpf)); err != nil {
+		t.Errorf("content.opf does not parse: %v", err)
+	}
+}
+
+func TestEPUBWriterVersion(t *testing.T) {
+	var buf bytes.Buffer
+	writer := NewEPUBWriter(&buf, "Test Title")
+	writer.SetVersion(3)
+	if err := writer.AddPage("0.png", pngImage(t)); err != nil {
+		t.Fatalf("AddPage failed: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	contentOpf := readEntry(t, buf.Bytes(), "OEBPS/content.opf")
+	if !strings.Contains(contentOpf, `<package version="3.0"`) || strings.Contains(contentOpf, "rendition:layout") {
+		t.Errorf("expected a reflowable EPUB 3: %s", contentOpf)
+	}
+
+	writer = NewEPUBWriter(io.Discard, "Test Title")
+	writer.SetVersion(2)
+	writer.SetImageFormat(ImageWebP)
+	if err := writer.AddPage("0.jpg", samplePage(t)); err == nil {
+		t.Error("expected an error for a WebP page in EPUB 2")
+	}
+}
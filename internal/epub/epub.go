@@ -2,45 +2,179 @@ package epub
 
 import (
 	"archive/zip"
+	"bytes"
+	"encoding/xml"
 	"fmt"
+	"image"
 	"io"
+	"log"
 	"mime"
 	"net/http"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
+
+	"comicsd/internal/naming"
 )
 
+// DefaultPageCSS is the style of every image page unless SetPageCSS replaces
+// it. It is stored once in OEBPS/style.css rather than inlined in each page.
+const DefaultPageCSS = `html, body {
+    margin: 0;
+    padding: 0;
+    height: 100%;
+    width: 100%;
+    overflow: hidden;
+}
+.page-container {
+    display: flex;
+    justify-content: center;
+    align-items: center;
+    height: 100vh;
+    width: 100vw;
+    background-color: #ffffff;
+}
+.page-image {
+    max-width: 100%;
+    max-height: 100%;
+    width: auto;
+    height: auto;
+    object-fit: contain;
+    display: block;
+}
+/* Landscape double-page spreads fill the width instead of the height */
+.spread .page-image {
+    width: 100%;
+    height: auto;
+}
+/* Fallback for older e-readers */
+body {
+    text-align: center;
+    margin: 0;
+    padding: 0;
+}
+img {
+    max-width: 100%;
+    max-height: 100%;
+    width: auto;
+    height: auto;
+}
+/* Recognized page text is invisible but searchable */
+.ocr-text {
+    position: absolute;
+    top: 0;
+    left: 0;
+    width: 100%;
+    height: 100%;
+    overflow: hidden;
+    color: transparent;
+    font-size: 1px;
+}
+`
+
+// pageTemplate is the XHTML wrapper used for every image page
+const pageTemplate = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml">
+<head>
+    <title>%s</title>
+%s    <link rel="stylesheet" type="text/css" href="style.css"/>
+</head>
+<body>
+    <div class="%s">
+        <img class="page-image" src="images/%s" alt="%s"/>
+    </div>
+%s</body>
+</html>`
+
+// TextRecognizer extracts the text shown in a page image
+type TextRecognizer interface {
+	Recognize(data []byte) (string, error)
+}
+
 type imageRef struct {
 	filename string
 	mimeType string
 }
 
+// defaultCreator is the creator of books without an author
+const defaultCreator = "Comic Downloader"
+
+// Metadata describes the book in the package document. Empty fields are omitted.
+type Metadata struct {
+	Creator     string
+	Description string
+	// Source is the book's web page, also written as an identifier
+	Source string
+	// ChapterSources are the pages of the book's chapters, written as
+	// further sources
+	ChapterSources []string
+	// Year is the publication year written as dc:date instead of today
+	Year int
+}
+
 type EPUBWriter struct {
-	zipWriter *zip.Writer
-	pages     []string
-	images    []imageRef
-	title     string
-	pageCount int
+	zipWriter    *zip.Writer
+	pages        []string
+	images       []imageRef
+	title        string
+	pageCount    int
+	cover        *imageRef
+	imageFormat  ImageFormat
+	imageQuality int
+	metadata     Metadata
+	// pageCSS is the content of style.css
+	pageCSS string
+	// recognizer, when set, adds each page's text for full-text search
+	recognizer TextRecognizer
+	// deflateLevel is the compression level of the text entries
+	deflateLevel int
+	// imageOnly puts the images in the spine instead of an XHTML page each
+	imageOnly bool
+	// pageWidth is the number of digits page file names are zero-padded to
+	pageWidth int
+	// frontMatter selects the text pages written before the first page
+	frontMatter FrontMatter
+	// transform changes the page images before they are stored
+	transform Transform
+	// version is the EPUB version to write, zero to pick it from the images
+	version int
+	// fixedLayout writes the pages pre-paginated, at the size of their image
+	fixedLayout bool
+	// rightToLeft turns the pages from right to left
+	rightToLeft bool
+	// err is the failure to start the book, returned by every later write
+	err error
 }
 
 func NewEPUBWriter(writer io.Writer, title string) *EPUBWriter {
-	return &EPUBWriter{
-		zipWriter: zip.NewWriter(writer),
-		title:     title,
-		pages:     make([]string, 0),
-		images:    make([]imageRef, 0),
-		pageCount: 0,
+	e := &EPUBWriter{
+		zipWriter:    zip.NewWriter(writer),
+		title:        title,
+		pages:        make([]string, 0),
+		images:       make([]imageRef, 0),
+		pageCount:    0,
+		pageCSS:      DefaultPageCSS,
+		deflateLevel: DefaultDeflateLevel,
 	}
+	e.registerCompressor(e.zipWriter)
+	// The container requires the mimetype as the first entry
+	e.err = e.writeMimeType()
+	return e
 }
 
 func (e *EPUBWriter) Close() error {
+	if e.err != nil {
+		return e.err
+	}
+
 	// Write the EPUB structure files
-	if err := e.writeMimeType(); err != nil {
+	if err := e.writeContainer(); err != nil {
 		return err
 	}
 
-	if err := e.writeContainer(); err != nil {
+	if err := e.writeFrontMatter(); err != nil {
 		return err
 	}
 
@@ -52,12 +186,112 @@ func (e *EPUBWriter) Close() error {
 		return err
 	}
 
+	if !e.imageOnly {
+		if err := e.writeStylesheet(); err != nil {
+			return err
+		}
+	}
+
+	if e.isEPUB3() {
+		if err := e.writeNav(); err != nil {
+			return err
+		}
+	}
+
 	return e.zipWriter.Close()
 }
 
+// SetImageFormat makes AddPage transcode every page image to the given format
+func (e *EPUBWriter) SetImageFormat(format ImageFormat) {
+	e.imageFormat = format
+}
+
+// SetTransform makes AddPage apply t to every page image before storing it
+func (e *EPUBWriter) SetTransform(t Transform) {
+	e.transform = t
+}
+
+// SetVersion selects the EPUB version, 2 or 3. By default books are EPUB 2
+// unless they hold WebP images, which EPUB 2 does not allow: AddPage then
+// fails for them.
+func (e *EPUBWriter) SetVersion(version int) {
+	e.version = version
+}
+
+// SetFixedLayout writes an EPUB 3 book whose pages keep the size of their
+// image instead of reflowing, as readers lay out comics best. Call it before
+// adding the cover or pages.
+func (e *EPUBWriter) SetFixedLayout(fixedLayout bool) {
+	e.fixedLayout = fixedLayout
+}
+
+// SetRightToLeft makes readers turn the pages from right to left, as manga
+// are read
+func (e *EPUBWriter) SetRightToLeft(rightToLeft bool) {
+	e.rightToLeft = rightToLeft
+}
+
+// SetMetadata sets the author, description and source recorded in the package document
+func (e *EPUBWriter) SetMetadata(metadata Metadata) {
+	e.metadata = metadata
+}
+
+// SetImageQuality sets the quality of lossy transcoding; zero keeps the format's default
+func (e *EPUBWriter) SetImageQuality(quality int) {
+	e.imageQuality = quality
+}
+
+// SetPageCSS replaces the default page style with css; an empty css restores
+// the default. Append to DefaultPageCSS to only tweak the default.
+func (e *EPUBWriter) SetPageCSS(css string) {
+	if css == "" {
+		css = DefaultPageCSS
+	}
+	e.pageCSS = css
+}
+
+// SetImageOnly makes the book reference the page images directly from the
+// spine instead of wrapping each in an XHTML page, producing smaller files.
+// Only some readers open such books, so it is off by default. Image-only books
+// have no page style or recognized text. Call it before adding the cover or pages.
+func (e *EPUBWriter) SetImageOnly(imageOnly bool) {
+	e.imageOnly = imageOnly
+}
+
+// SetExpectedPages zero-pads the numbers in page file names to the width of
+// n, so tools sorting the files by name keep the reading order of the spine
+// (page0009.xhtml before page1000.xhtml). n may be an upper bound; pages past
+// it get longer names. Call it before adding pages.
+func (e *EPUBWriter) SetExpectedPages(n int) {
+	e.pageWidth = 0
+	if n > 0 {
+		e.pageWidth = len(strconv.Itoa(n))
+	}
+}
+
+// SetTextRecognizer makes AddPage embed the text recognized in every page as
+// invisible text, so readers can search the book. Pages whose recognition
+// fails are added without text.
+func (e *EPUBWriter) SetTextRecognizer(r TextRecognizer) {
+	e.recognizer = r
+}
+
 func (e *EPUBWriter) AddPage(filename string, data []byte) error {
+	if e.err != nil {
+		return e.err
+	}
+	filename, data, err := TransformImage(filename, data, e.transform, e.imageFormat, e.imageQuality)
+	if err != nil {
+		return err
+	}
+	filename = naming.PadPageName(filename, e.pageWidth)
+	mimeType := detectMimeType(filename, data)
+	if err := e.checkVersion(filename, mimeType); err != nil {
+		return err
+	}
+
 	// Add image to EPUB
-	imageFile, err := e.zipWriter.Create(fmt.Sprintf("OEBPS/images/%s", filename))
+	imageFile, err := e.create(fmt.Sprintf("OEBPS/images/%s", filename))
 	if err != nil {
 		return err
 	}
@@ -66,69 +300,31 @@ func (e *EPUBWriter) AddPage(filename string, data []byte) error {
 		return err
 	}
 
-	mimeType := mime.TypeByExtension(strings.ToLower(filepath.Ext(filename)))
-	if mimeType == "" {
-		mimeType = http.DetectContentType(data)
+	if e.imageOnly {
+		e.pages = append(e.pages, "images/"+filename)
+		e.images = append(e.images, imageRef{filename: filename, mimeType: mimeType})
+		e.pageCount++
+		return nil
 	}
 
 	// Create XHTML page for this image
 	pageNum := e.pageCount + 1
-	xhtmlFilename := fmt.Sprintf("page%d.xhtml", pageNum)
+	xhtmlFilename := fmt.Sprintf("page%0*d.xhtml", e.pageWidth, pageNum)
 
-	xhtmlFile, err := e.zipWriter.Create(fmt.Sprintf("OEBPS/%s", xhtmlFilename))
+	xhtmlFile, err := e.create(fmt.Sprintf("OEBPS/%s", xhtmlFilename))
 	if err != nil {
 		return err
 	}
 
-	xhtmlContent := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
-<!DOCTYPE html>
-<html xmlns="http://www.w3.org/1999/xhtml">
-<head>
-    <title>Page %d</title>
-    <style type="text/css">
-        html, body {
-            margin: 0;
-            padding: 0;
-            height: 100%%;
-            width: 100%%;
-            overflow: hidden;
-        }
-        .page-container {
-            display: flex;
-            justify-content: center;
-            align-items: center;
-            height: 100vh;
-            width: 100vw;
-            background-color: #ffffff;
-        }
-        .page-image {
-            max-width: 100%%;
-            max-height: 100%%;
-            width: auto;
-            height: auto;
-            object-fit: contain;
-            display: block;
-        }
-        /* Fallback for older e-readers */
-        body {
-            text-align: center;
-            margin: 0;
-            padding: 0;
-        }
-        img {
-            max-width: 100%%;
-            max-height: 100%%;
-            width: auto;
-            height: auto;
-        }
-    </style>
-</head>
-<body>
-    <div class="page-container">
-        <img class="page-image" src="images/%s" alt="Page %d"/>
-    </div>
-</body>
-</html>`, pageNum, filename, pageNum)
+	var text string
+	if e.recognizer != nil {
+		if text, err = e.recognizer.Recognize(data); err != nil {
+			log.Printf("skipping text of %s: %v", filename, err)
+		}
+	}
+
+	size := imageSize(data)
+	xhtmlContent := renderPage(fmt.Sprintf("Page %d", pageNum), filename, size.X > size.Y, e.viewport(size), text)
 
 	if _, err := xhtmlFile.Write([]byte(xhtmlContent)); err != nil {
 		return err
@@ -141,8 +337,125 @@ func (e *EPUBWriter) AddPage(filename string, data []byte) error {
 	return nil
 }
 
+// renderPage renders the XHTML page displaying the given image and its
+// recognized text, if any. Spreads get the landscape treatment. A page with
+// a viewport size is laid out at that size, as fixed-layout books require.
+func renderPage(title, filename string, spread bool, viewport image.Point, text string) string {
+	class := "page-container"
+	if spread {
+		class += " spread"
+	}
+	var viewportMeta string
+	if viewport != (image.Point{}) {
+		viewportMeta = fmt.Sprintf("    <meta name=\"viewport\" content=\"width=%d, height=%d\"/>\n", viewport.X, viewport.Y)
+	}
+	var textBlock string
+	if text != "" {
+		textBlock = fmt.Sprintf("    <div class=\"ocr-text\">%s</div>\n", xmlEscape(text))
+	}
+	return fmt.Sprintf(pageTemplate, title, viewportMeta, class, filename, title, textBlock)
+}
+
+// imageSize returns the size of the image in data, zero when it cannot be
+// decoded
+func imageSize(data []byte) image.Point {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return image.Point{}
+	}
+	return image.Pt(cfg.Width, cfg.Height)
+}
+
+// viewport returns the size a page showing an image of size is laid out at:
+// the image's in fixed-layout books, none otherwise
+func (e *EPUBWriter) viewport(size image.Point) image.Point {
+	if !e.fixedLayout {
+		return image.Point{}
+	}
+	return size
+}
+
+// checkVersion fails for an image the book's EPUB version cannot hold
+func (e *EPUBWriter) checkVersion(filename, mimeType string) error {
+	if e.version == 2 && mimeType == "image/webp" {
+		return fmt.Errorf("%s: EPUB 2 cannot hold WebP images, transcode them to JPEG or PNG", filename)
+	}
+	return nil
+}
+
+// SetCover adds the cover image and a cover page placed before the first page
+func (e *EPUBWriter) SetCover(filename string, data []byte) error {
+	if e.err != nil {
+		return e.err
+	}
+	if e.cover != nil {
+		return fmt.Errorf("cover already set")
+	}
+
+	mimeType := detectMimeType(filename, data)
+	if err := e.checkVersion(filename, mimeType); err != nil {
+		return err
+	}
+	imageFile, err := e.create(fmt.Sprintf("OEBPS/images/%s", filename))
+	if err != nil {
+		return err
+	}
+	if _, err := imageFile.Write(data); err != nil {
+		return err
+	}
+	e.cover = &imageRef{filename: filename, mimeType: mimeType}
+	if e.imageOnly {
+		return nil
+	}
+
+	xhtmlFile, err := e.create("OEBPS/cover.xhtml")
+	if err != nil {
+		return err
+	}
+	if _, err := xhtmlFile.Write([]byte(renderPage("Cover", filename, false, e.viewport(imageSize(data)), ""))); err != nil {
+		return err
+	}
+	return nil
+}
+
+// isEPUB3 reports whether the book is written as EPUB 3: when asked to,
+// with a fixed layout, or by default when it holds WebP images, which are
+// only allowed from EPUB 3 on
+func (e *EPUBWriter) isEPUB3() bool {
+	if e.version != 0 || e.fixedLayout {
+		return e.version == 3 || e.fixedLayout
+	}
+	if e.cover != nil && e.cover.mimeType == "image/webp" {
+		return true
+	}
+	for _, img := range e.images {
+		if img.mimeType == "image/webp" {
+			return true
+		}
+	}
+	return false
+}
+
+// xmlEscape escapes s for use as XML character data
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// detectMimeType guesses the image MIME type from the extension, falling back to the content
+func detectMimeType(filename string, data []byte) string {
+	mimeType := mime.TypeByExtension(strings.ToLower(filepath.Ext(filename)))
+	if mimeType == "" {
+		mimeType = http.DetectContentType(data)
+	}
+	return mimeType
+}
+
+// writeMimeType writes the uncompressed mimetype entry that identifies the
+// archive as an EPUB
 func (e *EPUBWriter) writeMimeType() error {
-	file, err := e.zipWriter.Create("mimetype")
+	file, err := e.create("mimetype")
 	if err != nil {
 		return err
 	}
@@ -151,7 +464,7 @@ func (e *EPUBWriter) writeMimeType() error {
 }
 
 func (e *EPUBWriter) writeContainer() error {
-	file, err := e.zipWriter.Create("META-INF/container.xml")
+	file, err := e.create("META-INF/container.xml")
 	if err != nil {
 		return err
 	}
@@ -168,7 +481,7 @@ func (e *EPUBWriter) writeContainer() error {
 }
 
 func (e *EPUBWriter) writeOPF() error {
-	file, err := e.zipWriter.Create("OEBPS/content.opf")
+	file, err := e.create("OEBPS/content.opf")
 	if err != nil {
 		return err
 	}
@@ -176,10 +489,54 @@ func (e *EPUBWriter) writeOPF() error {
 	var manifestItems strings.Builder
 	var spineItems strings.Builder
 
+	var frontItems strings.Builder
+	for _, page := range e.frontPages() {
+		id := strings.TrimSuffix(page, ".xhtml")
+		manifestItems.WriteString(fmt.Sprintf(`        <item id="%s" href="%s" media-type="application/xhtml+xml"/>
+`, id, page))
+		frontItems.WriteString(fmt.Sprintf(`        <itemref idref="%s"/>
+`, id))
+	}
+	if e.frontMatter.BeforeCover || e.cover == nil {
+		spineItems.WriteString(frontItems.String())
+	}
+
+	coverID := "img1"
+	if e.imageOnly {
+		coverID = "page1"
+	}
+	if e.cover != nil {
+		coverID = "cover-image"
+		if e.imageOnly {
+			manifestItems.WriteString(fmt.Sprintf(`        <item id="%s" href="images/%s" media-type="%s"/>
+`, coverID, e.cover.filename, e.cover.mimeType))
+			spineItems.WriteString(fmt.Sprintf(`        <itemref idref="%s"/>
+`, coverID))
+		} else {
+			manifestItems.WriteString(fmt.Sprintf(`        <item id="cover" href="cover.xhtml" media-type="application/xhtml+xml"/>
+        <item id="%s" href="images/%s" media-type="%s"/>
+`, coverID, e.cover.filename, e.cover.mimeType))
+			spineItems.WriteString(`        <itemref idref="cover"/>
+`)
+		}
+		if !e.frontMatter.BeforeCover {
+			spineItems.WriteString(frontItems.String())
+		}
+	}
+
 	for i, page := range e.pages {
 		pageId := fmt.Sprintf("page%d", i+1)
 		imageId := fmt.Sprintf("img%d", i+1)
 
+		if e.imageOnly {
+			// The image is the page
+			manifestItems.WriteString(fmt.Sprintf(`        <item id="%s" href="%s" media-type="%s"/>
+`, pageId, page, e.images[i].mimeType))
+			spineItems.WriteString(fmt.Sprintf(`        <itemref idref="%s"/>
+`, pageId))
+			continue
+		}
+
 		manifestItems.WriteString(fmt.Sprintf(`        <item id="%s" href="%s" media-type="application/xhtml+xml"/>
 `, pageId, page))
 		manifestItems.WriteString(fmt.Sprintf(`        <item id="%s" href="images/%s" media-type="%s"/>
@@ -189,29 +546,91 @@ func (e *EPUBWriter) writeOPF() error {
 `, pageId))
 	}
 
+	if !e.imageOnly {
+		manifestItems.WriteString(`        <item id="css" href="style.css" media-type="text/css"/>
+`)
+	}
+
+	// EPUB 3 readers find the table of contents in the nav document and
+	// require a modification date; the NCX stays for older readers
+	version, meta := "2.0", ""
+	if e.isEPUB3() {
+		version = "3.0"
+		meta = fmt.Sprintf(`        <meta property="dcterms:modified">%s</meta>
+`, time.Now().UTC().Format("2006-01-02T15:04:05Z"))
+		manifestItems.WriteString(`        <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+`)
+	}
+	if e.fixedLayout {
+		// Kindle reads its own fixed-layout metadata besides the EPUB 3 one
+		meta += `        <meta property="rendition:layout">pre-paginated</meta>
+        <meta property="rendition:spread">landscape</meta>
+        <meta name="fixed-layout" content="true"/>
+        <meta name="book-type" content="comic"/>
+`
+	}
+	spineAttrs := ""
+	if e.rightToLeft {
+		// page-progression-direction is EPUB 3; Kindle and Calibre also
+		// honor it in EPUB 2
+		spineAttrs = ` page-progression-direction="rtl"`
+		meta += `        <meta name="primary-writing-mode" content="horizontal-rl"/>
+`
+	}
+
+	creator := e.metadata.Creator
+	if creator == "" {
+		creator = defaultCreator
+	}
+	date := time.Now().Format("2006-01-02")
+	if e.metadata.Year != 0 {
+		date = fmt.Sprintf("%04d", e.metadata.Year)
+	}
+	var optional strings.Builder
+	if e.metadata.Description != "" {
+		optional.WriteString(fmt.Sprintf("        <dc:description>%s</dc:description>\n", xmlEscape(e.metadata.Description)))
+	}
+	if e.metadata.Source != "" {
+		optional.WriteString(fmt.Sprintf("        <dc:identifier id=\"source-url\">%s</dc:identifier>\n", xmlEscape(e.metadata.Source)))
+		optional.WriteString(fmt.Sprintf("        <dc:source>%s</dc:source>\n", xmlEscape(e.metadata.Source)))
+	}
+	for _, source := range e.metadata.ChapterSources {
+		optional.WriteString(fmt.Sprintf("        <dc:source>%s</dc:source>\n", xmlEscape(source)))
+	}
+
 	content := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
-<package version="2.0" xmlns="http://www.idpf.org/2007/opf" unique-identifier="book-id">
+<package version="%s" xmlns="http://www.idpf.org/2007/opf" unique-identifier="book-id">
     <metadata xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:opf="http://www.idpf.org/2007/opf">
         <dc:title>%s</dc:title>
         <dc:language>en</dc:language>
         <dc:identifier id="book-id">%s</dc:identifier>
-        <dc:creator>Comic Downloader</dc:creator>
+        <dc:creator>%s</dc:creator>
         <dc:date>%s</dc:date>
-        <meta name="cover" content="img1"/>
-    </metadata>
+%s        <meta name="cover" content="%s"/>
+%s    </metadata>
     <manifest>
         <item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>
 %s    </manifest>
-    <spine toc="ncx">
+    <spine toc="ncx"%s>
 %s    </spine>
-</package>`, e.title, e.title, time.Now().Format("2006-01-02"), manifestItems.String(), spineItems.String())
+</package>`, version, xmlEscape(e.title), xmlEscape(e.title), xmlEscape(creator), date, optional.String(), coverID, meta, manifestItems.String(), spineAttrs, spineItems.String())
 
 	_, err = file.Write([]byte(content))
 	return err
 }
 
+// writeStylesheet writes the page style linked from every page
+func (e *EPUBWriter) writeStylesheet() error {
+	file, err := e.create("OEBPS/style.css")
+	if err != nil {
+		return err
+	}
+	_, err = file.Write([]byte(e.pageCSS))
+	return err
+}
+
 func (e *EPUBWriter) writeNCX() error {
-	file, err := e.zipWriter.Create("OEBPS/toc.ncx")
+	file, err := e.create("OEBPS/toc.ncx")
 	if err != nil {
 		return err
 	}
@@ -240,7 +659,38 @@ func (e *EPUBWriter) writeNCX() error {
     </docTitle>
     <navMap>
 %s    </navMap>
-</ncx>`, e.title, e.pageCount, e.pageCount, e.title, navPoints.String())
+</ncx>`, xmlEscape(e.title), e.pageCount, e.pageCount, xmlEscape(e.title), navPoints.String())
+
+	_, err = file.Write([]byte(content))
+	return err
+}
+
+// writeNav writes the EPUB 3 navigation document listing every page
+func (e *EPUBWriter) writeNav() error {
+	file, err := e.create("OEBPS/nav.xhtml")
+	if err != nil {
+		return err
+	}
+
+	var items strings.Builder
+	for i, page := range e.pages {
+		items.WriteString(fmt.Sprintf(`            <li><a href="%s">Page %d</a></li>
+`, page, i+1))
+	}
+
+	content := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
+<head>
+    <title>%s</title>
+</head>
+<body>
+    <nav epub:type="toc">
+        <ol>
+%s        </ol>
+    </nav>
+</body>
+</html>`, xmlEscape(e.title), items.String())
 
 	_, err = file.Write([]byte(content))
 	return err
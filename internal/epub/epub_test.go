@@ -3,7 +3,12 @@ package epub
 import (
 	"archive/zip"
 	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
 	"io"
+	"regexp"
+	"slices"
 	"strings"
 	"testing"
 )
@@ -56,4 +61,534 @@ func TestEPUBWriterManifestRecordsMimeTypes(t *testing.T) {
 	if !strings.Contains(contentOpf, "href=\"images/img2.jpg\" media-type=\"image/jpeg\"") {
 		t.Errorf("manifest missing img2.jpg with image/jpeg: %s", contentOpf)
 	}
+	if !strings.Contains(contentOpf, `<item id="css" href="style.css" media-type="text/css"/>`) {
+		t.Errorf("manifest missing style.css: %s", contentOpf)
+	}
+}
+
+// Test that the default page style is stored once in style.css and linked from every page
+func TestEPUBWriterDefaultStylesheet(t *testing.T) {
+	var buf bytes.Buffer
+	writer := NewEPUBWriter(&buf, "Test Title")
+	for _, name := range []string{"0.jpg", "1.jpg"} {
+		if err := writer.AddPage(name, []byte("data")); err != nil {
+			t.Fatalf("AddPage failed: %v", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	if got := readEntry(t, buf.Bytes(), "OEBPS/style.css"); got != DefaultPageCSS {
+		t.Errorf("unexpected style.css: %s", got)
+	}
+	for _, name := range []string{"OEBPS/page1.xhtml", "OEBPS/page2.xhtml"} {
+		page := readEntry(t, buf.Bytes(), name)
+		if !strings.Contains(page, `<link rel="stylesheet" type="text/css" href="style.css"/>`) || strings.Contains(page, "<style") {
+			t.Errorf("%s should link style.css instead of inlining it: %s", name, page)
+		}
+	}
+}
+
+// Test that SetCover registers the cover image and puts the cover page first in the spine
+func TestEPUBWriterSetCover(t *testing.T) {
+	var buf bytes.Buffer
+	writer := NewEPUBWriter(&buf, "Test Title")
+
+	if err := writer.SetCover("cover.jpg", []byte("cover")); err != nil {
+		t.Fatalf("SetCover failed: %v", err)
+	}
+	if err := writer.AddPage("0.jpg", []byte("data")); err != nil {
+		t.Fatalf("AddPage failed: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	contentOpf := readEntry(t, buf.Bytes(), "OEBPS/content.opf")
+
+	if !strings.Contains(contentOpf, `<meta name="cover" content="cover-image"/>`) {
+		t.Errorf("cover meta not pointing at cover image: %s", contentOpf)
+	}
+	if !strings.Contains(contentOpf, `href="images/cover.jpg" media-type="image/jpeg"`) {
+		t.Errorf("manifest missing cover image: %s", contentOpf)
+	}
+	if strings.Index(contentOpf, `<itemref idref="cover"/>`) > strings.Index(contentOpf, `<itemref idref="page1"/>`) {
+		t.Errorf("cover page is not first in spine: %s", contentOpf)
+	}
+	if readEntry(t, buf.Bytes(), "OEBPS/cover.xhtml") == "" {
+		t.Errorf("cover.xhtml not found")
+	}
+}
+
+// Test that image-only books put the images in the spine without XHTML pages
+func TestEPUBWriterImageOnly(t *testing.T) {
+	var buf bytes.Buffer
+	writer := NewEPUBWriter(&buf, "Test Title")
+	writer.SetImageOnly(true)
+
+	if err := writer.SetCover("cover.jpg", []byte("cover")); err != nil {
+		t.Fatalf("SetCover failed: %v", err)
+	}
+	for _, name := range []string{"0.jpg", "1.png"} {
+		if err := writer.AddPage(name, []byte("data")); err != nil {
+			t.Fatalf("AddPage failed: %v", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	contentOpf := readEntry(t, buf.Bytes(), "OEBPS/content.opf")
+	for _, want := range []string{
+		`<item id="cover-image" href="images/cover.jpg" media-type="image/jpeg"/>`,
+		`<item id="page1" href="images/0.jpg" media-type="image/jpeg"/>`,
+		`<item id="page2" href="images/1.png" media-type="image/png"/>`,
+		`<itemref idref="cover-image"/>
+        <itemref idref="page1"/>
+        <itemref idref="page2"/>`,
+	} {
+		if !strings.Contains(contentOpf, want) {
+			t.Errorf("content.opf missing %s: %s", want, contentOpf)
+		}
+	}
+	if strings.Contains(contentOpf, ".xhtml") || strings.Contains(contentOpf, "style.css") {
+		t.Errorf("image-only book should not reference pages or style: %s", contentOpf)
+	}
+	if ncx := readEntry(t, buf.Bytes(), "OEBPS/toc.ncx"); !strings.Contains(ncx, `<content src="images/0.jpg"/>`) {
+		t.Errorf("toc.ncx should point at the images: %s", ncx)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Failed to read zip: %v", err)
+	}
+	for _, f := range zr.File {
+		if strings.HasSuffix(f.Name, ".xhtml") || f.Name == "OEBPS/style.css" {
+			t.Errorf("unexpected entry %s", f.Name)
+		}
+	}
+}
+
+// readEntry returns the content of the named zip entry, failing the test if it is missing
+func readEntry(t *testing.T, archive []byte, name string) string {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatalf("Failed to read zip: %v", err)
+	}
+	for _, f := range zr.File {
+		if f.Name == name {
+			rc, err := f.Open()
+			if err != nil {
+				t.Fatalf("Failed to open %s: %v", name, err)
+			}
+			data, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				t.Fatalf("Failed to read %s: %v", name, err)
+			}
+			return string(data)
+		}
+	}
+	t.Fatalf("%s not found in EPUB", name)
+	return ""
+}
+
+// Test that landscape pages get the spread treatment while portrait pages keep the default layout
+func TestEPUBWriterMarksLandscapeSpreads(t *testing.T) {
+	var buf bytes.Buffer
+	writer := NewEPUBWriter(&buf, "Test Title")
+
+	if err := writer.AddPage("0.png", encodePNG(t, 4, 8)); err != nil {
+		t.Fatalf("AddPage portrait failed: %v", err)
+	}
+	if err := writer.AddPage("1.png", encodePNG(t, 8, 4)); err != nil {
+		t.Fatalf("AddPage landscape failed: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	if page := readEntry(t, buf.Bytes(), "OEBPS/page1.xhtml"); !strings.Contains(page, `<div class="page-container">`) {
+		t.Errorf("portrait page should use the default layout: %s", page)
+	}
+	if page := readEntry(t, buf.Bytes(), "OEBPS/page2.xhtml"); !strings.Contains(page, `<div class="page-container spread">`) {
+		t.Errorf("landscape page should be marked as a spread: %s", page)
+	}
+}
+
+// Test that the metadata replaces the default creator and adds escaped optional fields
+func TestEPUBWriterMetadata(t *testing.T) {
+	var buf bytes.Buffer
+	writer := NewEPUBWriter(&buf, "Test Title")
+	writer.SetMetadata(Metadata{
+		Creator:        "三田紀房",
+		Description:    "Tom & Jerry",
+		Source:         "https://tw.manhuagui.com/comic/1128/",
+		Year:           2003,
+		ChapterSources: []string{"https://tw.manhuagui.com/comic/1128/566271.html"},
+	})
+	if err := writer.AddPage("0.png", pngImage(t)); err != nil {
+		t.Fatalf("AddPage failed: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	contentOpf := readEntry(t, buf.Bytes(), "OEBPS/content.opf")
+	for _, want := range []string{
+		`<dc:creator>三田紀房</dc:creator>`,
+		`<dc:description>Tom &amp; Jerry</dc:description>`,
+		`<dc:identifier id="source-url">https://tw.manhuagui.com/comic/1128/</dc:identifier>`,
+		`<dc:source>https://tw.manhuagui.com/comic/1128/</dc:source>`,
+		`<dc:source>https://tw.manhuagui.com/comic/1128/566271.html</dc:source>`,
+		`<dc:date>2003</dc:date>`,
+	} {
+		if !strings.Contains(contentOpf, want) {
+			t.Errorf("content.opf missing %s: %s", want, contentOpf)
+		}
+	}
+	if strings.Contains(contentOpf, "Comic Downloader") {
+		t.Errorf("default creator not replaced: %s", contentOpf)
+	}
+}
+
+// Test that a title with XML special characters leaves every document
+// well-formed
+func TestEPUBWriterEscapesTitle(t *testing.T) {
+	const title = `Tom & Jerry <"1">`
+	var buf bytes.Buffer
+	writer := NewEPUBWriter(&buf, title)
+	// WebP pages make an EPUB 3 book, which has a navigation document
+	writer.SetImageFormat(ImageWebP)
+	if err := writer.AddPage("0.png", pngImage(t)); err != nil {
+		t.Fatalf("AddPage failed: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	for _, name := range []string{"OEBPS/content.opf", "OEBPS/toc.ncx", "OEBPS/nav.xhtml"} {
+		d := xml.NewDecoder(strings.NewReader(readEntry(t, buf.Bytes(), name)))
+		for {
+			_, err := d.Token()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Errorf("%s is not well-formed: %v", name, err)
+				break
+			}
+		}
+	}
+	got, _, err := ParsePackage([]byte(readEntry(t, buf.Bytes(), "OEBPS/content.opf")))
+	if err != nil || got != title {
+		t.Errorf("ParsePackage = %q, %v, want %q", got, err, title)
+	}
+}
+
+// Test that custom CSS is stored once in style.css and linked from every page
+func TestEPUBWriterPageCSS(t *testing.T) {
+	var buf bytes.Buffer
+	writer := NewEPUBWriter(&buf, "Test Title")
+	css := DefaultPageCSS + ".page-container { background-color: #000000; }\n"
+	writer.SetPageCSS(css)
+
+	if err := writer.SetCover("cover.jpg", []byte("cover")); err != nil {
+		t.Fatalf("SetCover failed: %v", err)
+	}
+	if err := writer.AddPage("0.jpg", []byte("data")); err != nil {
+		t.Fatalf("AddPage failed: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	if got := readEntry(t, buf.Bytes(), "OEBPS/style.css"); got != css {
+		t.Errorf("unexpected style.css: %s", got)
+	}
+	contentOpf := readEntry(t, buf.Bytes(), "OEBPS/content.opf")
+	if !strings.Contains(contentOpf, `<item id="css" href="style.css" media-type="text/css"/>`) {
+		t.Errorf("manifest missing style.css: %s", contentOpf)
+	}
+	for _, name := range []string{"OEBPS/cover.xhtml", "OEBPS/page1.xhtml"} {
+		page := readEntry(t, buf.Bytes(), name)
+		if !strings.Contains(page, `<link rel="stylesheet" type="text/css" href="style.css"/>`) || strings.Contains(page, "<style") {
+			t.Errorf("%s should link style.css instead of inlining it: %s", name, page)
+		}
+	}
+}
+
+// fakeRecognizer returns canned text per image, failing for unknown images
+type fakeRecognizer map[string]string
+
+func (f fakeRecognizer) Recognize(data []byte) (string, error) {
+	text, ok := f[string(data)]
+	if !ok {
+		return "", errors.New("unreadable")
+	}
+	return text, nil
+}
+
+// Test that recognized text is embedded escaped and failed pages are added without text
+func TestEPUBWriterEmbedsRecognizedText(t *testing.T) {
+	var buf bytes.Buffer
+	writer := NewEPUBWriter(&buf, "Test Title")
+	writer.SetTextRecognizer(fakeRecognizer{"data1": "東大 <合格>"})
+
+	if err := writer.AddPage("0.jpg", []byte("data1")); err != nil {
+		t.Fatalf("AddPage failed: %v", err)
+	}
+	if err := writer.AddPage("1.jpg", []byte("data2")); err != nil {
+		t.Fatalf("AddPage without text failed: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	if page := readEntry(t, buf.Bytes(), "OEBPS/page1.xhtml"); !strings.Contains(page, `<div class="ocr-text">東大 &lt;合格&gt;</div>`) {
+		t.Errorf("page should carry the escaped text: %s", page)
+	}
+	if page := readEntry(t, buf.Bytes(), "OEBPS/page2.xhtml"); strings.Contains(page, "ocr-text") {
+		t.Errorf("page without text should have no text block: %s", page)
+	}
+}
+
+// Test that images and the mimetype are stored while text entries are deflated
+func TestEPUBWriterCompression(t *testing.T) {
+	var buf bytes.Buffer
+	writer := NewEPUBWriter(&buf, "Test Title")
+	if err := writer.SetCover("cover.png", pngImage(t)); err != nil {
+		t.Fatalf("SetCover failed: %v", err)
+	}
+	if err := writer.AddPage("0.png", pngImage(t)); err != nil {
+		t.Fatalf("AddPage failed: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Failed to read zip: %v", err)
+	}
+	for _, f := range zr.File {
+		want := zip.Deflate
+		if f.Name == "mimetype" || strings.HasPrefix(f.Name, "OEBPS/images/") {
+			want = zip.Store
+		}
+		if f.Method != want {
+			t.Errorf("%s: expected method %d, got %d", f.Name, want, f.Method)
+		}
+		// Reading checks each entry's checksum
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", f.Name, err)
+		}
+		if _, err := io.Copy(io.Discard, rc); err != nil {
+			t.Errorf("Failed to read %s: %v", f.Name, err)
+		}
+		rc.Close()
+	}
+	if got := readEntry(t, buf.Bytes(), "mimetype"); got != "application/epub+zip" {
+		t.Errorf("unexpected mimetype %q", got)
+	}
+
+	if err := NewEPUBWriter(io.Discard, "x").SetDeflateLevel(10); err == nil {
+		t.Error("expected an error for an invalid deflate level")
+	}
+}
+
+// Test that mimetype is the first entry and uncompressed, as the EPUB container requires
+func TestEPUBWriterMimetypeFirst(t *testing.T) {
+	var buf bytes.Buffer
+	writer := NewEPUBWriter(&buf, "Test Title")
+	if err := writer.AddPage("0.png", pngImage(t)); err != nil {
+		t.Fatalf("AddPage failed: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Failed to read zip: %v", err)
+	}
+	first := zr.File[0]
+	if first.Name != "mimetype" || first.Method != zip.Store {
+		t.Fatalf("expected a stored mimetype first, got %s (method %d)", first.Name, first.Method)
+	}
+	if len(first.Extra) != 0 {
+		t.Errorf("expected no extra field on mimetype, got %d bytes", len(first.Extra))
+	}
+	// Readers sniff the type at a fixed offset: the 30 byte local header and
+	// the 8 byte name
+	if got := string(buf.Bytes()[38:58]); got != "application/epub+zip" {
+		t.Errorf("expected application/epub+zip at offset 38, got %q", got)
+	}
+	for _, f := range zr.File[1:] {
+		if f.Name == "mimetype" {
+			t.Errorf("mimetype written twice")
+		}
+	}
+}
+
+// Test that failures of the underlying writer are reported. Writes are
+// buffered, so they may only surface on Close.
+func TestEPUBWriterReportsWriteFailure(t *testing.T) {
+	writer := NewEPUBWriter(failingWriter{}, "Test Title")
+	addErr := writer.AddPage("0.png", pngImage(t))
+	if err := writer.Close(); err == nil && addErr == nil {
+		t.Error("expected the write failure to be reported")
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) { return 0, io.ErrShortWrite }
+
+// Test that with the expected page count, sorting the page files by name
+// keeps the spine order
+func TestEPUBWriterExpectedPagesSortInSpineOrder(t *testing.T) {
+	const pages = 1001
+	var buf bytes.Buffer
+	writer := NewEPUBWriter(&buf, "Test Title")
+	writer.SetExpectedPages(pages)
+	for i := 0; i < pages; i++ {
+		if err := writer.AddPage(fmt.Sprintf("%d.jpg", i), []byte("data")); err != nil {
+			t.Fatalf("AddPage %d failed: %v", i, err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Failed to read zip: %v", err)
+	}
+	var xhtml, images []string
+	var opf string
+	for _, f := range zr.File {
+		switch {
+		case strings.HasPrefix(f.Name, "OEBPS/page"):
+			xhtml = append(xhtml, strings.TrimPrefix(f.Name, "OEBPS/"))
+		case strings.HasPrefix(f.Name, "OEBPS/images/"):
+			images = append(images, strings.TrimPrefix(f.Name, "OEBPS/"))
+		case f.Name == "OEBPS/content.opf":
+			rc, err := f.Open()
+			if err != nil {
+				t.Fatalf("Failed to open content.opf: %v", err)
+			}
+			data, _ := io.ReadAll(rc)
+			rc.Close()
+			opf = string(data)
+		}
+	}
+
+	hrefs := make(map[string]string)
+	for _, m := range regexp.MustCompile(`<item id="(\w+)" href="([^"]+)"`).FindAllStringSubmatch(opf, -1) {
+		hrefs[m[1]] = m[2]
+	}
+	var spine, spineImages []string
+	for _, m := range regexp.MustCompile(`<itemref idref="page(\d+)"/>`).FindAllStringSubmatch(opf, -1) {
+		spine = append(spine, hrefs["page"+m[1]])
+		spineImages = append(spineImages, hrefs["img"+m[1]])
+	}
+	if len(spine) != pages {
+		t.Fatalf("expected %d pages in the spine, got %d", pages, len(spine))
+	}
+	if spine[0] != "page0001.xhtml" || spine[pages-1] != "page1001.xhtml" {
+		t.Errorf("expected zero-padded pages, got %s to %s", spine[0], spine[pages-1])
+	}
+	for name, files := range map[string][]string{"pages": xhtml, "images": images} {
+		slices.Sort(files)
+		expected := spine
+		if name == "images" {
+			expected = spineImages
+		}
+		if !slices.Equal(files, expected) {
+			t.Errorf("%s sorted by name differ from the spine order", name)
+		}
+	}
+}
+
+// Test that front matter pages follow the cover in the spine and show the metadata
+func TestEPUBWriterFrontMatter(t *testing.T) {
+	var buf bytes.Buffer
+	writer := NewEPUBWriter(&buf, "東大特訓班")
+	writer.SetFrontMatter(FrontMatter{TitlePage: true, Colophon: true})
+	writer.SetMetadata(Metadata{
+		Creator:        "三田紀房",
+		Source:         "https://tw.manhuagui.com/comic/1128/",
+		Year:           2003,
+		ChapterSources: []string{"https://tw.manhuagui.com/comic/1128/566271.html"},
+	})
+	if err := writer.SetCover("cover.jpg", []byte("cover")); err != nil {
+		t.Fatalf("SetCover failed: %v", err)
+	}
+	if err := writer.AddPage("0.jpg", []byte("data")); err != nil {
+		t.Fatalf("AddPage failed: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	contentOpf := readEntry(t, buf.Bytes(), "OEBPS/content.opf")
+	order := []string{`<itemref idref="cover"/>`, `<itemref idref="title"/>`, `<itemref idref="colophon"/>`, `<itemref idref="page1"/>`}
+	for i := 1; i < len(order); i++ {
+		if a, b := strings.Index(contentOpf, order[i-1]), strings.Index(contentOpf, order[i]); a < 0 || b < a {
+			t.Errorf("spine does not have %s before %s: %s", order[i-1], order[i], contentOpf)
+		}
+	}
+	title := readEntry(t, buf.Bytes(), "OEBPS/title.xhtml")
+	for _, want := range []string{"<h1>東大特訓班</h1>", "<p>三田紀房</p>", `href="https://tw.manhuagui.com/comic/1128/"`} {
+		if !strings.Contains(title, want) {
+			t.Errorf("title page missing %s: %s", want, title)
+		}
+	}
+	colophon := readEntry(t, buf.Bytes(), "OEBPS/colophon.xhtml")
+	for _, want := range []string{"First published: 2003", "566271.html", "Pages: 1", "Artwork © 三田紀房"} {
+		if !strings.Contains(colophon, want) {
+			t.Errorf("colophon missing %s: %s", want, colophon)
+		}
+	}
+	for _, page := range []string{title, colophon} {
+		if err := xml.Unmarshal([]byte(page), new(struct{})); err != nil {
+			t.Errorf("front matter is not well-formed: %v", err)
+		}
+	}
+}
+
+func TestEPUBWriterFrontMatterBeforeCover(t *testing.T) {
+	var buf bytes.Buffer
+	writer := NewEPUBWriter(&buf, "Test Title")
+	writer.SetFrontMatter(FrontMatter{TitlePage: true, BeforeCover: true})
+	if err := writer.SetCover("cover.jpg", []byte("cover")); err != nil {
+		t.Fatalf("SetCover failed: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	contentOpf := readEntry(t, buf.Bytes(), "OEBPS/content.opf")
+	if strings.Index(contentOpf, `<itemref idref="title"/>`) > strings.Index(contentOpf, `<itemref idref="cover"/>`) {
+		t.Errorf("title page is not before the cover: %s", contentOpf)
+	}
+	if strings.Contains(contentOpf, "colophon") {
+		t.Errorf("unexpected colophon: %s", contentOpf)
+	}
+}
+
+func TestParseFrontMatter(t *testing.T) {
+	f, err := ParseFrontMatter(" Title, colophon")
+	if err != nil || !f.TitlePage || !f.Colophon {
+		t.Errorf("ParseFrontMatter = %+v, %v", f, err)
+	}
+	if f, err := ParseFrontMatter(""); err != nil || f != (FrontMatter{}) {
+		t.Errorf("ParseFrontMatter(\"\") = %+v, %v", f, err)
+	}
+	if _, err := ParseFrontMatter("title,index"); err == nil {
+		t.Error("expected an error for an unknown page")
+	}
 }
@@ -0,0 +1,146 @@
+package epub
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// FrontMatter selects the text pages opening the book, written from its
+// metadata. The zero value adds none.
+type FrontMatter struct {
+	// TitlePage shows the title, author and source
+	TitlePage bool
+	// Colophon describes the book: its author, year, sources and pages
+	Colophon bool
+	// BeforeCover places the pages before the cover instead of between the
+	// cover and the first page
+	BeforeCover bool
+}
+
+// ParseFrontMatter converts a comma-separated list of front matter pages,
+// "title" and "colophon", into a FrontMatter
+func ParseFrontMatter(s string) (FrontMatter, error) {
+	var f FrontMatter
+	for _, name := range strings.Split(s, ",") {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "":
+		case "title":
+			f.TitlePage = true
+		case "colophon":
+			f.Colophon = true
+		default:
+			return FrontMatter{}, fmt.Errorf("invalid front matter page: %s. Use 'title' or 'colophon'", name)
+		}
+	}
+	return f, nil
+}
+
+// frontMatterTemplate is the XHTML of the front matter pages. They carry
+// their own style, so a replaced page style or an image-only book leaves
+// them readable.
+const frontMatterTemplate = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml">
+<head>
+    <title>%s</title>
+    <style type="text/css">
+        body { margin: 10%% 8%%; text-align: center; font-family: serif; }
+        h1 { font-size: 2em; margin: 30%% 0 1em; }
+        .colophon { text-align: left; font-size: 0.9em; }
+        .colophon ul { padding-left: 1.5em; }
+        a { color: inherit; word-break: break-all; }
+    </style>
+</head>
+<body>
+%s</body>
+</html>`
+
+// SetFrontMatter adds the given front matter pages. They are written on
+// Close from the metadata then set.
+func (e *EPUBWriter) SetFrontMatter(f FrontMatter) {
+	e.frontMatter = f
+}
+
+// frontPages returns the file names of the front matter pages in spine order
+func (e *EPUBWriter) frontPages() []string {
+	var pages []string
+	if e.frontMatter.TitlePage {
+		pages = append(pages, "title.xhtml")
+	}
+	if e.frontMatter.Colophon {
+		pages = append(pages, "colophon.xhtml")
+	}
+	return pages
+}
+
+// writeFrontMatter writes the front matter pages
+func (e *EPUBWriter) writeFrontMatter() error {
+	for _, page := range e.frontPages() {
+		title, body := "Title Page", e.titlePageBody()
+		if page == "colophon.xhtml" {
+			title, body = "Colophon", e.colophonBody()
+		}
+		file, err := e.create("OEBPS/" + page)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(file, frontMatterTemplate, title, body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// titlePageBody shows the title, author and source
+func (e *EPUBWriter) titlePageBody() string {
+	var body strings.Builder
+	fmt.Fprintf(&body, "    <h1>%s</h1>\n", xmlEscape(e.title))
+	if e.metadata.Creator != "" {
+		fmt.Fprintf(&body, "    <p>%s</p>\n", xmlEscape(e.metadata.Creator))
+	}
+	if e.metadata.Source != "" {
+		fmt.Fprintf(&body, "    <p>%s</p>\n", link(e.metadata.Source))
+	}
+	return body.String()
+}
+
+// colophonBody describes the book and where its pages come from
+func (e *EPUBWriter) colophonBody() string {
+	var body strings.Builder
+	body.WriteString("    <div class=\"colophon\">\n")
+	line := func(format string, args ...any) {
+		body.WriteString("        <p>" + fmt.Sprintf(format, args...) + "</p>\n")
+	}
+	line("<strong>%s</strong>", xmlEscape(e.title))
+	author := "its creators"
+	if e.metadata.Creator != "" {
+		line("Author: %s", xmlEscape(e.metadata.Creator))
+		author = xmlEscape(e.metadata.Creator)
+	}
+	if e.metadata.Year != 0 {
+		line("First published: %04d", e.metadata.Year)
+	}
+	if e.metadata.Source != "" {
+		line("Source: %s", link(e.metadata.Source))
+	}
+	if len(e.metadata.ChapterSources) > 0 {
+		line("Chapters:")
+		body.WriteString("        <ul>\n")
+		for _, source := range e.metadata.ChapterSources {
+			body.WriteString("            <li>" + link(source) + "</li>\n")
+		}
+		body.WriteString("        </ul>\n")
+	}
+	line("Pages: %d", e.pageCount)
+	line("Made on %s", time.Now().Format("2006-01-02"))
+	line("Artwork © %s. This copy is for personal use only.", author)
+	body.WriteString("    </div>\n")
+	return body.String()
+}
+
+// link renders url as a link showing itself
+func link(url string) string {
+	escaped := xmlEscape(url)
+	return fmt.Sprintf(`<a href="%s">%s</a>`, escaped, escaped)
+}
@@ -0,0 +1,103 @@
+package epub
+
+import (
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Sidecar describes a book in a standalone OPF metadata file, as read by
+// Calibre when importing the book file of the same name. Empty fields are
+// omitted.
+type Sidecar struct {
+	Title       string
+	Authors     []string
+	Series      string
+	Description string
+	// Source is the book's web page, also used as its identifier
+	Source string
+	Year   int
+	Tags   []string
+	// Cover is the file name of the cover image next to the OPF
+	Cover string
+}
+
+// OPF renders the sidecar as an OPF package document without manifest or spine
+func (s Sidecar) OPF() []byte {
+	var meta strings.Builder
+	line := func(format string, args ...any) {
+		meta.WriteString("        " + fmt.Sprintf(format, args...) + "\n")
+	}
+	line("<dc:title>%s</dc:title>", xmlEscape(s.Title))
+	for _, author := range s.Authors {
+		line(`<dc:creator opf:role="aut">%s</dc:creator>`, xmlEscape(author))
+	}
+	if s.Description != "" {
+		line("<dc:description>%s</dc:description>", xmlEscape(s.Description))
+	}
+	if s.Source != "" {
+		line(`<dc:identifier opf:scheme="URI">%s</dc:identifier>`, xmlEscape(s.Source))
+		line("<dc:source>%s</dc:source>", xmlEscape(s.Source))
+	}
+	if s.Year != 0 {
+		line("<dc:date>%04d</dc:date>", s.Year)
+	}
+	for _, tag := range s.Tags {
+		line("<dc:subject>%s</dc:subject>", xmlEscape(tag))
+	}
+	if s.Series != "" {
+		line(`<meta name="calibre:series" content="%s"/>`, xmlEscape(s.Series))
+	}
+
+	var guide string
+	if s.Cover != "" {
+		guide = fmt.Sprintf(`    <guide>
+        <reference type="cover" href="%s" title="Cover"/>
+    </guide>
+`, xmlEscape(s.Cover))
+	}
+
+	return []byte(fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<package version="2.0" xmlns="http://www.idpf.org/2007/opf">
+    <metadata xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:opf="http://www.idpf.org/2007/opf">
+%s    </metadata>
+%s</package>
+`, meta.String(), guide))
+}
+
+// packageMetadata is the metadata of a package document read by ParsePackage
+type packageMetadata struct {
+	Title       string   `xml:"metadata>title"`
+	Creator     string   `xml:"metadata>creator"`
+	Description string   `xml:"metadata>description"`
+	Date        string   `xml:"metadata>date"`
+	Sources     []string `xml:"metadata>source"`
+}
+
+// yearPattern matches a dc:date holding only a year. Books without a known
+// year are dated the day they were written, which says nothing of the comic.
+var yearPattern = regexp.MustCompile(`^\d{4}$`)
+
+// ParsePackage reads back the title and metadata of a book from its package
+// document, as written by EPUBWriter. The first source is the book's page and
+// the others its chapters'.
+func ParsePackage(data []byte) (string, Metadata, error) {
+	var doc packageMetadata
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return "", Metadata{}, err
+	}
+	metadata := Metadata{Description: doc.Description}
+	if doc.Creator != defaultCreator {
+		metadata.Creator = doc.Creator
+	}
+	if yearPattern.MatchString(doc.Date) {
+		metadata.Year, _ = strconv.Atoi(doc.Date)
+	}
+	if len(doc.Sources) > 0 {
+		metadata.Source = doc.Sources[0]
+		metadata.ChapterSources = doc.Sources[1:]
+	}
+	return doc.Title, metadata, nil
+}
@@ -0,0 +1,99 @@
+package epub
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSidecarOPF(t *testing.T) {
+	opf := string(Sidecar{
+		Title:       "東大特訓班 1-2",
+		Authors:     []string{"三田紀房"},
+		Series:      "東大特訓班",
+		Description: "<考試> & 夢想",
+		Source:      "https://tw.manhuagui.com/comic/1128/",
+		Year:        2003,
+		Tags:        []string{"Manga", "Completed"},
+		Cover:       "東大特訓班 1-2.jpg",
+	}.OPF())
+
+	for _, want := range []string{
+		`<dc:title>東大特訓班 1-2</dc:title>`,
+		`<dc:creator opf:role="aut">三田紀房</dc:creator>`,
+		`<dc:description>&lt;考試&gt; &amp; 夢想</dc:description>`,
+		`<dc:identifier opf:scheme="URI">https://tw.manhuagui.com/comic/1128/</dc:identifier>`,
+		`<dc:date>2003</dc:date>`,
+		`<dc:subject>Manga</dc:subject>`,
+		`<dc:subject>Completed</dc:subject>`,
+		`<meta name="calibre:series" content="東大特訓班"/>`,
+		`<reference type="cover" href="東大特訓班 1-2.jpg" title="Cover"/>`,
+	} {
+		if !strings.Contains(opf, want) {
+			t.Errorf("OPF missing %s:\n%s", want, opf)
+		}
+	}
+	if err := xml.Unmarshal([]byte(opf), new(struct{})); err != nil {
+		t.Errorf("OPF is not well-formed: %v", err)
+	}
+}
+
+func TestSidecarOPFOmitsEmptyFields(t *testing.T) {
+	opf := string(Sidecar{Title: "t"}.OPF())
+	for _, unwanted := range []string{"dc:creator", "dc:description", "dc:identifier", "dc:date", "dc:subject", "calibre:series", "<guide>"} {
+		if strings.Contains(opf, unwanted) {
+			t.Errorf("OPF should not contain %s:\n%s", unwanted, opf)
+		}
+	}
+}
+
+func TestParsePackageRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewEPUBWriter(&buf, "東大特訓班 1-2")
+	metadata := Metadata{
+		Creator:        "三田紀房",
+		Description:    "<考試> & 夢想",
+		Source:         "https://tw.manhuagui.com/comic/1128/",
+		ChapterSources: []string{"https://tw.manhuagui.com/comic/1128/566271.html"},
+		Year:           2003,
+	}
+	w.SetMetadata(metadata)
+	if err := w.AddPage("0.jpg", []byte("page")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := zr.Open("OEBPS/content.opf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+
+	title, got, err := ParsePackage(data)
+	if err != nil {
+		t.Fatalf("ParsePackage failed: %v", err)
+	}
+	if title != "東大特訓班 1-2" || !reflect.DeepEqual(got, metadata) {
+		t.Errorf("ParsePackage = %q, %+v", title, got)
+	}
+}
+
+func TestParsePackageSkipsDefaults(t *testing.T) {
+	data := []byte(`<package><metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+<dc:title>t</dc:title><dc:creator>Comic Downloader</dc:creator><dc:date>2026-10-16</dc:date>
+</metadata></package>`)
+	_, got, err := ParsePackage(data)
+	if err != nil || !reflect.DeepEqual(got, Metadata{}) {
+		t.Errorf("ParsePackage = %+v (%v), want no metadata", got, err)
+	}
+}
@@ -0,0 +1,78 @@
+package info
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// DefaultCacheDir returns where the update command remembers the comics it
+// has seen, ~/.cache/comicsd/info on Linux
+func DefaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "comicsd", "info")
+}
+
+// LoadCached reads the comic info saved in dir by SaveCached, nil when the
+// comic was never saved
+func LoadCached(dir, comicID string) (*ComicInfo, error) {
+	data, err := os.ReadFile(filepath.Join(dir, comicID+".json"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ci ComicInfo
+	if err := json.Unmarshal(data, &ci); err != nil {
+		return nil, fmt.Errorf("invalid cached comic info %s: %w", comicID, err)
+	}
+	return &ci, nil
+}
+
+// SaveCached saves the comic info in dir, replacing the previous copy
+func SaveCached(dir string, info *ComicInfo) error {
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	// Write a temporary file first so an interrupted save keeps the old copy
+	tmp, err := os.CreateTemp(dir, info.ID+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, info.ID+".json"))
+}
+
+// NewChapters returns the chapters missing from prev in reading (oldest
+// first) order
+func (info *ComicInfo) NewChapters(prev *ComicInfo) []Chapter {
+	seen := make(map[string]bool, len(prev.Chapters))
+	for _, chapter := range prev.Chapters {
+		seen[chapter.ID] = true
+	}
+	var chapters []Chapter
+	for i := len(info.Chapters) - 1; i >= 0; i-- {
+		if !seen[info.Chapters[i].ID] {
+			chapters = append(chapters, info.Chapters[i])
+		}
+	}
+	return chapters
+}
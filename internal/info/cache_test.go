@@ -0,0 +1,45 @@
+package info
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCachedInfoRoundTrip(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "info")
+	if ci, err := LoadCached(dir, "1128"); err != nil || ci != nil {
+		t.Fatalf("expected nothing cached, got %v, %v", ci, err)
+	}
+
+	saved := &ComicInfo{ID: "1128", Title: "東大特訓班", Chapters: []Chapter{{ID: "7777", Title: "第1話"}}}
+	if err := SaveCached(dir, saved); err != nil {
+		t.Fatalf("SaveCached failed: %v", err)
+	}
+	loaded, err := LoadCached(dir, "1128")
+	if err != nil {
+		t.Fatalf("LoadCached failed: %v", err)
+	}
+	if loaded.Title != "東大特訓班" || len(loaded.Chapters) != 1 || loaded.Chapters[0].ID != "7777" {
+		t.Errorf("unexpected cached info: %+v", loaded)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("expected only the cached file, got %d entries", len(entries))
+	}
+}
+
+func TestNewChapters(t *testing.T) {
+	prev := &ComicInfo{Chapters: []Chapter{{ID: "2"}, {ID: "1"}}}
+	// The site lists chapters newest first
+	current := &ComicInfo{Chapters: []Chapter{{ID: "4"}, {ID: "3"}, {ID: "2"}, {ID: "1"}}}
+
+	chapters := current.NewChapters(prev)
+	if len(chapters) != 2 || chapters[0].ID != "3" || chapters[1].ID != "4" {
+		t.Errorf("expected chapters 3 and 4 in reading order, got %v", chapters)
+	}
+	if chapters := current.NewChapters(current); len(chapters) != 0 {
+		t.Errorf("expected no new chapters, got %v", chapters)
+	}
+}
@@ -0,0 +1,112 @@
+package info
+
+import (
+	"encoding/xml"
+	"strings"
+
+	"comicsd/internal/site"
+)
+
+// comicRackInfo is the ComicInfo.xml document read by CBZ readers such as
+// ComicRack, Komga and Kavita
+type comicRackInfo struct {
+	XMLName   xml.Name `xml:"ComicInfo"`
+	Title     string   `xml:"Title,omitempty"`
+	Series    string   `xml:"Series,omitempty"`
+	Number    string   `xml:"Number,omitempty"`
+	Volume    int      `xml:"Volume,omitempty"`
+	Summary   string   `xml:"Summary,omitempty"`
+	Year      int      `xml:"Year,omitempty"`
+	Writer    string   `xml:"Writer,omitempty"`
+	PageCount int      `xml:"PageCount,omitempty"`
+	Web       string   `xml:"Web,omitempty"`
+	Manga     string   `xml:"Manga"`
+}
+
+// URL returns the comic's page on the default site
+func (info *ComicInfo) URL() string {
+	return site.Default.ComicURL(info.ID)
+}
+
+// ChapterURL returns the reader of a chapter of the comic on the default site
+func (info *ComicInfo) ChapterURL(chapterID string) string {
+	return site.Default.ChapterURL(info.ID, chapterID)
+}
+
+// ComicRackXML renders the comic as a ComicInfo.xml document for an archive
+// named title holding pageCount pages. Web lists the comic's page followed by
+// the readers of chapterIDs, separated by spaces as ComicInfo allows, and is
+// left out for a comic without ID.
+func (info *ComicInfo) ComicRackXML(title string, pageCount int, chapterIDs ...string) ([]byte, error) {
+	var web []string
+	if info.ID != "" {
+		web = append(web, info.URL())
+		for _, id := range chapterIDs {
+			web = append(web, info.ChapterURL(id))
+		}
+	}
+	return info.comicRack(comicRackInfo{Title: title, Web: strings.Join(web, " "), PageCount: pageCount})
+}
+
+// ChapterComicRackXML renders a ComicInfo.xml document for an archive holding
+// a single chapter, so comic servers index it as issue number of the series.
+// A volume is indexed by its Volume instead, and a range by its first number.
+// Web is the chapter's reader; the site's relative chapter links are resolved.
+func (info *ComicInfo) ChapterComicRackXML(chapter Chapter, number ChapterNumber, pageCount int) ([]byte, error) {
+	web := chapter.URL
+	if !strings.Contains(web, "://") {
+		web = info.URL()
+		if chapter.ID != "" {
+			web = info.ChapterURL(chapter.ID)
+		}
+	}
+	doc := comicRackInfo{Title: chapter.Title, Web: web, PageCount: pageCount}
+	if number.Volume {
+		doc.Volume = int(number.First)
+	} else {
+		doc.Number = formatNumber(number.First)
+	}
+	return info.comicRack(doc)
+}
+
+// comicRack renders doc with the comic's own fields filled in
+func (info *ComicInfo) comicRack(doc comicRackInfo) ([]byte, error) {
+	doc.Series = info.Title
+	doc.Summary = info.Description
+	doc.Year = info.Year
+	doc.Writer = info.Author
+	doc.Manga = "YesAndRightToLeft"
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// ParseComicRackXML reads back the comic described by a ComicInfo.xml
+// document and the title of its archive. The comic ID and chapters are taken
+// from the site's URLs in Web; other links are ignored.
+func ParseComicRackXML(data []byte) (*ComicInfo, string, error) {
+	var doc comicRackInfo
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, "", err
+	}
+	info := &ComicInfo{
+		Title:       doc.Series,
+		Author:      doc.Writer,
+		Description: doc.Summary,
+		Year:        doc.Year,
+	}
+	if info.Title == "" {
+		info.Title = doc.Title
+	}
+	for _, link := range strings.Fields(doc.Web) {
+		if comicID, chapterID, err := site.Default.ParseChapterURL(link); err == nil {
+			info.ID = comicID
+			info.Chapters = append(info.Chapters, Chapter{ID: chapterID, URL: link})
+		} else if id := site.Default.ComicID(link); id != "" {
+			info.ID = id
+		}
+	}
+	return info, doc.Title, nil
+}
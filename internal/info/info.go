@@ -3,43 +3,127 @@ package info
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"regexp"
 	"strings"
+	"time"
+
+	"comicsd/internal/downloader"
+	"comicsd/internal/site"
 
 	"github.com/chromedp/chromedp"
 	"go.uber.org/multierr"
 )
 
 type ComicInfo struct {
-	ID          string    `json:"id"`
-	Title       string    `json:"title"`
-	Author      string    `json:"author"`
-	Status      string    `json:"status"`
+	ID     string `json:"id"`
+	Title  string `json:"title"`
+	Author string `json:"author"`
+	// Status is the status as shown on the site
+	Status string `json:"status"`
+	// Completed tells finished from ongoing series, nil when the status is
+	// missing or not recognized
+	Completed *bool `json:"completed"`
+	// Year is when the series started, 0 when the site does not say
+	Year        int       `json:"year,omitempty"`
 	Description string    `json:"description"`
+	CoverURL    string    `json:"cover_url"`
 	Chapters    []Chapter `json:"chapters"`
 }
 
 type Chapter struct {
-	ID    string `json:"id"`
-	Title string `json:"title"`
-	URL   string `json:"url"`
+	ID        string `json:"id"`
+	Title     string `json:"title"`
+	URL       string `json:"url"`
+	PageCount int    `json:"page_count,omitempty"`
 }
 
 type SearchResult struct {
 	ID    string `json:"id"`
 	Title string `json:"title"`
 	URL   string `json:"url"`
+	// CoverURL is the result's cover thumbnail, empty when it has none
+	CoverURL string `json:"cover_url,omitempty"`
+}
+
+// DownloadPlan is the input of the download-plan command and mirrors the
+// arguments of the MCP download tools
+type DownloadPlan struct {
+	ComicID    string   `json:"comic_id"`
+	Title      string   `json:"title"`
+	ChapterIDs []string `json:"chapter_ids"`
+	Format     string   `json:"format,omitempty"`
+}
+
+// Validate checks that the plan names a comic, a title and at least one chapter
+func (p *DownloadPlan) Validate() error {
+	if p.ComicID == "" {
+		return fmt.Errorf("comic_id is required")
+	}
+	if p.Title == "" {
+		return fmt.Errorf("title is required")
+	}
+	if len(p.ChapterIDs) == 0 {
+		return fmt.Errorf("at least one chapter is required")
+	}
+	return downloader.ValidateIDs(p.ComicID, p.ChapterIDs...)
 }
 
+// Validate checks that comic info read back from JSON names a comic and
+// chapters that all have IDs
+func (info *ComicInfo) Validate() error {
+	if info.ID == "" {
+		return fmt.Errorf("id is required")
+	}
+	if len(info.Chapters) == 0 {
+		return fmt.Errorf("at least one chapter is required")
+	}
+	for i, chapter := range info.Chapters {
+		if chapter.ID == "" {
+			return fmt.Errorf("chapter %d (%q) has no id", i+1, chapter.Title)
+		}
+		if err := downloader.ValidateIDs(info.ID, chapter.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Fetcher retrieves comic information. ComicInfoFetcher implements it with a
+// browser tab; infotest.Fetcher serves canned data to tests.
+type Fetcher interface {
+	SearchComics(keyword string) ([]SearchResult, error)
+	GetComicInfo(comicID string) (*ComicInfo, error)
+	FillChapterPageCounts(info *ComicInfo, workers int) error
+}
+
+var _ Fetcher = (*ComicInfoFetcher)(nil)
+
 type ComicInfoFetcher struct {
 	ctx context.Context
+	// site is the site comics are read from, site.Default when nil
+	site site.Adapter
 }
 
 func NewComicInfoFetcher(ctx context.Context) *ComicInfoFetcher {
 	return &ComicInfoFetcher{ctx: ctx}
 }
 
+// NewSiteFetcher returns a fetcher reading comics from the given site
+func NewSiteFetcher(ctx context.Context, adapter site.Adapter) *ComicInfoFetcher {
+	return &ComicInfoFetcher{ctx: ctx, site: adapter}
+}
+
+// adapter returns the fetcher's site
+func (c *ComicInfoFetcher) adapter() site.Adapter {
+	if c.site == nil {
+		return downloader.OnWorkingMirror(site.Default)
+	}
+	return c.site
+}
+
 // textContent extracts text content using chromedp. Defined as a variable for tests.
 var textContent = func(ctx context.Context, sel string, res *string) error {
 	return chromedp.Text(sel, res, chromedp.ByQuery).Do(ctx)
@@ -50,14 +134,43 @@ var evalJS = func(ctx context.Context, expr string, res interface{}) error {
 	return chromedp.Evaluate(expr, res).Do(ctx)
 }
 
+// runActions runs browser actions in the tab of ctx. Defined as a variable for tests.
+var runActions = chromedp.Run
+
+const (
+	// searchAttempts is how often a search page is loaded before giving up
+	searchAttempts = 3
+	// searchWaitTimeout bounds the wait for the results of one attempt
+	searchWaitTimeout = 30 * time.Second
+)
+
+// enumeratePages collects// enumeratePages collects chapter page lists using chromedp. Defined as a variable for tests.
+var enumeratePages = downloader.EnumeratePages
+
+// Strict makes GetComicInfo fail when any field cannot be read. By default
+// only the title and chapters are required; a missing author, status,
+// description or cover is logged and left empty, so minor layout changes of
+// the site do not break every command.
+var Strict bool
+
 // fillComicInfo fills the ComicInfo struct by scraping the page.
 func (c *ComicInfoFetcher) fillComicInfo(info *ComicInfo) chromedp.ActionFunc {
 	return chromedp.ActionFunc(func(ctx context.Context) error {
-		var err error
+		adapter := c.adapter()
+		sel := adapter.Info()
+		var err, warnings error
+		// optional records the failure to read a field the comic is usable without
+		optional := func(e error) {
+			if Strict {
+				err = multierr.Append(err, e)
+			} else {
+				warnings = multierr.Append(warnings, e)
+			}
+		}
 
 		// Get comic title
 		var title string
-		if e := textContent(ctx, `.book-title h1`, &title); e != nil {
+		if e := textContent(ctx, sel.Title, &title); e != nil {
 			err = multierr.Append(err, fmt.Errorf("get title: %w", e))
 		} else {
 			info.Title = strings.TrimSpace(title)
@@ -65,8 +178,8 @@ func (c *ComicInfoFetcher) fillComicInfo(info *ComicInfo) chromedp.ActionFunc {
 
 		// Get author and status from detail list
 		var detailText string
-		if e := textContent(ctx, `.book-detail .detail-list`, &detailText); e != nil {
-			err = multierr.Append(err, fmt.Errorf("get detail: %w", e))
+		if e := textContent(ctx, sel.Detail, &detailText); e != nil {
+			optional(fmt.Errorf("get detail: %w", e))
 		} else {
 			if strings.Contains(detailText, "作者") || strings.Contains(detailText, "漫畫作者") {
 				re := regexp.MustCompile(`作者[：:]\s*([^\n\r]+)`)
@@ -76,41 +189,46 @@ func (c *ComicInfoFetcher) fillComicInfo(info *ComicInfo) chromedp.ActionFunc {
 				}
 			}
 			if strings.Contains(detailText, "狀態") || strings.Contains(detailText, "状态") {
-				re := regexp.MustCompile(`狀態[：:]\s*([^\n\r]+)`)
+				re := regexp.MustCompile(`(?:狀態|状态)[：:]\s*([^\n\r]+)`)
 				matches := re.FindStringSubmatch(detailText)
 				if len(matches) > 1 {
 					info.Status = strings.TrimSpace(matches[1])
+					info.Completed = parseCompleted(info.Status)
 				}
 			}
+			re := regexp.MustCompile(`出品年代[：:]\s*([^\n\r]+)`)
+			if matches := re.FindStringSubmatch(detailText); len(matches) > 1 {
+				info.Year = parseYear(matches[1])
+			}
 		}
 
 		// Get description
 		var description string
-		if e := textContent(ctx, `#intro-all`, &description); e != nil {
-			err = multierr.Append(err, fmt.Errorf("get description: %w", e))
+		if e := textContent(ctx, sel.Description, &description); e != nil {
+			optional(fmt.Errorf("get description: %w", e))
 		} else {
 			info.Description = strings.TrimSpace(description)
 		}
 
+		// Get cover image URL, empty when the page has no cover
+		var coverURL string
+		if e := evalJS(ctx, fmt.Sprintf(`(document.querySelector(%s) || {}).src || ''`, jsString(sel.Cover)), &coverURL); e != nil {
+			optional(fmt.Errorf("get cover: %w", e))
+		} else {
+			info.CoverURL = strings.TrimSpace(coverURL)
+		}
+
 		// Get chapters - use evaluate to get href attributes and titles
 		var chapterData []map[string]string
-		if e := evalJS(ctx, `Array.from(document.querySelectorAll('.chapter-list li a')).map(link => ({href: link.getAttribute('href'), title: link.textContent.trim(),}))`, &chapterData); e != nil {
+		if e := evalJS(ctx, fmt.Sprintf(`Array.from(document.querySelectorAll(%s)).map(link => ({href: link.getAttribute('href'), title: link.textContent.trim(),}))`, jsString(sel.Chapters)), &chapterData); e != nil {
 			err = multierr.Append(err, fmt.Errorf("get chapters: %w", e))
 		} else {
 			for _, data := range chapterData {
 				link := data["href"]
 				title := data["title"]
 
-				// Extract chapter ID from URL
-				re := regexp.MustCompile(`/comic/\d+/(\d+)\.html`)
-				matches := re.FindStringSubmatch(link)
-				chapterID := ""
-				if len(matches) > 1 {
-					chapterID = matches[1]
-				}
-
 				chapter := Chapter{
-					ID:    chapterID,
+					ID:    adapter.ChapterID(link),
 					Title: title,
 					URL:   link,
 				}
@@ -118,21 +236,25 @@ func (c *ComicInfoFetcher) fillComicInfo(info *ComicInfo) chromedp.ActionFunc {
 			}
 		}
 
+		if err == nil && warnings != nil {
+			log.Printf("comic %s: incomplete info: %v", info.ID, warnings)
+		}
 		return err
 	})
 }
 
 func (c *ComicInfoFetcher) GetComicInfo(comicID string) (*ComicInfo, error) {
-	comicURL := fmt.Sprintf("https://tw.manhuagui.com/comic/%s/", comicID)
-
+	if err := downloader.ValidateIDs(comicID); err != nil {
+		return nil, err
+	}
 	info := &ComicInfo{
 		ID:       comicID,
 		Chapters: make([]Chapter, 0),
 	}
 
 	err := chromedp.Run(c.ctx,
-		chromedp.Navigate(comicURL),
-		chromedp.WaitVisible(`.book-title`),
+		downloader.NavigateMirrors(c.adapter(), func(s site.Adapter) string { return s.ComicURL(comicID) }, nil),
+		downloader.WaitReady(c.adapter(), c.adapter().Info().Ready),
 		c.fillComicInfo(info),
 	)
 
@@ -143,6 +265,64 @@ func (c *ComicInfoFetcher) GetComicInfo(comicID string) (*ComicInfo, error) {
 	return info, nil
 }
 
+// ChaptersSince returns the chapters newer than the marker chapter ID in reading
+// (oldest first) order. Manhuagui lists chapters newest first, so the newer
+// chapters are the ones preceding the marker. An empty marker selects every chapter.
+func (info *ComicInfo) ChaptersSince(marker string) ([]Chapter, error) {
+	end := len(info.Chapters)
+	if marker != "" {
+		end = -1
+		for i, chapter := range info.Chapters {
+			if chapter.ID == marker {
+				end = i
+				break
+			}
+		}
+		if end < 0 {
+			return nil, fmt.Errorf("chapter %s not found in comic %s", marker, info.ID)
+		}
+	}
+
+	chapters := make([]Chapter, 0, end)
+	for i := end - 1; i >= 0; i-- {
+		chapters = append(chapters, info.Chapters[i])
+	}
+	return chapters, nil
+}
+
+// FillChapterPageCounts loads every chapter's reader page, using up to workers
+// tabs, and records its page count. This is expensive for long series.
+func (c *ComicInfoFetcher) FillChapterPageCounts(info *ComicInfo, workers int) error {
+	chapterIDs := make([]string, len(info.Chapters))
+	for i, chapter := range info.Chapters {
+		chapterIDs[i] = chapter.ID
+	}
+
+	pages, err := enumeratePages(c.ctx, info.ID, chapterIDs, workers)
+	if err != nil {
+		return fmt.Errorf("failed to count chapter pages: %w", err)
+	}
+
+	for i := range info.Chapters {
+		info.Chapters[i].PageCount = len(pages[i])
+	}
+	return nil
+}
+
+// Plan returns a download plan covering every chapter in reading order
+func (info *ComicInfo) Plan() DownloadPlan {
+	chapters, _ := info.ChaptersSince("")
+	plan := DownloadPlan{
+		ComicID:    info.ID,
+		Title:      info.Title,
+		ChapterIDs: make([]string, 0, len(chapters)),
+	}
+	for _, chapter := range chapters {
+		plan.ChapterIDs = append(plan.ChapterIDs, chapter.ID)
+	}
+	return plan
+}
+
 func (info *ComicInfo) ToJSON() (string, error) {
 	jsonData, err := json.MarshalIndent(info, "", "  ")
 	if err != nil {
@@ -162,6 +342,9 @@ func (info *ComicInfo) ToPlainText() string {
 	if info.Status != "" {
 		sb.WriteString(fmt.Sprintf("Status: %s\n", info.Status))
 	}
+	if info.Year != 0 {
+		sb.WriteString(fmt.Sprintf("Year: %d\n", info.Year))
+	}
 	if info.Description != "" {
 		sb.WriteString(fmt.Sprintf("Description: %s\n", info.Description))
 	}
@@ -169,22 +352,32 @@ func (info *ComicInfo) ToPlainText() string {
 	sb.WriteString("\nChapter List:\n")
 
 	for i, chapter := range info.Chapters {
-		sb.WriteString(fmt.Sprintf("  %d. [%s] %s\n", i+1, chapter.ID, chapter.Title))
+		if chapter.PageCount > 0 {
+			sb.WriteString(fmt.Sprintf("  %d. [%s] %s (%d pages)\n", i+1, chapter.ID, chapter.Title, chapter.PageCount))
+		} else {
+			sb.WriteString(fmt.Sprintf("  %d. [%s] %s\n", i+1, chapter.ID, chapter.Title))
+		}
 	}
 
 	return sb.String()
 }
 
 func (c *ComicInfoFetcher) SearchComics(keyword string) ([]SearchResult, error) {
-	searchURL := fmt.Sprintf("https://tw.manhuagui.com/s/%s.html", keyword)
-
 	var results []SearchResult
-
-	err := chromedp.Run(c.ctx,
-		chromedp.Navigate(searchURL),
-		chromedp.WaitVisible(`.book-result`),
-		c.fillSearchResults(&results),
-	)
+	var err error
+	for attempt := 1; attempt <= searchAttempts; attempt++ {
+		results = nil
+		err = c.searchOnce(keyword, &results)
+		// A page listing no comics is a valid answer; only retry when the
+		// results never showed up, and stop once the caller's context ends
+		// or the site blocks us, which reloading only makes worse
+		if err == nil || c.ctx.Err() != nil || errors.Is(err, downloader.ErrBlocked) {
+			break
+		}
+		if attempt < searchAttempts {
+			log.Printf("search results did not load (attempt %d/%d): %v", attempt, searchAttempts, err)
+		}
+	}
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to search comics: %w", err)
@@ -193,32 +386,59 @@ func (c *ComicInfoFetcher) SearchComics(keyword string) ([]SearchResult, error)
 	return results, nil
 }
 
+// searchOnce loads the search page of keyword and collects its results,
+// waiting at most searchWaitTimeout for them to appear
+func (c *ComicInfoFetcher) searchOnce(keyword string, results *[]SearchResult) error {
+	ctx, cancel := context.WithTimeout(c.ctx, searchWaitTimeout)
+	defer cancel()
+	return runActions(ctx,
+		downloader.NavigateMirrors(c.adapter(), func(s site.Adapter) string { return s.SearchURL(keyword) }, nil),
+		downloader.WaitReady(c.adapter(), c.adapter().Search().Ready),
+		c.fillSearchResults(results),
+	)
+}
+
+// jsString quotes s as a JavaScript string literal
+func jsString(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
+
+// absoluteURL gives protocol-relative image URLs, as used by the site's
+// thumbnails, the https scheme
+func absoluteURL(link string) string {
+	if strings.HasPrefix(link, "//") {
+		return "https:" + link
+	}
+	return link
+}
+
 // fillSearchResults fills the search results slice by scraping the page.
 func (c *ComicInfoFetcher) fillSearchResults(results *[]SearchResult) chromedp.ActionFunc {
 	return chromedp.ActionFunc(func(ctx context.Context) error {
+		adapter := c.adapter()
+		sel := adapter.Search()
 		var err error
 
 		var searchData []map[string]string
-		if e := evalJS(ctx, `Array.from(document.querySelectorAll('.book-result .book-detail dt a')).map(link => ({href: link.getAttribute('href'), title: link.textContent.trim(),}))`, &searchData); e != nil {
+		// Lazy-loaded thumbnails keep their URL in data-src until scrolled into view
+		if e := evalJS(ctx, fmt.Sprintf(`Array.from(document.querySelectorAll(%s)).map(link => {
+			const img = (link.closest('li') || document).querySelector(%s);
+			const src = img ? img.getAttribute('src') || '' : '';
+			return {href: link.getAttribute('href'), title: link.textContent.trim(), cover: src && !src.startsWith('data:') ? src : (img && img.getAttribute('data-src')) || ''};
+		})`, jsString(sel.Results), jsString(sel.Cover)), &searchData); e != nil {
 			err = multierr.Append(err, fmt.Errorf("get search results: %w", e))
 		} else {
 			for _, data := range searchData {
 				link := data["href"]
 				title := data["title"]
 
-				// Extract comic ID from URL
-				re := regexp.MustCompile(`/comic/(\d+)/`)
-				matches := re.FindStringSubmatch(link)
-				comicID := ""
-				if len(matches) > 1 {
-					comicID = matches[1]
-				}
-
-				if comicID != "" {
+				if comicID := adapter.ComicID(link); comicID != "" {
 					result := SearchResult{
-						ID:    comicID,
-						Title: title,
-						URL:   link,
+						ID:       comicID,
+						Title:    title,
+						URL:      link,
+						CoverURL: absoluteURL(data["cover"]),
 					}
 					*results = append(*results, result)
 				}
@@ -5,12 +5,18 @@ import (
 	"errors"
 	"strings"
 	"testing"
+
+	"comicsd/internal/downloader"
+	"comicsd/internal/site"
+
+	"github.com/chromedp/chromedp"
 )
 
 func TestFillComicInfoMissingElements(t *testing.T) {
 	origText := textContent
 	origEval := evalJS
-	defer func() { textContent = origText; evalJS = origEval }()
+	defer func() { textContent = origText; evalJS = origEval; Strict = false }()
+	Strict = true
 
 	textErrors := map[string]error{
 		`.book-title h1`:            errors.New("title missing"),
@@ -38,6 +44,116 @@ func TestFillComicInfoMissingElements(t *testing.T) {
 	}
 }
 
+func TestFillComicInfoToleratesOptionalFields(t *testing.T) {
+	origText := textContent
+	origEval := evalJS
+	defer func() { textContent = origText; evalJS = origEval }()
+
+	textErrors := map[string]error{
+		`.book-detail .detail-list`: errors.New("detail missing"),
+		`#intro-all`:                errors.New("description missing"),
+	}
+	textContent = func(ctx context.Context, sel string, res *string) error {
+		if err, ok := textErrors[sel]; ok {
+			return err
+		}
+		*res = "東大特訓班"
+		return nil
+	}
+	evalJS = func(ctx context.Context, expr string, res interface{}) error {
+		if chapters, ok := res.(*[]map[string]string); ok {
+			*chapters = []map[string]string{{"href": "/comic/1/566271.html", "title": "第1卷"}}
+			return nil
+		}
+		return errors.New("cover missing")
+	}
+
+	info := &ComicInfo{ID: "1"}
+	fetcher := &ComicInfoFetcher{}
+	if err := fetcher.fillComicInfo(info).Do(context.Background()); err != nil {
+		t.Fatalf("expected missing optional fields to be tolerated, got %v", err)
+	}
+	if info.Title != "東大特訓班" || len(info.Chapters) != 1 || info.Chapters[0].ID != "566271" {
+		t.Errorf("expected the title and chapters, got %+v", info)
+	}
+
+	textErrors[`.book-title h1`] = errors.New("title missing")
+	err := fetcher.fillComicInfo(&ComicInfo{ID: "1"}).Do(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "title missing") || strings.Contains(err.Error(), "detail missing") {
+		t.Errorf("expected only the missing title to fail, got %v", err)
+	}
+}
+
+// otherSite is a site laid out like manhuagui but with its own comic page
+type otherSite struct{ site.Manhuagui }
+
+func (otherSite) Info() site.InfoSelectors {
+	return site.InfoSelectors{Title: "h1.name", Detail: ".meta", Description: ".summary", Cover: ".poster", Chapters: ".episodes a"}
+}
+
+func (otherSite) ChapterID(link string) string { return strings.TrimPrefix(link, "/episode/") }
+
+func TestFillComicInfoUsesSiteSelectors(t *testing.T) {
+	origText := textContent
+	origEval := evalJS
+	defer func() { textContent = origText; evalJS = origEval }()
+
+	textContent = func(ctx context.Context, sel string, res *string) error {
+		*res = map[string]string{"h1.name": "Other Comic", ".summary": "About"}[sel]
+		return nil
+	}
+	var exprs []string
+	evalJS = func(ctx context.Context, expr string, res interface{}) error {
+		exprs = append(exprs, expr)
+		if chapters, ok := res.(*[]map[string]string); ok {
+			*chapters = []map[string]string{{"href": "/episode/7", "title": "Episode 7"}}
+		}
+		return nil
+	}
+
+	info := &ComicInfo{ID: "1"}
+	fetcher := NewSiteFetcher(context.Background(), otherSite{})
+	if err := fetcher.fillComicInfo(info).Do(context.Background()); err != nil {
+		t.Fatalf("fillComicInfo failed: %v", err)
+	}
+	if info.Title != "Other Comic" || info.Description != "About" {
+		t.Errorf("expected the site's title and description, got %+v", info)
+	}
+	if len(info.Chapters) != 1 || info.Chapters[0].ID != "7" {
+		t.Errorf("expected the site's chapter IDs, got %v", info.Chapters)
+	}
+	if !strings.Contains(strings.Join(exprs, "\n"), `querySelectorAll(".episodes a")`) {
+		t.Errorf("expected the site's chapter selector, got %v", exprs)
+	}
+}
+
+func TestFillSearchResultsCovers(t *testing.T) {
+	origEval := evalJS
+	defer func() { evalJS = origEval }()
+
+	evalJS = func(ctx context.Context, expr string, res interface{}) error {
+		*res.(*[]map[string]string) = []map[string]string{
+			{"href": "/comic/1128/", "title": "東大特訓班", "cover": "//cf.hamreus.com/cpic/h/1128.jpg"},
+			{"href": "/comic/2000/", "title": "東大特訓班2", "cover": ""},
+		}
+		return nil
+	}
+
+	var results []SearchResult
+	if err := (&ComicInfoFetcher{}).fillSearchResults(&results).Do(context.Background()); err != nil {
+		t.Fatalf("fillSearchResults failed: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %v", results)
+	}
+	if results[0].CoverURL != "https://cf.hamreus.com/cpic/h/1128.jpg" {
+		t.Errorf("unexpected cover URL %q", results[0].CoverURL)
+	}
+	if results[1].CoverURL != "" {
+		t.Errorf("expected no cover URL, got %q", results[1].CoverURL)
+	}
+}
+
 func TestFillSearchResultsMissingElements(t *testing.T) {
 	origEval := evalJS
 	defer func() { evalJS = origEval }()
@@ -56,3 +172,273 @@ func TestFillSearchResultsMissingElements(t *testing.T) {
 		t.Fatalf("unexpected error: %v", err)
 	}
 }
+
+// stubSearch fails the given number of search page loads, then only runs the
+// last action, which collects the results. It returns the count of loads.
+func stubSearch(t *testing.T, failures int) *int {
+	t.Helper()
+	origRun, origEval := runActions, evalJS
+	t.Cleanup(func() { runActions, evalJS = origRun, origEval })
+
+	evalJS = func(ctx context.Context, expr string, res interface{}) error {
+		*res.(*[]map[string]string) = []map[string]string{{"href": "/comic/1128/", "title": "東大特訓班"}}
+		return nil
+	}
+	runs := new(int)
+	runActions = func(ctx context.Context, actions ...chromedp.Action) error {
+		*runs++
+		if *runs <= failures {
+			return errors.New("waiting for .book-result: context deadline exceeded")
+		}
+		return actions[len(actions)-1].Do(ctx)
+	}
+	return runs
+}
+
+func TestSearchComicsRetriesUntilResultsLoad(t *testing.T) {
+	runs := stubSearch(t, 1)
+	results, err := NewComicInfoFetcher(context.Background()).SearchComics("東大")
+	if err != nil {
+		t.Fatalf("SearchComics failed: %v", err)
+	}
+	if len(results) != 1 || results[0].ID != "1128" {
+		t.Errorf("unexpected results: %v", results)
+	}
+	if *runs != 2 {
+		t.Errorf("expected 2 attempts, got %d", *runs)
+	}
+}
+
+func TestSearchComicsGivesUp(t *testing.T) {
+	runs := stubSearch(t, searchAttempts)
+	if _, err := NewComicInfoFetcher(context.Background()).SearchComics("東大"); err == nil {
+		t.Fatalf("expected an error after %d failed attempts", searchAttempts)
+	}
+	if *runs != searchAttempts {
+		t.Errorf("expected %d attempts, got %d", searchAttempts, *runs)
+	}
+}
+
+func TestSearchComicsStopsWhenCancelled(t *testing.T) {
+	runs := stubSearch(t, searchAttempts)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := NewComicInfoFetcher(ctx).SearchComics("東大"); err == nil {
+		t.Fatalf("expected an error")
+	}
+	if *runs != 1 {
+		t.Errorf("expected no retry after cancellation, got %d attempts", *runs)
+	}
+}
+
+func TestSearchComicsStopsWhenBlocked(t *testing.T) {
+	origRun := runActions
+	t.Cleanup(func() { runActions = origRun })
+	runs := 0
+	runActions = func(ctx context.Context, actions ...chromedp.Action) error {
+		runs++
+		return downloader.ErrBlocked
+	}
+
+	_, err := NewComicInfoFetcher(context.Background()).SearchComics("東大")
+	if !errors.Is(err, downloader.ErrBlocked) {
+		t.Fatalf("expected ErrBlocked, got %v", err)
+	}
+	if runs != 1 {
+		t.Errorf("expected no retry once blocked, got %d attempts", runs)
+	}
+}
+
+func TestChaptersSince(t *testing.T) {
+	info := &ComicInfo{
+		ID: "1",
+		Chapters: []Chapter{
+			{ID: "40"}, {ID: "30"}, {ID: "20"}, {ID: "10"},
+		},
+	}
+
+	chapters, err := info.ChaptersSince("20")
+	if err != nil {
+		t.Fatalf("ChaptersSince failed: %v", err)
+	}
+	if len(chapters) != 2 || chapters[0].ID != "30" || chapters[1].ID != "40" {
+		t.Fatalf("unexpected chapters: %v", chapters)
+	}
+
+	chapters, err = info.ChaptersSince("40")
+	if err != nil || len(chapters) != 0 {
+		t.Fatalf("expected no new chapters, got %v (%v)", chapters, err)
+	}
+
+	chapters, err = info.ChaptersSince("")
+	if err != nil || len(chapters) != 4 || chapters[0].ID != "10" {
+		t.Fatalf("expected all chapters oldest first, got %v (%v)", chapters, err)
+	}
+
+	if _, err := info.ChaptersSince("99"); err == nil {
+		t.Fatalf("expected error for unknown marker")
+	}
+}
+
+func TestFillChapterPageCounts(t *testing.T) {
+	orig := enumeratePages
+	defer func() { enumeratePages = orig }()
+
+	enumeratePages = func(ctx context.Context, comicID string, chapterIDs []string, workers int) ([][]string, error) {
+		pages := make([][]string, len(chapterIDs))
+		for i := range chapterIDs {
+			pages[i] = make([]string, i+1)
+		}
+		return pages, nil
+	}
+
+	info := &ComicInfo{ID: "1", Chapters: []Chapter{{ID: "20"}, {ID: "10"}}}
+	fetcher := &ComicInfoFetcher{}
+	if err := fetcher.FillChapterPageCounts(info, 2); err != nil {
+		t.Fatalf("FillChapterPageCounts failed: %v", err)
+	}
+	if info.Chapters[0].PageCount != 1 || info.Chapters[1].PageCount != 2 {
+		t.Fatalf("unexpected page counts: %v", info.Chapters)
+	}
+	if !strings.Contains(info.ToPlainText(), "[10]  (2 pages)") {
+		t.Fatalf("page count missing from plain text: %s", info.ToPlainText())
+	}
+}
+
+func TestPlanListsChaptersInReadingOrder(t *testing.T) {
+	info := &ComicInfo{ID: "1", Title: "Comic", Chapters: []Chapter{{ID: "20"}, {ID: "10"}}}
+
+	plan := info.Plan()
+	if plan.ComicID != "1" || plan.Title != "Comic" {
+		t.Fatalf("unexpected plan: %+v", plan)
+	}
+	if len(plan.ChapterIDs) != 2 || plan.ChapterIDs[0] != "10" || plan.ChapterIDs[1] != "20" {
+		t.Fatalf("unexpected chapter order: %v", plan.ChapterIDs)
+	}
+	if err := plan.Validate(); err != nil {
+		t.Fatalf("plan should be valid: %v", err)
+	}
+
+	empty := DownloadPlan{ComicID: "1", Title: "Comic"}
+	if err := empty.Validate(); err == nil {
+		t.Fatalf("expected error for plan without chapters")
+	}
+}
+
+func TestComicRackXML(t *testing.T) {
+	info := &ComicInfo{ID: "1128", Title: "東大特訓班", Author: "三田紀房", Description: "Tom & Jerry <3", Year: 2003}
+
+	data, err := info.ComicRackXML("東大特訓班 1-3", 42)
+	if err != nil {
+		t.Fatalf("ComicRackXML failed: %v", err)
+	}
+	xml := string(data)
+	for _, want := range []string{
+		`<?xml version="1.0" encoding="UTF-8"?>`,
+		`<Title>東大特訓班 1-3</Title>`,
+		`<Series>東大特訓班</Series>`,
+		`<Writer>三田紀房</Writer>`,
+		`<Summary>Tom &amp; Jerry &lt;3</Summary>`,
+		`<PageCount>42</PageCount>`,
+		`<Year>2003</Year>`,
+		`<Web>https://tw.manhuagui.com/comic/1128/</Web>`,
+		`<Manga>YesAndRightToLeft</Manga>`,
+	} {
+		if !strings.Contains(xml, want) {
+			t.Errorf("ComicInfo.xml missing %s:\n%s", want, xml)
+		}
+	}
+}
+
+func TestChapterComicRackXML(t *testing.T) {
+	info := &ComicInfo{ID: "1128", Title: "東大特訓班", Author: "三田紀房"}
+	chapter := Chapter{ID: "7777", Title: "第10話", URL: "https://tw.manhuagui.com/comic/1128/7777.html"}
+
+	data, err := info.ChapterComicRackXML(chapter, ChapterNumber{First: 10, Last: 10}, 18)
+	if err != nil {
+		t.Fatalf("ChapterComicRackXML failed: %v", err)
+	}
+	xml := string(data)
+	for _, want := range []string{
+		`<Title>第10話</Title>`,
+		`<Series>東大特訓班</Series>`,
+		`<Number>10</Number>`,
+		`<PageCount>18</PageCount>`,
+		`<Web>https://tw.manhuagui.com/comic/1128/7777.html</Web>`,
+	} {
+		if !strings.Contains(xml, want) {
+			t.Errorf("ComicInfo.xml missing %s:\n%s", want, xml)
+		}
+	}
+
+	data, _ = info.ComicRackXML("東大特訓班", 18)
+	if strings.Contains(string(data), "<Number>") {
+		t.Errorf("expected no Number for a whole-comic archive:\n%s", data)
+	}
+
+	// The site links chapters relative to itself
+	chapter.URL = "/comic/1128/7777.html"
+	data, _ = info.ChapterComicRackXML(chapter, ChapterNumber{First: 10, Last: 10}, 18)
+	if !strings.Contains(string(data), `<Web>https://tw.manhuagui.com/comic/1128/7777.html</Web>`) {
+		t.Errorf("expected the chapter's absolute URL:\n%s", data)
+	}
+}
+
+func TestChapterComicRackXMLVolume(t *testing.T) {
+	info := &ComicInfo{ID: "1128", Title: "東大特訓班"}
+	data, err := info.ChapterComicRackXML(Chapter{ID: "7777", Title: "第3卷"}, ChapterNumber{First: 3, Last: 3, Volume: true}, 180)
+	if err != nil {
+		t.Fatalf("ChapterComicRackXML failed: %v", err)
+	}
+	if xml := string(data); !strings.Contains(xml, "<Volume>3</Volume>") || strings.Contains(xml, "<Number>") {
+		t.Errorf("expected a Volume without a Number:\n%s", xml)
+	}
+
+	data, _ = info.ChapterComicRackXML(Chapter{ID: "7778", Title: "第11-12話"}, ChapterNumber{First: 11, Last: 12}, 36)
+	if xml := string(data); !strings.Contains(xml, "<Number>11</Number>") || strings.Contains(xml, "<Volume>") {
+		t.Errorf("expected a range to be numbered by its first chapter:\n%s", xml)
+	}
+}
+
+func TestComicRackXMLListsChapterURLs(t *testing.T) {
+	info := &ComicInfo{ID: "1128", Title: "東大特訓班"}
+	data, err := info.ComicRackXML("東大特訓班", 18, "566271", "566272")
+	if err != nil {
+		t.Fatalf("ComicRackXML failed: %v", err)
+	}
+	want := `<Web>https://tw.manhuagui.com/comic/1128/ https://tw.manhuagui.com/comic/1128/566271.html https://tw.manhuagui.com/comic/1128/566272.html</Web>`
+	if !strings.Contains(string(data), want) {
+		t.Errorf("ComicInfo.xml missing %s:\n%s", want, data)
+	}
+}
+
+func TestParseComicRackXMLRoundTrip(t *testing.T) {
+	info := &ComicInfo{ID: "1128", Title: "東大特訓班", Author: "三田紀房", Description: "受験", Year: 2003}
+	data, err := info.ComicRackXML("東大特訓班 1-2", 18, "566271", "566272")
+	if err != nil {
+		t.Fatalf("ComicRackXML failed: %v", err)
+	}
+	got, title, err := ParseComicRackXML(data)
+	if err != nil {
+		t.Fatalf("ParseComicRackXML failed: %v", err)
+	}
+	if title != "東大特訓班 1-2" {
+		t.Errorf("title = %q", title)
+	}
+	if got.ID != "1128" || got.Title != info.Title || got.Author != info.Author || got.Description != info.Description || got.Year != info.Year {
+		t.Errorf("unexpected comic: %+v", got)
+	}
+	if len(got.Chapters) != 2 || got.Chapters[0].ID != "566271" || got.Chapters[1].ID != "566272" {
+		t.Errorf("unexpected chapters: %+v", got.Chapters)
+	}
+}
+
+func TestComicRackXMLWithoutID(t *testing.T) {
+	data, err := (&ComicInfo{Title: "東大特訓班"}).ComicRackXML("東大特訓班", 18)
+	if err != nil {
+		t.Fatalf("ComicRackXML failed: %v", err)
+	}
+	if strings.Contains(string(data), "<Web>") {
+		t.Errorf("expected no Web without a comic ID:\n%s", data)
+	}
+}
@@ -0,0 +1,59 @@
+// Package infotest provides a fake info.Fetcher for tests that must run
+// without a browser or network.
+package infotest
+
+import (
+	"fmt"
+
+	"comicsd/internal/info"
+)
+
+// Fetcher is an info.Fetcher serving canned data
+type Fetcher struct {
+	// Results is returned by every search
+	Results []info.SearchResult
+	// Comics maps comic IDs to the info GetComicInfo returns
+	Comics map[string]*info.ComicInfo
+	// PageCounts maps chapter IDs to the counts FillChapterPageCounts records
+	PageCounts map[string]int
+	// Err, when set, is returned by every method
+	Err error
+	// Keywords records the keywords searched for
+	Keywords []string
+}
+
+var _ info.Fetcher = (*Fetcher)(nil)
+
+// SearchComics returns the canned results
+func (f *Fetcher) SearchComics(keyword string) ([]info.SearchResult, error) {
+	f.Keywords = append(f.Keywords, keyword)
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	return f.Results, nil
+}
+
+// GetComicInfo returns a copy of the canned comic, so callers may modify it
+func (f *Fetcher) GetComicInfo(comicID string) (*info.ComicInfo, error) {
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	ci, ok := f.Comics[comicID]
+	if !ok {
+		return nil, fmt.Errorf("failed to get comic info: comic %s not found", comicID)
+	}
+	c := *ci
+	c.Chapters = append([]info.Chapter(nil), ci.Chapters...)
+	return &c, nil
+}
+
+// FillChapterPageCounts records the canned page counts
+func (f *Fetcher) FillChapterPageCounts(ci *info.ComicInfo, workers int) error {
+	if f.Err != nil {
+		return f.Err
+	}
+	for i, chapter := range ci.Chapters {
+		ci.Chapters[i].PageCount = f.PageCounts[chapter.ID]
+	}
+	return nil
+}
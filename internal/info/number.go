@@ -0,0 +1,106 @@
+package info
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ChapterNumber is the number a chapter title gives its chapter or volume
+type ChapterNumber struct {
+	// First and Last are the numbers the title covers, equal unless it names
+	// a range such as 第11-12話
+	First, Last float64
+	// Volume reports a volume, such as 第3卷 or Vol.3, rather than a chapter
+	Volume bool
+}
+
+// String formats the number as "10", "10.5" or, for a range, "11-12"
+func (n ChapterNumber) String() string {
+	s := formatNumber(n.First)
+	if n.Last != n.First {
+		s += "-" + formatNumber(n.Last)
+	}
+	return s
+}
+
+func formatNumber(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+// chineseDigits and chineseUnits are the numerals of titles such as 第十二話
+var (
+	chineseDigits = map[rune]float64{
+		'零': 0, '〇': 0, '一': 1, '二': 2, '兩': 2, '两': 2, '三': 3,
+		'四': 4, '五': 5, '六': 6, '七': 7, '八': 8, '九': 9,
+	}
+	chineseUnits = map[rune]float64{'十': 10, '百': 100, '千': 1000}
+)
+
+// titleNumberPattern matches a number of a chapter title with its markers: a
+// prefix (第, Vol., Ch.), a range end and a counter (話, 章, 卷). Full-width
+// digits are folded before matching.
+var titleNumberPattern = func() *regexp.Regexp {
+	num := `[0-9]+(?:\.[0-9]+)?|[零〇一二兩两三四五六七八九十百千]+`
+	return regexp.MustCompile(`(?i)(vol(?:ume)?\.?|ch(?:apter|\.)?|第)?\s*(` + num + `)(?:\s*[-~～－至]\s*(` + num + `))?\s*([話话回章集卷巻冊册])?`)
+}()
+
+// ParseChapterNumber reads the number of a manhuagui chapter title: 第10話,
+// 第10.5话, 第三章, 第11-12話, 第3卷, Vol.03 or a bare 10. A number with a
+// prefix or counter wins over a bare one, and Chinese numerals count only with
+// them, so 最後一戰 has no number. It reports false when the title has none,
+// as extras such as 番外篇 often do.
+func ParseChapterNumber(title string) (ChapterNumber, bool) {
+	var bare *ChapterNumber
+	for _, m := range titleNumberPattern.FindAllStringSubmatch(fullWidthDigits.Replace(title), -1) {
+		prefix, suffix := strings.ToLower(m[1]), m[4]
+		marked := prefix != "" || suffix != ""
+		first, ok := parseNumeral(m[2], marked)
+		if !ok {
+			continue
+		}
+		n := ChapterNumber{First: first, Last: first}
+		if last, ok := parseNumeral(m[3], marked); ok && last > first {
+			n.Last = last
+		}
+		if marked {
+			n.Volume = strings.HasPrefix(prefix, "vol") || strings.ContainsAny(suffix, "卷巻冊册")
+			return n, true
+		}
+		if bare == nil {
+			bare = &n
+		}
+	}
+	if bare == nil {
+		return ChapterNumber{}, false
+	}
+	return *bare, true
+}
+
+// parseNumeral parses ASCII digits, or Chinese numerals when allowed
+func parseNumeral(s string, chinese bool) (float64, bool) {
+	if s == "" {
+		return 0, false
+	}
+	if n, err := strconv.ParseFloat(s, 64); err == nil {
+		return n, true
+	}
+	if !chinese {
+		return 0, false
+	}
+	var total, digit float64
+	for _, r := range s {
+		if d, ok := chineseDigits[r]; ok {
+			digit = d
+			continue
+		}
+		unit := chineseUnits[r]
+		if digit == 0 && unit == 10 {
+			// 十二 is 12
+			digit = 1
+		}
+		total += digit * unit
+		digit = 0
+	}
+	return total + digit, true
+}
@@ -0,0 +1,49 @@
+package info
+
+import "testing"
+
+func TestParseChapterNumber(t *testing.T) {
+	tests := map[string]ChapterNumber{
+		"第10話":          {First: 10, Last: 10},
+		"第01话":          {First: 1, Last: 1},
+		"第10.5話":        {First: 10.5, Last: 10.5},
+		"第１２回":          {First: 12, Last: 12},
+		"第三章":           {First: 3, Last: 3},
+		"第十二話":          {First: 12, Last: 12},
+		"第一百零五話":        {First: 105, Last: 105},
+		"第11-12話":       {First: 11, Last: 12},
+		"第11~12話":       {First: 11, Last: 12},
+		"第3卷":           {First: 3, Last: 3, Volume: true},
+		"第二巻":           {First: 2, Last: 2, Volume: true},
+		"Vol.03":        {First: 3, Last: 3, Volume: true},
+		"volume 4":      {First: 4, Last: 4, Volume: true},
+		"Ch. 7":         {First: 7, Last: 7},
+		"10":            {First: 10, Last: 10},
+		"2019年 第10話":    {First: 10, Last: 10},
+		"東大特訓班2 第5話 上篇": {First: 5, Last: 5},
+	}
+	for title, want := range tests {
+		got, ok := ParseChapterNumber(title)
+		if !ok || got != want {
+			t.Errorf("ParseChapterNumber(%q) = %+v, %v, want %+v", title, got, ok, want)
+		}
+	}
+	for _, title := range []string{"番外篇", "最後一戰", ""} {
+		if got, ok := ParseChapterNumber(title); ok {
+			t.Errorf("ParseChapterNumber(%q) = %+v, expected no number", title, got)
+		}
+	}
+}
+
+func TestChapterNumberString(t *testing.T) {
+	tests := map[ChapterNumber]string{
+		{First: 10, Last: 10}:     "10",
+		{First: 10.5, Last: 10.5}: "10.5",
+		{First: 11, Last: 12}:     "11-12",
+	}
+	for n, want := range tests {
+		if got := n.String(); got != want {
+			t.Errorf("%+v.String() = %q, want %q", n, got, want)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package info
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Chapter orders accepted by SortChapters
+const (
+	// SortSource keeps the site's order, newest first
+	SortSource = "source"
+	// SortAsc orders chapters by number, i.e. reading order
+	SortAsc = "asc"
+	// SortDesc orders chapters by number, highest first
+	SortDesc = "desc"
+)
+
+// chapterNumberPattern matches the first number of a chapter title, allowing
+// full-width digits and a decimal part (第12.5話)
+var chapterNumberPattern = regexp.MustCompile(`[0-9０-９]+(?:[.．][0-9０-９]+)?`)
+
+// fullWidthDigits folds full-width digits to ASCII
+var fullWidthDigits = strings.NewReplacer(
+	"０", "0", "１", "1", "２", "2", "３", "3", "４", "4",
+	"５", "5", "６", "6", "７", "7", "８", "8", "９", "9", "．", ".",
+)
+
+// chapterNumber returns the number in the chapter's title, else in its ID
+func chapterNumber(chapter Chapter) (float64, bool) {
+	for _, s := range []string{chapter.Title, chapter.ID} {
+		if n, ok := TitleNumber(s); ok {
+			return n, true
+		}
+	}
+	return 0, false
+}
+
+// TitleNumber returns the first number in a chapter title such as 第12.5話
+func TitleNumber(title string) (float64, bool) {
+	if m := chapterNumberPattern.FindString(title); m != "" {
+		if n, err := strconv.ParseFloat(fullWidthDigits.Replace(m), 64); err == nil {
+			return n, true
+		}
+	}
+	return 0, false
+}
+
+// SortChapters reorders the chapters by the number in their titles, falling
+// back to the number in their IDs. Chapters without any number, such as
+// extras, follow the numbered ones in their original order. SortSource and
+// an empty order leave the site's order.
+//
+// ChaptersSince and Plan expect the site's order, so sort only for display.
+func (info *ComicInfo) SortChapters(order string) error {
+	switch order {
+	case "", SortSource:
+		return nil
+	case SortAsc, SortDesc:
+	default:
+		return fmt.Errorf("invalid chapter order: %s. Use '%s', '%s' or '%s'", order, SortAsc, SortDesc, SortSource)
+	}
+
+	sort.SliceStable(info.Chapters, func(i, j int) bool {
+		a, aok := chapterNumber(info.Chapters[i])
+		b, bok := chapterNumber(info.Chapters[j])
+		if !aok || !bok {
+			return aok && !bok
+		}
+		if order == SortDesc {
+			return a > b
+		}
+		return a < b
+	})
+	return nil
+}
@@ -0,0 +1,63 @@
+package info
+
+import (
+	"strings"
+	"testing"
+)
+
+func sortFixture() *ComicInfo {
+	return &ComicInfo{ID: "1128", Chapters: []Chapter{
+		{ID: "566300", Title: "第10話"},
+		{ID: "566290", Title: "番外篇"},
+		{ID: "566280", Title: "第９話"},
+		{ID: "566275", Title: "第2.5話"},
+		{ID: "566271", Title: "第2話"},
+	}}
+}
+
+func chapterTitles(info *ComicInfo) string {
+	titles := make([]string, len(info.Chapters))
+	for i, chapter := range info.Chapters {
+		titles[i] = chapter.Title
+	}
+	return strings.Join(titles, ",")
+}
+
+func TestSortChapters(t *testing.T) {
+	tests := []struct {
+		order string
+		want  string
+	}{
+		// Titles carry the numbers; the extra has none in its title and
+		// falls back to its ID
+		{SortAsc, "第2話,第2.5話,第９話,第10話,番外篇"},
+		{SortDesc, "番外篇,第10話,第９話,第2.5話,第2話"},
+		{SortSource, "第10話,番外篇,第９話,第2.5話,第2話"},
+		{"", "第10話,番外篇,第９話,第2.5話,第2話"},
+	}
+	for _, tt := range tests {
+		info := sortFixture()
+		if err := info.SortChapters(tt.order); err != nil {
+			t.Fatalf("SortChapters(%q) failed: %v", tt.order, err)
+		}
+		if got := chapterTitles(info); got != tt.want {
+			t.Errorf("SortChapters(%q) = %s, want %s", tt.order, got, tt.want)
+		}
+	}
+}
+
+func TestSortChaptersWithoutNumbers(t *testing.T) {
+	info := &ComicInfo{Chapters: []Chapter{{ID: "b", Title: "後篇"}, {ID: "a", Title: "前篇"}, {ID: "c", Title: "第1話"}}}
+	if err := info.SortChapters(SortAsc); err != nil {
+		t.Fatal(err)
+	}
+	if got := chapterTitles(info); got != "第1話,後篇,前篇" {
+		t.Errorf("unnumbered chapters should follow in source order, got %s", got)
+	}
+}
+
+func TestSortChaptersInvalidOrder(t *testing.T) {
+	if err := sortFixture().SortChapters("newest"); err == nil {
+		t.Errorf("expected an error for an unknown order")
+	}
+}
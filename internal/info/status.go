@@ -0,0 +1,29 @@
+package info
+
+import "strings"
+
+// completedKeywords mark a finished series, in Traditional and Simplified Chinese
+var completedKeywords = []string{"已完結", "已完结", "完結", "完结"}
+
+// ongoingKeywords mark a series still being published
+var ongoingKeywords = []string{"連載中", "连载中", "連載", "连载"}
+
+// parseCompleted derives whether a series is finished from its scraped status,
+// nil when the status is missing or not recognized
+func parseCompleted(status string) *bool {
+	completed := containsAny(status, completedKeywords)
+	ongoing := containsAny(status, ongoingKeywords)
+	if completed == ongoing {
+		return nil
+	}
+	return &completed
+}
+
+func containsAny(s string, keywords []string) bool {
+	for _, k := range keywords {
+		if strings.Contains(s, k) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package info
+
+import (
+	"context"
+	"testing"
+)
+
+func TestParseCompleted(t *testing.T) {
+	yes, no := true, false
+	tests := []struct {
+		status string
+		want   *bool
+	}{
+		{"已完結", &yes},
+		{"已完结", &yes},
+		{"連載中", &no},
+		{"连载中 最近更新：2024-01-01", &no},
+		{"", nil},
+		{"休刊", nil},
+	}
+	for _, tt := range tests {
+		got := parseCompleted(tt.status)
+		if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+			t.Errorf("parseCompleted(%q) = %v, want %v", tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestFillComicInfoParsesStatus(t *testing.T) {
+	origText := textContent
+	origEval := evalJS
+	defer func() { textContent = origText; evalJS = origEval }()
+
+	textContent = func(ctx context.Context, sel string, res *string) error {
+		if sel == `.book-detail .detail-list` {
+			*res = "出品年代：2003年\n漫画状态：已完结\n漫画作者：三田紀房"
+		}
+		return nil
+	}
+	evalJS = func(ctx context.Context, expr string, res interface{}) error {
+		return nil
+	}
+
+	info := &ComicInfo{ID: "1"}
+	if err := (&ComicInfoFetcher{}).fillComicInfo(info).Do(context.Background()); err != nil {
+		t.Fatalf("fillComicInfo failed: %v", err)
+	}
+	if info.Status != "已完结" || info.Completed == nil || !*info.Completed {
+		t.Errorf("unexpected status %q, completed %v", info.Status, info.Completed)
+	}
+	if info.Year != 2003 {
+		t.Errorf("expected year 2003, got %d", info.Year)
+	}
+}
@@ -0,0 +1,25 @@
+package info
+
+import (
+	"regexp"
+	"strconv"
+)
+
+// yearPattern matches runs of digits, noting when they name a decade (年代)
+var yearPattern = regexp.MustCompile(`(\d+)(年代)?`)
+
+// parseYear returns the first plausible year in a scraped publish date such as
+// "2003年" or "2003-2010", or 0 when it holds none. Decades such as "90年代"
+// are too vague to catalog and are skipped.
+func parseYear(date string) int {
+	for _, m := range yearPattern.FindAllStringSubmatch(date, -1) {
+		if len(m[1]) != 4 || m[2] != "" {
+			continue
+		}
+		year, _ := strconv.Atoi(m[1])
+		if year >= 1800 && year <= 2100 {
+			return year
+		}
+	}
+	return 0
+}
@@ -0,0 +1,24 @@
+package info
+
+import "testing"
+
+func TestParseYear(t *testing.T) {
+	tests := []struct {
+		date string
+		want int
+	}{
+		{"2003年", 2003},
+		{"1998-2004", 1998},
+		{"2012年 漫畫地區：日本", 2012},
+		{"90年代", 0},
+		{"2000年代", 0},
+		{"12345", 0},
+		{"不詳", 0},
+		{"", 0},
+	}
+	for _, tt := range tests {
+		if got := parseYear(tt.date); got != tt.want {
+			t.Errorf("parseYear(%q) = %d, want %d", tt.date, got, tt.want)
+		}
+	}
+}
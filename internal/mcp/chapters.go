@@ -0,0 +1,34 @@
+package mcp
+
+import (
+	"log"
+	"strings"
+
+	"comicsd/internal/downloader"
+	"comicsd/internal/info"
+)
+
+// chapterEntry is the compact chapter representation returned by list_chapters
+type chapterEntry struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+}
+
+// compactChapters strips chapters down to their IDs and titles
+func compactChapters(chapters []info.Chapter) []chapterEntry {
+	entries := make([]chapterEntry, 0, len(chapters))
+	for _, chapter := range chapters {
+		entries = append(entries, chapterEntry{ID: chapter.ID, Title: chapter.Title})
+	}
+	return entries
+}
+
+// dedupeChapters drops repeated chapter IDs of a download, keeping their
+// first-seen order
+func dedupeChapters(ids []string) []string {
+	unique, duplicates := downloader.DedupeIDs(ids)
+	if len(duplicates) > 0 {
+		log.Printf("Skipping duplicate chapters: %s", strings.Join(duplicates, ", "))
+	}
+	return unique
+}
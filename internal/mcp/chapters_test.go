@@ -0,0 +1,25 @@
+package mcp
+
+import (
+	"encoding/json"
+	"testing"
+
+	"comicsd/internal/info"
+)
+
+func TestCompactChaptersKeepsAllChapters(t *testing.T) {
+	chapters := []info.Chapter{
+		{ID: "1", Title: "第1話", URL: "/comic/100/1.html"},
+		{ID: "2", Title: "第2話", URL: "/comic/100/2.html"},
+	}
+
+	data, err := json.Marshal(compactChapters(chapters))
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+
+	expected := `[{"id":"1","title":"第1話"},{"id":"2","title":"第2話"}]`
+	if string(data) != expected {
+		t.Fatalf("unexpected JSON: %s", data)
+	}
+}
@@ -0,0 +1,24 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+
+	"comicsd/internal/browser"
+	"comicsd/internal/info"
+)
+
+// openFetcherFunc returns a fetcher for one tool call and a function
+// releasing the resources it holds
+type openFetcherFunc func(ctx context.Context) (info.Fetcher, func(), error)
+
+// poolFetcher opens every fetcher in a tab of pool
+func poolFetcher(pool *browser.Pool) openFetcherFunc {
+	return func(ctx context.Context) (info.Fetcher, func(), error) {
+		tabCtx, release, err := pool.Acquire(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open browser tab: %w", err)
+		}
+		return info.NewComicInfoFetcher(tabCtx), release, nil
+	}
+}
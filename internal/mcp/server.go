@@ -1,19 +1,21 @@
 package mcp
 
 import (
-	"archive/zip"
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
+	"comicsd/internal/archive"
+	"comicsd/internal/browser"
+	"comicsd/internal/config"
 	"comicsd/internal/downloader"
-	"comicsd/internal/epub"
-	"comicsd/internal/info"
+	"comicsd/internal/naming"
 
-	"github.com/chromedp/chromedp"
 	mcp_golang "github.com/metoro-io/mcp-golang"
 	"github.com/metoro-io/mcp-golang/transport/stdio"
 )
@@ -28,30 +30,49 @@ type GetComicInfoArgs struct {
 	ComicID string `json:"comic_id" jsonschema:"required,description=Comic ID to get information for"`
 }
 
+// ListChaptersArgs defines the arguments for listing chapters
+type ListChaptersArgs struct {
+	ComicID string `json:"comic_id" jsonschema:"required,description=Comic ID to list chapters for"`
+	Sort    string `json:"sort,omitempty" jsonschema:"description=Chapter order: asc (reading order) or desc by chapter number; source (default) keeps the site's newest-first order"`
+}
+
 // DownloadComicArgs defines the arguments for downloading comics
 type DownloadComicArgs struct {
 	ComicID    string   `json:"comic_id" jsonschema:"required,description=Comic ID to download"`
 	ChapterIDs []string `json:"chapter_ids" jsonschema:"required,description=List of chapter IDs to download"`
-	Format     string   `json:"format" jsonschema:"required,description=Output format (cbz or epub)"`
+	Format     string   `json:"format" jsonschema:"required,description=Output format (cbz, cbt, epub, or auto for epub with a single chapter and cbz with several)"`
 	Title      string   `json:"title" jsonschema:"required,description=Comic title for filename"`
+	Overwrite  bool     `json:"overwrite,omitempty" jsonschema:"description=Replace the output file if it already exists"`
 }
 
+// openChapters prepares the chapters of a download. Defined as a variable for tests.
+var openChapters = downloader.OpenChapters
+
+// openChapterTabs prepares the chapters of a download fetching several
+// chapters at once. Defined as a variable for tests.
+var openChapterTabs = downloader.OpenChaptersInTabs
+
 // MCPServer wraps the MCP functionality
 type MCPServer struct {
-	server *mcp_golang.Server
+	server      *mcp_golang.Server
+	settings    *config.Settings
+	pool        *browser.Pool
+	openFetcher openFetcherFunc
 }
 
 // NewMCPServer creates a new MCP server instance
-func NewMCPServer() *MCPServer {
-	// Add debug output to stderr
-	log.SetOutput(os.Stderr)
+func NewMCPServer(settings *config.Settings) *MCPServer {
 	log.Println("Creating MCP server...")
 
 	transport := stdio.NewStdioServerTransport()
 	server := mcp_golang.NewServer(transport)
 
+	pool := browser.NewServerPool(context.Background(), settings)
 	mcpServer := &MCPServer{
-		server: server,
+		server:      server,
+		settings:    settings,
+		pool:        pool,
+		openFetcher: poolFetcher(pool),
 	}
 
 	// Register tools
@@ -86,15 +107,39 @@ func (m *MCPServer) registerTools() {
 		log.Printf("Failed to register get_comic_info tool: %v", err)
 	}
 
+	// List chapters tool
+	log.Println("Registering list_chapters tool...")
+	err = m.server.RegisterTool(
+		"list_chapters",
+		"List chapter IDs and titles of a comic without the full comic information",
+		m.listChapters,
+	)
+	if err != nil {
+		log.Printf("Failed to register list_chapters tool: %v", err)
+	}
+
+	// Download comic tool
+	log.Println("Registering download_comic tool...")
+	err = m.server.RegisterTool(
+		"download_comic",
+		"Download chapters of a comic to a CBZ, CBT or EPUB file in the output directory",
+		m.downloadComic,
+	)
+	if err != nil {
+		log.Printf("Failed to register download_comic tool: %v", err)
+	}
+
 	log.Println("All tools registered successfully")
 }
 
 // searchComics implements the search functionality for MCP
 func (m *MCPServer) searchComics(args SearchComicsArgs) (*mcp_golang.ToolResponse, error) {
-	ctx, cancel := chromedp.NewContext(context.Background(), chromedp.WithLogf(func(string, ...interface{}) {}))
-	defer cancel()
+	fetcher, release, err := m.openFetcher(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer release()
 
-	fetcher := info.NewComicInfoFetcher(ctx)
 	results, err := fetcher.SearchComics(args.Keyword)
 	if err != nil {
 		log.Printf("search comics error: %v", err)
@@ -123,10 +168,15 @@ func (m *MCPServer) searchComics(args SearchComicsArgs) (*mcp_golang.ToolRespons
 
 // getComicInfo implements the comic info functionality for MCP
 func (m *MCPServer) getComicInfo(args GetComicInfoArgs) (*mcp_golang.ToolResponse, error) {
-	ctx, cancel := chromedp.NewContext(context.Background(), chromedp.WithLogf(func(string, ...interface{}) {}))
-	defer cancel()
+	if err := downloader.ValidateIDs(args.ComicID); err != nil {
+		return nil, err
+	}
+	fetcher, release, err := m.openFetcher(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer release()
 
-	fetcher := info.NewComicInfoFetcher(ctx)
 	comicInfo, err := fetcher.GetComicInfo(args.ComicID)
 	if err != nil {
 		log.Printf("get comic info error: %v", err)
@@ -143,6 +193,9 @@ func (m *MCPServer) getComicInfo(args GetComicInfoArgs) (*mcp_golang.ToolRespons
 	if comicInfo.Status != "" {
 		responseText += fmt.Sprintf("Status: %s\n", comicInfo.Status)
 	}
+	if comicInfo.Year != 0 {
+		responseText += fmt.Sprintf("Year: %d\n", comicInfo.Year)
+	}
 	responseText += fmt.Sprintf("Total Chapters: %d\n\n", len(comicInfo.Chapters))
 
 	// List first 10 chapters as examples
@@ -169,120 +222,204 @@ func (m *MCPServer) getComicInfo(args GetComicInfoArgs) (*mcp_golang.ToolRespons
 	), nil
 }
 
+// listChapters implements the chapter listing functionality for MCP
+func (m *MCPServer) listChapters(args ListChaptersArgs) (*mcp_golang.ToolResponse, error) {
+	if err := downloader.ValidateIDs(args.ComicID); err != nil {
+		return nil, err
+	}
+	fetcher, release, err := m.openFetcher(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	comicInfo, err := fetcher.GetComicInfo(args.ComicID)
+	if err != nil {
+		log.Printf("list chapters error: %v", err)
+		return nil, fmt.Errorf("failed to list chapters: %w", err)
+	}
+	if err := comicInfo.SortChapters(args.Sort); err != nil {
+		return nil, err
+	}
+
+	// Compact JSON keeps the response small
+	jsonData, err := json.Marshal(compactChapters(comicInfo.Chapters))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal chapters: %w", err)
+	}
+
+	return mcp_golang.NewToolResponse(
+		mcp_golang.NewTextContent(string(jsonData)),
+	), nil
+}
+
 // downloadComic implements the download functionality for MCP
 func (m *MCPServer) downloadComic(args DownloadComicArgs) (*mcp_golang.ToolResponse, error) {
 	// Validate format
-	if args.Format != "cbz" && args.Format != "epub" {
-		return nil, fmt.Errorf("invalid format: %s. Use 'cbz' or 'epub'", args.Format)
+	if err := archive.CheckWriter(args.Format); err != nil {
+		return nil, err
 	}
 
 	if len(args.ChapterIDs) == 0 {
 		return nil, fmt.Errorf("no chapters specified for download")
 	}
+	if err := downloader.ValidateIDs(args.ComicID, args.ChapterIDs...); err != nil {
+		return nil, err
+	}
+	args.ChapterIDs = dedupeChapters(args.ChapterIDs)
+	args.Format = archive.Resolve(args.Format, len(args.ChapterIDs))
 
-	ctx, cancel := chromedp.NewContext(context.Background(), chromedp.WithLogf(func(string, ...interface{}) {}))
-	defer cancel()
+	ctx, release, err := m.pool.Acquire(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open browser tab: %w", err)
+	}
+	defer release()
+	// Count this download's retries apart from the others running at once
+	ctx, retries := downloader.WithRetryCounter(ctx)
 
 	// Create output file
-	filename := fmt.Sprintf("%s.%s", args.Title, args.Format)
-	file, err := os.Create(filename)
+	filename := filepath.Join(m.settings.OutputDir, naming.OutputFilename(args.Title, args.Format, ""))
+	file, err := downloader.CreateOutput(filename, args.Overwrite)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create output file: %w", err)
 	}
-	defer file.Close()
 
-	var responseText string
-
-	if args.Format == "cbz" {
-		err = m.downloadToCBZ(ctx, args, file)
-		if err != nil {
-			return nil, fmt.Errorf("failed to download CBZ: %w", err)
-		}
-		responseText = fmt.Sprintf("Successfully downloaded %d chapters to %s (CBZ format)", len(args.ChapterIDs), filename)
-	} else {
-		err = m.downloadToEPUB(ctx, args, file)
-		if err != nil {
-			return nil, fmt.Errorf("failed to download EPUB: %w", err)
-		}
-		responseText = fmt.Sprintf("Successfully downloaded %d chapters to %s (EPUB format)", len(args.ChapterIDs), filename)
+	start := time.Now()
+	pages, err := m.downloadToArchive(ctx, args, file)
+	stats := finishStats(file, len(args.ChapterIDs), pages, start, retries.Load())
+	if err != nil {
+		// Do not leave a partial archive behind
+		os.Remove(filename)
+		return nil, fmt.Errorf("failed to download %s: %w", strings.ToUpper(args.Format), err)
 	}
 
+	responseText := fmt.Sprintf("Successfully downloaded %d chapters to %s (%s format)\n\n%s", len(args.ChapterIDs), filename, strings.ToUpper(args.Format), stats.Summary())
+
 	return mcp_golang.NewToolResponse(
 		mcp_golang.NewTextContent(responseText),
+		mcp_golang.NewTextContent(downloadResultJSON(filename, args.Format, stats)),
 	), nil
 }
 
-// downloadToCBZ downloads comic chapters to CBZ format
-func (m *MCPServer) downloadToCBZ(ctx context.Context, args DownloadComicArgs, file *os.File) error {
-	cbz := zip.NewWriter(file)
-	defer cbz.Close()
-
-	page := 0
-	for chn, chapterID := range args.ChapterIDs {
-		log.Printf("Downloading chapter %s (%d/%d)", chapterID, chn+1, len(args.ChapterIDs))
-		cc, err := downloader.NewDownload(ctx, args.ComicID, chapterID)
-		if err != nil {
-			return err
-		}
+// downloadResult is the machine-readable result of the download tools,
+// returned as JSON after the prose response
+type downloadResult struct {
+	Path     string `json:"path"`
+	Format   string `json:"format"`
+	Chapters int    `json:"chapters"`
+	Pages    int    `json:"pages"`
+	Bytes    int64  `json:"bytes"`
+}
 
-		for n := range cc.Pages {
-			log.Printf("Downloading page %d/%d/%d", n, len(cc.Pages), chn)
-			w, err := cbz.Create(fmt.Sprintf("%d.jpg", page))
-			if err != nil {
-				return err
-			}
-
-			err = cc.DownloadPageTo(cc.Pages[n], w)
-			if err != nil {
-				return err
-			}
-			page++
-		}
+// downloadResultJSON describes the download written to filename as JSON
+func downloadResultJSON(filename, format string, stats downloader.Stats) string {
+	path, err := filepath.Abs(filename)
+	if err != nil {
+		path = filename
 	}
+	data, _ := json.Marshal(downloadResult{
+		Path:     path,
+		Format:   format,
+		Chapters: stats.Chapters,
+		Pages:    stats.Pages,
+		Bytes:    stats.Bytes,
+	})
+	return string(data)
+}
 
-	return nil
+// finishStats closes file and summarizes the download written to it since
+// start, which retried retries pages
+func finishStats(file *os.File, chapters, pages int, start time.Time, retries int64) downloader.Stats {
+	stats := downloader.Stats{
+		Chapters: chapters,
+		Pages:    pages,
+		Retries:  retries,
+	}
+	file.Close()
+	stats.Duration = time.Since(start)
+	if fi, err := os.Stat(file.Name()); err == nil {
+		stats.Bytes = fi.Size()
+	}
+	return stats
 }
 
-// downloadToEPUB downloads comic chapters to EPUB format
-func (m *MCPServer) downloadToEPUB(ctx context.Context, args DownloadComicArgs, file *os.File) error {
-	epubWriter := epub.NewEPUBWriter(file, args.Title)
-	defer epubWriter.Close()
-
-	page := 0
-	for chn, chapterID := range args.ChapterIDs {
-		log.Printf("Downloading chapter %s (%d/%d)", chapterID, chn+1, len(args.ChapterIDs))
-		cc, err := downloader.NewDownload(ctx, args.ComicID, chapterID)
-		if err != nil {
-			return err
-		}
+// downloadToArchive downloads comic chapters to the requested format and
+// returns the number of pages
+func (m *MCPServer) downloadToArchive(ctx context.Context, args DownloadComicArgs, file *os.File) (int, error) {
+	w, err := archive.NewWriter(args.Format, file, args.Title)
+	if err != nil {
+		return 0, err
+	}
+	pages, err := writeChapters(ctx, w, args.ComicID, args.ChapterIDs, m.settings, "Downloading")
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	return pages, err
+}
 
-		for n := range cc.Pages {
-			log.Printf("Downloading page %d/%d/%d", n, len(cc.Pages), chn)
-
-			// Download image data to memory
-			var buf bytes.Buffer
-			err := cc.DownloadPageTo(cc.Pages[n], &buf)
-			if err != nil {
-				return err
-			}
-
-			// Add page to EPUB
-			filename := fmt.Sprintf("%d.jpg", page)
-			err = epubWriter.AddPage(filename, buf.Bytes())
-			if err != nil {
-				return err
-			}
-			page++
-		}
+// writeChapters downloads the chapters into w in order, numbering the pages
+// across them, and returns the number of pages. It shares the page pipeline
+// of the CLI: up to settings.Workers tabs prepare the upcoming chapters,
+// settings.ChapterWorkers chapters download at once, and at most
+// settings.MaxInflight pages wait to be written. It stops between pages once
+// ctx is cancelled. verb names the work in the log.
+func writeChapters(ctx context.Context, w archive.ArchiveWriter, comicID string, chapterIDs []string, settings *config.Settings, verb string) (int, error) {
+	inflight := make(chan struct{}, downloader.InflightLimit(settings.MaxInflight, settings.Workers))
+	fetch := downloader.Fetch{
+		ComicID:        comicID,
+		ChapterIDs:     chapterIDs,
+		ChapterWorkers: min(settings.ChapterWorkers, len(chapterIDs), cap(inflight)),
+	}
+	open := openChapters
+	if fetch.ChapterWorkers > 1 {
+		open = openChapterTabs
+	}
+	openChapter, err := open(ctx, comicID, chapterIDs, settings.Workers)
+	if err != nil {
+		return 0, err
 	}
 
-	return nil
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	out := make(chan downloader.FetchedPage, cap(inflight))
+	fetchErr := make(chan error, 1)
+	go func() {
+		fetchErr <- downloader.FetchPages(fetch, openChapter, out, inflight, ctx.Done())
+		close(out)
+	}()
+
+	page, chapter, pages, n := 0, 0, 0, 0
+	for p := range out {
+		if p.Start {
+			chapter, pages, n = p.Chapter, p.Pages, 0
+			log.Printf("%s chapter %s (%d/%d)", verb, chapterIDs[chapter], chapter+1, len(chapterIDs))
+			continue
+		}
+		log.Printf("%s page %d/%d/%d", verb, n, pages, chapter)
+		if err = w.AddPage(naming.PageEntryName(page, 0, ".jpg"), p.Data); err != nil {
+			cancel()
+			break
+		}
+		<-inflight
+		page++
+		n++
+	}
+	if ferr := <-fetchErr; err == nil {
+		err = ferr
+	}
+	if err == nil {
+		// Cancelled by the caller: the download stopped short
+		err = context.Cause(ctx)
+	}
+	return page, err
 }
 
 // Serve starts the MCP server
 func (m *MCPServer) Serve() error {
 	log.Println("Starting MCP server...")
 
+	defer m.pool.Close()
+
 	// Add recovery to catch any panics
 	defer func() {
 		if r := recover(); r != nil {
@@ -1,20 +1,21 @@
 package mcp
 
 import (
-	"archive/zip"
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
+	"comicsd/internal/archive"
+	"comicsd/internal/browser"
+	"comicsd/internal/config"
 	"comicsd/internal/downloader"
-	"comicsd/internal/epub"
-	"comicsd/internal/info"
+	"comicsd/internal/naming"
 
-	"github.com/chromedp/chromedp"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 )
 
@@ -28,6 +29,12 @@ type InfoParams struct {
 	ComicID string `json:"comic_id"`
 }
 
+// ListChaptersParams represents the parameters for the list chapters tool
+type ListChaptersParams struct {
+	ComicID string `json:"comic_id"`
+	Sort    string `json:"sort,omitempty"`
+}
+
 // GenerateConfigParams represents the parameters for the config generation tool
 type GenerateConfigParams struct {
 	ComicID    string   `json:"comic_id"`
@@ -39,23 +46,32 @@ type GenerateConfigParams struct {
 
 // SummarizeParams represents the parameters for the summarize tool
 type SummarizeParams struct {
-	ComicID  string   `json:"comic_id"`
-	Chapters []string `json:"chapters"`
-	Title    string   `json:"title"`
-	Format   string   `json:"format"`
+	ComicID   string   `json:"comic_id"`
+	Chapters  []string `json:"chapters"`
+	Title     string   `json:"title"`
+	Format    string   `json:"format"`
+	Overwrite bool     `json:"overwrite,omitempty"`
+}
+
+// officialTools holds the state shared by the official SDK tool handlers
+type officialTools struct {
+	settings    *config.Settings
+	pool        *browser.Pool
+	openFetcher openFetcherFunc
 }
 
-// NewOfficialMCPServer creates a new MCP server using the official SDK
-func NewOfficialMCPServer() *mcp.Server {
-	log.SetOutput(os.Stderr)
+// NewOfficialMCPServer creates a new MCP server using the official SDK.
+// Tool calls open their browser tabs from pool.
+func NewOfficialMCPServer(settings *config.Settings, pool *browser.Pool) *mcp.Server {
 	log.Println("Creating official MCP server...")
 
 	server := mcp.NewServer("comicsd", "1.0.0", nil)
+	tools := &officialTools{settings: settings, pool: pool, openFetcher: poolFetcher(pool)}
 
 	// Add search tool
 	log.Println("Adding search tool...")
 	server.AddTools(
-		mcp.NewServerTool("search_comics", "Search for comics by keyword", searchComicsOfficial, mcp.Input(
+		mcp.NewServerTool("search_comics", "Search for comics by keyword", tools.searchComicsOfficial, mcp.Input(
 			mcp.Property("keyword", mcp.Description("Keyword to search for comics")),
 		)),
 	)
@@ -63,19 +79,28 @@ func NewOfficialMCPServer() *mcp.Server {
 	// Add info tool
 	log.Println("Adding info tool...")
 	server.AddTools(
-		mcp.NewServerTool("get_comic_info", "Get comic information", getComicInfoOfficial, mcp.Input(
+		mcp.NewServerTool("get_comic_info", "Get comic information", tools.getComicInfoOfficial, mcp.Input(
 			mcp.Property("comic_id", mcp.Description("Comic ID to get information for")),
 		)),
 	)
 
+	// Add list chapters tool
+	log.Println("Adding list chapters tool...")
+	server.AddTools(
+		mcp.NewServerTool("list_chapters", "List chapter IDs and titles of a comic", tools.listChaptersOfficial, mcp.Input(
+			mcp.Property("comic_id", mcp.Description("Comic ID to list chapters for")),
+			mcp.Property("sort", mcp.Description("Chapter order: asc (reading order) or desc by chapter number; source (default) keeps the site's newest-first order")),
+		)),
+	)
+
 	// Add config generation tool
 	log.Println("Adding config generation tool...")
 	server.AddTools(
-		mcp.NewServerTool("generate_config", "Generate summarization configuration for specified comic and chapters", generateConfigOfficial, mcp.Input(
+		mcp.NewServerTool("generate_config", "Generate summarization configuration for specified comic and chapters", tools.generateConfigOfficial, mcp.Input(
 			mcp.Property("comic_id", mcp.Description("Comic ID to summarize")),
 			mcp.Property("chapters", mcp.Description("List of chapter IDs to include")),
 			mcp.Property("title", mcp.Description("Comic title for the configuration")),
-			mcp.Property("format", mcp.Description("Output format (cbz or epub)")),
+			mcp.Property("format", mcp.Description("Output format (cbz, cbt, epub, or auto for epub with a single chapter and cbz with several)")),
 			mcp.Property("config_name", mcp.Description("Name for this configuration entry")),
 		)),
 	)
@@ -83,11 +108,12 @@ func NewOfficialMCPServer() *mcp.Server {
 	// Add summarize tool
 	log.Println("Adding summarize tool...")
 	server.AddTools(
-		mcp.NewServerTool("summarize_comic", "Summarize specific chapters of a comic in CBZ or EPUB format", summarizeComicOfficial, mcp.Input(
+		mcp.NewServerTool("summarize_comic", "Summarize specific chapters of a comic in CBZ, CBT or EPUB format", tools.summarizeComicOfficial, mcp.Input(
 			mcp.Property("comic_id", mcp.Description("Comic ID to summarize")),
 			mcp.Property("chapters", mcp.Description("List of chapter IDs to summarize")),
 			mcp.Property("title", mcp.Description("Comic title for filename")),
-			mcp.Property("format", mcp.Description("Output format (cbz or epub)")),
+			mcp.Property("format", mcp.Description("Output format (cbz, cbt, epub, or auto for epub with a single chapter and cbz with several)")),
+			mcp.Property("overwrite", mcp.Description("Replace the output file if it already exists")),
 		)),
 	)
 
@@ -96,13 +122,15 @@ func NewOfficialMCPServer() *mcp.Server {
 }
 
 // searchComicsOfficial implements search using the official SDK
-func searchComicsOfficial(ctx context.Context, cc *mcp.ServerSession, params *mcp.CallToolParamsFor[SearchParams]) (*mcp.CallToolResultFor[any], error) {
+func (t *officialTools) searchComicsOfficial(ctx context.Context, cc *mcp.ServerSession, params *mcp.CallToolParamsFor[SearchParams]) (*mcp.CallToolResultFor[any], error) {
 	log.Printf("Search called with keyword: %s", params.Arguments.Keyword)
 
-	chromectx, cancel := chromedp.NewContext(ctx, chromedp.WithLogf(func(string, ...interface{}) {}))
-	defer cancel()
+	fetcher, release, err := t.openFetcher(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
 
-	fetcher := info.NewComicInfoFetcher(chromectx)
 	results, err := fetcher.SearchComics(params.Arguments.Keyword)
 	if err != nil {
 		log.Printf("search comics error: %v", err)
@@ -121,13 +149,19 @@ func searchComicsOfficial(ctx context.Context, cc *mcp.ServerSession, params *mc
 }
 
 // getComicInfoOfficial implements info retrieval using the official SDK
-func getComicInfoOfficial(ctx context.Context, cc *mcp.ServerSession, params *mcp.CallToolParamsFor[InfoParams]) (*mcp.CallToolResultFor[any], error) {
+func (t *officialTools) getComicInfoOfficial(ctx context.Context, cc *mcp.ServerSession, params *mcp.CallToolParamsFor[InfoParams]) (*mcp.CallToolResultFor[any], error) {
 	log.Printf("Info called with comic ID: %s", params.Arguments.ComicID)
 
-	chromectx, cancel := chromedp.NewContext(ctx, chromedp.WithLogf(func(string, ...interface{}) {}))
-	defer cancel()
+	if err := downloader.ValidateIDs(params.Arguments.ComicID); err != nil {
+		return nil, err
+	}
+
+	fetcher, release, err := t.openFetcher(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
 
-	fetcher := info.NewComicInfoFetcher(chromectx)
 	comicInfo, err := fetcher.GetComicInfo(params.Arguments.ComicID)
 	if err != nil {
 		log.Printf("get comic info error: %v", err)
@@ -145,18 +179,52 @@ func getComicInfoOfficial(ctx context.Context, cc *mcp.ServerSession, params *mc
 	}, nil
 }
 
+// listChaptersOfficial implements chapter listing using the official SDK
+func (t *officialTools) listChaptersOfficial(ctx context.Context, cc *mcp.ServerSession, params *mcp.CallToolParamsFor[ListChaptersParams]) (*mcp.CallToolResultFor[any], error) {
+	log.Printf("List chapters called with comic ID: %s", params.Arguments.ComicID)
+
+	if err := downloader.ValidateIDs(params.Arguments.ComicID); err != nil {
+		return nil, err
+	}
+
+	fetcher, release, err := t.openFetcher(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	comicInfo, err := fetcher.GetComicInfo(params.Arguments.ComicID)
+	if err != nil {
+		log.Printf("list chapters error: %v", err)
+		return nil, fmt.Errorf("failed to list chapters: %w", err)
+	}
+	if err := comicInfo.SortChapters(params.Arguments.Sort); err != nil {
+		return nil, err
+	}
+
+	// Return compact JSON
+	jsonData, err := json.Marshal(compactChapters(comicInfo.Chapters))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal chapters: %w", err)
+	}
+
+	return &mcp.CallToolResultFor[any]{
+		Content: []mcp.Content{&mcp.TextContent{Text: string(jsonData)}},
+	}, nil
+}
+
 // generateConfigOfficial implements config generation using the official SDK
-func generateConfigOfficial(ctx context.Context, cc *mcp.ServerSession, params *mcp.CallToolParamsFor[GenerateConfigParams]) (*mcp.CallToolResultFor[any], error) {
+func (t *officialTools) generateConfigOfficial(ctx context.Context, cc *mcp.ServerSession, params *mcp.CallToolParamsFor[GenerateConfigParams]) (*mcp.CallToolResultFor[any], error) {
 	log.Printf("Generate config called with comic ID: %s, chapters: %v, format: %s",
 		params.Arguments.ComicID, params.Arguments.Chapters, params.Arguments.Format)
 
 	// Validate format
 	format := params.Arguments.Format
-	if format != "cbz" && format != "epub" && format != "" {
-		return nil, fmt.Errorf("invalid format: %s. Use 'cbz' or 'epub'", format)
-	}
 	if format == "" {
-		format = "cbz" // default
+		format = archive.Default
+	}
+	if err := archive.CheckWriter(format); err != nil {
+		return nil, err
 	}
 
 	// Validate inputs
@@ -169,32 +237,27 @@ func generateConfigOfficial(ctx context.Context, cc *mcp.ServerSession, params *
 	if params.Arguments.Title == "" {
 		return nil, fmt.Errorf("title is required")
 	}
+	if err := downloader.ValidateIDs(params.Arguments.ComicID, params.Arguments.Chapters...); err != nil {
+		return nil, err
+	}
 	if params.Arguments.ConfigName == "" {
 		return nil, fmt.Errorf("config_name is required")
 	}
 
-	// Generate TOML configuration
-	var tomlConfig strings.Builder
-	tomlConfig.WriteString(fmt.Sprintf("[%s]\n", params.Arguments.ConfigName))
-	tomlConfig.WriteString(fmt.Sprintf("title = \"%s\"\n", params.Arguments.Title))
-	tomlConfig.WriteString(fmt.Sprintf("mangaid = \"%s\"\n", params.Arguments.ComicID))
-
-	// Format chapters array
-	tomlConfig.WriteString("chapters = [")
-	for i, chapter := range params.Arguments.Chapters {
-		if i > 0 {
-			tomlConfig.WriteString(", ")
-		}
-		tomlConfig.WriteString(fmt.Sprintf("\"%s\"", chapter))
+	// Generate TOML configuration, leaving out the default format
+	entry := config.SummarizeEntry{
+		Title:    params.Arguments.Title,
+		MangaID:  params.Arguments.ComicID,
+		Chapters: params.Arguments.Chapters,
 	}
-	tomlConfig.WriteString("]\n")
-
-	// Add format if not default
-	if format != "cbz" {
-		tomlConfig.WriteString(fmt.Sprintf("format = \"%s\"\n", format))
+	if format != archive.Default {
+		entry.Format = format
 	}
-
-	configContent := tomlConfig.String()
+	data, err := config.MarshalSummarize(map[string]config.SummarizeEntry{params.Arguments.ConfigName: entry})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode config: %w", err)
+	}
+	configContent := string(data)
 
 	// Create response
 	responseText := fmt.Sprintf("Generated summarization configuration for comic '%s':\n\n", params.Arguments.Title)
@@ -219,17 +282,17 @@ func generateConfigOfficial(ctx context.Context, cc *mcp.ServerSession, params *
 }
 
 // summarizeComicOfficial implements comic summarization (downloading) using the official SDK
-func summarizeComicOfficial(ctx context.Context, cc *mcp.ServerSession, params *mcp.CallToolParamsFor[SummarizeParams]) (*mcp.CallToolResultFor[any], error) {
+func (t *officialTools) summarizeComicOfficial(ctx context.Context, cc *mcp.ServerSession, params *mcp.CallToolParamsFor[SummarizeParams]) (*mcp.CallToolResultFor[any], error) {
 	log.Printf("Summarize called with comic ID: %s, chapters: %v, format: %s",
 		params.Arguments.ComicID, params.Arguments.Chapters, params.Arguments.Format)
 
 	// Validate format
 	format := params.Arguments.Format
-	if format != "cbz" && format != "epub" && format != "" {
-		return nil, fmt.Errorf("invalid format: %s. Use 'cbz' or 'epub'", format)
-	}
 	if format == "" {
-		format = "cbz" // default
+		format = archive.Default
+	}
+	if err := archive.CheckWriter(format); err != nil {
+		return nil, err
 	}
 
 	// Validate inputs
@@ -242,111 +305,72 @@ func summarizeComicOfficial(ctx context.Context, cc *mcp.ServerSession, params *
 	if params.Arguments.Title == "" {
 		return nil, fmt.Errorf("title is required")
 	}
+	if err := downloader.ValidateIDs(params.Arguments.ComicID, params.Arguments.Chapters...); err != nil {
+		return nil, err
+	}
+	params.Arguments.Chapters = dedupeChapters(params.Arguments.Chapters)
+	format = archive.Resolve(format, len(params.Arguments.Chapters))
 
 	// Create chromedp context for downloading
-	chromectx, cancel := chromedp.NewContext(ctx, chromedp.WithLogf(func(string, ...interface{}) {}))
-	defer cancel()
+	chromectx, release, err := t.pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open browser tab: %w", err)
+	}
+	defer release()
+	// Count this download's retries apart from the others running at once
+	chromectx, retries := downloader.WithRetryCounter(chromectx)
 
 	// Create output file
-	filename := fmt.Sprintf("%s.%s", params.Arguments.Title, format)
-	file, err := os.Create(filename)
+	filename := filepath.Join(t.settings.OutputDir, naming.OutputFilename(params.Arguments.Title, format, ""))
+	file, err := downloader.CreateOutput(filename, params.Arguments.Overwrite)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create output file: %w", err)
 	}
-	defer file.Close()
 
-	var responseText string
-
-	if format == "cbz" {
-		err = summarizeToCBZ(chromectx, params.Arguments, file)
-		if err != nil {
-			return nil, fmt.Errorf("failed to summarize to CBZ: %w", err)
-		}
-		responseText = fmt.Sprintf("Successfully summarized %d chapters to %s (CBZ format)", len(params.Arguments.Chapters), filename)
-	} else {
-		err = summarizeToEPUB(chromectx, params.Arguments, file)
-		if err != nil {
-			return nil, fmt.Errorf("failed to summarize to EPUB: %w", err)
+	start := time.Now()
+	params.Arguments.Format = format
+	pages, err := summarizeToArchive(chromectx, params.Arguments, t.settings, file)
+	stats := finishStats(file, len(params.Arguments.Chapters), pages, start, retries.Load())
+	if err != nil {
+		// Do not leave a partial archive behind
+		os.Remove(filename)
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("summarize cancelled: %w", ctx.Err())
 		}
-		responseText = fmt.Sprintf("Successfully summarized %d chapters to %s (EPUB format)", len(params.Arguments.Chapters), filename)
+		return nil, fmt.Errorf("failed to summarize to %s: %w", strings.ToUpper(format), err)
 	}
 
+	responseText := fmt.Sprintf("Successfully summarized %d chapters to %s (%s format)\n\n%s", len(params.Arguments.Chapters), filename, strings.ToUpper(format), stats.Summary())
+
 	return &mcp.CallToolResultFor[any]{
-		Content: []mcp.Content{&mcp.TextContent{Text: responseText}},
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: responseText},
+			&mcp.TextContent{Text: downloadResultJSON(filename, format, stats)},
+		},
 	}, nil
 }
 
-// summarizeToCBZ downloads comic chapters to CBZ format
-func summarizeToCBZ(ctx context.Context, params SummarizeParams, file *os.File) error {
-	cbz := zip.NewWriter(file)
-	defer cbz.Close()
-
-	page := 0
-	for chn, chapterID := range params.Chapters {
-		log.Printf("Summarizing chapter %s (%d/%d)", chapterID, chn+1, len(params.Chapters))
-		cc, err := downloader.NewDownload(ctx, params.ComicID, chapterID)
-		if err != nil {
-			return err
-		}
-
-		for n := range cc.Pages {
-			log.Printf("Summarizing page %d/%d/%d", n, len(cc.Pages), chn)
-			w, err := cbz.Create(fmt.Sprintf("%d.jpg", page))
-			if err != nil {
-				return err
-			}
-
-			err = cc.DownloadPageTo(cc.Pages[n], w)
-			if err != nil {
-				return err
-			}
-			page++
-		}
+// summarizeToArchive downloads comic chapters to the requested format and
+// returns the number of pages. It shares the chapter pipeline of the other
+// server, set up by settings.
+func summarizeToArchive(ctx context.Context, params SummarizeParams, settings *config.Settings, file *os.File) (int, error) {
+	w, err := archive.NewWriter(params.Format, file, params.Title)
+	if err != nil {
+		return 0, err
 	}
-
-	return nil
-}
-
-// summarizeToEPUB downloads comic chapters to EPUB format
-func summarizeToEPUB(ctx context.Context, params SummarizeParams, file *os.File) error {
-	epubWriter := epub.NewEPUBWriter(file, params.Title)
-	defer epubWriter.Close()
-
-	page := 0
-	for chn, chapterID := range params.Chapters {
-		log.Printf("Summarizing chapter %s (%d/%d)", chapterID, chn+1, len(params.Chapters))
-		cc, err := downloader.NewDownload(ctx, params.ComicID, chapterID)
-		if err != nil {
-			return err
-		}
-
-		for n := range cc.Pages {
-			log.Printf("Summarizing page %d/%d/%d", n, len(cc.Pages), chn)
-
-			// Download image data to memory
-			var buf bytes.Buffer
-			err := cc.DownloadPageTo(cc.Pages[n], &buf)
-			if err != nil {
-				return err
-			}
-
-			// Add page to EPUB
-			filename := fmt.Sprintf("%d.jpg", page)
-			err = epubWriter.AddPage(filename, buf.Bytes())
-			if err != nil {
-				return err
-			}
-			page++
-		}
+	pages, err := writeChapters(ctx, w, params.ComicID, params.Chapters, settings, "Summarizing")
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
 	}
-
-	return nil
+	return pages, err
 }
 
 // ServeOfficial runs the official MCP server
-func ServeOfficial() error {
+func ServeOfficial(settings *config.Settings) error {
 	log.Println("Starting official MCP server...")
-	server := NewOfficialMCPServer()
+	pool := browser.NewServerPool(context.Background(), settings)
+	defer pool.Close()
+	server := NewOfficialMCPServer(settings, pool)
 
 	transport := mcp.NewStdioTransport()
 	err := server.Run(context.Background(), transport)
@@ -0,0 +1,424 @@
+package mcp
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"comicsd/internal/config"
+	"comicsd/internal/downloader"
+	"comicsd/internal/info"
+	"comicsd/internal/info/infotest"
+
+	mcp_golang "github.com/metoro-io/mcp-golang"
+	"github.com/metoro-io/mcp-golang/transport/stdio"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// fakeFetcher opens fetcher instead of a browser tab
+func fakeFetcher(fetcher info.Fetcher) openFetcherFunc {
+	return func(ctx context.Context) (info.Fetcher, func(), error) {
+		return fetcher, func() {}, nil
+	}
+}
+
+func sampleFetcher() *infotest.Fetcher {
+	return &infotest.Fetcher{
+		Results: []info.SearchResult{{ID: "1128", Title: "東大特訓班"}},
+		Comics: map[string]*info.ComicInfo{
+			"1128": {
+				ID:     "1128",
+				Title:  "東大特訓班",
+				Author: "三田紀房",
+				Chapters: []info.Chapter{
+					{ID: "2", Title: "第2話", URL: "/comic/1128/2.html"},
+					{ID: "1", Title: "第1話", URL: "/comic/1128/1.html"},
+				},
+			},
+		},
+	}
+}
+
+func responseText(t *testing.T, resp *mcp_golang.ToolResponse) []string {
+	t.Helper()
+	texts := make([]string, 0, len(resp.Content))
+	for _, c := range resp.Content {
+		if c.TextContent == nil {
+			t.Fatalf("expected text content, got %+v", c)
+		}
+		texts = append(texts, c.TextContent.Text)
+	}
+	return texts
+}
+
+func TestSearchComicsResponse(t *testing.T) {
+	fetcher := sampleFetcher()
+	m := &MCPServer{openFetcher: fakeFetcher(fetcher)}
+
+	resp, err := m.searchComics(SearchComicsArgs{Keyword: "東大"})
+	if err != nil {
+		t.Fatalf("searchComics failed: %v", err)
+	}
+	texts := responseText(t, resp)
+	if len(texts) != 2 {
+		t.Fatalf("expected summary and JSON content, got %d items", len(texts))
+	}
+	if !strings.Contains(texts[0], "Found 1 comics for '東大'") || !strings.Contains(texts[0], "1. 東大特訓班 (ID: 1128)") {
+		t.Errorf("unexpected summary: %s", texts[0])
+	}
+	if !strings.Contains(texts[1], `"id": "1128"`) {
+		t.Errorf("unexpected JSON: %s", texts[1])
+	}
+	if len(fetcher.Keywords) != 1 || fetcher.Keywords[0] != "東大" {
+		t.Errorf("unexpected searches: %v", fetcher.Keywords)
+	}
+}
+
+func TestSearchComicsNoResults(t *testing.T) {
+	m := &MCPServer{openFetcher: fakeFetcher(&infotest.Fetcher{})}
+
+	resp, err := m.searchComics(SearchComicsArgs{Keyword: "nothing"})
+	if err != nil {
+		t.Fatalf("searchComics failed: %v", err)
+	}
+	if texts := responseText(t, resp); texts[0] != "No comics found for keyword 'nothing'" {
+		t.Errorf("unexpected summary: %s", texts[0])
+	}
+}
+
+func TestGetComicInfoResponse(t *testing.T) {
+	m := &MCPServer{openFetcher: fakeFetcher(sampleFetcher())}
+
+	resp, err := m.getComicInfo(GetComicInfoArgs{ComicID: "1128"})
+	if err != nil {
+		t.Fatalf("getComicInfo failed: %v", err)
+	}
+	text := responseText(t, resp)[0]
+	for _, want := range []string{"Title: 東大特訓班", "Author: 三田紀房", "Total Chapters: 2", "1. [2] 第2話"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("response missing %q: %s", want, text)
+		}
+	}
+}
+
+func TestHandlersRejectNonNumericIDs(t *testing.T) {
+	m := &MCPServer{openFetcher: fakeFetcher(sampleFetcher())}
+
+	if _, err := m.getComicInfo(GetComicInfoArgs{ComicID: "1128/../x"}); !errors.Is(err, downloader.ErrInvalidID) {
+		t.Errorf("expected ErrInvalidID from getComicInfo, got %v", err)
+	}
+	if _, err := m.downloadComic(DownloadComicArgs{ComicID: "1128", ChapterIDs: []string{"abc"}, Format: "cbz"}); !errors.Is(err, downloader.ErrInvalidID) {
+		t.Errorf("expected ErrInvalidID from downloadComic, got %v", err)
+	}
+}
+
+func TestHandlersWrapFetchErrors(t *testing.T) {
+	m := &MCPServer{openFetcher: fakeFetcher(&infotest.Fetcher{Err: errors.New("offline")})}
+
+	if _, err := m.listChapters(ListChaptersArgs{ComicID: "1128"}); err == nil || !strings.Contains(err.Error(), "failed to list chapters: offline") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestListChaptersOfficialResponse(t *testing.T) {
+	tools := &officialTools{openFetcher: fakeFetcher(sampleFetcher())}
+
+	params := &mcp.CallToolParamsFor[ListChaptersParams]{Arguments: ListChaptersParams{ComicID: "1128"}}
+	result, err := tools.listChaptersOfficial(context.Background(), nil, params)
+	if err != nil {
+		t.Fatalf("listChaptersOfficial failed: %v", err)
+	}
+	text, ok := result.Content[0].(*mcp.TextContent)
+	if !ok {
+		t.Fatalf("expected text content, got %T", result.Content[0])
+	}
+	expected := `[{"id":"2","title":"第2話"},{"id":"1","title":"第1話"}]`
+	if text.Text != expected {
+		t.Errorf("unexpected JSON: %s", text.Text)
+	}
+}
+
+func TestListChaptersSorted(t *testing.T) {
+	m := &MCPServer{openFetcher: fakeFetcher(sampleFetcher())}
+
+	resp, err := m.listChapters(ListChaptersArgs{ComicID: "1128", Sort: "asc"})
+	if err != nil {
+		t.Fatalf("listChapters failed: %v", err)
+	}
+	expected := `[{"id":"1","title":"第1話"},{"id":"2","title":"第2話"}]`
+	if text := responseText(t, resp); len(text) != 1 || text[0] != expected {
+		t.Errorf("unexpected JSON: %v", text)
+	}
+	if _, err := m.listChapters(ListChaptersArgs{ComicID: "1128", Sort: "newest"}); err == nil {
+		t.Errorf("expected an error for an unknown order")
+	}
+}
+
+func TestRegisterTools(t *testing.T) {
+	m := &MCPServer{server: mcp_golang.NewServer(stdio.NewStdioServerTransport())}
+	m.registerTools()
+	for _, name := range []string{"search_comics", "get_comic_info", "list_chapters", "download_comic"} {
+		if !m.server.CheckToolRegistered(name) {
+			t.Errorf("tool %s is not registered", name)
+		}
+	}
+}
+
+// fakeChapter serves numbered pages of synthetic bytes
+type fakeChapter struct {
+	id    string
+	pages []string
+}
+
+func (c *fakeChapter) PageIDs() []string { return c.pages }
+
+func (c *fakeChapter) DownloadPageTo(page string, w io.Writer) error {
+	_, err := fmt.Fprintf(w, "%s/%s", c.id, page)
+	return err
+}
+
+func (c *fakeChapter) Close() {}
+
+func TestSummarizeToCBZ(t *testing.T) {
+	orig := openChapters
+	defer func() { openChapters = orig }()
+	openChapters = func(ctx context.Context, comicID string, chapterIDs []string, workers int) (downloader.ChapterOpener, error) {
+		return func(i int) (downloader.PageSource, error) {
+			return &fakeChapter{id: chapterIDs[i], pages: []string{"1", "2"}}, nil
+		}, nil
+	}
+
+	path := filepath.Join(t.TempDir(), "out.cbz")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := SummarizeParams{ComicID: "1128", Chapters: []string{"a", "b"}, Title: "t", Format: "cbz"}
+	pages, err := summarizeToArchive(context.Background(), params, &config.Settings{Workers: 1, ChapterWorkers: 1}, file)
+	if err != nil {
+		t.Fatalf("summarizeToArchive failed: %v", err)
+	}
+	file.Close()
+	if pages != 4 {
+		t.Errorf("expected 4 pages, got %d", pages)
+	}
+
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatalf("open archive: %v", err)
+	}
+	defer zr.Close()
+	var got []string
+	for _, f := range zr.File {
+		rc, _ := f.Open()
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		got = append(got, f.Name+"="+string(data))
+	}
+	expected := "0000.jpg=a/1,0001.jpg=a/2,0002.jpg=b/1,0003.jpg=b/2"
+	if strings.Join(got, ",") != expected {
+		t.Errorf("unexpected entries: %v", got)
+	}
+}
+
+func TestSummarizeToArchivePreparesChaptersWithWorkers(t *testing.T) {
+	var workersUsed int
+	orig := openChapters
+	defer func() { openChapters = orig }()
+	openChapters = func(ctx context.Context, comicID string, chapterIDs []string, workers int) (downloader.ChapterOpener, error) {
+		workersUsed = workers
+		return func(i int) (downloader.PageSource, error) {
+			return &fakeChapter{id: chapterIDs[i], pages: []string{"1"}}, nil
+		}, nil
+	}
+
+	file, err := os.Create(filepath.Join(t.TempDir(), "out.epub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	params := SummarizeParams{ComicID: "1128", Chapters: []string{"a", "b", "c"}, Title: "t", Format: "epub"}
+	pages, err := summarizeToArchive(context.Background(), params, &config.Settings{Workers: 3, ChapterWorkers: 1}, file)
+	if err != nil {
+		t.Fatalf("summarizeToArchive failed: %v", err)
+	}
+	if pages != 3 || workersUsed != 3 {
+		t.Errorf("expected 3 pages from 3 workers, got %d pages from %d", pages, workersUsed)
+	}
+}
+
+func TestSummarizeToArchiveReportsCloseError(t *testing.T) {
+	orig := openChapters
+	defer func() { openChapters = orig }()
+	openChapters = func(ctx context.Context, comicID string, chapterIDs []string, workers int) (downloader.ChapterOpener, error) {
+		return func(i int) (downloader.PageSource, error) {
+			return &fakeChapter{id: chapterIDs[i], pages: []string{"1"}}, nil
+		}, nil
+	}
+
+	// The small pages stay buffered, so the read-only file only fails once
+	// Close writes the central directory
+	path := filepath.Join(t.TempDir(), "out.cbz")
+	if err := os.WriteFile(path, nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	params := SummarizeParams{ComicID: "1128", Chapters: []string{"a"}, Title: "t", Format: "cbz"}
+	if _, err := summarizeToArchive(context.Background(), params, &config.Settings{Workers: 1, ChapterWorkers: 1}, file); err == nil {
+		t.Error("expected the failed Close to be reported")
+	}
+}
+
+// cancellingChapter cancels the summarize context once its first page is written
+type cancellingChapter struct {
+	fakeChapter
+	cancel context.CancelFunc
+}
+
+func (c *cancellingChapter) DownloadPageTo(page string, w io.Writer) error {
+	c.cancel()
+	return c.fakeChapter.DownloadPageTo(page, w)
+}
+
+func TestSummarizeToCBZStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var opened []string
+	orig := openChapters
+	defer func() { openChapters = orig }()
+	openChapters = func(ctx context.Context, comicID string, chapterIDs []string, workers int) (downloader.ChapterOpener, error) {
+		return func(i int) (downloader.PageSource, error) {
+			opened = append(opened, chapterIDs[i])
+			return &cancellingChapter{fakeChapter{id: chapterIDs[i], pages: []string{"1", "2"}}, cancel}, nil
+		}, nil
+	}
+
+	file, err := os.Create(filepath.Join(t.TempDir(), "out.cbz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	params := SummarizeParams{ComicID: "1128", Chapters: []string{"a", "b"}, Title: "t", Format: "cbz"}
+	_, err = summarizeToArchive(ctx, params, &config.Settings{Workers: 1, ChapterWorkers: 1}, file)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if strings.Join(opened, ",") != "a" {
+		t.Errorf("expected only chapter a to be opened, got %v", opened)
+	}
+}
+
+// heldChapter serves pages while counting the ones downloaded
+type heldChapter struct {
+	fakeChapter
+	w *heldWriter
+}
+
+func (c *heldChapter) DownloadPageTo(page string, w io.Writer) error {
+	c.w.mu.Lock()
+	c.w.downloaded++
+	c.w.peak = max(c.w.peak, c.w.downloaded-c.w.written)
+	c.w.mu.Unlock()
+	return c.fakeChapter.DownloadPageTo(page, w)
+}
+
+// heldWriter records the pages written and the most pages downloaded but
+// not yet written
+type heldWriter struct {
+	mu         sync.Mutex
+	downloaded int
+	written    int
+	peak       int
+	names      []string
+}
+
+func (w *heldWriter) AddPage(name string, data []byte) error {
+	time.Sleep(time.Millisecond)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.written++
+	w.names = append(w.names, name+"="+string(data))
+	return nil
+}
+
+func (w *heldWriter) Close() error { return nil }
+
+func TestWriteChaptersFetchesChaptersAtOnceWithinMaxInflight(t *testing.T) {
+	w := &heldWriter{}
+	origChapters, origTabs := openChapters, openChapterTabs
+	defer func() { openChapters, openChapterTabs = origChapters, origTabs }()
+	openChapters = func(ctx context.Context, comicID string, chapterIDs []string, workers int) (downloader.ChapterOpener, error) {
+		return nil, errors.New("chapters opened in the current tab")
+	}
+	openChapterTabs = func(ctx context.Context, comicID string, chapterIDs []string, workers int) (downloader.ChapterOpener, error) {
+		return func(i int) (downloader.PageSource, error) {
+			return &heldChapter{fakeChapter{id: chapterIDs[i], pages: []string{"1", "2", "3", "4"}}, w}, nil
+		}, nil
+	}
+
+	settings := &config.Settings{Workers: 1, ChapterWorkers: 3, MaxInflight: 3}
+	pages, err := writeChapters(context.Background(), w, "1128", []string{"a", "b", "c", "d"}, settings, "Downloading")
+	if err != nil {
+		t.Fatalf("writeChapters failed: %v", err)
+	}
+	if pages != 16 || w.names[4] != "4.jpg=b/1" || w.names[15] != "15.jpg=d/4" {
+		t.Errorf("expected 16 pages in order, got %d: %v", pages, w.names)
+	}
+	if w.peak > settings.MaxInflight {
+		t.Errorf("held %d pages at once, want at most %d", w.peak, settings.MaxInflight)
+	}
+}
+
+func TestDownloadResultJSON(t *testing.T) {
+	dir := t.TempDir()
+	stats := downloader.Stats{Chapters: 2, Pages: 40, Bytes: 1234}
+	var got downloadResult
+	if err := json.Unmarshal([]byte(downloadResultJSON(filepath.Join(dir, "t.cbz"), "cbz", stats)), &got); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	expected := downloadResult{Path: filepath.Join(dir, "t.cbz"), Format: "cbz", Chapters: 2, Pages: 40, Bytes: 1234}
+	if got != expected {
+		t.Errorf("unexpected result: %+v", got)
+	}
+}
+
+func TestGenerateConfigEscapesValues(t *testing.T) {
+	tools := &officialTools{}
+	args := GenerateConfigParams{
+		ComicID:    "1128",
+		Chapters:   []string{"566271"},
+		Title:      "He said \"hi\"\nand left",
+		Format:     "epub",
+		ConfigName: "東大 \"特訓\"",
+	}
+	result, err := tools.generateConfigOfficial(context.Background(), nil, &mcp.CallToolParamsFor[GenerateConfigParams]{Arguments: args})
+	if err != nil {
+		t.Fatalf("generateConfigOfficial failed: %v", err)
+	}
+	text := result.Content[0].(*mcp.TextContent).Text
+	start := strings.Index(text, "```toml\n") + len("```toml\n")
+	end := strings.Index(text[start:], "```")
+	entries, err := config.ParseSummarize([]byte(text[start : start+end]))
+	if err != nil {
+		t.Fatalf("generated config does not parse: %v\n%s", err, text)
+	}
+	expected := config.SummarizeEntry{Title: args.Title, MangaID: "1128", Chapters: []string{"566271"}, Format: "epub"}
+	if got := entries[args.ConfigName]; !reflect.DeepEqual(got, expected) {
+		t.Errorf("unexpected entry: %#v", got)
+	}
+}
@@ -0,0 +1,131 @@
+// Package naming builds the names of the files comicsd writes: output
+// archives and the page entries inside them.
+package naming
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// DefaultTemplate names an output file after the title with the format as
+// its extension
+const DefaultTemplate = "{title}.{format}"
+
+// untitled replaces a title with nothing usable left after sanitizing
+const untitled = "untitled"
+
+// OutputFilename returns the file name of an archive of title in format. The
+// template may use {title} and {format}; empty selects DefaultTemplate. The
+// title is sanitized, and the format is added as the extension when the
+// template leaves it out.
+func OutputFilename(title, format, template string) string {
+	if template == "" {
+		template = DefaultTemplate
+	}
+	name := Sanitize(title)
+	if name == "" {
+		name = untitled
+	}
+	name = strings.NewReplacer("{title}", name, "{format}", format).Replace(template)
+	name = strings.TrimRight(name, ".")
+	if format != "" && path.Ext(name) != "."+format {
+		name += "." + format
+	}
+	return name
+}
+
+// PageEntryName returns the archive entry name of the page at index, counted
+// from 0, with extension ext. When total is known the index is zero-padded to
+// the width of the last index, so names sort in reading order; a total of 0
+// or less leaves it unpadded.
+func PageEntryName(index, total int, ext string) string {
+	if ext != "" && !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	width := 0
+	if total > 0 {
+		width = len(strconv.Itoa(total - 1))
+	}
+	return fmt.Sprintf("%0*d%s", width, index, ext)
+}
+
+// MinPageWidth is the least number of digits CBZ and CBT page names are
+// zero-padded to. Their page count is rarely known before the download, so
+// this keeps readers sorting entries by name in reading order for books of
+// up to 10000 pages.
+const MinPageWidth = 4
+
+// CoverName is the stem of the cover entry of CBZ and CBT archives. "!"
+// sorts before the digits of page names, so readers taking the first image
+// by name show the cover first instead of after the last page.
+const CoverName = "!cover"
+
+// PadPageName zero-pads a numeric image name such as "7.jpg" to width
+// digits. Other names, and every name when width is 0, are kept.
+func PadPageName(filename string, width int) string {
+	if width == 0 {
+		return filename
+	}
+	ext := path.Ext(filename)
+	n, err := strconv.Atoi(strings.TrimSuffix(filename, ext))
+	if err != nil || n < 0 {
+		return filename
+	}
+	return fmt.Sprintf("%0*d%s", width, n, ext)
+}
+
+// Sanitize makes a title scraped from the site safe to use as a file name
+func Sanitize(title string) string {
+	title = strings.Map(func(r rune) rune {
+		switch {
+		case strings.ContainsRune(`/\:*?"<>|`, r):
+			return '_'
+		case unicode.IsControl(r):
+			return -1
+		}
+		return r
+	}, title)
+	return strings.Trim(strings.TrimSpace(title), ".")
+}
+
+// Flatten turns a title into an ASCII-only file name. Full-width and
+// accented letters are folded to their ASCII forms and everything else
+// becomes hyphens. When letters had to be dropped, as with Chinese titles,
+// or nothing is left, the name is prefixed with the comic ID so it stays
+// unique and non-empty.
+func Flatten(title, comicID string) string {
+	var b strings.Builder
+	dropped := false
+	hyphen := false
+	for _, r := range norm.NFKD.String(title) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			// combining accent left over from decomposition
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			if hyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			hyphen = false
+			b.WriteRune(r)
+		default:
+			if r >= unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+				dropped = true
+			}
+			hyphen = true
+		}
+	}
+
+	slug := b.String()
+	switch {
+	case slug == "":
+		return "comic-" + comicID
+	case dropped:
+		return "comic-" + comicID + "-" + slug
+	}
+	return slug
+}
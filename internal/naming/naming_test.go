@@ -0,0 +1,109 @@
+package naming
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestOutputFilename(t *testing.T) {
+	tests := []struct {
+		title, format, template string
+		want                    string
+	}{
+		{"東大特訓班", "cbz", "", "東大特訓班.cbz"},
+		{"東大特訓班 1-3", "epub", "", "東大特訓班 1-3.epub"},
+		{" Re:Zero / 第二章 ", "cbt", "", "Re_Zero _ 第二章.cbt"},
+		{"../../etc/passwd", "cbz", "", "_.._etc_passwd.cbz"},
+		{"", "cbz", "", "untitled.cbz"},
+		{"...", "cbz", "", "untitled.cbz"},
+		{"One Piece", "cbz", "[comicsd] {title}", "[comicsd] One Piece.cbz"},
+		{"One Piece", "epub", "{title} ({format}).{format}", "One Piece (epub).epub"},
+		{"One Piece", "", "", "One Piece"},
+	}
+	for _, tt := range tests {
+		if got := OutputFilename(tt.title, tt.format, tt.template); got != tt.want {
+			t.Errorf("OutputFilename(%q, %q, %q) = %q, want %q", tt.title, tt.format, tt.template, got, tt.want)
+		}
+	}
+}
+
+func TestPageEntryName(t *testing.T) {
+	tests := []struct {
+		index, total int
+		ext          string
+		want         string
+	}{
+		{0, 0, ".jpg", "0.jpg"},
+		{12, 0, ".jpg", "12.jpg"},
+		{0, 10, ".jpg", "0.jpg"},
+		{0, 11, "jpg", "00.jpg"},
+		{7, 100, ".webp", "07.webp"},
+		{99999, 100000, ".png", "99999.png"},
+		{3, 100000, ".png", "00003.png"},
+		{5, 10, "", "5"},
+	}
+	for _, tt := range tests {
+		if got := PageEntryName(tt.index, tt.total, tt.ext); got != tt.want {
+			t.Errorf("PageEntryName(%d, %d, %q) = %q, want %q", tt.index, tt.total, tt.ext, got, tt.want)
+		}
+	}
+}
+
+func TestPadPageName(t *testing.T) {
+	tests := []struct {
+		name  string
+		width int
+		want  string
+	}{
+		{"7.jpg", 4, "0007.jpg"},
+		{"0007.jpg", 4, "0007.jpg"},
+		{"12345.png", 4, "12345.png"},
+		{"7.jpg", 0, "7.jpg"},
+		{"cover.jpg", 4, "cover.jpg"},
+	}
+	for _, tt := range tests {
+		if got := PadPageName(tt.name, tt.width); got != tt.want {
+			t.Errorf("PadPageName(%q, %d) = %q, want %q", tt.name, tt.width, got, tt.want)
+		}
+	}
+}
+
+func TestCoverNameSortsFirst(t *testing.T) {
+	names := []string{PadPageName("10.jpg", MinPageWidth), PadPageName("2.jpg", MinPageWidth), CoverName + ".jpg", PadPageName("0.jpg", MinPageWidth)}
+	slices.Sort(names)
+	if got := strings.Join(names, ","); got != "!cover.jpg,0000.jpg,0002.jpg,0010.jpg" {
+		t.Errorf("unexpected order: %s", got)
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	tests := map[string]string{
+		"東大特訓班":           "東大特訓班",
+		" Re:Zero / 第二章 ": "Re_Zero _ 第二章",
+		"What?\n":         "What_",
+		"..hidden..":      "hidden",
+		`a\b*c"d<e>f|g`:   "a_b_c_d_e_f_g",
+	}
+	for in, want := range tests {
+		if got := Sanitize(in); got != want {
+			t.Errorf("Sanitize(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestFlatten(t *testing.T) {
+	tests := map[string]string{
+		"One Piece":           "One-Piece",
+		"Pokémon: Adventures": "Pokemon-Adventures",
+		"ＤＲ．ＳＴＯＮＥ 新石紀":        "comic-1128-DR-STONE",
+		"東大特訓班":               "comic-1128",
+		"東大特訓班2":              "comic-1128-2",
+		"  --  ":              "comic-1128",
+	}
+	for in, want := range tests {
+		if got := Flatten(in, "1128"); got != want {
+			t.Errorf("Flatten(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+// Package ocr recognizes the text of page images with Tesseract
+package ocr
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"os/exec"
+	"strings"
+
+	// Pages are often WebP, which Tesseract builds may not read; decoding
+	// them here lets every page be handed over as PNG
+	_ "github.com/gen2brain/webp"
+)
+
+// DefaultLang is the Tesseract language of manhuagui's traditional Chinese pages
+const DefaultLang = "chi_tra"
+
+// ErrNotInstalled is returned when the tesseract command cannot be found
+var ErrNotInstalled = errors.New("tesseract is not installed")
+
+// lookPath finds the tesseract command. Defined as a variable for tests.
+var lookPath = exec.LookPath
+
+// Tesseract runs the tesseract command on page images
+type Tesseract struct {
+	path string
+	lang string
+}
+
+// NewTesseract returns a recognizer for lang, or ErrNotInstalled when the
+// tesseract command is not on the PATH
+func NewTesseract(lang string) (*Tesseract, error) {
+	path, err := lookPath("tesseract")
+	if err != nil {
+		return nil, ErrNotInstalled
+	}
+	if lang == "" {
+		lang = DefaultLang
+	}
+	return &Tesseract{path: path, lang: lang}, nil
+}
+
+// Recognize returns the text found in the image data
+func (t *Tesseract) Recognize(data []byte) (string, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("decode image: %w", err)
+	}
+	var input bytes.Buffer
+	if err := png.Encode(&input, img); err != nil {
+		return "", err
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(t.path, "stdin", "stdout", "-l", t.lang)
+	cmd.Stdin = &input
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("tesseract: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
@@ -0,0 +1,53 @@
+package ocr
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewTesseractNotInstalled(t *testing.T) {
+	orig := lookPath
+	defer func() { lookPath = orig }()
+	lookPath = func(string) (string, error) { return "", errors.New("not found") }
+
+	if _, err := NewTesseract("eng"); !errors.Is(err, ErrNotInstalled) {
+		t.Errorf("expected ErrNotInstalled, got %v", err)
+	}
+}
+
+func TestRecognizeRunsTesseract(t *testing.T) {
+	// A stand-in tesseract that consumes the image and echoes the language
+	script := filepath.Join(t.TempDir(), "tesseract")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\ncat >/dev/null\necho \"text in $4\"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	orig := lookPath
+	defer func() { lookPath = orig }()
+	lookPath = func(string) (string, error) { return script, nil }
+
+	tess, err := NewTesseract("")
+	if err != nil {
+		t.Fatalf("NewTesseract failed: %v", err)
+	}
+	var page bytes.Buffer
+	png.Encode(&page, image.NewGray(image.Rect(0, 0, 4, 4)))
+	text, err := tess.Recognize(page.Bytes())
+	if err != nil {
+		t.Fatalf("Recognize failed: %v", err)
+	}
+	if text != "text in "+DefaultLang {
+		t.Errorf("unexpected text: %q", text)
+	}
+}
+
+func TestRecognizeRejectsNonImages(t *testing.T) {
+	tess := &Tesseract{path: "tesseract", lang: "eng"}
+	if _, err := tess.Recognize([]byte("not an image")); err == nil {
+		t.Errorf("expected an error for data that is not an image")
+	}
+}
@@ -0,0 +1,124 @@
+package site
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// ManhuaguiHost is the mirror of manhuagui used unless Manhuagui names another
+const ManhuaguiHost = "tw.manhuagui.com"
+
+var (
+	manhuaguiChapterPath = regexp.MustCompile(`^/comic/(\d+)/(\d+)\.html$`)
+	manhuaguiChapterLink = regexp.MustCompile(`/comic/\d+/(\d+)\.html`)
+	manhuaguiComicLink   = regexp.MustCompile(`/comic/(\d+)/`)
+)
+
+// Manhuagui is the adapter of manhuagui.com, reading from Host or
+// ManhuaguiHost when it is empty
+type Manhuagui struct {
+	Host string
+}
+
+var _ Mirrored = Manhuagui{}
+
+func (m Manhuagui) Name() string { return "manhuagui" }
+
+func (m Manhuagui) host() string {
+	if m.Host == "" {
+		return ManhuaguiHost
+	}
+	return m.Host
+}
+
+func (m Manhuagui) HostName() string { return m.host() }
+
+func (m Manhuagui) OnHost(host string) Adapter { return Manhuagui{Host: host} }
+
+func (m Manhuagui) ComicURL(comicID string) string {
+	return fmt.Sprintf("https://%s/comic/%s/", m.host(), comicID)
+}
+
+func (m Manhuagui) ChapterURL(comicID, chapterID string) string {
+	return fmt.Sprintf("https://%s/comic/%s/%s.html", m.host(), comicID, chapterID)
+}
+
+func (m Manhuagui) PageURL(comicID, chapterID, page string) string {
+	return fmt.Sprintf("%s#p=%s", m.ChapterURL(comicID, chapterID), page)
+}
+
+func (m Manhuagui) SearchURL(keyword string) string {
+	return fmt.Sprintf("https://%s/s/%s.html", m.host(), keyword)
+}
+
+// ParseChapterURL accepts reader URLs of every manhuagui mirror, such as
+// https://tw.manhuagui.com/comic/1128/566271.html
+func (m Manhuagui) ParseChapterURL(rawURL string) (comicID, chapterID string, err error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid chapter URL %q: %w", rawURL, err)
+	}
+	if u.Hostname() != "manhuagui.com" && !strings.HasSuffix(u.Hostname(), ".manhuagui.com") {
+		return "", "", fmt.Errorf("invalid chapter URL %q: not a manhuagui URL", rawURL)
+	}
+	match := manhuaguiChapterPath.FindStringSubmatch(u.Path)
+	if match == nil {
+		return "", "", fmt.Errorf("invalid chapter URL %q: expected /comic/<comic_id>/<chapter_id>.html", rawURL)
+	}
+	return match[1], match[2], nil
+}
+
+func (m Manhuagui) ComicID(link string) string {
+	if match := manhuaguiComicLink.FindStringSubmatch(link); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+func (m Manhuagui) ChapterID(link string) string {
+	if match := manhuaguiChapterLink.FindStringSubmatch(link); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+func (m Manhuagui) Referer() string {
+	return fmt.Sprintf("https://%s/", m.host())
+}
+
+// Blocked matches the Cloudflare challenge and error pages the site sits
+// behind and the CAPTCHAs they show
+func (m Manhuagui) Blocked() string {
+	return "#challenge-form, #challenge-running, #challenge-stage, .cf-browser-verification, #cf-error-details, iframe[src*='captcha']"
+}
+
+func (m Manhuagui) Info() InfoSelectors {
+	return InfoSelectors{
+		Ready:       ".book-title",
+		Title:       ".book-title h1",
+		Detail:      ".book-detail .detail-list",
+		Description: "#intro-all",
+		Cover:       ".book-cover img",
+		Chapters:    ".chapter-list li a",
+	}
+}
+
+func (m Manhuagui) Search() SearchSelectors {
+	return SearchSelectors{
+		Ready:   ".book-result",
+		Results: ".book-result .book-detail dt a",
+		Cover:   ".book-cover img",
+	}
+}
+
+func (m Manhuagui) Reader() ReaderSelectors {
+	return ReaderSelectors{
+		Ready: "#mangaBox",
+		Pages: "#pageSelect",
+		// The title bar's "(<span id="page">1</span>/45)"
+		PageCount: ".title > span",
+		Image:     "#mangaFile",
+	}
+}
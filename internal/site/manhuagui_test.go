@@ -0,0 +1,35 @@
+package site
+
+import "testing"
+
+func TestManhuaguiURLs(t *testing.T) {
+	m := Manhuagui{}
+	for got, want := range map[string]string{
+		m.ComicURL("1128"):                                    "https://tw.manhuagui.com/comic/1128/",
+		m.ChapterURL("1128", "566271"):                        "https://tw.manhuagui.com/comic/1128/566271.html",
+		m.PageURL("1128", "566271", "3"):                      "https://tw.manhuagui.com/comic/1128/566271.html#p=3",
+		m.SearchURL("東大"):                                     "https://tw.manhuagui.com/s/東大.html",
+		m.Referer():                                           "https://tw.manhuagui.com/",
+		Manhuagui{Host: "www.manhuagui.com"}.ComicURL("1128"): "https://www.manhuagui.com/comic/1128/",
+	} {
+		if got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+}
+
+func TestManhuaguiLinkIDs(t *testing.T) {
+	m := Manhuagui{}
+	if id := m.ComicID("/comic/1128/"); id != "1128" {
+		t.Errorf("expected comic 1128, got %q", id)
+	}
+	if id := m.ComicID("/list/japan/"); id != "" {
+		t.Errorf("expected no comic for a list link, got %q", id)
+	}
+	if id := m.ChapterID("/comic/1128/566271.html"); id != "566271" {
+		t.Errorf("expected chapter 566271, got %q", id)
+	}
+	if id := m.ChapterID("/comic/1128/"); id != "" {
+		t.Errorf("expected no chapter for a comic link, got %q", id)
+	}
+}
@@ -0,0 +1,87 @@
+// Package site describes the comic sites comicsd reads. An Adapter builds a
+// site's URLs and names the elements of its pages holding the comic
+// information, search results and page images, so the fetcher and downloader
+// work on any site that fits the same shape. Manhuagui is built in.
+package site
+
+// Adapter locates the pages of a comic site and the elements holding their data
+type Adapter interface {
+	// Name identifies the site, such as "manhuagui"
+	Name() string
+	// ComicURL is the page listing a comic's information and chapters
+	ComicURL(comicID string) string
+	// ChapterURL is the reader of a chapter
+	ChapterURL(comicID, chapterID string) string
+	// PageURL is the reader showing one page of a chapter
+	PageURL(comicID, chapterID, page string) string
+	// SearchURL is the page listing the comics matching keyword
+	SearchURL(keyword string) string
+	// ParseChapterURL extracts the comic and chapter IDs from a reader URL
+	// copied from the browser
+	ParseChapterURL(rawURL string) (comicID, chapterID string, err error)
+	// ComicID extracts the comic ID from a search result link, empty when
+	// the link is not a comic
+	ComicID(link string) string
+	// ChapterID extracts the chapter ID from a chapter link of the comic page
+	ChapterID(link string) string
+	// Referer is sent with requests for images outside the browser, which
+	// image hosts often require
+	Referer() string
+	// Blocked matches the elements of the anti-bot and CAPTCHA pages served
+	// in place of the requested page when the site blocks the browser
+	Blocked() string
+	// Info, Search and Reader are the elements of the comic, search and
+	// reader pages
+	Info() InfoSelectors
+	Search() SearchSelectors
+	Reader() ReaderSelectors
+}
+
+// Mirrored is implemented by adapters of sites served from several hosts
+type Mirrored interface {
+	Adapter
+	// HostName is the host the adapter reads from
+	HostName() string
+	// OnHost returns the same adapter reading from host
+	OnHost(host string) Adapter
+}
+
+// InfoSelectors are the CSS selectors of a comic page
+type InfoSelectors struct {
+	// Ready shows once the page has loaded
+	Ready string
+	Title string
+	// Detail holds the "label: value" lines of the author, status and year
+	Detail      string
+	Description string
+	// Cover is the cover <img>
+	Cover string
+	// Chapters are the chapter links, newest first
+	Chapters string
+}
+
+// SearchSelectors are the CSS selectors of a search result page
+type SearchSelectors struct {
+	// Ready shows once the results have loaded
+	Ready string
+	// Results are the links to the found comics, titled with their names
+	Results string
+	// Cover is the thumbnail <img> within a result's list item
+	Cover string
+}
+
+// ReaderSelectors are the CSS selectors of a chapter reader
+type ReaderSelectors struct {
+	// Ready shows once the reader has loaded
+	Ready string
+	// Pages is the <select> whose option values are the page IDs
+	Pages string
+	// PageCount shows the chapter's page count, such as "(1/45)", which
+	// completes a page select listing fewer pages; empty when there is none
+	PageCount string
+	// Image is the <img> of the current page
+	Image string
+}
+
+// Default is the site of new fetchers and downloads
+var Default Adapter = Manhuagui{}
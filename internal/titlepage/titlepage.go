@@ -0,0 +1,114 @@
+// Package titlepage renders the plain pages inserted before each chapter of
+// a multi-chapter archive, so readers see where a chapter starts.
+package titlepage
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"sync"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	// Width and Height are the size of a title page, a typical manga page ratio
+	Width  = 800
+	Height = 1200
+
+	headingSize  = 72
+	subtitleSize = 40
+)
+
+// The fonts are parsed on first use
+var (
+	loadOnce     sync.Once
+	loadErr      error
+	headingFont  *sfnt.Font
+	subtitleFont *sfnt.Font
+	headingFace  font.Face
+	subtitleFace font.Face
+	// drawMu serializes drawing: the faces cache glyphs and are not safe
+	// for concurrent use
+	drawMu sync.Mutex
+)
+
+// load parses the embedded Go fonts once
+func load() error {
+	loadOnce.Do(func() {
+		if headingFont, loadErr = opentype.Parse(gobold.TTF); loadErr != nil {
+			return
+		}
+		if subtitleFont, loadErr = opentype.Parse(goregular.TTF); loadErr != nil {
+			return
+		}
+		if headingFace, loadErr = opentype.NewFace(headingFont, &opentype.FaceOptions{Size: headingSize, DPI: 72, Hinting: font.HintingFull}); loadErr != nil {
+			return
+		}
+		subtitleFace, loadErr = opentype.NewFace(subtitleFont, &opentype.FaceOptions{Size: subtitleSize, DPI: 72, Hinting: font.HintingFull})
+	})
+	return loadErr
+}
+
+// Renderable reports whether the title page font has a glyph for every
+// character of s. The Go fonts cover Latin, Greek and Cyrillic but not
+// Chinese or Japanese.
+func Renderable(s string) bool {
+	if load() != nil {
+		return false
+	}
+	var buf sfnt.Buffer
+	for _, r := range s {
+		if r == ' ' {
+			continue
+		}
+		if i, err := subtitleFont.GlyphIndex(&buf, r); err != nil || i == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Render draws heading, and subtitle below it when not empty, centered in
+// black on a white page and returns it as a JPEG. Characters the font lacks
+// are left out; check the text with Renderable first.
+func Render(heading, subtitle string) ([]byte, error) {
+	if err := load(); err != nil {
+		return nil, err
+	}
+
+	img := image.NewGray(image.Rect(0, 0, Width, Height))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+
+	y := Height / 2
+	if subtitle != "" {
+		y -= subtitleSize
+	}
+	drawMu.Lock()
+	drawCentered(img, headingFace, heading, y)
+	if subtitle != "" {
+		drawCentered(img, subtitleFace, subtitle, y+2*subtitleSize)
+	}
+	drawMu.Unlock()
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// drawCentered draws s horizontally centered with its baseline at y
+func drawCentered(img draw.Image, face font.Face, s string, y int) {
+	d := &font.Drawer{Dst: img, Src: image.NewUniform(color.Black), Face: face}
+	width := d.MeasureString(s).Ceil()
+	d.Dot = fixed.P((Width-width)/2, y)
+	d.DrawString(s)
+}
@@ -0,0 +1,77 @@
+package titlepage
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"sync"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	data, err := Render("Chapter 10", "Dr. Stone")
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("title page is not a JPEG: %v", err)
+	}
+	if img.Bounds() != image.Rect(0, 0, Width, Height) {
+		t.Errorf("unexpected size %v", img.Bounds())
+	}
+
+	// The text is drawn around the middle, the margins stay white
+	if dark := darkPixels(img, image.Rect(0, Height/3, Width, 2*Height/3)); dark == 0 {
+		t.Error("expected text in the middle of the page")
+	}
+	if dark := darkPixels(img, image.Rect(0, 0, Width, Height/4)); dark != 0 {
+		t.Errorf("expected a blank top margin, found %d dark pixels", dark)
+	}
+}
+
+func TestRenderConcurrently(t *testing.T) {
+	want, err := Render("Chapter 10", "Dr. Stone")
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	// Chapter workers render their title pages at once
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got, err := Render("Chapter 10", "Dr. Stone"); err != nil || !bytes.Equal(got, want) {
+				t.Errorf("concurrent Render differs (%v)", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func darkPixels(img image.Image, r image.Rectangle) int {
+	dark := 0
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if g, _, _, _ := img.At(x, y).RGBA(); g < 0x4000 {
+				dark++
+			}
+		}
+	}
+	return dark
+}
+
+func TestRenderable(t *testing.T) {
+	tests := map[string]bool{
+		"Chapter 10":    true,
+		"Dr. Stone 新石紀": false,
+		"第10話":          false,
+		"Pokémon":       true,
+		"":              true,
+	}
+	for s, want := range tests {
+		if got := Renderable(s); got != want {
+			t.Errorf("Renderable(%q) = %v, want %v", s, got, want)
+		}
+	}
+}